@@ -8,34 +8,66 @@ import (
 	"time"
 
 	"github.com/devldavydov/promytheus/internal/agent"
+	"github.com/devldavydov/promytheus/internal/agent/publisher"
 	"github.com/devldavydov/promytheus/internal/common/env"
 )
 
 const (
-	_defaultConfigAddress          = "127.0.0.1:8080"
-	_defaultConfigReportInterval   = 10 * time.Second
-	_defaultConfigPollInterval     = 2 * time.Second
-	_defaultConfigLogLevel         = "DEBUG"
-	_defaultConfigLogFile          = "agent.log"
-	_defaultConfigHmacKey          = ""
-	_defaultConfigRateLimit        = 2
-	_defaultConfigCryptoPubKeyPath = ""
-	_defaultConfigFilePath         = ""
-	_defaultConfigUseGRPC          = false
-	_defaultConfigGRPCCACertPath   = ""
+	_defaultConfigAddress               = "127.0.0.1:8080"
+	_defaultConfigServerMode            = agent.ServerModeFailover
+	_defaultConfigReportInterval        = 10 * time.Second
+	_defaultConfigPollInterval          = 2 * time.Second
+	_defaultConfigLogLevel              = "DEBUG"
+	_defaultConfigLogFile               = "agent.log"
+	_defaultConfigHmacKey               = ""
+	_defaultConfigHmacKeyID             = ""
+	_defaultConfigAPIKey                = ""
+	_defaultConfigRateLimit             = 2
+	_defaultConfigCryptoPubKeyPath      = ""
+	_defaultConfigCryptoKeyID           = ""
+	_defaultConfigFilePath              = ""
+	_defaultConfigUseGRPC               = false
+	_defaultConfigGRPCCACertPath        = ""
+	_defaultConfigGRPCCertPath          = ""
+	_defaultConfigGRPCKeyPath           = ""
+	_defaultConfigTLSCACertPath         = ""
+	_defaultConfigTLSCertPath           = ""
+	_defaultConfigTLSKeyPath            = ""
+	_defaultConfigSpoolDir              = ""
+	_defaultConfigSpoolMaxSize          = 64 << 20
+	_defaultConfigSpoolMaxAge           = 24 * time.Hour
+	_defaultConfigRetryInitialBackoff   = publisher.DefaultRetryInitialBackoff
+	_defaultConfigRetryMaxBackoff       = publisher.DefaultRetryMaxBackoff
+	_defaultConfigRetryFailureThreshold = publisher.DefaultRetryFailureThreshold
 )
 
 type Config struct {
-	Address          string
-	HmacKey          string
-	LogLevel         string
-	LogFile          string
-	CryptoPubKeyPath string
-	ReportInterval   time.Duration
-	PollInterval     time.Duration
-	RateLimit        int
-	UseGRPC          bool
-	GRPCCACertPath   string
+	Address               string
+	ServerMode            string
+	HmacKey               string
+	HmacKeyID             string
+	APIKey                string
+	LogLevel              string
+	LogFile               string
+	CryptoPubKeyPath      string
+	CryptoKeyID           string
+	ReportInterval        time.Duration
+	PollInterval          time.Duration
+	RateLimit             int
+	UseGRPC               bool
+	GRPCCACertPath        string
+	GRPCCertPath          string
+	GRPCKeyPath           string
+	TLSCACertPath         string
+	TLSCertPath           string
+	TLSKeyPath            string
+	SpoolDir              string
+	SpoolMaxSize          int
+	SpoolMaxAge           time.Duration
+	RetryInitialBackoff   time.Duration
+	RetryMaxBackoff       time.Duration
+	RetryFailureThreshold int
+	Collectors            map[string]agent.CollectorConfig
 }
 
 func LoadConfig(flagSet flag.FlagSet, flags []string) (*Config, error) {
@@ -43,14 +75,29 @@ func LoadConfig(flagSet flag.FlagSet, flags []string) (*Config, error) {
 	var configFilePath string
 	config := &Config{}
 
-	flagSet.StringVar(&config.Address, "a", _defaultConfigAddress, "server address")
+	flagSet.StringVar(&config.Address, "a", _defaultConfigAddress, "server addresses, comma separated")
+	flagSet.StringVar(&config.ServerMode, "server-mode", _defaultConfigServerMode, "mode of publishing to servers: failover or replicate")
 	flagSet.DurationVar(&config.ReportInterval, "r", _defaultConfigReportInterval, "report interval")
 	flagSet.DurationVar(&config.PollInterval, "p", _defaultConfigPollInterval, "poll interval")
 	flagSet.StringVar(&config.HmacKey, "k", _defaultConfigHmacKey, "sign key")
+	flagSet.StringVar(&config.HmacKeyID, "hmac-key-id", _defaultConfigHmacKeyID, "sign key ID")
+	flagSet.StringVar(&config.APIKey, "api-key", _defaultConfigAPIKey, "API key")
 	flagSet.IntVar(&config.RateLimit, "l", _defaultConfigRateLimit, "rate limit")
 	flagSet.StringVar(&config.CryptoPubKeyPath, "crypto-key", _defaultConfigCryptoPubKeyPath, "crypto public key path")
+	flagSet.StringVar(&config.CryptoKeyID, "crypto-key-id", _defaultConfigCryptoKeyID, "crypto public key ID")
 	flagSet.BoolVar(&config.UseGRPC, "g", _defaultConfigUseGRPC, "use gRPC insted of HTTP")
 	flagSet.StringVar(&config.GRPCCACertPath, "gca", _defaultConfigGRPCCACertPath, "gRPC TLS CA certificate path")
+	flagSet.StringVar(&config.GRPCCertPath, "gcert", _defaultConfigGRPCCertPath, "gRPC client certificate path")
+	flagSet.StringVar(&config.GRPCKeyPath, "gkey", _defaultConfigGRPCKeyPath, "gRPC client certificate key path")
+	flagSet.StringVar(&config.TLSCACertPath, "tls-ca", _defaultConfigTLSCACertPath, "HTTPS server CA certificate path")
+	flagSet.StringVar(&config.TLSCertPath, "tls-cert", _defaultConfigTLSCertPath, "HTTPS client certificate path")
+	flagSet.StringVar(&config.TLSKeyPath, "tls-key", _defaultConfigTLSKeyPath, "HTTPS client certificate key path")
+	flagSet.StringVar(&config.SpoolDir, "spool-dir", _defaultConfigSpoolDir, "directory of spool for metrics, which failed to publish")
+	flagSet.IntVar(&config.SpoolMaxSize, "spool-max-size", _defaultConfigSpoolMaxSize, "spool max size in bytes")
+	flagSet.DurationVar(&config.SpoolMaxAge, "spool-max-age", _defaultConfigSpoolMaxAge, "spool max age of metrics, 0 for no limit")
+	flagSet.DurationVar(&config.RetryInitialBackoff, "retry-initial-backoff", _defaultConfigRetryInitialBackoff, "backoff after first publish failure")
+	flagSet.DurationVar(&config.RetryMaxBackoff, "retry-max-backoff", _defaultConfigRetryMaxBackoff, "max backoff after publish failures")
+	flagSet.IntVar(&config.RetryFailureThreshold, "retry-failure-threshold", _defaultConfigRetryFailureThreshold, "count of publish failures to open circuit breaker")
 	//
 	flagSet.StringVar(&configFilePath, "c", _defaultConfigFilePath, "config file path")
 	flagSet.StringVar(&configFilePath, "config", _defaultConfigFilePath, "config file path")
@@ -69,6 +116,11 @@ func LoadConfig(flagSet flag.FlagSet, flags []string) (*Config, error) {
 		return nil, err
 	}
 
+	config.ServerMode, err = env.GetVariable("SERVER_MODE", env.CastString, config.ServerMode)
+	if err != nil {
+		return nil, err
+	}
+
 	config.ReportInterval, err = env.GetVariable("REPORT_INTERVAL", env.CastDuration, config.ReportInterval)
 	if err != nil {
 		return nil, err
@@ -84,6 +136,16 @@ func LoadConfig(flagSet flag.FlagSet, flags []string) (*Config, error) {
 		return nil, err
 	}
 
+	config.HmacKeyID, err = env.GetVariable("HMAC_KEY_ID", env.CastString, config.HmacKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	config.APIKey, err = env.GetVariable("API_KEY", env.CastString, config.APIKey)
+	if err != nil {
+		return nil, err
+	}
+
 	config.RateLimit, err = env.GetVariable("RATE_LIMIT", env.CastInt, config.RateLimit)
 	if err != nil {
 		return nil, err
@@ -94,6 +156,11 @@ func LoadConfig(flagSet flag.FlagSet, flags []string) (*Config, error) {
 		return nil, err
 	}
 
+	config.CryptoKeyID, err = env.GetVariable("CRYPTO_KEY_ID", env.CastString, config.CryptoKeyID)
+	if err != nil {
+		return nil, err
+	}
+
 	config.UseGRPC, err = env.GetVariable("USE_GRPC", env.CastBool, config.UseGRPC)
 	if err != nil {
 		return nil, err
@@ -104,6 +171,61 @@ func LoadConfig(flagSet flag.FlagSet, flags []string) (*Config, error) {
 		return nil, err
 	}
 
+	config.GRPCCertPath, err = env.GetVariable("GRPC_CLIENT_CERT", env.CastString, config.GRPCCertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config.GRPCKeyPath, err = env.GetVariable("GRPC_CLIENT_KEY", env.CastString, config.GRPCKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config.TLSCACertPath, err = env.GetVariable("TLS_CA_CERT", env.CastString, config.TLSCACertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config.TLSCertPath, err = env.GetVariable("TLS_CLIENT_CERT", env.CastString, config.TLSCertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config.TLSKeyPath, err = env.GetVariable("TLS_CLIENT_KEY", env.CastString, config.TLSKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config.SpoolDir, err = env.GetVariable("SPOOL_DIR", env.CastString, config.SpoolDir)
+	if err != nil {
+		return nil, err
+	}
+
+	config.SpoolMaxSize, err = env.GetVariable("SPOOL_MAX_SIZE", env.CastInt, config.SpoolMaxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	config.SpoolMaxAge, err = env.GetVariable("SPOOL_MAX_AGE", env.CastDuration, config.SpoolMaxAge)
+	if err != nil {
+		return nil, err
+	}
+
+	config.RetryInitialBackoff, err = env.GetVariable("RETRY_INITIAL_BACKOFF", env.CastDuration, config.RetryInitialBackoff)
+	if err != nil {
+		return nil, err
+	}
+
+	config.RetryMaxBackoff, err = env.GetVariable("RETRY_MAX_BACKOFF", env.CastDuration, config.RetryMaxBackoff)
+	if err != nil {
+		return nil, err
+	}
+
+	config.RetryFailureThreshold, err = env.GetVariable("RETRY_FAILURE_THRESHOLD", env.CastInt, config.RetryFailureThreshold)
+	if err != nil {
+		return nil, err
+	}
+
 	config.LogLevel, err = env.GetVariable("LOG_LEVEL", env.CastString, _defaultConfigLogLevel)
 	if err != nil {
 		return nil, err
@@ -130,13 +252,29 @@ func LoadConfig(flagSet flag.FlagSet, flags []string) (*Config, error) {
 func AgentSettingsAdapt(config *Config) (agent.ServiceSettings, error) {
 	agentSettings, err := agent.NewServiceSettings(
 		config.Address,
+		config.ServerMode,
 		config.PollInterval,
 		config.ReportInterval,
 		config.HmacKey,
+		config.HmacKeyID,
+		config.APIKey,
 		config.RateLimit,
 		config.CryptoPubKeyPath,
+		config.CryptoKeyID,
 		config.UseGRPC,
-		config.GRPCCACertPath)
+		config.GRPCCACertPath,
+		config.GRPCCertPath,
+		config.GRPCKeyPath,
+		config.TLSCACertPath,
+		config.TLSCertPath,
+		config.TLSKeyPath,
+		config.SpoolDir,
+		int64(config.SpoolMaxSize),
+		config.SpoolMaxAge,
+		config.RetryInitialBackoff,
+		config.RetryMaxBackoff,
+		config.RetryFailureThreshold,
+		config.Collectors)
 	if err != nil {
 		return agent.ServiceSettings{}, err
 	}
@@ -144,14 +282,37 @@ func AgentSettingsAdapt(config *Config) (agent.ServiceSettings, error) {
 }
 
 type configFile struct {
-	Address          *string        `json:"address"`
-	ReportInterval   *time.Duration `json:"report_interval"`
-	PollInterval     *time.Duration `json:"poll_interval"`
-	HmacKey          *string        `json:"hmac_key"`
-	RateLimit        *int           `json:"rate_limit"`
-	CryptoPubKeyPath *string        `json:"crypto_key"`
-	UseGRPC          *bool          `json:"use_grpc"`
-	GRPCCACertPath   *string        `json:"grpc_ca_cert"`
+	Address               *string                        `json:"address"`
+	ServerMode            *string                        `json:"server_mode"`
+	ReportInterval        *time.Duration                 `json:"report_interval"`
+	PollInterval          *time.Duration                 `json:"poll_interval"`
+	HmacKey               *string                        `json:"hmac_key"`
+	HmacKeyID             *string                        `json:"hmac_key_id"`
+	APIKey                *string                        `json:"api_key"`
+	RateLimit             *int                           `json:"rate_limit"`
+	CryptoPubKeyPath      *string                        `json:"crypto_key"`
+	CryptoKeyID           *string                        `json:"crypto_key_id"`
+	UseGRPC               *bool                          `json:"use_grpc"`
+	GRPCCACertPath        *string                        `json:"grpc_ca_cert"`
+	GRPCCertPath          *string                        `json:"grpc_client_cert"`
+	GRPCKeyPath           *string                        `json:"grpc_client_key"`
+	TLSCACertPath         *string                        `json:"tls_ca_cert"`
+	TLSCertPath           *string                        `json:"tls_client_cert"`
+	TLSKeyPath            *string                        `json:"tls_client_key"`
+	SpoolDir              *string                        `json:"spool_dir"`
+	SpoolMaxSize          *int                           `json:"spool_max_size"`
+	SpoolMaxAge           *time.Duration                 `json:"spool_max_age"`
+	RetryInitialBackoff   *time.Duration                 `json:"retry_initial_backoff"`
+	RetryMaxBackoff       *time.Duration                 `json:"retry_max_backoff"`
+	RetryFailureThreshold *int                           `json:"retry_failure_threshold"`
+	Collectors            map[string]collectorConfigFile `json:"collectors"`
+}
+
+type collectorConfigFile struct {
+	Enabled      *bool           `json:"enabled"`
+	PollInterval *time.Duration  `json:"poll_interval"`
+	Prefix       *string         `json:"prefix"`
+	Options      json.RawMessage `json:"options"`
 }
 
 func applyConfigFile(config *Config, configFilePath string) error {
@@ -173,6 +334,9 @@ func applyConfigFile(config *Config, configFilePath string) error {
 	if configFromFile.Address != nil && config.Address == _defaultConfigAddress {
 		config.Address = *configFromFile.Address
 	}
+	if configFromFile.ServerMode != nil && config.ServerMode == _defaultConfigServerMode {
+		config.ServerMode = *configFromFile.ServerMode
+	}
 	if configFromFile.ReportInterval != nil && config.ReportInterval == _defaultConfigReportInterval {
 		config.ReportInterval = *configFromFile.ReportInterval
 	}
@@ -182,18 +346,79 @@ func applyConfigFile(config *Config, configFilePath string) error {
 	if configFromFile.HmacKey != nil && config.HmacKey == _defaultConfigHmacKey {
 		config.HmacKey = *configFromFile.HmacKey
 	}
+	if configFromFile.HmacKeyID != nil && config.HmacKeyID == _defaultConfigHmacKeyID {
+		config.HmacKeyID = *configFromFile.HmacKeyID
+	}
+	if configFromFile.APIKey != nil && config.APIKey == _defaultConfigAPIKey {
+		config.APIKey = *configFromFile.APIKey
+	}
 	if configFromFile.RateLimit != nil && config.RateLimit == _defaultConfigRateLimit {
 		config.RateLimit = *configFromFile.RateLimit
 	}
 	if configFromFile.CryptoPubKeyPath != nil && config.CryptoPubKeyPath == _defaultConfigCryptoPubKeyPath {
 		config.CryptoPubKeyPath = *configFromFile.CryptoPubKeyPath
 	}
+	if configFromFile.CryptoKeyID != nil && config.CryptoKeyID == _defaultConfigCryptoKeyID {
+		config.CryptoKeyID = *configFromFile.CryptoKeyID
+	}
 	if configFromFile.UseGRPC != nil && !config.UseGRPC {
 		config.UseGRPC = *configFromFile.UseGRPC
 	}
 	if configFromFile.GRPCCACertPath != nil && config.GRPCCACertPath == _defaultConfigGRPCCACertPath {
 		config.GRPCCACertPath = *configFromFile.GRPCCACertPath
 	}
+	if configFromFile.GRPCCertPath != nil && config.GRPCCertPath == _defaultConfigGRPCCertPath {
+		config.GRPCCertPath = *configFromFile.GRPCCertPath
+	}
+	if configFromFile.GRPCKeyPath != nil && config.GRPCKeyPath == _defaultConfigGRPCKeyPath {
+		config.GRPCKeyPath = *configFromFile.GRPCKeyPath
+	}
+	if configFromFile.TLSCACertPath != nil && config.TLSCACertPath == _defaultConfigTLSCACertPath {
+		config.TLSCACertPath = *configFromFile.TLSCACertPath
+	}
+	if configFromFile.TLSCertPath != nil && config.TLSCertPath == _defaultConfigTLSCertPath {
+		config.TLSCertPath = *configFromFile.TLSCertPath
+	}
+	if configFromFile.TLSKeyPath != nil && config.TLSKeyPath == _defaultConfigTLSKeyPath {
+		config.TLSKeyPath = *configFromFile.TLSKeyPath
+	}
+	if configFromFile.SpoolDir != nil && config.SpoolDir == _defaultConfigSpoolDir {
+		config.SpoolDir = *configFromFile.SpoolDir
+	}
+	if configFromFile.SpoolMaxSize != nil && config.SpoolMaxSize == _defaultConfigSpoolMaxSize {
+		config.SpoolMaxSize = *configFromFile.SpoolMaxSize
+	}
+	if configFromFile.SpoolMaxAge != nil && config.SpoolMaxAge == _defaultConfigSpoolMaxAge {
+		config.SpoolMaxAge = *configFromFile.SpoolMaxAge
+	}
+	if configFromFile.RetryInitialBackoff != nil && config.RetryInitialBackoff == _defaultConfigRetryInitialBackoff {
+		config.RetryInitialBackoff = *configFromFile.RetryInitialBackoff
+	}
+	if configFromFile.RetryMaxBackoff != nil && config.RetryMaxBackoff == _defaultConfigRetryMaxBackoff {
+		config.RetryMaxBackoff = *configFromFile.RetryMaxBackoff
+	}
+	if configFromFile.RetryFailureThreshold != nil && config.RetryFailureThreshold == _defaultConfigRetryFailureThreshold {
+		config.RetryFailureThreshold = *configFromFile.RetryFailureThreshold
+	}
+	if configFromFile.Collectors != nil {
+		config.Collectors = make(map[string]agent.CollectorConfig, len(configFromFile.Collectors))
+		for name, clctrCfg := range configFromFile.Collectors {
+			cfg := agent.CollectorConfig{}
+			if string(clctrCfg.Options) != "null" {
+				cfg.Options = clctrCfg.Options
+			}
+			if clctrCfg.Enabled != nil {
+				cfg.Disabled = !*clctrCfg.Enabled
+			}
+			if clctrCfg.PollInterval != nil {
+				cfg.PollInterval = *clctrCfg.PollInterval
+			}
+			if clctrCfg.Prefix != nil {
+				cfg.Prefix = *clctrCfg.Prefix
+			}
+			config.Collectors[name] = cfg
+		}
+	}
 
 	return nil
 }
@@ -8,7 +8,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/devldavydov/promytheus/internal/agent"
+	"github.com/devldavydov/promytheus/internal/agent/collector"
+	"github.com/devldavydov/promytheus/internal/agent/publisher"
 	"github.com/devldavydov/promytheus/internal/common/nettools"
+	"github.com/devldavydov/promytheus/internal/common/tlsconfig"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -24,23 +28,50 @@ func TestAgentSettingsAdaptDefault(t *testing.T) {
 	expAddr, _ := nettools.NewAddress("127.0.0.1:8080")
 	assert.Equal(t, 10*time.Second, agentSettings.ReportInterval)
 	assert.Equal(t, 2*time.Second, agentSettings.PollInterval)
-	assert.Equal(t, expAddr, agentSettings.ServerAddress)
+	assert.Equal(t, []nettools.Address{expAddr}, agentSettings.ServerAddresses)
+	assert.Equal(t, agent.ServerModeFailover, agentSettings.ServerMode)
 	assert.Nil(t, agentSettings.HmacKey)
 	assert.Nil(t, agentSettings.CryptoPubKeyPath)
+	assert.Nil(t, agentSettings.CryptoKeyID)
+	assert.Nil(t, agentSettings.HmacKeyID)
+	assert.Nil(t, agentSettings.APIKey)
 	assert.Equal(t, 2, agentSettings.RateLimit)
 	assert.False(t, agentSettings.UseGRPC)
 	assert.Nil(t, agentSettings.GRPCCACertPath)
+	assert.Nil(t, agentSettings.HTTPClientTLS)
+	assert.Nil(t, agentSettings.SpoolDir)
+	assert.Equal(t, publisher.RetrySettings{
+		InitialBackoff: time.Second, MaxBackoff: time.Minute, FailureThreshold: 5,
+	}, agentSettings.RetrySettings)
+	assert.Equal(t, collector.Settings{Enabled: true, PollInterval: 2 * time.Second}, agentSettings.Collectors["runtime"])
+	assert.Equal(t, collector.Settings{Enabled: true, PollInterval: 2 * time.Second}, agentSettings.Collectors["psutil"])
+	assert.Equal(t, collector.Settings{Enabled: false, PollInterval: 2 * time.Second}, agentSettings.Collectors["disk"])
 }
 
 func TestAgentSettingsAdaptCustomEnv(t *testing.T) {
-	t.Setenv("ADDRESS", "1.1.1.1:9999")
+	t.Setenv("ADDRESS", "1.1.1.1:9999, 2.2.2.2:9999")
+	t.Setenv("SERVER_MODE", "replicate")
 	t.Setenv("REPORT_INTERVAL", "1s")
 	t.Setenv("POLL_INTERVAL", "2s")
 	t.Setenv("KEY", "123")
 	t.Setenv("RATE_LIMIT", "10")
 	t.Setenv("CRYPTO_KEY", "/home/.ssh/id_rsa.pub")
+	t.Setenv("CRYPTO_KEY_ID", "key1")
+	t.Setenv("HMAC_KEY_ID", "team1")
+	t.Setenv("API_KEY", "key1")
 	t.Setenv("USE_GRPC", "true")
 	t.Setenv("GRPC_CA_CERT", "/home/ca.pem")
+	t.Setenv("GRPC_CLIENT_CERT", "/home/grpc-client.pem")
+	t.Setenv("GRPC_CLIENT_KEY", "/home/grpc-client.key")
+	t.Setenv("TLS_CA_CERT", "/home/http-ca.pem")
+	t.Setenv("TLS_CLIENT_CERT", "/home/client.pem")
+	t.Setenv("TLS_CLIENT_KEY", "/home/client.key")
+	t.Setenv("SPOOL_DIR", "/var/spool/agent")
+	t.Setenv("SPOOL_MAX_SIZE", "1024")
+	t.Setenv("SPOOL_MAX_AGE", "1h")
+	t.Setenv("RETRY_INITIAL_BACKOFF", "2s")
+	t.Setenv("RETRY_MAX_BACKOFF", "30s")
+	t.Setenv("RETRY_FAILURE_THRESHOLD", "3")
 
 	testFlagSet := flag.NewFlagSet("test", flag.ExitOnError)
 	config, err := LoadConfig(*testFlagSet, []string{})
@@ -49,15 +80,31 @@ func TestAgentSettingsAdaptCustomEnv(t *testing.T) {
 	agentSettings, err := AgentSettingsAdapt(config)
 	assert.NoError(t, err)
 
-	expAddr, _ := nettools.NewAddress("1.1.1.1:9999")
+	expAddr1, _ := nettools.NewAddress("1.1.1.1:9999")
+	expAddr2, _ := nettools.NewAddress("2.2.2.2:9999")
 	assert.Equal(t, 1*time.Second, agentSettings.ReportInterval)
 	assert.Equal(t, 2*time.Second, agentSettings.PollInterval)
-	assert.Equal(t, expAddr, agentSettings.ServerAddress)
+	assert.Equal(t, []nettools.Address{expAddr1, expAddr2}, agentSettings.ServerAddresses)
+	assert.Equal(t, agent.ServerModeReplicate, agentSettings.ServerMode)
 	assert.Equal(t, "123", *agentSettings.HmacKey)
 	assert.Equal(t, "/home/.ssh/id_rsa.pub", *agentSettings.CryptoPubKeyPath)
+	assert.Equal(t, "key1", *agentSettings.CryptoKeyID)
+	assert.Equal(t, "team1", *agentSettings.HmacKeyID)
+	assert.Equal(t, "key1", *agentSettings.APIKey)
 	assert.Equal(t, 10, agentSettings.RateLimit)
 	assert.True(t, agentSettings.UseGRPC)
 	assert.Equal(t, "/home/ca.pem", *agentSettings.GRPCCACertPath)
+	assert.Equal(t, "/home/grpc-client.pem", *agentSettings.GRPCCertPath)
+	assert.Equal(t, "/home/grpc-client.key", *agentSettings.GRPCKeyPath)
+	assert.Equal(t, tlsconfig.ClientSettings{
+		CACertPath: "/home/http-ca.pem", CertPath: "/home/client.pem", KeyPath: "/home/client.key",
+	}, *agentSettings.HTTPClientTLS)
+	assert.Equal(t, "/var/spool/agent", *agentSettings.SpoolDir)
+	assert.Equal(t, int64(1024), agentSettings.SpoolMaxSize)
+	assert.Equal(t, time.Hour, agentSettings.SpoolMaxAge)
+	assert.Equal(t, publisher.RetrySettings{
+		InitialBackoff: 2 * time.Second, MaxBackoff: 30 * time.Second, FailureThreshold: 3,
+	}, agentSettings.RetrySettings)
 }
 
 func TestAgentSettingsAdaptCustomFlag(t *testing.T) {
@@ -65,8 +112,11 @@ func TestAgentSettingsAdaptCustomFlag(t *testing.T) {
 	config, err := LoadConfig(
 		*testFlagSet,
 		[]string{
-			"-a", "8.8.8.8:8888", "-r", "11s", "-p", "3s", "-k", "123", "-l", "5", "-crypto-key", "./key.pub", "-g",
-			"-gca", "/home/ca.pem",
+			"-a", "8.8.8.8:8888,9.9.9.9:8888", "-server-mode", "replicate", "-r", "11s", "-p", "3s", "-k", "123", "-l", "5", "-crypto-key", "./key.pub", "-g",
+			"-gca", "/home/ca.pem", "-crypto-key-id", "key2", "-hmac-key-id", "team2", "-api-key", "key2", "-tls-ca", "/home/http-ca.pem",
+			"-gcert", "/home/grpc-client.pem", "-gkey", "/home/grpc-client.key",
+			"-spool-dir", "/tmp/spool", "-spool-max-size", "2048", "-spool-max-age", "0s",
+			"-retry-initial-backoff", "100ms", "-retry-max-backoff", "10s", "-retry-failure-threshold", "2",
 		},
 	)
 	assert.NoError(t, err)
@@ -74,15 +124,29 @@ func TestAgentSettingsAdaptCustomFlag(t *testing.T) {
 	agentSettings, err := AgentSettingsAdapt(config)
 	assert.NoError(t, err)
 
-	expAddr, _ := nettools.NewAddress("8.8.8.8:8888")
+	expAddr1, _ := nettools.NewAddress("8.8.8.8:8888")
+	expAddr2, _ := nettools.NewAddress("9.9.9.9:8888")
 	assert.Equal(t, 11*time.Second, agentSettings.ReportInterval)
 	assert.Equal(t, 3*time.Second, agentSettings.PollInterval)
-	assert.Equal(t, expAddr, agentSettings.ServerAddress)
+	assert.Equal(t, []nettools.Address{expAddr1, expAddr2}, agentSettings.ServerAddresses)
+	assert.Equal(t, agent.ServerModeReplicate, agentSettings.ServerMode)
 	assert.Equal(t, "123", *agentSettings.HmacKey)
 	assert.Equal(t, "./key.pub", *agentSettings.CryptoPubKeyPath)
+	assert.Equal(t, "key2", *agentSettings.CryptoKeyID)
+	assert.Equal(t, "team2", *agentSettings.HmacKeyID)
+	assert.Equal(t, "key2", *agentSettings.APIKey)
 	assert.Equal(t, 5, agentSettings.RateLimit)
 	assert.True(t, agentSettings.UseGRPC)
 	assert.Equal(t, "/home/ca.pem", *agentSettings.GRPCCACertPath)
+	assert.Equal(t, "/home/grpc-client.pem", *agentSettings.GRPCCertPath)
+	assert.Equal(t, "/home/grpc-client.key", *agentSettings.GRPCKeyPath)
+	assert.Equal(t, tlsconfig.ClientSettings{CACertPath: "/home/http-ca.pem"}, *agentSettings.HTTPClientTLS)
+	assert.Equal(t, "/tmp/spool", *agentSettings.SpoolDir)
+	assert.Equal(t, int64(2048), agentSettings.SpoolMaxSize)
+	assert.Equal(t, time.Duration(0), agentSettings.SpoolMaxAge)
+	assert.Equal(t, publisher.RetrySettings{
+		InitialBackoff: 100 * time.Millisecond, MaxBackoff: 10 * time.Second, FailureThreshold: 2,
+	}, agentSettings.RetrySettings)
 }
 
 func TestAgentSettingsAdaptCustomEnvAndFlag(t *testing.T) {
@@ -92,6 +156,9 @@ func TestAgentSettingsAdaptCustomEnvAndFlag(t *testing.T) {
 	t.Setenv("KEY", "123")
 	t.Setenv("RATE_LIMIT", "15")
 	t.Setenv("CRYPTO_KEY", "/home/.ssh/id_rsa.pub")
+	t.Setenv("CRYPTO_KEY_ID", "key1")
+	t.Setenv("HMAC_KEY_ID", "team1")
+	t.Setenv("API_KEY", "key1")
 	t.Setenv("USE_GRPC", "false")
 	t.Setenv("GRPC_CA_CERT", "/home/ca.pem")
 
@@ -100,7 +167,7 @@ func TestAgentSettingsAdaptCustomEnvAndFlag(t *testing.T) {
 		*testFlagSet,
 		[]string{
 			"-a", "8.8.8.8:8888", "-r", "11s", "-p", "3s", "-k", "456", "-l", "1", "-crypto-key", "./key.pub", "-g",
-			"-gca", "/home/ca2.pem",
+			"-gca", "/home/ca2.pem", "-crypto-key-id", "key2", "-hmac-key-id", "team2", "-api-key", "key2",
 		},
 	)
 	assert.NoError(t, err)
@@ -111,9 +178,12 @@ func TestAgentSettingsAdaptCustomEnvAndFlag(t *testing.T) {
 	expAddr, _ := nettools.NewAddress("1.1.1.1:9999")
 	assert.Equal(t, 2*time.Second, agentSettings.ReportInterval)
 	assert.Equal(t, 4*time.Second, agentSettings.PollInterval)
-	assert.Equal(t, expAddr, agentSettings.ServerAddress)
+	assert.Equal(t, []nettools.Address{expAddr}, agentSettings.ServerAddresses)
 	assert.Equal(t, "123", *agentSettings.HmacKey)
 	assert.Equal(t, "/home/.ssh/id_rsa.pub", *agentSettings.CryptoPubKeyPath)
+	assert.Equal(t, "key1", *agentSettings.CryptoKeyID)
+	assert.Equal(t, "team1", *agentSettings.HmacKeyID)
+	assert.Equal(t, "key1", *agentSettings.APIKey)
 	assert.Equal(t, 15, agentSettings.RateLimit)
 	assert.False(t, agentSettings.UseGRPC)
 	assert.Equal(t, "/home/ca.pem", *agentSettings.GRPCCACertPath)
@@ -134,7 +204,7 @@ func TestAgentSettingsAdaptCustomEnvAndFlagMix(t *testing.T) {
 	expAddr, _ := nettools.NewAddress("1.1.1.1:9999")
 	assert.Equal(t, 10*time.Second, agentSettings.ReportInterval)
 	assert.Equal(t, 3*time.Second, agentSettings.PollInterval)
-	assert.Equal(t, expAddr, agentSettings.ServerAddress)
+	assert.Equal(t, []nettools.Address{expAddr}, agentSettings.ServerAddresses)
 	assert.Nil(t, agentSettings.HmacKey)
 	assert.Equal(t, "/home/.ssh/id_rsa.pub", *agentSettings.CryptoPubKeyPath)
 	assert.Equal(t, 11, agentSettings.RateLimit)
@@ -153,6 +223,78 @@ func TestAgentSettingsAdaptCustomError(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestAgentSettingsAdaptServerError(t *testing.T) {
+	for _, vars := range []map[string]string{
+		{"ADDRESS": "1.1.1.1:9999,"},
+		{"ADDRESS": "1.1.1.1:9999,a.%^7b.c.d.e.f"},
+		{"SERVER_MODE": "roundrobin"},
+	} {
+		vars := vars
+		t.Run(fmt.Sprint(vars), func(t *testing.T) {
+			for k, v := range vars {
+				t.Setenv(k, v)
+			}
+
+			testFlagSet := flag.NewFlagSet("test", flag.ExitOnError)
+			config, err := LoadConfig(*testFlagSet, []string{})
+			assert.NoError(t, err)
+
+			_, err = AgentSettingsAdapt(config)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAgentSettingsAdaptTLSError(t *testing.T) {
+	for _, envVarName := range []string{"TLS_CLIENT_CERT", "GRPC_CLIENT_CERT", "GRPC_CLIENT_KEY"} {
+		envVarName := envVarName
+		t.Run(envVarName, func(t *testing.T) {
+			t.Setenv(envVarName, "/home/client.pem")
+
+			testFlagSet := flag.NewFlagSet("test", flag.ExitOnError)
+			config, err := LoadConfig(*testFlagSet, []string{})
+			assert.NoError(t, err)
+
+			_, err = AgentSettingsAdapt(config)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAgentSettingsAdaptSpoolError(t *testing.T) {
+	t.Setenv("SPOOL_DIR", "/var/spool/agent")
+	t.Setenv("SPOOL_MAX_SIZE", "0")
+
+	testFlagSet := flag.NewFlagSet("test", flag.ExitOnError)
+	config, err := LoadConfig(*testFlagSet, []string{})
+	assert.NoError(t, err)
+
+	_, err = AgentSettingsAdapt(config)
+	assert.Error(t, err)
+}
+
+func TestAgentSettingsAdaptRetryError(t *testing.T) {
+	for _, vars := range []map[string]string{
+		{"RETRY_INITIAL_BACKOFF": "0s"},
+		{"RETRY_INITIAL_BACKOFF": "10s", "RETRY_MAX_BACKOFF": "1s"},
+		{"RETRY_FAILURE_THRESHOLD": "0"},
+	} {
+		vars := vars
+		t.Run(fmt.Sprint(vars), func(t *testing.T) {
+			for k, v := range vars {
+				t.Setenv(k, v)
+			}
+
+			testFlagSet := flag.NewFlagSet("test", flag.ExitOnError)
+			config, err := LoadConfig(*testFlagSet, []string{})
+			assert.NoError(t, err)
+
+			_, err = AgentSettingsAdapt(config)
+			assert.Error(t, err)
+		})
+	}
+}
+
 func TestAgentSettingsCastEnvError(t *testing.T) {
 	for i, tt := range []struct {
 		envVarName string
@@ -161,6 +303,11 @@ func TestAgentSettingsCastEnvError(t *testing.T) {
 		{envVarName: "REPORT_INTERVAL", envVarVal: "foobar"},
 		{envVarName: "POLL_INTERVAL", envVarVal: "foobar"},
 		{envVarName: "RATE_LIMIT", envVarVal: "foobar"},
+		{envVarName: "SPOOL_MAX_SIZE", envVarVal: "foobar"},
+		{envVarName: "SPOOL_MAX_AGE", envVarVal: "foobar"},
+		{envVarName: "RETRY_INITIAL_BACKOFF", envVarVal: "foobar"},
+		{envVarName: "RETRY_MAX_BACKOFF", envVarVal: "foobar"},
+		{envVarName: "RETRY_FAILURE_THRESHOLD", envVarVal: "foobar"},
 	} {
 		tt := tt
 		i := i
@@ -205,12 +352,16 @@ func TestAgentSettingsWithConfigFile(t *testing.T) {
 	expAddr, _ := nettools.NewAddress("172.100.1.1:9090")
 	assert.Equal(t, 1*time.Second, agentSettings.ReportInterval)
 	assert.Equal(t, 3*time.Second, agentSettings.PollInterval)
-	assert.Equal(t, expAddr, agentSettings.ServerAddress)
+	assert.Equal(t, []nettools.Address{expAddr}, agentSettings.ServerAddresses)
 	assert.Nil(t, agentSettings.HmacKey)
 	assert.Nil(t, agentSettings.CryptoPubKeyPath)
+	assert.Nil(t, agentSettings.CryptoKeyID)
+	assert.Nil(t, agentSettings.HmacKeyID)
 	assert.Equal(t, 2, agentSettings.RateLimit)
 	assert.False(t, agentSettings.UseGRPC)
 	assert.Nil(t, agentSettings.GRPCCACertPath)
+	assert.Nil(t, agentSettings.GRPCCertPath)
+	assert.Nil(t, agentSettings.GRPCKeyPath)
 }
 
 func TestAgentSettingsAllFromConfigFile(t *testing.T) {
@@ -223,24 +374,62 @@ func TestAgentSettingsAllFromConfigFile(t *testing.T) {
 		os.Remove(fCfg.Name())
 	}()
 
-	cfgAddr := "172.100.1.1:9090"
+	cfgAddr := "172.100.1.1:9090,172.100.1.2:9090"
+	cfgServerMode := "replicate"
 	cfgRepInt := 100 * time.Minute
 	cfgPollInt := 200 * time.Minute
 	cfgHmacKey := "hmacKey"
 	cfgRateLimit := 1
 	cfgPubKey := "/tmp/id_rsa.pub"
+	cfgKeyID := "key3"
+	cfgHmacKeyID := "team3"
+	cfgAPIKey := "key3"
 	cfgUseGRPC := true
 	cfgGRPCCACertPath := "/home/ca.pem"
+	cfgGRPCCertPath := "/home/grpc-client.pem"
+	cfgGRPCKeyPath := "/home/grpc-client.key"
+	cfgTLSCACertPath := "/home/http-ca.pem"
+	cfgTLSCertPath := "/home/client.pem"
+	cfgTLSKeyPath := "/home/client.key"
+	cfgSpoolDir := "/var/spool/agent"
+	cfgSpoolMaxSize := 4096
+	cfgSpoolMaxAge := 2 * time.Hour
+	cfgRetryInitialBackoff := 3 * time.Second
+	cfgRetryMaxBackoff := 3 * time.Minute
+	cfgRetryFailureThreshold := 10
+	cfgDisabled := false
+	cfgCollectorPollInt := 30 * time.Second
+	cfgCollectorPrefix := "go_"
 
 	tempCfg := configFile{
-		Address:          &cfgAddr,
-		ReportInterval:   &cfgRepInt,
-		PollInterval:     &cfgPollInt,
-		HmacKey:          &cfgHmacKey,
-		RateLimit:        &cfgRateLimit,
-		CryptoPubKeyPath: &cfgPubKey,
-		UseGRPC:          &cfgUseGRPC,
-		GRPCCACertPath:   &cfgGRPCCACertPath,
+		Address:               &cfgAddr,
+		ServerMode:            &cfgServerMode,
+		ReportInterval:        &cfgRepInt,
+		PollInterval:          &cfgPollInt,
+		HmacKey:               &cfgHmacKey,
+		RateLimit:             &cfgRateLimit,
+		CryptoPubKeyPath:      &cfgPubKey,
+		CryptoKeyID:           &cfgKeyID,
+		HmacKeyID:             &cfgHmacKeyID,
+		APIKey:                &cfgAPIKey,
+		UseGRPC:               &cfgUseGRPC,
+		GRPCCACertPath:        &cfgGRPCCACertPath,
+		GRPCCertPath:          &cfgGRPCCertPath,
+		GRPCKeyPath:           &cfgGRPCKeyPath,
+		TLSCACertPath:         &cfgTLSCACertPath,
+		TLSCertPath:           &cfgTLSCertPath,
+		TLSKeyPath:            &cfgTLSKeyPath,
+		SpoolDir:              &cfgSpoolDir,
+		SpoolMaxSize:          &cfgSpoolMaxSize,
+		SpoolMaxAge:           &cfgSpoolMaxAge,
+		RetryInitialBackoff:   &cfgRetryInitialBackoff,
+		RetryMaxBackoff:       &cfgRetryMaxBackoff,
+		RetryFailureThreshold: &cfgRetryFailureThreshold,
+		Collectors: map[string]collectorConfigFile{
+			"runtime": {PollInterval: &cfgCollectorPollInt, Prefix: &cfgCollectorPrefix},
+			"psutil":  {Enabled: &cfgDisabled},
+			"disk":    {},
+		},
 	}
 	assert.NoError(t, json.NewEncoder(fCfg).Encode(&tempCfg))
 
@@ -252,13 +441,56 @@ func TestAgentSettingsAllFromConfigFile(t *testing.T) {
 	agentSettings, err := AgentSettingsAdapt(config)
 	assert.NoError(t, err)
 
-	expAddr, _ := nettools.NewAddress("172.100.1.1:9090")
+	expAddr1, _ := nettools.NewAddress("172.100.1.1:9090")
+	expAddr2, _ := nettools.NewAddress("172.100.1.2:9090")
 	assert.Equal(t, 100*time.Minute, agentSettings.ReportInterval)
 	assert.Equal(t, 200*time.Minute, agentSettings.PollInterval)
-	assert.Equal(t, expAddr, agentSettings.ServerAddress)
+	assert.Equal(t, []nettools.Address{expAddr1, expAddr2}, agentSettings.ServerAddresses)
+	assert.Equal(t, agent.ServerModeReplicate, agentSettings.ServerMode)
 	assert.Equal(t, "hmacKey", *agentSettings.HmacKey)
 	assert.Equal(t, "/tmp/id_rsa.pub", *agentSettings.CryptoPubKeyPath)
+	assert.Equal(t, "key3", *agentSettings.CryptoKeyID)
+	assert.Equal(t, "team3", *agentSettings.HmacKeyID)
+	assert.Equal(t, "key3", *agentSettings.APIKey)
 	assert.Equal(t, 1, agentSettings.RateLimit)
 	assert.True(t, agentSettings.UseGRPC)
 	assert.Equal(t, "/home/ca.pem", *agentSettings.GRPCCACertPath)
+	assert.Equal(t, "/home/grpc-client.pem", *agentSettings.GRPCCertPath)
+	assert.Equal(t, "/home/grpc-client.key", *agentSettings.GRPCKeyPath)
+	assert.Equal(t, tlsconfig.ClientSettings{
+		CACertPath: "/home/http-ca.pem", CertPath: "/home/client.pem", KeyPath: "/home/client.key",
+	}, *agentSettings.HTTPClientTLS)
+	assert.Equal(t, "/var/spool/agent", *agentSettings.SpoolDir)
+	assert.Equal(t, int64(4096), agentSettings.SpoolMaxSize)
+	assert.Equal(t, 2*time.Hour, agentSettings.SpoolMaxAge)
+	assert.Equal(t, publisher.RetrySettings{
+		InitialBackoff: 3 * time.Second, MaxBackoff: 3 * time.Minute, FailureThreshold: 10,
+	}, agentSettings.RetrySettings)
+	assert.Equal(t, collector.Settings{
+		Enabled: true, PollInterval: 30 * time.Second, Prefix: "go_",
+	}, agentSettings.Collectors["runtime"])
+	assert.Equal(t, collector.Settings{Enabled: false, PollInterval: 200 * time.Minute}, agentSettings.Collectors["psutil"])
+	assert.Equal(t, collector.Settings{Enabled: true, PollInterval: 200 * time.Minute}, agentSettings.Collectors["disk"])
+}
+
+func TestAgentSettingsCollectorsConfigFileError(t *testing.T) {
+	cfgPollInt := -time.Second
+	cfgPrefix := "go.runtime_"
+	for _, collectors := range []map[string]collectorConfigFile{
+		{"foobar": {}},
+		{"runtime": {PollInterval: &cfgPollInt}},
+		{"runtime": {Prefix: &cfgPrefix}},
+	} {
+		fCfg, err := os.CreateTemp(t.TempDir(), "cfg")
+		require.NoError(t, err)
+		require.NoError(t, json.NewEncoder(fCfg).Encode(&configFile{Collectors: collectors}))
+		require.NoError(t, fCfg.Close())
+
+		testFlagSet := flag.NewFlagSet("test", flag.ExitOnError)
+		config, err := LoadConfig(*testFlagSet, []string{"-c", fCfg.Name()})
+		assert.NoError(t, err)
+
+		_, err = AgentSettingsAdapt(config)
+		assert.Error(t, err)
+	}
 }
@@ -2,50 +2,90 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/devldavydov/promytheus/internal/common/acl"
 	"github.com/devldavydov/promytheus/internal/common/env"
+	"github.com/devldavydov/promytheus/internal/common/hash"
 	"github.com/devldavydov/promytheus/internal/common/nettools"
+	"github.com/devldavydov/promytheus/internal/common/tlsconfig"
 	"github.com/devldavydov/promytheus/internal/grpc/gtls"
 	"github.com/devldavydov/promytheus/internal/server"
+	"github.com/devldavydov/promytheus/internal/server/graphite"
 	"github.com/devldavydov/promytheus/internal/server/storage"
 )
 
 const (
-	_defaultConfigHTTPAddress       = "127.0.0.1:8080"
-	_defaultConfigLogLevel          = "DEBUG"
-	_defaultConfigLogFile           = "server.log"
-	_defaultconfigStoreInterval     = 300 * time.Second
-	_defaultConfigStoreFile         = "/tmp/devops-metrics-db.json"
-	_defaultConfigRestore           = true
-	_defaultConfigHmacKey           = ""
-	_defaultConfigDatabaseDsn       = ""
-	_defaultconfigCryptoPrivKeyPath = ""
-	_defaultConfigFilePath          = ""
-	_defaultConfigTrustedSubnet     = ""
-	_defaultConfigGrpcAddress       = ""
-	_defaultConfigGrpcServerTLSCert = ""
-	_defaultConfigGrpcServerTLSKey  = ""
+	_defaultConfigHTTPAddress        = "127.0.0.1:8080"
+	_defaultConfigLogLevel           = "DEBUG"
+	_defaultConfigLogFile            = "server.log"
+	_defaultconfigStoreInterval      = 300 * time.Second
+	_defaultConfigStoreFile          = "/tmp/devops-metrics-db.json"
+	_defaultConfigRestore            = true
+	_defaultConfigHmacKey            = ""
+	_defaultConfigHmacKeys           = ""
+	_defaultConfigHmacPrimaryKeyID   = ""
+	_defaultConfigDatabaseDsn        = ""
+	_defaultconfigCryptoPrivKeyPath  = ""
+	_defaultConfigFilePath           = ""
+	_defaultConfigTrustedSubnet      = ""
+	_defaultConfigTrustedProxies     = ""
+	_defaultConfigACL                = ""
+	_defaultConfigAPIKeysPath        = ""
+	_defaultConfigGrpcAddress        = ""
+	_defaultConfigGrpcServerTLSCert  = ""
+	_defaultConfigGrpcServerTLSKey   = ""
+	_defaultConfigGrpcClientCA       = ""
+	_defaultConfigGrpcAllowedClients = ""
+	_defaultConfigHTTPTLSCert        = ""
+	_defaultConfigHTTPTLSKey         = ""
+	_defaultConfigHTTPTLSClientCA    = ""
+	_defaultConfigHistorySize        = 0
+	_defaultConfigStatsDAddress      = ""
+	_defaultConfigGraphiteAddress    = ""
+	_defaultConfigGraphiteTemplates  = ""
+	_defaultConfigSignWindow         = hash.DefaultSignatureWindow
+	_defaultConfigSignRequired       = false
+	_defaultConfigAllowUnauthIngest  = false
 )
 
 type Config struct {
-	HTTPAddress       string
-	StoreFile         string
-	HmacKey           string
-	DatabaseDsn       string
-	LogLevel          string
-	LogFile           string
-	CryptoPrivKeyPath string
-	TrustedSubnet     string
-	GRPCAddress       string
-	GRPCServerTLSCert string
-	GRPCServerTLSKey  string
-	StoreInterval     time.Duration
-	Restore           bool
+	HTTPAddress        string
+	StoreFile          string
+	HmacKey            string
+	HmacKeys           string
+	HmacPrimaryKeyID   string
+	DatabaseDsn        string
+	LogLevel           string
+	LogFile            string
+	CryptoPrivKeyPath  string
+	TrustedSubnet      string
+	TrustedProxies     string
+	ACL                string
+	APIKeysPath        string
+	GRPCAddress        string
+	GRPCServerTLSCert  string
+	GRPCServerTLSKey   string
+	GRPCClientCA       string
+	GRPCAllowedClients string
+	HTTPTLSCert        string
+	HTTPTLSKey         string
+	HTTPTLSClientCA    string
+	StatsDAddress      string
+	GraphiteAddress    string
+	GraphiteTemplates  string
+	StoreInterval      time.Duration
+	SignWindow         time.Duration
+	HistorySize        int
+	Restore            bool
+	SignRequired       bool
+	AllowUnauthIngest  bool
 }
 
 func LoadConfig(flagSet flag.FlagSet, flags []string) (*Config, error) {
@@ -59,12 +99,29 @@ func LoadConfig(flagSet flag.FlagSet, flags []string) (*Config, error) {
 	flagSet.StringVar(&config.StoreFile, "f", _defaultConfigStoreFile, "store file")
 	flagSet.BoolVar(&config.Restore, "r", _defaultConfigRestore, "restore")
 	flagSet.StringVar(&config.HmacKey, "k", _defaultConfigHmacKey, "sign key")
+	flagSet.StringVar(&config.HmacKeys, "hmac-keys", _defaultConfigHmacKeys, "comma separated sign keys as id=key")
+	flagSet.StringVar(&config.HmacPrimaryKeyID, "hmac-primary", _defaultConfigHmacPrimaryKeyID, "primary sign key ID")
 	flagSet.StringVar(&config.DatabaseDsn, "d", _defaultConfigDatabaseDsn, "database dsn")
-	flagSet.StringVar(&config.CryptoPrivKeyPath, "crypto-key", _defaultconfigCryptoPrivKeyPath, "crypto private key path")
+	flagSet.StringVar(&config.CryptoPrivKeyPath, "crypto-key", _defaultconfigCryptoPrivKeyPath, "crypto private key files or directories, comma separated")
 	flagSet.StringVar(&config.TrustedSubnet, "t", _defaultConfigTrustedSubnet, "trusted subnet")
+	flagSet.StringVar(&config.ACL, "acl", _defaultConfigACL, "ACL policy of route groups (write, read, admin) as group=subnet,!subnet;...")
+	flagSet.StringVar(&config.APIKeysPath, "api-keys-file", _defaultConfigAPIKeysPath, "API keys file with hashes, scopes and write prefixes of keys")
+	flagSet.StringVar(&config.TrustedProxies, "trusted-proxies", _defaultConfigTrustedProxies, "comma separated IPs or subnets of proxies, allowed to set X-Forwarded-For")
 	flagSet.StringVar(&config.GRPCAddress, "g", _defaultConfigGrpcAddress, "server gRPC address")
 	flagSet.StringVar(&config.GRPCServerTLSCert, "gtlscert", _defaultConfigGrpcServerTLSCert, "gRPC server certificate")
 	flagSet.StringVar(&config.GRPCServerTLSKey, "gtlskey", _defaultConfigGrpcServerTLSKey, "gRPC server certificate key")
+	flagSet.StringVar(&config.GRPCClientCA, "gtlsclientca", _defaultConfigGrpcClientCA, "gRPC clients CA certificate, enables client certificate verification")
+	flagSet.StringVar(&config.GRPCAllowedClients, "gallowedclients", _defaultConfigGrpcAllowedClients, "comma separated CN/SAN of gRPC clients, allowed to update metrics")
+	flagSet.StringVar(&config.HTTPTLSCert, "tlscert", _defaultConfigHTTPTLSCert, "HTTP server certificate")
+	flagSet.StringVar(&config.HTTPTLSKey, "tlskey", _defaultConfigHTTPTLSKey, "HTTP server certificate key")
+	flagSet.StringVar(&config.HTTPTLSClientCA, "tlsclientca", _defaultConfigHTTPTLSClientCA, "HTTP clients CA certificate, enables client certificate verification")
+	flagSet.IntVar(&config.HistorySize, "history", _defaultConfigHistorySize, "history samples per series (0 - disabled)")
+	flagSet.StringVar(&config.StatsDAddress, "statsd", _defaultConfigStatsDAddress, "server StatsD UDP address")
+	flagSet.StringVar(&config.GraphiteAddress, "graphite", _defaultConfigGraphiteAddress, "server Graphite TCP address")
+	flagSet.StringVar(&config.GraphiteTemplates, "graphite-templates", _defaultConfigGraphiteTemplates, "comma separated Graphite templates")
+	flagSet.DurationVar(&config.SignWindow, "sign-window", _defaultConfigSignWindow, "request signature timestamp window")
+	flagSet.BoolVar(&config.SignRequired, "sign-required", _defaultConfigSignRequired, "reject write requests without request signature")
+	flagSet.BoolVar(&config.AllowUnauthIngest, "allow-unauth-ingest", _defaultConfigAllowUnauthIngest, "allow StatsD and Graphite listeners, which do not check API keys")
 	//
 	flagSet.StringVar(&configFilePath, "c", _defaultConfigFilePath, "config file path")
 	flagSet.StringVar(&configFilePath, "config", _defaultConfigFilePath, "config file path")
@@ -104,6 +161,16 @@ func LoadConfig(flagSet flag.FlagSet, flags []string) (*Config, error) {
 		return nil, err
 	}
 
+	config.HmacKeys, err = env.GetVariable("HMAC_KEYS", env.CastString, config.HmacKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	config.HmacPrimaryKeyID, err = env.GetVariable("HMAC_PRIMARY_KEY_ID", env.CastString, config.HmacPrimaryKeyID)
+	if err != nil {
+		return nil, err
+	}
+
 	config.DatabaseDsn, err = env.GetVariable("DATABASE_DSN", env.CastString, config.DatabaseDsn)
 	if err != nil {
 		return nil, err
@@ -119,6 +186,21 @@ func LoadConfig(flagSet flag.FlagSet, flags []string) (*Config, error) {
 		return nil, err
 	}
 
+	config.ACL, err = env.GetVariable("ACL", env.CastString, config.ACL)
+	if err != nil {
+		return nil, err
+	}
+
+	config.APIKeysPath, err = env.GetVariable("API_KEYS_FILE", env.CastString, config.APIKeysPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config.TrustedProxies, err = env.GetVariable("TRUSTED_PROXIES", env.CastString, config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
 	config.GRPCAddress, err = env.GetVariable("GRPC_ADDRESS", env.CastString, config.GRPCAddress)
 	if err != nil {
 		return nil, err
@@ -134,6 +216,66 @@ func LoadConfig(flagSet flag.FlagSet, flags []string) (*Config, error) {
 		return nil, err
 	}
 
+	config.GRPCClientCA, err = env.GetVariable("GRPC_SERVER_TLS_CLIENT_CA", env.CastString, config.GRPCClientCA)
+	if err != nil {
+		return nil, err
+	}
+
+	config.GRPCAllowedClients, err = env.GetVariable("GRPC_ALLOWED_CLIENTS", env.CastString, config.GRPCAllowedClients)
+	if err != nil {
+		return nil, err
+	}
+
+	config.HTTPTLSCert, err = env.GetVariable("HTTP_TLS_CERT", env.CastString, config.HTTPTLSCert)
+	if err != nil {
+		return nil, err
+	}
+
+	config.HTTPTLSKey, err = env.GetVariable("HTTP_TLS_KEY", env.CastString, config.HTTPTLSKey)
+	if err != nil {
+		return nil, err
+	}
+
+	config.HTTPTLSClientCA, err = env.GetVariable("HTTP_TLS_CLIENT_CA", env.CastString, config.HTTPTLSClientCA)
+	if err != nil {
+		return nil, err
+	}
+
+	config.HistorySize, err = env.GetVariable("HISTORY_SIZE", env.CastInt, config.HistorySize)
+	if err != nil {
+		return nil, err
+	}
+
+	config.StatsDAddress, err = env.GetVariable("STATSD_ADDRESS", env.CastString, config.StatsDAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	config.GraphiteAddress, err = env.GetVariable("GRAPHITE_ADDRESS", env.CastString, config.GraphiteAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	config.GraphiteTemplates, err = env.GetVariable("GRAPHITE_TEMPLATES", env.CastString, config.GraphiteTemplates)
+	if err != nil {
+		return nil, err
+	}
+
+	config.SignWindow, err = env.GetVariable("SIGN_WINDOW", env.CastDuration, config.SignWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	config.SignRequired, err = env.GetVariable("SIGN_REQUIRED", env.CastBool, config.SignRequired)
+	if err != nil {
+		return nil, err
+	}
+
+	config.AllowUnauthIngest, err = env.GetVariable("ALLOW_UNAUTH_INGEST", env.CastBool, config.AllowUnauthIngest)
+	if err != nil {
+		return nil, err
+	}
+
 	config.LogLevel, err = env.GetVariable("LOG_LEVEL", env.CastString, _defaultConfigLogLevel)
 	if err != nil {
 		return nil, err
@@ -171,6 +313,21 @@ func ServerSettingsAdapt(config *Config) (server.ServiceSettings, error) {
 		}
 	}
 
+	policy, err := acl.ParsePolicy(config.ACL)
+	if err != nil {
+		return server.ServiceSettings{}, err
+	}
+
+	trustedProxies, err := nettools.ParseSubnets(config.TrustedProxies)
+	if err != nil {
+		return server.ServiceSettings{}, err
+	}
+
+	hmacKeys, err := hash.ParseKeyRing(config.HmacKey, config.HmacKeys, config.HmacPrimaryKeyID)
+	if err != nil {
+		return server.ServiceSettings{}, err
+	}
+
 	var grpcAddress *nettools.Address
 	if config.GRPCAddress != "" {
 		var gAddr nettools.Address
@@ -181,35 +338,120 @@ func ServerSettingsAdapt(config *Config) (server.ServiceSettings, error) {
 		grpcAddress = &gAddr
 	}
 
-	grpcServerTLS, err := gtls.NewOptionalTLSServerSettings(config.GRPCServerTLSCert, config.GRPCServerTLSKey)
+	var statsDAddress *nettools.Address
+	if config.StatsDAddress != "" {
+		var sAddr nettools.Address
+		sAddr, err = nettools.NewAddress(config.StatsDAddress)
+		if err != nil {
+			return server.ServiceSettings{}, err
+		}
+		statsDAddress = &sAddr
+	}
+
+	var graphiteAddress *nettools.Address
+	if config.GraphiteAddress != "" {
+		var gAddr nettools.Address
+		gAddr, err = nettools.NewAddress(config.GraphiteAddress)
+		if err != nil {
+			return server.ServiceSettings{}, err
+		}
+		graphiteAddress = &gAddr
+	}
+
+	graphiteTemplates, err := graphite.ParseTemplates(config.GraphiteTemplates)
 	if err != nil {
 		return server.ServiceSettings{}, err
 	}
 
+	// StatsD and Graphite protocols have no authentication, API keys would be bypassed
+	if config.APIKeysPath != "" && (statsDAddress != nil || graphiteAddress != nil) && !config.AllowUnauthIngest {
+		return server.ServiceSettings{}, errors.New("StatsD and Graphite listeners are not authenticated with API keys, allow unauthenticated ingest explicitly")
+	}
+
+	grpcServerTLS, err := gtls.NewOptionalTLSServerSettings(
+		config.GRPCServerTLSCert,
+		config.GRPCServerTLSKey,
+		config.GRPCClientCA,
+		parseList(config.GRPCAllowedClients))
+	if err != nil {
+		return server.ServiceSettings{}, err
+	}
+
+	httpServerTLS, err := tlsconfig.NewOptionalServerSettings(config.HTTPTLSCert, config.HTTPTLSKey, config.HTTPTLSClientCA)
+	if err != nil {
+		return server.ServiceSettings{}, err
+	}
+
+	if config.SignWindow <= 0 {
+		return server.ServiceSettings{}, fmt.Errorf("wrong sign window: %v", config.SignWindow)
+	}
+
+	if config.HistorySize < 0 {
+		return server.ServiceSettings{}, fmt.Errorf("wrong history size: %d", config.HistorySize)
+	}
+
 	persistSettings := storage.NewPersistSettings(config.StoreInterval, config.StoreFile, config.Restore)
+	historySettings := storage.NewHistorySettings(config.HistorySize)
 	return server.NewServiceSettings(
 		httpAddress,
-		config.HmacKey,
+		httpServerTLS,
+		hmacKeys,
 		config.DatabaseDsn,
 		persistSettings,
+		historySettings,
 		config.CryptoPrivKeyPath,
 		trustedSubnet,
+		trustedProxies,
+		policy,
+		config.APIKeysPath,
 		grpcAddress,
-		grpcServerTLS), nil
+		grpcServerTLS,
+		statsDAddress,
+		graphiteAddress,
+		graphiteTemplates,
+		config.SignWindow,
+		config.SignRequired), nil
+}
+
+func parseList(s string) []string {
+	var res []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
 }
 
 type configFile struct {
-	Address           *string        `json:"address"`
-	Restore           *bool          `json:"restore"`
-	StoreInterval     *time.Duration `json:"store_interval"`
-	StoreFile         *string        `json:"store_file"`
-	DatabaseDsn       *string        `json:"database_dsn"`
-	HmacKey           *string        `json:"hmac_key"`
-	CryptoPrivKeyPath *string        `json:"crypto_key"`
-	TrustedSubnet     *string        `json:"trusted_subnet"`
-	GRPCAddress       *string        `json:"grpc_address"`
-	GRPCServerTLSCert *string        `json:"grpc_server_tls_cert"`
-	GRPCServerTLSKey  *string        `json:"grpc_server_tls_key"`
+	Address            *string        `json:"address"`
+	Restore            *bool          `json:"restore"`
+	StoreInterval      *time.Duration `json:"store_interval"`
+	StoreFile          *string        `json:"store_file"`
+	DatabaseDsn        *string        `json:"database_dsn"`
+	HmacKey            *string        `json:"hmac_key"`
+	HmacKeys           *string        `json:"hmac_keys"`
+	HmacPrimaryKeyID   *string        `json:"hmac_primary_key_id"`
+	CryptoPrivKeyPath  *string        `json:"crypto_key"`
+	TrustedSubnet      *string        `json:"trusted_subnet"`
+	TrustedProxies     *string        `json:"trusted_proxies"`
+	ACL                *string        `json:"acl"`
+	APIKeysPath        *string        `json:"api_keys_file"`
+	GRPCAddress        *string        `json:"grpc_address"`
+	GRPCServerTLSCert  *string        `json:"grpc_server_tls_cert"`
+	GRPCServerTLSKey   *string        `json:"grpc_server_tls_key"`
+	GRPCClientCA       *string        `json:"grpc_server_tls_client_ca"`
+	GRPCAllowedClients *string        `json:"grpc_allowed_clients"`
+	HTTPTLSCert        *string        `json:"http_tls_cert"`
+	HTTPTLSKey         *string        `json:"http_tls_key"`
+	HTTPTLSClientCA    *string        `json:"http_tls_client_ca"`
+	HistorySize        *int           `json:"history_size"`
+	StatsDAddress      *string        `json:"statsd_address"`
+	GraphiteAddress    *string        `json:"graphite_address"`
+	GraphiteTemplates  *string        `json:"graphite_templates"`
+	SignWindow         *time.Duration `json:"sign_window"`
+	SignRequired       *bool          `json:"sign_required"`
+	AllowUnauthIngest  *bool          `json:"allow_unauth_ingest"`
 }
 
 func applyConfigFile(config *Config, configFilePath string) error {
@@ -246,12 +488,27 @@ func applyConfigFile(config *Config, configFilePath string) error {
 	if configFromFile.HmacKey != nil && config.HmacKey == _defaultConfigHmacKey {
 		config.HmacKey = *configFromFile.HmacKey
 	}
+	if configFromFile.HmacKeys != nil && config.HmacKeys == _defaultConfigHmacKeys {
+		config.HmacKeys = *configFromFile.HmacKeys
+	}
+	if configFromFile.HmacPrimaryKeyID != nil && config.HmacPrimaryKeyID == _defaultConfigHmacPrimaryKeyID {
+		config.HmacPrimaryKeyID = *configFromFile.HmacPrimaryKeyID
+	}
 	if configFromFile.CryptoPrivKeyPath != nil && config.CryptoPrivKeyPath == _defaultconfigCryptoPrivKeyPath {
 		config.CryptoPrivKeyPath = *configFromFile.CryptoPrivKeyPath
 	}
 	if configFromFile.TrustedSubnet != nil && config.TrustedSubnet == _defaultConfigTrustedSubnet {
 		config.TrustedSubnet = *configFromFile.TrustedSubnet
 	}
+	if configFromFile.ACL != nil && config.ACL == _defaultConfigACL {
+		config.ACL = *configFromFile.ACL
+	}
+	if configFromFile.APIKeysPath != nil && config.APIKeysPath == _defaultConfigAPIKeysPath {
+		config.APIKeysPath = *configFromFile.APIKeysPath
+	}
+	if configFromFile.TrustedProxies != nil && config.TrustedProxies == _defaultConfigTrustedProxies {
+		config.TrustedProxies = *configFromFile.TrustedProxies
+	}
 	if configFromFile.GRPCAddress != nil && config.GRPCAddress == _defaultConfigGrpcAddress {
 		config.GRPCAddress = *configFromFile.GRPCAddress
 	}
@@ -261,6 +518,42 @@ func applyConfigFile(config *Config, configFilePath string) error {
 	if configFromFile.GRPCServerTLSKey != nil && config.GRPCServerTLSKey == _defaultConfigGrpcServerTLSKey {
 		config.GRPCServerTLSKey = *configFromFile.GRPCServerTLSKey
 	}
+	if configFromFile.GRPCClientCA != nil && config.GRPCClientCA == _defaultConfigGrpcClientCA {
+		config.GRPCClientCA = *configFromFile.GRPCClientCA
+	}
+	if configFromFile.GRPCAllowedClients != nil && config.GRPCAllowedClients == _defaultConfigGrpcAllowedClients {
+		config.GRPCAllowedClients = *configFromFile.GRPCAllowedClients
+	}
+	if configFromFile.HTTPTLSCert != nil && config.HTTPTLSCert == _defaultConfigHTTPTLSCert {
+		config.HTTPTLSCert = *configFromFile.HTTPTLSCert
+	}
+	if configFromFile.HTTPTLSKey != nil && config.HTTPTLSKey == _defaultConfigHTTPTLSKey {
+		config.HTTPTLSKey = *configFromFile.HTTPTLSKey
+	}
+	if configFromFile.HTTPTLSClientCA != nil && config.HTTPTLSClientCA == _defaultConfigHTTPTLSClientCA {
+		config.HTTPTLSClientCA = *configFromFile.HTTPTLSClientCA
+	}
+	if configFromFile.HistorySize != nil && config.HistorySize == _defaultConfigHistorySize {
+		config.HistorySize = *configFromFile.HistorySize
+	}
+	if configFromFile.StatsDAddress != nil && config.StatsDAddress == _defaultConfigStatsDAddress {
+		config.StatsDAddress = *configFromFile.StatsDAddress
+	}
+	if configFromFile.GraphiteAddress != nil && config.GraphiteAddress == _defaultConfigGraphiteAddress {
+		config.GraphiteAddress = *configFromFile.GraphiteAddress
+	}
+	if configFromFile.GraphiteTemplates != nil && config.GraphiteTemplates == _defaultConfigGraphiteTemplates {
+		config.GraphiteTemplates = *configFromFile.GraphiteTemplates
+	}
+	if configFromFile.SignWindow != nil && config.SignWindow == _defaultConfigSignWindow {
+		config.SignWindow = *configFromFile.SignWindow
+	}
+	if configFromFile.SignRequired != nil && !config.SignRequired {
+		config.SignRequired = *configFromFile.SignRequired
+	}
+	if configFromFile.AllowUnauthIngest != nil && !config.AllowUnauthIngest {
+		config.AllowUnauthIngest = *configFromFile.AllowUnauthIngest
+	}
 
 	return nil
 }
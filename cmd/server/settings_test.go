@@ -9,7 +9,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/devldavydov/promytheus/internal/common/acl"
+	"github.com/devldavydov/promytheus/internal/common/tlsconfig"
 	"github.com/devldavydov/promytheus/internal/grpc/gtls"
+	"github.com/devldavydov/promytheus/internal/server"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -24,15 +27,26 @@ func TestServerSettingsAdaptDefault(t *testing.T) {
 
 	assert.Equal(t, "127.0.0.1", serverSettings.HTTPAddress.Host)
 	assert.Equal(t, 8080, serverSettings.HTTPAddress.Port)
-	assert.Nil(t, serverSettings.HmacKey)
+	assert.Nil(t, serverSettings.HmacKeys)
 	assert.Equal(t, 300*time.Second, serverSettings.PersistSettings.StoreInterval)
 	assert.Equal(t, "/tmp/devops-metrics-db.json", serverSettings.PersistSettings.StoreFile)
 	assert.Equal(t, "", serverSettings.DatabaseDsn)
 	assert.True(t, serverSettings.PersistSettings.Restore)
 	assert.Nil(t, serverSettings.CryptoPrivKeyPath)
+	assert.Nil(t, serverSettings.APIKeysPath)
 	assert.Nil(t, serverSettings.TrustedSubnet)
 	assert.Nil(t, serverSettings.GRPCAddress)
 	assert.Nil(t, serverSettings.GRPCServerTLS)
+	assert.Nil(t, serverSettings.TrustedProxies)
+	_, ok := serverSettings.ACL.Rule(acl.GroupWrite)
+	assert.False(t, ok)
+	assert.Nil(t, serverSettings.HTTPServerTLS)
+	assert.False(t, serverSettings.HistorySettings.Enabled())
+	assert.Nil(t, serverSettings.StatsDAddress)
+	assert.Nil(t, serverSettings.GraphiteAddress)
+	assert.Nil(t, serverSettings.GraphiteTemplates)
+	assert.Equal(t, 5*time.Minute, serverSettings.SignWindow)
+	assert.False(t, serverSettings.SignRequired)
 }
 
 func TestServerSettingsAdaptCustomEnv(t *testing.T) {
@@ -46,9 +60,25 @@ func TestServerSettingsAdaptCustomEnv(t *testing.T) {
 		t.Setenv("DATABASE_DSN", "postgre:5444")
 		t.Setenv("CRYPTO_KEY", "/home/.ssh/id_rsa")
 		t.Setenv("TRUSTED_SUBNET", "192.168.0.0/16")
+		t.Setenv("TRUSTED_PROXIES", "10.1.1.1, 172.16.0.0/12")
+		t.Setenv("ACL", "write=!192.168.1.0/24;read=fd00::/8")
+		t.Setenv("API_KEYS_FILE", "/home/keys.json")
 		t.Setenv("GRPC_ADDRESS", "10.0.0.0:5555")
 		t.Setenv("GRPC_SERVER_TLS_CERT", "/home/srv.pem")
 		t.Setenv("GRPC_SERVER_TLS_KEY", "/home/srv.key")
+		t.Setenv("GRPC_SERVER_TLS_CLIENT_CA", "/home/grpc-ca.pem")
+		t.Setenv("GRPC_ALLOWED_CLIENTS", "agent1, agent2.example.com")
+		t.Setenv("HISTORY_SIZE", "100")
+		t.Setenv("STATSD_ADDRESS", "10.0.0.1:8125")
+		t.Setenv("GRAPHITE_ADDRESS", "10.0.0.1:2003")
+		t.Setenv("GRAPHITE_TEMPLATES", "servers.* .host.measurement*")
+		t.Setenv("SIGN_WINDOW", "1m")
+		t.Setenv("SIGN_REQUIRED", "true")
+		t.Setenv("ALLOW_UNAUTH_INGEST", "true")
+		t.Setenv("HMAC_KEYS", "team1=k1")
+		t.Setenv("HTTP_TLS_CERT", "/home/http.pem")
+		t.Setenv("HTTP_TLS_KEY", "/home/http.key")
+		t.Setenv("HTTP_TLS_CLIENT_CA", "/home/ca.pem")
 
 		testFlagSet := flag.NewFlagSet("test", flag.ExitOnError)
 		config, err := LoadConfig(*testFlagSet, []string{})
@@ -59,18 +89,37 @@ func TestServerSettingsAdaptCustomEnv(t *testing.T) {
 
 		assert.Equal(t, "1.1.1.1", serverSettings.HTTPAddress.Host)
 		assert.Equal(t, 9999, serverSettings.HTTPAddress.Port)
-		assert.Equal(t, "123", *serverSettings.HmacKey)
+		assert.Equal(t, "123", primaryHmacKey(serverSettings))
 		assert.Equal(t, time.Duration(0), serverSettings.PersistSettings.StoreInterval)
 		assert.Equal(t, storeFile, serverSettings.PersistSettings.StoreFile)
 		assert.False(t, serverSettings.PersistSettings.Restore)
 		assert.Equal(t, "postgre:5444", serverSettings.DatabaseDsn)
 		assert.Equal(t, "/home/.ssh/id_rsa", *serverSettings.CryptoPrivKeyPath)
 		assert.Equal(t, getIPNet("192.168.0.0/16"), serverSettings.TrustedSubnet)
+		assert.Equal(t, []*net.IPNet{getIPNet("10.1.1.1/32"), getIPNet("172.16.0.0/12")}, serverSettings.TrustedProxies)
+		assert.True(t, serverSettings.ACL.Allowed(acl.GroupWrite, net.ParseIP("192.168.0.1")))
+		assert.False(t, serverSettings.ACL.Allowed(acl.GroupWrite, net.ParseIP("192.168.1.1")))
+		assert.False(t, serverSettings.ACL.Allowed(acl.GroupWrite, net.ParseIP("10.0.0.1")))
+		assert.True(t, serverSettings.ACL.Allowed(acl.GroupRead, net.ParseIP("fd00::1")))
+		assert.False(t, serverSettings.ACL.Allowed(acl.GroupRead, net.ParseIP("10.0.0.1")))
+		assert.Equal(t, "/home/keys.json", *serverSettings.APIKeysPath)
 		assert.Equal(t, "10.0.0.0", serverSettings.GRPCAddress.Host)
 		assert.Equal(t, 5555, serverSettings.GRPCAddress.Port)
 		assert.Equal(t, gtls.TLSServerSettings{
-			ServerCertPath: "/home/srv.pem", ServerKeyPath: "/home/srv.key",
+			ServerCertPath: "/home/srv.pem", ServerKeyPath: "/home/srv.key", ClientCACertPath: "/home/grpc-ca.pem",
+			AllowedClients: []string{"agent1", "agent2.example.com"},
 		}, *serverSettings.GRPCServerTLS)
+		assert.Equal(t, 100, serverSettings.HistorySettings.Size)
+		assert.Equal(t, "10.0.0.1", serverSettings.StatsDAddress.Host)
+		assert.Equal(t, 8125, serverSettings.StatsDAddress.Port)
+		assert.Equal(t, 2003, serverSettings.GraphiteAddress.Port)
+		assert.Len(t, serverSettings.GraphiteTemplates, 1)
+		assert.Equal(t, time.Minute, serverSettings.SignWindow)
+		assert.True(t, serverSettings.SignRequired)
+		assert.Equal(t, []string{"default", "team1"}, serverSettings.HmacKeys.IDs())
+		assert.Equal(t, tlsconfig.ServerSettings{
+			CertPath: "/home/http.pem", KeyPath: "/home/http.key", ClientCACertPath: "/home/ca.pem",
+		}, *serverSettings.HTTPServerTLS)
 	}
 }
 
@@ -87,28 +136,56 @@ func TestServerSettingsAdaptCustomFlag(t *testing.T) {
 			"-d", "postgre:5444",
 			"-crypto-key", "/home/.ssh/id_rsa",
 			"-t", "192.168.0.0/16",
+			"-trusted-proxies", "::1",
+			"-acl", "admin=::1",
+			"-api-keys-file", "/home/keys.json",
 			"-g", "10.0.0.0:5555",
 			"-gtlscert", "/home/srv.pem",
-			"-gtlskey", "/home/srv.key"})
+			"-gtlskey", "/home/srv.key",
+			"-gtlsclientca", "/home/grpc-ca.pem",
+			"-history", "50",
+			"-statsd", ":9125",
+			"-graphite", ":3003",
+			"-graphite-templates", "a.measurement,b.measurement",
+			"-sign-window", "30s",
+			"-sign-required",
+			"-allow-unauth-ingest",
+			"-hmac-keys", "team1=k1,team2=k2",
+			"-hmac-primary", "team2",
+			"-tlscert", "/home/http.pem",
+			"-tlskey", "/home/http.key"})
 	assert.NoError(t, err)
 
 	serverSettings, err := ServerSettingsAdapt(config)
 	assert.NoError(t, err)
 
+	assert.Equal(t, 30*time.Second, serverSettings.SignWindow)
+	assert.True(t, serverSettings.SignRequired)
+	assert.Equal(t, []string{"default", "team1", "team2"}, serverSettings.HmacKeys.IDs())
+	assert.Equal(t, tlsconfig.ServerSettings{CertPath: "/home/http.pem", KeyPath: "/home/http.key"}, *serverSettings.HTTPServerTLS)
 	assert.Equal(t, "1.1.1.1", serverSettings.HTTPAddress.Host)
 	assert.Equal(t, 9999, serverSettings.HTTPAddress.Port)
-	assert.Equal(t, "123", *serverSettings.HmacKey)
+	assert.Equal(t, "k2", primaryHmacKey(serverSettings))
 	assert.Equal(t, time.Duration(0), serverSettings.PersistSettings.StoreInterval)
 	assert.Equal(t, "/tmp/ttt", serverSettings.PersistSettings.StoreFile)
 	assert.False(t, serverSettings.PersistSettings.Restore)
 	assert.Equal(t, "postgre:5444", serverSettings.DatabaseDsn)
 	assert.Equal(t, "/home/.ssh/id_rsa", *serverSettings.CryptoPrivKeyPath)
 	assert.Equal(t, getIPNet("192.168.0.0/16"), serverSettings.TrustedSubnet)
+	assert.Equal(t, []*net.IPNet{getIPNet("::1/128")}, serverSettings.TrustedProxies)
+	assert.True(t, serverSettings.ACL.Allowed(acl.GroupAdmin, net.ParseIP("::1")))
+	assert.False(t, serverSettings.ACL.Allowed(acl.GroupAdmin, net.ParseIP("127.0.0.1")))
+	assert.Equal(t, "/home/keys.json", *serverSettings.APIKeysPath)
 	assert.Equal(t, "10.0.0.0", serverSettings.GRPCAddress.Host)
 	assert.Equal(t, 5555, serverSettings.GRPCAddress.Port)
 	assert.Equal(t, gtls.TLSServerSettings{
-		ServerCertPath: "/home/srv.pem", ServerKeyPath: "/home/srv.key",
+		ServerCertPath: "/home/srv.pem", ServerKeyPath: "/home/srv.key", ClientCACertPath: "/home/grpc-ca.pem",
 	}, *serverSettings.GRPCServerTLS)
+	assert.Equal(t, 50, serverSettings.HistorySettings.Size)
+	assert.Equal(t, "", serverSettings.StatsDAddress.Host)
+	assert.Equal(t, 9125, serverSettings.StatsDAddress.Port)
+	assert.Equal(t, 3003, serverSettings.GraphiteAddress.Port)
+	assert.Len(t, serverSettings.GraphiteTemplates, 2)
 }
 
 func TestServerSettingsAdaptCustomEnvAndFlag(t *testing.T) {
@@ -124,6 +201,11 @@ func TestServerSettingsAdaptCustomEnvAndFlag(t *testing.T) {
 	t.Setenv("GRPC_SERVER_CERT", "/home/srv.pem")
 	t.Setenv("GRPC_SERVER_TLS_CERT", "/home/srv.pem")
 	t.Setenv("GRPC_SERVER_TLS_KEY", "/home/srv.key")
+	t.Setenv("HISTORY_SIZE", "100")
+	t.Setenv("STATSD_ADDRESS", ":8125")
+	t.Setenv("GRAPHITE_ADDRESS", ":2003")
+	t.Setenv("GRAPHITE_TEMPLATES", "host.measurement")
+	t.Setenv("SIGN_WINDOW", "1m")
 
 	testFlagSet := flag.NewFlagSet("test", flag.ExitOnError)
 	config, err := LoadConfig(
@@ -138,15 +220,21 @@ func TestServerSettingsAdaptCustomEnvAndFlag(t *testing.T) {
 			"-crypto-key", "./id_rsa",
 			"-t", "192.168.0.0/16",
 			"-gtlscert", "/home/srv2.pem",
-			"-gtlskey", "/home/srv2.key"})
+			"-gtlskey", "/home/srv2.key",
+			"-history", "50",
+			"-statsd", ":9125",
+			"-graphite", ":3003",
+			"-graphite-templates", "a.measurement,b.measurement",
+			"-sign-window", "30s"})
 	assert.NoError(t, err)
 
 	serverSettings, err := ServerSettingsAdapt(config)
 	assert.NoError(t, err)
 
+	assert.Equal(t, time.Minute, serverSettings.SignWindow)
 	assert.Equal(t, "1.1.1.1", serverSettings.HTTPAddress.Host)
 	assert.Equal(t, 9999, serverSettings.HTTPAddress.Port)
-	assert.Equal(t, "123", *serverSettings.HmacKey)
+	assert.Equal(t, "123", primaryHmacKey(serverSettings))
 	assert.Equal(t, time.Duration(0), serverSettings.PersistSettings.StoreInterval)
 	assert.Equal(t, "/tmp/ttt", serverSettings.PersistSettings.StoreFile)
 	assert.False(t, serverSettings.PersistSettings.Restore)
@@ -158,6 +246,10 @@ func TestServerSettingsAdaptCustomEnvAndFlag(t *testing.T) {
 	assert.Equal(t, gtls.TLSServerSettings{
 		ServerCertPath: "/home/srv.pem", ServerKeyPath: "/home/srv.key",
 	}, *serverSettings.GRPCServerTLS)
+	assert.Equal(t, 100, serverSettings.HistorySettings.Size)
+	assert.Equal(t, 8125, serverSettings.StatsDAddress.Port)
+	assert.Equal(t, 2003, serverSettings.GraphiteAddress.Port)
+	assert.Len(t, serverSettings.GraphiteTemplates, 1)
 }
 
 func TestServerSettingsAdaptCustomEnvAndFlagMix(t *testing.T) {
@@ -177,7 +269,7 @@ func TestServerSettingsAdaptCustomEnvAndFlagMix(t *testing.T) {
 
 	assert.Equal(t, "127.0.0.1", serverSettings.HTTPAddress.Host)
 	assert.Equal(t, 8080, serverSettings.HTTPAddress.Port)
-	assert.Equal(t, "123", *serverSettings.HmacKey)
+	assert.Equal(t, "123", primaryHmacKey(serverSettings))
 	assert.Equal(t, 1*time.Second, serverSettings.PersistSettings.StoreInterval)
 	assert.Equal(t, "/tmp/devops-metrics-db.json", serverSettings.PersistSettings.StoreFile)
 	assert.True(t, serverSettings.PersistSettings.Restore)
@@ -202,6 +294,30 @@ func TestServerSettingsAdaptCustomError(t *testing.T) {
 		{vars: map[string]string{"TRUSTED_SUBNET": "abcdef"}},
 		{vars: map[string]string{"TRUSTED_SUBNET": "10.0.0.0"}},
 		{vars: map[string]string{"TRUSTED_SUBNET": "10.0.0.0/500"}},
+		{vars: map[string]string{"TRUSTED_PROXIES": "10.0.0.1,abcdef"}},
+		{vars: map[string]string{"ACL": "write"}},
+		{vars: map[string]string{"ACL": "metrics=10.0.0.0/8"}},
+		{vars: map[string]string{"ACL": "read=!10.0.0.0/500"}},
+		{vars: map[string]string{"HISTORY_SIZE": "-1"}},
+		{vars: map[string]string{"STATSD_ADDRESS": "1.1.1.1"}},
+		{vars: map[string]string{"GRAPHITE_ADDRESS": "1.1.1.1"}},
+		{vars: map[string]string{"GRAPHITE_TEMPLATES": "host.region"}},
+		{vars: map[string]string{"API_KEYS_FILE": "/home/keys.json", "STATSD_ADDRESS": ":8125"}},
+		{vars: map[string]string{"API_KEYS_FILE": "/home/keys.json", "GRAPHITE_ADDRESS": ":2003"}},
+		{vars: map[string]string{"SIGN_WINDOW": "0s"}},
+		{vars: map[string]string{"HMAC_KEYS": "team1"}},
+		{vars: map[string]string{"HMAC_KEYS": "team1=k1,team1=k2", "HMAC_PRIMARY_KEY_ID": "team1"}},
+		{vars: map[string]string{"HMAC_KEYS": "team1=k1,team2=k2"}},
+		{vars: map[string]string{"HMAC_KEYS": "team1=k1", "HMAC_PRIMARY_KEY_ID": "team2"}},
+		{vars: map[string]string{"HMAC_PRIMARY_KEY_ID": "team2"}},
+		{vars: map[string]string{"HTTP_TLS_CERT": "/home/f"}},
+		{vars: map[string]string{"HTTP_TLS_CLIENT_CA": "/home/f"}},
+		{vars: map[string]string{"GRPC_SERVER_TLS_CLIENT_CA": "/home/f"}},
+		{vars: map[string]string{
+			"GRPC_SERVER_TLS_CERT": "/home/f",
+			"GRPC_SERVER_TLS_KEY":  "/home/f",
+			"GRPC_ALLOWED_CLIENTS": "agent1",
+		}},
 		{vars: map[string]string{
 			"GRPC_SERVER_TLS_CERT": "/home/f",
 			"GRPC_SERVER_TLS_KEY":  "",
@@ -235,6 +351,7 @@ func TestServerSettingsCastEnvError(t *testing.T) {
 	}{
 		{envVarName: "STORE_INTERVAL", envVarVal: "foobar"},
 		{envVarName: "RESTORE", envVarVal: "foobar"},
+		{envVarName: "HISTORY_SIZE", envVarVal: "foobar"},
 	} {
 		tt := tt
 		i := i
@@ -281,7 +398,7 @@ func TestServerSettingsWithConfigFile(t *testing.T) {
 
 	assert.Equal(t, "172.100.1.1", serverSettings.HTTPAddress.Host)
 	assert.Equal(t, 9090, serverSettings.HTTPAddress.Port)
-	assert.Nil(t, serverSettings.HmacKey)
+	assert.Nil(t, serverSettings.HmacKeys)
 	assert.Equal(t, 10*time.Second, serverSettings.PersistSettings.StoreInterval)
 	assert.Equal(t, "/tmp/devops-metrics-db.json", serverSettings.PersistSettings.StoreFile)
 	assert.Equal(t, "postgre:5444", serverSettings.DatabaseDsn)
@@ -308,24 +425,58 @@ func TestServerSettingsAllFromConfigFile(t *testing.T) {
 	cfgStoreFile := "/tmp/store"
 	cfgDatabaseDsn := "foobar"
 	cfgHmacKey := "hmac_key"
+	cfgHmacKeys := "team1=k1"
+	cfgHmacPrimaryKeyID := "team1"
+	cfgHTTPTLSCert := "/home/http.pem"
+	cfgHTTPTLSKey := "/home/http.key"
+	cfgHTTPTLSClientCA := "/home/ca.pem"
 	cfgPrivKey := "/tmp/id_rsa"
 	cfgTrustedSubnet := "10.0.0.0/16"
+	cfgTrustedProxies := "10.0.0.1"
+	cfgACL := "read=10.0.0.0/8"
+	cfgAPIKeysPath := "/tmp/keys.json"
 	cfgGRPCAddress := "10.0.0.0:5555"
 	cfgGRPCServerCert := "/home/srv.pem"
 	cfgGRPCServerKey := "/home/srv.key"
+	cfgGRPCClientCA := "/home/grpc-ca.pem"
+	cfgGRPCAllowedClients := "agent1"
+	cfgHistorySize := 10
+	cfgStatsDAddress := "0.0.0.0:8125"
+	cfgGraphiteAddress := "0.0.0.0:2003"
+	cfgGraphiteTemplates := "servers.* .host.measurement*,host.measurement"
+	cfgSignWindow := 2 * time.Minute
+	cfgSignRequired := true
+	cfgAllowUnauthIngest := true
 
 	tempCfg := configFile{
-		Address:           &cfgAddr,
-		Restore:           &cfgRestore,
-		StoreInterval:     &cfgStoreInt,
-		StoreFile:         &cfgStoreFile,
-		DatabaseDsn:       &cfgDatabaseDsn,
-		HmacKey:           &cfgHmacKey,
-		CryptoPrivKeyPath: &cfgPrivKey,
-		TrustedSubnet:     &cfgTrustedSubnet,
-		GRPCAddress:       &cfgGRPCAddress,
-		GRPCServerTLSCert: &cfgGRPCServerCert,
-		GRPCServerTLSKey:  &cfgGRPCServerKey,
+		Address:            &cfgAddr,
+		Restore:            &cfgRestore,
+		StoreInterval:      &cfgStoreInt,
+		StoreFile:          &cfgStoreFile,
+		DatabaseDsn:        &cfgDatabaseDsn,
+		HmacKey:            &cfgHmacKey,
+		HmacKeys:           &cfgHmacKeys,
+		HmacPrimaryKeyID:   &cfgHmacPrimaryKeyID,
+		HTTPTLSCert:        &cfgHTTPTLSCert,
+		HTTPTLSKey:         &cfgHTTPTLSKey,
+		HTTPTLSClientCA:    &cfgHTTPTLSClientCA,
+		CryptoPrivKeyPath:  &cfgPrivKey,
+		TrustedSubnet:      &cfgTrustedSubnet,
+		TrustedProxies:     &cfgTrustedProxies,
+		ACL:                &cfgACL,
+		APIKeysPath:        &cfgAPIKeysPath,
+		GRPCAddress:        &cfgGRPCAddress,
+		GRPCServerTLSCert:  &cfgGRPCServerCert,
+		GRPCServerTLSKey:   &cfgGRPCServerKey,
+		GRPCClientCA:       &cfgGRPCClientCA,
+		GRPCAllowedClients: &cfgGRPCAllowedClients,
+		HistorySize:        &cfgHistorySize,
+		StatsDAddress:      &cfgStatsDAddress,
+		GraphiteAddress:    &cfgGraphiteAddress,
+		GraphiteTemplates:  &cfgGraphiteTemplates,
+		SignWindow:         &cfgSignWindow,
+		SignRequired:       &cfgSignRequired,
+		AllowUnauthIngest:  &cfgAllowUnauthIngest,
 	}
 	assert.NoError(t, json.NewEncoder(fCfg).Encode(&tempCfg))
 
@@ -339,18 +490,40 @@ func TestServerSettingsAllFromConfigFile(t *testing.T) {
 
 	assert.Equal(t, "172.100.1.1", serverSettings.HTTPAddress.Host)
 	assert.Equal(t, 9090, serverSettings.HTTPAddress.Port)
-	assert.Equal(t, "hmac_key", *serverSettings.HmacKey)
+	assert.Equal(t, "k1", primaryHmacKey(serverSettings))
+	key, _ := serverSettings.HmacKeys.Get("default")
+	assert.Equal(t, "hmac_key", key)
+	assert.Equal(t, tlsconfig.ServerSettings{
+		CertPath: "/home/http.pem", KeyPath: "/home/http.key", ClientCACertPath: "/home/ca.pem",
+	}, *serverSettings.HTTPServerTLS)
 	assert.Equal(t, 100*time.Minute, serverSettings.PersistSettings.StoreInterval)
 	assert.Equal(t, "/tmp/store", serverSettings.PersistSettings.StoreFile)
 	assert.Equal(t, "foobar", serverSettings.DatabaseDsn)
 	assert.True(t, serverSettings.PersistSettings.Restore)
 	assert.Equal(t, "/tmp/id_rsa", *serverSettings.CryptoPrivKeyPath)
 	assert.Equal(t, getIPNet("10.0.0.0/16"), serverSettings.TrustedSubnet)
+	assert.Equal(t, []*net.IPNet{getIPNet("10.0.0.1/32")}, serverSettings.TrustedProxies)
+	assert.True(t, serverSettings.ACL.Allowed(acl.GroupRead, net.ParseIP("10.1.1.1")))
+	assert.False(t, serverSettings.ACL.Allowed(acl.GroupRead, net.ParseIP("1.1.1.1")))
+	assert.Equal(t, "/tmp/keys.json", *serverSettings.APIKeysPath)
 	assert.Equal(t, "10.0.0.0", serverSettings.GRPCAddress.Host)
 	assert.Equal(t, 5555, serverSettings.GRPCAddress.Port)
 	assert.Equal(t, gtls.TLSServerSettings{
-		ServerCertPath: "/home/srv.pem", ServerKeyPath: "/home/srv.key",
+		ServerCertPath: "/home/srv.pem", ServerKeyPath: "/home/srv.key", ClientCACertPath: "/home/grpc-ca.pem",
+		AllowedClients: []string{"agent1"},
 	}, *serverSettings.GRPCServerTLS)
+	assert.Equal(t, 10, serverSettings.HistorySettings.Size)
+	assert.Equal(t, "0.0.0.0", serverSettings.StatsDAddress.Host)
+	assert.Equal(t, 8125, serverSettings.StatsDAddress.Port)
+	assert.Equal(t, 2003, serverSettings.GraphiteAddress.Port)
+	assert.Len(t, serverSettings.GraphiteTemplates, 2)
+	assert.Equal(t, 2*time.Minute, serverSettings.SignWindow)
+	assert.True(t, serverSettings.SignRequired)
+}
+
+func primaryHmacKey(settings server.ServiceSettings) string {
+	_, key := settings.HmacKeys.Primary()
+	return key
 }
 
 func getIPNet(cidr string) *net.IPNet {
@@ -10,17 +10,22 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-type collectWorker interface {
-	getMetrics() (metric.Metrics, error)
-	collectCleanup()
+// CollectWorker gets metrics for Collector. Workers are made available for
+// agent with Register.
+type CollectWorker interface {
+	// GetMetrics returns current metrics, called every poll interval.
+	GetMetrics() (metric.Metrics, error)
+	// CollectCleanup is called after metrics are collected for publishing.
+	CollectCleanup()
 }
 
 // Collector is a base struct for different collectors.
 type Collector struct {
-	collectWorker
+	worker         CollectWorker
 	currentMetrics metric.Metrics
 	logger         *logrus.Logger
 	name           string
+	prefix         string
 	pollInterval   time.Duration
 	mu             sync.Mutex
 }
@@ -35,12 +40,13 @@ func (c *Collector) Start(ctx context.Context) {
 		case <-ticker.C:
 			c.mu.Lock()
 
-			metrics, err := c.getMetrics()
+			metrics, err := c.worker.GetMetrics()
 			if err != nil {
-				c.logger.Errorf("Collector [%s] failed to get runtime metrics: %v", c.name, err)
+				c.mu.Unlock()
+				c.logger.Errorf("Collector [%s] failed to get metrics: %v", c.name, err)
 				continue
 			}
-			c.currentMetrics = metrics
+			c.currentMetrics = c.withPrefix(metrics)
 
 			c.mu.Unlock()
 		case <-ctx.Done():
@@ -55,9 +61,30 @@ func (c *Collector) Collect() (metric.Metrics, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.collectCleanup()
+	c.worker.CollectCleanup()
 
 	c.logger.Debugf("Collector [%s] collected metrics: %+v", c.name, c.currentMetrics)
 
 	return c.currentMetrics, nil
 }
+
+func (c *Collector) withPrefix(metrics metric.Metrics) metric.Metrics {
+	if c.prefix == "" {
+		return metrics
+	}
+
+	prefixed := make(metric.Metrics, len(metrics))
+	for seriesID, value := range metrics {
+		name, labels, err := metric.ParseSeriesID(seriesID)
+		if err == nil {
+			name = c.prefix + name
+			err = metric.ValidateName(name)
+		}
+		if err != nil {
+			c.logger.Warnf("Collector [%s] skipped metric [%s]: %v", c.name, seriesID, err)
+			continue
+		}
+		prefixed[metric.SeriesID(name, labels)] = value
+	}
+	return prefixed
+}
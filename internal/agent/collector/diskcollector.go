@@ -0,0 +1,202 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// DiskCollectorName - registered name of DiskCollector.
+const DiskCollectorName = "disk"
+
+var _defaultExcludeFsTypes = []string{"tmpfs", "devtmpfs", "overlay", "squashfs"}
+
+// DiskCollectorOptions - options of DiskCollector. Empty include list
+// includes all, exclude list is applied after include list. Mount points are
+// matched with path.Match patterns. Not set ExcludeFsTypes means default
+// list of virtual filesystems.
+type DiskCollectorOptions struct {
+	IncludeFsTypes     []string `json:"include_fs_types"`
+	ExcludeFsTypes     []string `json:"exclude_fs_types"`
+	IncludeMountPoints []string `json:"include_mount_points"`
+	ExcludeMountPoints []string `json:"exclude_mount_points"`
+}
+
+// DiskCollector is a collector for filesystems usage and disk IO metrics.
+// IO bytes and operations are reported as counters since previous collect,
+// IOPS are rates between polls. IO metrics are reported only for devices
+// of filesystems, which pass filters.
+type DiskCollector struct {
+	options DiskCollectorOptions
+
+	partitions func(all bool) ([]disk.PartitionStat, error)
+	usage      func(path string) (*disk.UsageStat, error)
+	ioCounters func(names ...string) (map[string]disk.IOCountersStat, error)
+	now        func() time.Time
+
+	// baseline - IO counters at previous collect
+	baseline map[string]disk.IOCountersStat
+	// reported - IO counters of metrics, returned by previous poll
+	reported map[string]disk.IOCountersStat
+	// last - IO counters at previous poll
+	last     map[string]disk.IOCountersStat
+	lastTime time.Time
+}
+
+var _ CollectWorker = (*DiskCollector)(nil)
+
+func init() {
+	RegisterOptIn(DiskCollectorName, func(options json.RawMessage) (CollectWorker, error) {
+		return NewDiskCollector(options)
+	})
+}
+
+// NewDiskCollector creates new DiskCollector with options from config.
+func NewDiskCollector(options json.RawMessage) (*DiskCollector, error) {
+	var opts DiskCollectorOptions
+	if options != nil {
+		if err := json.Unmarshal(options, &opts); err != nil {
+			return nil, fmt.Errorf("wrong disk collector options: %w", err)
+		}
+	}
+	if opts.ExcludeFsTypes == nil {
+		opts.ExcludeFsTypes = _defaultExcludeFsTypes
+	}
+
+	for _, pattern := range append(opts.IncludeMountPoints, opts.ExcludeMountPoints...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("wrong disk collector mount point pattern [%s]: %w", pattern, err)
+		}
+	}
+
+	return &DiskCollector{
+		options:    opts,
+		partitions: disk.Partitions,
+		usage:      disk.Usage,
+		ioCounters: disk.IOCounters,
+		now:        time.Now,
+		baseline:   make(map[string]disk.IOCountersStat),
+	}, nil
+}
+
+func (dc *DiskCollector) GetMetrics() (metric.Metrics, error) {
+	partitions, err := dc.partitions(true)
+	if err != nil {
+		return nil, err
+	}
+
+	resultMetrics := make(metric.Metrics)
+	devices := make(map[string]bool)
+
+	for _, partition := range partitions {
+		if !dc.options.match(partition) {
+			continue
+		}
+
+		usage, err := dc.usage(partition.Mountpoint)
+		// Skip unavailable and pseudo filesystems
+		if err != nil || usage.Total == 0 {
+			continue
+		}
+
+		labels := metric.Labels{"mountpoint": partition.Mountpoint, "fstype": partition.Fstype}
+		resultMetrics[metric.SeriesID("DiskTotal", labels)] = metric.Gauge(usage.Total)
+		resultMetrics[metric.SeriesID("DiskUsed", labels)] = metric.Gauge(usage.Used)
+		resultMetrics[metric.SeriesID("DiskFree", labels)] = metric.Gauge(usage.Free)
+		resultMetrics[metric.SeriesID("DiskInodesTotal", labels)] = metric.Gauge(usage.InodesTotal)
+		resultMetrics[metric.SeriesID("DiskInodesUsed", labels)] = metric.Gauge(usage.InodesUsed)
+		resultMetrics[metric.SeriesID("DiskInodesFree", labels)] = metric.Gauge(usage.InodesFree)
+
+		devices[filepath.Base(partition.Device)] = true
+	}
+
+	counters, err := dc.ioCounters()
+	if err != nil {
+		return nil, err
+	}
+
+	now := dc.now()
+	reported := make(map[string]disk.IOCountersStat)
+	for name, cur := range counters {
+		if !devices[name] && !devices[cur.Label] {
+			continue
+		}
+
+		// Counters are reset on device reattach
+		base, ok := dc.baseline[name]
+		if !ok || !ioCountersIncreased(base, cur) {
+			base = cur
+			dc.baseline[name] = cur
+		}
+
+		reported[name] = cur
+
+		labels := metric.Labels{"device": name}
+		resultMetrics[metric.SeriesID("DiskReadBytes", labels)] = metric.Counter(cur.ReadBytes - base.ReadBytes)
+		resultMetrics[metric.SeriesID("DiskWriteBytes", labels)] = metric.Counter(cur.WriteBytes - base.WriteBytes)
+		resultMetrics[metric.SeriesID("DiskReads", labels)] = metric.Counter(cur.ReadCount - base.ReadCount)
+		resultMetrics[metric.SeriesID("DiskWrites", labels)] = metric.Counter(cur.WriteCount - base.WriteCount)
+
+		prev, ok := dc.last[name]
+		if ok && ioCountersIncreased(prev, cur) && now.After(dc.lastTime) {
+			elapsed := now.Sub(dc.lastTime).Seconds()
+			resultMetrics[metric.SeriesID("DiskReadIOPS", labels)] = metric.Gauge(float64(cur.ReadCount-prev.ReadCount) / elapsed)
+			resultMetrics[metric.SeriesID("DiskWriteIOPS", labels)] = metric.Gauge(float64(cur.WriteCount-prev.WriteCount) / elapsed)
+		}
+	}
+
+	dc.reported = reported
+	dc.last, dc.lastTime = counters, now
+
+	return resultMetrics, nil
+}
+
+// CollectCleanup moves baseline to IO counters of collected metrics.
+func (dc *DiskCollector) CollectCleanup() {
+	for name, cur := range dc.reported {
+		dc.baseline[name] = cur
+	}
+}
+
+func (o DiskCollectorOptions) match(partition disk.PartitionStat) bool {
+	if len(o.IncludeFsTypes) > 0 && !containsString(o.IncludeFsTypes, partition.Fstype) {
+		return false
+	}
+	if containsString(o.ExcludeFsTypes, partition.Fstype) {
+		return false
+	}
+	if len(o.IncludeMountPoints) > 0 && !matchPath(o.IncludeMountPoints, partition.Mountpoint) {
+		return false
+	}
+	return !matchPath(o.ExcludeMountPoints, partition.Mountpoint)
+}
+
+func ioCountersIncreased(prev, cur disk.IOCountersStat) bool {
+	return cur.ReadBytes >= prev.ReadBytes &&
+		cur.WriteBytes >= prev.WriteBytes &&
+		cur.ReadCount >= prev.ReadCount &&
+		cur.WriteCount >= prev.WriteCount
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPath(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
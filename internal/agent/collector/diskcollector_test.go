@@ -0,0 +1,187 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDiskCollector(t *testing.T, options string, counters *map[string]disk.IOCountersStat, now *time.Time) *DiskCollector {
+	var opts json.RawMessage
+	if options != "" {
+		opts = json.RawMessage(options)
+	}
+	dc, err := NewDiskCollector(opts)
+	require.NoError(t, err)
+
+	dc.partitions = func(bool) ([]disk.PartitionStat, error) {
+		return []disk.PartitionStat{
+			{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+			{Device: "/dev/sdb1", Mountpoint: "/data", Fstype: "xfs"},
+			{Device: "tmpfs", Mountpoint: "/run", Fstype: "tmpfs"},
+			{Device: "overlay", Mountpoint: "/var/lib/docker/overlay2/x/merged", Fstype: "overlay"},
+			{Device: "proc", Mountpoint: "/proc", Fstype: "proc"},
+		}, nil
+	}
+	dc.usage = func(path string) (*disk.UsageStat, error) {
+		if path == "/proc" {
+			return &disk.UsageStat{}, nil
+		}
+		return &disk.UsageStat{Total: 100, Used: 40, Free: 60, InodesTotal: 10, InodesUsed: 1, InodesFree: 9}, nil
+	}
+	dc.ioCounters = func(...string) (map[string]disk.IOCountersStat, error) { return *counters, nil }
+	dc.now = func() time.Time { return *now }
+	return dc
+}
+
+func diskMountPoints(metrics metric.Metrics) []string {
+	var mountPoints []string
+	for seriesID := range metrics {
+		name, labels, _ := metric.ParseSeriesID(seriesID)
+		if name == "DiskTotal" {
+			mountPoints = append(mountPoints, labels["mountpoint"])
+		}
+	}
+	return mountPoints
+}
+
+func TestDiskCollectorUsage(t *testing.T) {
+	counters := map[string]disk.IOCountersStat{}
+	now := time.Now()
+
+	for _, tt := range []struct {
+		name        string
+		options     string
+		mountPoints []string
+	}{
+		{name: "default", mountPoints: []string{"/", "/data"}},
+		{name: "include fs types", options: `{"include_fs_types": ["xfs"]}`, mountPoints: []string{"/data"}},
+		{name: "exclude fs types", options: `{"exclude_fs_types": ["ext4"]}`, mountPoints: []string{"/data", "/run", "/var/lib/docker/overlay2/x/merged"}},
+		{name: "include mount points", options: `{"include_mount_points": ["/", "/run"]}`, mountPoints: []string{"/"}},
+		{name: "exclude mount points", options: `{"exclude_fs_types": [], "exclude_mount_points": ["/var/lib/docker/*/*/*", "/run"]}`, mountPoints: []string{"/", "/data"}},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dc := newTestDiskCollector(t, tt.options, &counters, &now)
+			metrics, err := dc.GetMetrics()
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.mountPoints, diskMountPoints(metrics))
+		})
+	}
+
+	dc := newTestDiskCollector(t, "", &counters, &now)
+	metrics, err := dc.GetMetrics()
+	require.NoError(t, err)
+	labels := metric.Labels{"mountpoint": "/data", "fstype": "xfs"}
+	assert.Equal(t, metric.Gauge(100), metrics[metric.SeriesID("DiskTotal", labels)])
+	assert.Equal(t, metric.Gauge(40), metrics[metric.SeriesID("DiskUsed", labels)])
+	assert.Equal(t, metric.Gauge(60), metrics[metric.SeriesID("DiskFree", labels)])
+	assert.Equal(t, metric.Gauge(10), metrics[metric.SeriesID("DiskInodesTotal", labels)])
+	assert.Equal(t, metric.Gauge(1), metrics[metric.SeriesID("DiskInodesUsed", labels)])
+	assert.Equal(t, metric.Gauge(9), metrics[metric.SeriesID("DiskInodesFree", labels)])
+}
+
+func TestDiskCollectorIO(t *testing.T) {
+	counters := map[string]disk.IOCountersStat{
+		"sda1":  {ReadBytes: 1000, WriteBytes: 2000, ReadCount: 10, WriteCount: 20},
+		"loop0": {ReadBytes: 1000, WriteBytes: 2000, ReadCount: 10, WriteCount: 20},
+	}
+	now := time.Now()
+	dc := newTestDiskCollector(t, `{"include_mount_points": ["/"]}`, &counters, &now)
+	sda1 := metric.Labels{"device": "sda1"}
+
+	// First poll sets baseline
+	metrics, err := dc.GetMetrics()
+	require.NoError(t, err)
+	assert.Equal(t, metric.Counter(0), metrics[metric.SeriesID("DiskReadBytes", sda1)])
+	assert.NotContains(t, metrics, metric.SeriesID("DiskReadIOPS", sda1))
+	assert.NotContains(t, metrics, metric.SeriesID("DiskReadBytes", metric.Labels{"device": "loop0"}))
+
+	// Counters accumulate until collect, IOPS are rates between polls
+	for i := 1; i <= 2; i++ {
+		now = now.Add(2 * time.Second)
+		counters = map[string]disk.IOCountersStat{
+			"sda1": {ReadBytes: 1000 + uint64(i)*100, WriteBytes: 2000 + uint64(i)*200, ReadCount: 10 + uint64(i)*4, WriteCount: 20 + uint64(i)*8},
+		}
+		metrics, err = dc.GetMetrics()
+		require.NoError(t, err)
+	}
+	assert.Equal(t, metric.Counter(200), metrics[metric.SeriesID("DiskReadBytes", sda1)])
+	assert.Equal(t, metric.Counter(400), metrics[metric.SeriesID("DiskWriteBytes", sda1)])
+	assert.Equal(t, metric.Counter(8), metrics[metric.SeriesID("DiskReads", sda1)])
+	assert.Equal(t, metric.Counter(16), metrics[metric.SeriesID("DiskWrites", sda1)])
+	assert.Equal(t, metric.Gauge(2), metrics[metric.SeriesID("DiskReadIOPS", sda1)])
+	assert.Equal(t, metric.Gauge(4), metrics[metric.SeriesID("DiskWriteIOPS", sda1)])
+
+	// Collect resets counters
+	dc.CollectCleanup()
+	now = now.Add(time.Second)
+	counters = map[string]disk.IOCountersStat{
+		"sda1": {ReadBytes: 1300, WriteBytes: 2400, ReadCount: 18, WriteCount: 36},
+	}
+	metrics, err = dc.GetMetrics()
+	require.NoError(t, err)
+	assert.Equal(t, metric.Counter(100), metrics[metric.SeriesID("DiskReadBytes", sda1)])
+	assert.Equal(t, metric.Counter(0), metrics[metric.SeriesID("DiskWriteBytes", sda1)])
+
+	// Counters reset on device reattach
+	now = now.Add(time.Second)
+	counters = map[string]disk.IOCountersStat{
+		"sda1": {ReadBytes: 50, WriteBytes: 50, ReadCount: 1, WriteCount: 1},
+	}
+	metrics, err = dc.GetMetrics()
+	require.NoError(t, err)
+	assert.Equal(t, metric.Counter(0), metrics[metric.SeriesID("DiskReadBytes", sda1)])
+	assert.NotContains(t, metrics, metric.SeriesID("DiskReadIOPS", sda1))
+}
+
+func TestDiskCollectorCollectBaseline(t *testing.T) {
+	counters := map[string]disk.IOCountersStat{"sda1": {ReadBytes: 1000}}
+	now := time.Now()
+	dc := newTestDiskCollector(t, `{"include_mount_points": ["/"]}`, &counters, &now)
+	partitions := dc.partitions
+	sda1 := metric.Labels{"device": "sda1"}
+
+	_, err := dc.GetMetrics()
+	require.NoError(t, err)
+	counters = map[string]disk.IOCountersStat{"sda1": {ReadBytes: 1100}}
+	metrics, err := dc.GetMetrics()
+	require.NoError(t, err)
+	assert.Equal(t, metric.Counter(100), metrics[metric.SeriesID("DiskReadBytes", sda1)])
+	dc.CollectCleanup()
+
+	// Baseline is counters of collected metrics, not of later polls
+	dc.partitions = func(bool) ([]disk.PartitionStat, error) { return nil, nil }
+	counters = map[string]disk.IOCountersStat{"sda1": {ReadBytes: 1200}}
+	metrics, err = dc.GetMetrics()
+	require.NoError(t, err)
+	assert.NotContains(t, metrics, metric.SeriesID("DiskReadBytes", sda1))
+	dc.CollectCleanup()
+
+	dc.partitions = partitions
+	counters = map[string]disk.IOCountersStat{"sda1": {ReadBytes: 1300}}
+	metrics, err = dc.GetMetrics()
+	require.NoError(t, err)
+	assert.Equal(t, metric.Counter(200), metrics[metric.SeriesID("DiskReadBytes", sda1)])
+}
+
+func TestDiskCollectorError(t *testing.T) {
+	_, err := NewDiskCollector(json.RawMessage(`{"include_fs_types": "ext4"}`))
+	assert.Error(t, err)
+
+	_, err = NewDiskCollector(json.RawMessage(`{"exclude_mount_points": ["/run/["]}`))
+	assert.Error(t, err)
+
+	counters := map[string]disk.IOCountersStat{}
+	now := time.Now()
+	dc := newTestDiskCollector(t, "", &counters, &now)
+	dc.ioCounters = func(...string) (map[string]disk.IOCountersStat, error) { return nil, errors.New("failed") }
+	_, err = dc.GetMetrics()
+	assert.Error(t, err)
+}
@@ -1,31 +1,29 @@
 package collector
 
 import (
-	"fmt"
-	"time"
+	"encoding/json"
+	"strconv"
 
 	"github.com/devldavydov/promytheus/internal/common/metric"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/mem"
-	"github.com/sirupsen/logrus"
 )
 
+// PsUtilCollectorName - registered name of PsUtilCollector.
+const PsUtilCollectorName = "psutil"
+
 // PsUtilCollector is a collector for gopsutil metrics.
 type PsUtilCollector struct{}
 
-var _ collectWorker = (*PsUtilCollector)(nil)
+var _ CollectWorker = (*PsUtilCollector)(nil)
 
-// NewPsUtilCollector creates new PsUtilCollector.
-func NewPsUtilCollector(pollInterval time.Duration, logger *logrus.Logger) *Collector {
-	return &Collector{
-		collectWorker: &PsUtilCollector{},
-		name:          "PsUtilCollector",
-		pollInterval:  pollInterval,
-		logger:        logger,
-	}
+func init() {
+	Register(PsUtilCollectorName, func(json.RawMessage) (CollectWorker, error) {
+		return &PsUtilCollector{}, nil
+	})
 }
 
-func (pc *PsUtilCollector) getMetrics() (metric.Metrics, error) {
+func (pc *PsUtilCollector) GetMetrics() (metric.Metrics, error) {
 	memStats, err := mem.VirtualMemory()
 	if err != nil {
 		return nil, err
@@ -56,10 +54,11 @@ func (pc *PsUtilCollector) updateWithCPUUtilization(resultMetrics metric.Metrics
 	}
 
 	for i, cpu := range cpusTimes {
-		resultMetrics[fmt.Sprintf("CPUutilization%d", i)] = metric.Gauge(calcUtilization(cpu))
+		seriesID := metric.SeriesID("CPUutilization", metric.Labels{"cpu": strconv.Itoa(i)})
+		resultMetrics[seriesID] = metric.Gauge(calcUtilization(cpu))
 	}
 
 	return nil
 }
 
-func (pc *PsUtilCollector) collectCleanup() {}
+func (pc *PsUtilCollector) CollectCleanup() {}
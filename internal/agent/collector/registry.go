@@ -0,0 +1,114 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WorkerFactory creates collect worker with collector options from config.
+type WorkerFactory func(options json.RawMessage) (CollectWorker, error)
+
+// Settings - settings of collector.
+type Settings struct {
+	Enabled      bool
+	PollInterval time.Duration
+	// Prefix - prefix for names of collected metrics.
+	Prefix string
+	// Options - collector specific options, passed to worker factory.
+	Options json.RawMessage
+}
+
+type registration struct {
+	factory WorkerFactory
+	optIn   bool
+}
+
+var (
+	_registryMu sync.RWMutex
+	_registry   = make(map[string]registration)
+)
+
+// Register makes collect worker available by name. Register is usually called
+// from init function of package with worker, it panics if name is already
+// registered.
+func Register(name string, factory WorkerFactory) {
+	register(name, factory, false)
+}
+
+// RegisterOptIn makes collect worker available by name like Register, but
+// collector is disabled unless it is enabled in config.
+func RegisterOptIn(name string, factory WorkerFactory) {
+	register(name, factory, true)
+}
+
+func register(name string, factory WorkerFactory, optIn bool) {
+	_registryMu.Lock()
+	defer _registryMu.Unlock()
+
+	if factory == nil {
+		panic("collector: Register factory is nil")
+	}
+	if _, dup := _registry[name]; dup {
+		panic("collector: Register called twice for collector " + name)
+	}
+	_registry[name] = registration{factory: factory, optIn: optIn}
+}
+
+// Registered returns sorted names of registered collectors.
+func Registered() []string {
+	_registryMu.RLock()
+	defer _registryMu.RUnlock()
+
+	names := make([]string, 0, len(_registry))
+	for name := range _registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsRegistered checks that collector with name is registered.
+func IsRegistered(name string) bool {
+	_registryMu.RLock()
+	defer _registryMu.RUnlock()
+
+	_, ok := _registry[name]
+	return ok
+}
+
+// IsOptIn checks that collector with name is registered with RegisterOptIn.
+func IsOptIn(name string) bool {
+	_registryMu.RLock()
+	defer _registryMu.RUnlock()
+
+	return _registry[name].optIn
+}
+
+// New creates collector with registered worker.
+func New(name string, settings Settings, logger *logrus.Logger) (*Collector, error) {
+	_registryMu.RLock()
+	reg, ok := _registry[name]
+	_registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown collector: %s", name)
+	}
+
+	worker, err := reg.factory(settings.Options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create collector [%s]: %w", name, err)
+	}
+
+	return &Collector{
+		worker:       worker,
+		name:         name,
+		prefix:       settings.Prefix,
+		pollInterval: settings.PollInterval,
+		logger:       logger,
+	}, nil
+}
@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testWorker struct {
+	value float64
+}
+
+func (w *testWorker) GetMetrics() (metric.Metrics, error) {
+	return metric.Metrics{
+		"Value": metric.Gauge(w.value),
+		metric.SeriesID("Labeled", metric.Labels{"a": "b"}): metric.Gauge(w.value),
+	}, nil
+}
+
+func (w *testWorker) CollectCleanup() {}
+
+func init() {
+	Register("test", func(options json.RawMessage) (CollectWorker, error) {
+		w := &testWorker{}
+		if options != nil {
+			if err := json.Unmarshal(options, &w.value); err != nil {
+				return nil, err
+			}
+		}
+		return w, nil
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	assert.Equal(t, []string{DiskCollectorName, PsUtilCollectorName, RuntimeCollectorName, "test"}, Registered())
+	assert.True(t, IsRegistered("test"))
+	assert.False(t, IsRegistered("foobar"))
+	assert.True(t, IsOptIn(DiskCollectorName))
+	assert.False(t, IsOptIn(RuntimeCollectorName))
+	assert.False(t, IsOptIn("foobar"))
+
+	assert.Panics(t, func() {
+		Register("test", func(json.RawMessage) (CollectWorker, error) { return &testWorker{}, nil })
+	})
+
+	_, err := New("foobar", Settings{PollInterval: time.Second}, logrus.New())
+	assert.Error(t, err)
+
+	_, err = New("test", Settings{PollInterval: time.Second, Options: json.RawMessage(`"foo"`)}, logrus.New())
+	assert.Error(t, err)
+}
+
+func TestCollectorPrefix(t *testing.T) {
+	clctr, err := New("test", Settings{
+		PollInterval: 10 * time.Millisecond,
+		Prefix:       "test_",
+		Options:      json.RawMessage(`1.5`),
+	}, logrus.New())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		clctr.Start(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		metrics, err := clctr.Collect()
+		return err == nil && len(metrics) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	metrics, err := clctr.Collect()
+	require.NoError(t, err)
+	assert.Equal(t, metric.Metrics{
+		"test_Value": metric.Gauge(1.5),
+		metric.SeriesID("test_Labeled", metric.Labels{"a": "b"}): metric.Gauge(1.5),
+	}, metrics)
+
+	cancel()
+	<-done
+}
+
+func TestCollectorPrefixWrongName(t *testing.T) {
+	clctr := &Collector{name: "test", prefix: "test_", logger: logrus.New()}
+
+	assert.Equal(t, metric.Metrics{
+		metric.SeriesID("test_Labeled", metric.Labels{"a": "b"}): metric.Gauge(1),
+	}, clctr.withPrefix(metric.Metrics{
+		metric.SeriesID("Labeled", metric.Labels{"a": "b"}): metric.Gauge(1),
+		"bad.name":    metric.Gauge(2),
+		"bad{a=\"b\"": metric.Gauge(3),
+	}))
+}
+
+type failingWorker struct{}
+
+func (w failingWorker) GetMetrics() (metric.Metrics, error) { return nil, errors.New("failed") }
+
+func (w failingWorker) CollectCleanup() {}
+
+func TestCollectorWorkerError(t *testing.T) {
+	clctr := &Collector{worker: failingWorker{}, name: "failing", pollInterval: time.Millisecond, logger: logrus.New()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	clctr.Start(ctx)
+
+	// Collector is not locked after worker error
+	metrics, err := clctr.Collect()
+	assert.NoError(t, err)
+	assert.Nil(t, metrics)
+}
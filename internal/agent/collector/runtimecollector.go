@@ -1,32 +1,30 @@
 package collector
 
 import (
+	"encoding/json"
 	"math/rand"
 	"runtime"
-	"time"
 
 	"github.com/devldavydov/promytheus/internal/common/metric"
-	"github.com/sirupsen/logrus"
 )
 
+// RuntimeCollectorName - registered name of RuntimeCollector.
+const RuntimeCollectorName = "runtime"
+
 // RuntimeCollector is a collector for runtime metrics.
 type RuntimeCollector struct {
 	pollCnt int64
 }
 
-var _ collectWorker = (*RuntimeCollector)(nil)
+var _ CollectWorker = (*RuntimeCollector)(nil)
 
-// NewRuntimeCollector creates new RuntimeCollector.
-func NewRuntimeCollector(pollInterval time.Duration, logger *logrus.Logger) *Collector {
-	return &Collector{
-		collectWorker: &RuntimeCollector{pollCnt: 0},
-		name:          "RuntimeCollector",
-		pollInterval:  pollInterval,
-		logger:        logger,
-	}
+func init() {
+	Register(RuntimeCollectorName, func(json.RawMessage) (CollectWorker, error) {
+		return &RuntimeCollector{pollCnt: 0}, nil
+	})
 }
 
-func (rc *RuntimeCollector) getMetrics() (metric.Metrics, error) {
+func (rc *RuntimeCollector) GetMetrics() (metric.Metrics, error) {
 	rc.pollCnt += 1
 	memStats := runtime.MemStats{}
 	runtime.ReadMemStats(&memStats)
@@ -64,6 +62,6 @@ func (rc *RuntimeCollector) getMetrics() (metric.Metrics, error) {
 	}, nil
 }
 
-func (rc *RuntimeCollector) collectCleanup() {
+func (rc *RuntimeCollector) CollectCleanup() {
 	rc.pollCnt = 0
 }
@@ -12,12 +12,15 @@ import (
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
 // GRPCPublisher is a gRPC metric publisher.
 type GRPCPublisher struct {
-	serverAddress        nettools.Address
+	servers              *ServerPool
 	hmacKey              *string
+	hmacKeyID            string
+	apiKey               *string
 	metricsChan          <-chan metric.Metrics
 	logger               *logrus.Logger
 	failedCounterMetrics metric.Metrics
@@ -25,11 +28,12 @@ type GRPCPublisher struct {
 	threadID             int
 	shutdownTimeout      time.Duration
 	tlsCredentials       credentials.TransportCredentials
+	spool                *Spool
 }
 
 // GRPCPublisher constructor.
 func NewGRPCPublisher(
-	serverAddress nettools.Address,
+	servers *ServerPool,
 	metricsChan <-chan metric.Metrics,
 	threadID int,
 	logger *logrus.Logger,
@@ -41,13 +45,16 @@ func NewGRPCPublisher(
 	}
 
 	return &GRPCPublisher{
-		serverAddress:   serverAddress,
+		servers:         servers,
 		hmacKey:         extra.HmacKey,
+		hmacKeyID:       extra.HmacKeyID,
+		apiKey:          extra.APIKey,
 		metricsChan:     metricsChan,
 		threadID:        threadID,
 		shutdownTimeout: shutdownTimeout,
 		hostIP:          extra.HostIP.String(),
 		tlsCredentials:  extra.EncrSettings.TLSCredentials,
+		spool:           extra.Spool,
 		logger:          logger,
 	}
 }
@@ -68,21 +75,30 @@ func (g *GRPCPublisher) processMetrics(metricsList []metric.Metrics) {
 
 	metricReq := make([]metric.MetricsDTO, 0, totalMetrics(metricsList))
 
-	iterateMetrics(metricsList, func(name string, value metric.MetricValue) {
-		metricReq = append(metricReq, prepareMetric(name, value, g.hmacKey))
+	iterateMetrics(metricsList, func(seriesID string, value metric.MetricValue) {
+		mReq, err := prepareMetric(seriesID, value, g.hmacKey)
+		if err != nil {
+			g.logger.Errorf("gRPC publisher[%d] skipped metric [%s]: %v", g.threadID, seriesID, err)
+			return
+		}
+		metricReq = append(metricReq, mReq)
 
 		if value.TypeName() == metric.CounterTypeName {
-			curVal, ok := counterMetricsToSend[name]
+			curVal, ok := counterMetricsToSend[seriesID]
 			if !ok {
-				counterMetricsToSend[name] = value
+				counterMetricsToSend[seriesID] = value
 			} else {
-				counterMetricsToSend[name] = curVal.(metric.Counter) + value.(metric.Counter)
+				counterMetricsToSend[seriesID] = curVal.(metric.Counter) + value.(metric.Counter)
 			}
 		}
 	})
 
-	if err := g.publishMetrics(metricReq); err != nil {
+	spooled, err := g.spool.Send(metricReq, g.publish)
+	if err != nil {
 		g.logger.Errorf("gRPC publisher[%d] failed to publish: %v", g.threadID, err)
+	}
+	// Spooled counters are replayed from spool, not retryable are dropped
+	if err != nil && !spooled && IsRetryable(err) {
 		g.failedCounterMetrics = counterMetricsToSend
 		return
 	}
@@ -90,15 +106,40 @@ func (g *GRPCPublisher) processMetrics(metricsList []metric.Metrics) {
 	g.failedCounterMetrics = nil
 }
 
-func (g *GRPCPublisher) publishMetrics(metricReq []metric.MetricsDTO) error {
-	opts := []grpc.DialOption{grpc.WithUnaryInterceptor(interceptor.NewGzipClientInterceptor().Handle)}
+// publish publishes metrics to servers pool.
+func (g *GRPCPublisher) publish(metricReq []metric.MetricsDTO) error {
+	return g.servers.Publish(
+		func(serverAddress nettools.Address) error {
+			return g.publishMetrics(serverAddress, metricReq)
+		},
+		g.ping)
+}
+
+func (g *GRPCPublisher) dial(serverAddress nettools.Address) (*grpc.ClientConn, error) {
+	interceptors := []grpc.UnaryClientInterceptor{interceptor.NewGzipClientInterceptor().Handle}
+	if g.hmacKey != nil {
+		interceptors = append(interceptors, interceptor.NewSignatureClientInterceptor(*g.hmacKey, g.hmacKeyID).Handle)
+	}
+	if g.apiKey != nil {
+		interceptors = append(interceptors, interceptor.NewAPIKeyClientInterceptor(*g.apiKey).Handle)
+	}
+
+	opts := []grpc.DialOption{grpc.WithChainUnaryInterceptor(interceptors...)}
 	if g.tlsCredentials != nil {
 		opts = append([]grpc.DialOption{grpc.WithTransportCredentials(g.tlsCredentials)}, opts...)
 	}
 
-	conn, err := grpc.Dial(g.serverAddress.String(), opts...)
+	conn, err := grpc.Dial(serverAddress.String(), opts...)
 	if err != nil {
-		return fmt.Errorf("gRPC publisher[%d] failed to create connection: %w", g.threadID, err)
+		return nil, fmt.Errorf("gRPC publisher[%d] failed to create connection: %w", g.threadID, err)
+	}
+	return conn, nil
+}
+
+func (g *GRPCPublisher) publishMetrics(serverAddress nettools.Address, metricReq []metric.MetricsDTO) error {
+	conn, err := g.dial(serverAddress)
+	if err != nil {
+		return err
 	}
 	defer conn.Close()
 
@@ -108,7 +149,7 @@ func (g *GRPCPublisher) publishMetrics(metricReq []metric.MetricsDTO) error {
 
 	updMetrics := make([]*pb.Metric, 0, len(metricReq))
 	for _, mReq := range metricReq {
-		updMetric := &pb.Metric{Id: mReq.ID}
+		updMetric := &pb.Metric{Id: mReq.ID, Labels: mReq.Labels}
 		if mReq.Hash != nil {
 			updMetric.Hash = *mReq.Hash
 		}
@@ -119,6 +160,24 @@ func (g *GRPCPublisher) publishMetrics(metricReq []metric.MetricsDTO) error {
 		} else if mReq.MType == metric.GaugeTypeName {
 			updMetric.Type = pb.MetricType_GAUGE
 			updMetric.Value = *mReq.Value
+		} else if mReq.MType == metric.HistogramTypeName {
+			updMetric.Type = pb.MetricType_HISTOGRAM
+			updMetric.Histogram = &pb.Histogram{
+				Bounds:  mReq.Bounds,
+				Buckets: mReq.Buckets,
+				Sum:     *mReq.Sum,
+				Count:   *mReq.Count,
+			}
+		} else if mReq.MType == metric.SummaryTypeName {
+			updMetric.Type = pb.MetricType_SUMMARY
+			updMetric.Summary = &pb.Summary{
+				Alpha:    mReq.Sketch.Alpha,
+				Positive: mReq.Sketch.Positive,
+				Negative: mReq.Sketch.Negative,
+				Zero:     mReq.Sketch.Zero,
+				Sum:      *mReq.Sum,
+				Count:    *mReq.Count,
+			}
 		}
 
 		updMetrics = append(updMetrics, updMetric)
@@ -126,12 +185,33 @@ func (g *GRPCPublisher) publishMetrics(metricReq []metric.MetricsDTO) error {
 
 	_, err = clnt.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: updMetrics})
 	if err != nil {
-		return fmt.Errorf("gRPC publisher[%d] failed to publish metrics: %w", g.threadID, err)
+		return grpcStatusError(g.threadID, err)
 	}
 
 	return nil
 }
 
+// ping checks server health with health service Check call.
+func (g *GRPCPublisher) ping(serverAddress nettools.Address) error {
+	conn, err := g.dial(serverAddress)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), _defaultPingTimeout)
+	defer cancel()
+
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		return grpcStatusError(g.threadID, err)
+	}
+	if resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		return fmt.Errorf("publisher[%d] server is not serving: %s", g.threadID, resp.Status)
+	}
+	return nil
+}
+
 func (g *GRPCPublisher) shutdown() {
 	if g.failedCounterMetrics == nil {
 		return
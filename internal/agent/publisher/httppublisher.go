@@ -10,7 +10,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/devldavydov/promytheus/internal/common/apikey"
 	"github.com/devldavydov/promytheus/internal/common/cipher"
+	"github.com/devldavydov/promytheus/internal/common/hash"
 	_http "github.com/devldavydov/promytheus/internal/common/http"
 	"github.com/devldavydov/promytheus/internal/common/iotools"
 	"github.com/devldavydov/promytheus/internal/common/metric"
@@ -24,8 +26,13 @@ const (
 
 // HTTPPublisher is a HTTP metric publisher.
 type HTTPPublisher struct {
-	serverAddress        nettools.Address
+	servers              *ServerPool
+	scheme               string
 	hmacKey              *string
+	hmacKeyID            string
+	apiKey               *string
+	encrypted            bool
+	cryptoKeyID          string
 	httpClient           *http.Client
 	metricsChan          <-chan metric.Metrics
 	logger               *logrus.Logger
@@ -34,11 +41,12 @@ type HTTPPublisher struct {
 	hostIP               string
 	threadID             int
 	shutdownTimeout      time.Duration
+	spool                *Spool
 }
 
 // NewHTTPPublisher creates new HTTPPublisher.
 func NewHTTPPublisher(
-	serverAddress nettools.Address,
+	servers *ServerPool,
 	metricsChan <-chan metric.Metrics,
 	threadID int,
 	logger *logrus.Logger,
@@ -48,6 +56,14 @@ func NewHTTPPublisher(
 		Timeout: _httpClientTimeout,
 	}
 
+	scheme := "http"
+	if extra.EncrSettings.HTTPTLSConfig != nil {
+		scheme = "https"
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = extra.EncrSettings.HTTPTLSConfig
+		client.Transport = transport
+	}
+
 	bufPool := &sync.Pool{
 		New: func() any {
 			if extra.EncrSettings.CryptoPubKey == nil {
@@ -63,14 +79,20 @@ func NewHTTPPublisher(
 	}
 
 	return &HTTPPublisher{
-		serverAddress:   serverAddress,
+		servers:         servers,
+		scheme:          scheme,
 		hmacKey:         extra.HmacKey,
+		hmacKeyID:       extra.HmacKeyID,
+		apiKey:          extra.APIKey,
+		encrypted:       extra.EncrSettings.CryptoPubKey != nil,
+		cryptoKeyID:     extra.EncrSettings.CryptoKeyID,
 		httpClient:      client,
 		metricsChan:     metricsChan,
 		threadID:        threadID,
 		bufPool:         bufPool,
 		shutdownTimeout: shutdownTimeout,
 		hostIP:          extra.HostIP.String(),
+		spool:           extra.Spool,
 		logger:          logger,
 	}
 }
@@ -91,21 +113,30 @@ func (httpPublisher *HTTPPublisher) processMetrics(metricsList []metric.Metrics)
 
 	metricReq := make([]metric.MetricsDTO, 0, totalMetrics(metricsList))
 
-	iterateMetrics(metricsList, func(name string, value metric.MetricValue) {
-		metricReq = append(metricReq, prepareMetric(name, value, httpPublisher.hmacKey))
+	iterateMetrics(metricsList, func(seriesID string, value metric.MetricValue) {
+		mReq, err := prepareMetric(seriesID, value, httpPublisher.hmacKey)
+		if err != nil {
+			httpPublisher.logger.Errorf("HTTP publisher[%d] skipped metric [%s]: %v", httpPublisher.threadID, seriesID, err)
+			return
+		}
+		metricReq = append(metricReq, mReq)
 
 		if value.TypeName() == metric.CounterTypeName {
-			curVal, ok := counterMetricsToSend[name]
+			curVal, ok := counterMetricsToSend[seriesID]
 			if !ok {
-				counterMetricsToSend[name] = value
+				counterMetricsToSend[seriesID] = value
 			} else {
-				counterMetricsToSend[name] = curVal.(metric.Counter) + value.(metric.Counter)
+				counterMetricsToSend[seriesID] = curVal.(metric.Counter) + value.(metric.Counter)
 			}
 		}
 	})
 
-	if err := httpPublisher.publishMetrics(metricReq); err != nil {
+	spooled, err := httpPublisher.spool.Send(metricReq, httpPublisher.publish)
+	if err != nil {
 		httpPublisher.logger.Errorf("HTTP publisher[%d] failed to publish: %v", httpPublisher.threadID, err)
+	}
+	// Spooled counters are replayed from spool, not retryable are dropped
+	if err != nil && !spooled && IsRetryable(err) {
 		httpPublisher.failedCounterMetrics = counterMetricsToSend
 		return
 	}
@@ -113,12 +144,26 @@ func (httpPublisher *HTTPPublisher) processMetrics(metricsList []metric.Metrics)
 	httpPublisher.failedCounterMetrics = nil
 }
 
-func (httpPublisher *HTTPPublisher) publishMetrics(metricReq []metric.MetricsDTO) error {
+// publish publishes metrics to servers pool.
+func (httpPublisher *HTTPPublisher) publish(metricReq []metric.MetricsDTO) error {
+	return httpPublisher.servers.Publish(
+		func(serverAddress nettools.Address) error {
+			return httpPublisher.publishMetrics(serverAddress, metricReq)
+		},
+		httpPublisher.ping)
+}
+
+func (httpPublisher *HTTPPublisher) publishMetrics(serverAddress nettools.Address, metricReq []metric.MetricsDTO) error {
 	buf := httpPublisher.bufPool.Get().(iotools.PoolBuffer)
 	defer httpPublisher.bufPool.Put(buf)
 
+	body, err := json.Marshal(metricReq)
+	if err != nil {
+		return Permanent(fmt.Errorf("HTTP publisher[%d] failed to encode request: %w", httpPublisher.threadID, err))
+	}
+
 	buf.Reset()
-	json.NewEncoder(buf).Encode(metricReq)
+	buf.Write(body)
 
 	ctx, cancel := context.WithTimeout(context.Background(), _defaultRequestTimeout)
 	defer cancel()
@@ -126,27 +171,74 @@ func (httpPublisher *HTTPPublisher) publishMetrics(metricReq []metric.MetricsDTO
 	request, err := http.NewRequestWithContext(
 		ctx,
 		http.MethodPost,
-		fmt.Sprintf("http://%s/updates/", httpPublisher.serverAddress.String()),
+		fmt.Sprintf("%s://%s/updates/", httpPublisher.scheme, serverAddress.String()),
 		buf)
 	if err != nil {
-		return fmt.Errorf("HTTP publisher[%d] failed to create request: %w", httpPublisher.threadID, err)
+		return Permanent(fmt.Errorf("HTTP publisher[%d] failed to create request: %w", httpPublisher.threadID, err))
 	}
 
 	request.Header.Set("Content-Type", _http.ContentTypeApplicationJSON)
-	request.Header.Set(nettools.RealIPHeader, httpPublisher.hostIP)
+	if httpPublisher.encrypted {
+		request.Header.Set("Content-Encoding", cipher.ContentEncoding)
+		if httpPublisher.cryptoKeyID != "" {
+			request.Header.Set(cipher.KeyIDHeader, httpPublisher.cryptoKeyID)
+		}
+	}
+	httpPublisher.setClientHeaders(request)
+	if httpPublisher.hmacKey != nil {
+		// Signature covers plain body, server checks it after decryption
+		sig, err := hash.SignRequest(*httpPublisher.hmacKey, httpPublisher.hmacKeyID, hash.HTTPRequestTarget(request), body, time.Now())
+		if err != nil {
+			return Permanent(fmt.Errorf("HTTP publisher[%d] failed to sign request: %w", httpPublisher.threadID, err))
+		}
+		request.Header.Set(hash.SignatureHeader, sig)
+		if httpPublisher.hmacKeyID != "" {
+			request.Header.Set(hash.KeyIDHeader, httpPublisher.hmacKeyID)
+		}
+	}
 
 	response, err := httpPublisher.httpClient.Do(request)
 	if err != nil {
 		return fmt.Errorf("publisher[%d] failed to send request, err: %w", httpPublisher.threadID, err)
 	}
+	defer response.Body.Close()
 	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("publisher[%d] failed to send request, code: %d", httpPublisher.threadID, response.StatusCode)
+		return httpStatusError(httpPublisher.threadID, response.StatusCode)
+	}
+
+	return nil
+}
+
+// ping checks server health with health request.
+func (httpPublisher *HTTPPublisher) ping(serverAddress nettools.Address) error {
+	request, err := http.NewRequest(
+		http.MethodGet,
+		fmt.Sprintf("%s://%s/health", httpPublisher.scheme, serverAddress.String()),
+		nil)
+	if err != nil {
+		return fmt.Errorf("publisher[%d] failed to create ping request: %w", httpPublisher.threadID, err)
+	}
+	httpPublisher.setClientHeaders(request)
+
+	response, err := httpPublisher.httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("publisher[%d] failed to send ping request, err: %w", httpPublisher.threadID, err)
 	}
 	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return httpStatusError(httpPublisher.threadID, response.StatusCode)
+	}
 
 	return nil
 }
 
+func (httpPublisher *HTTPPublisher) setClientHeaders(request *http.Request) {
+	request.Header.Set(nettools.RealIPHeader, httpPublisher.hostIP)
+	if httpPublisher.apiKey != nil {
+		request.Header.Set(apikey.AuthorizationHeader, "Bearer "+*httpPublisher.apiKey)
+	}
+}
+
 func (httpPublisher *HTTPPublisher) shutdown() {
 	if httpPublisher.failedCounterMetrics == nil {
 		return
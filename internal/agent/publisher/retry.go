@@ -0,0 +1,222 @@
+package publisher
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DefaultRetryInitialBackoff   = 1 * time.Second
+	DefaultRetryMaxBackoff       = 1 * time.Minute
+	DefaultRetryFailureThreshold = 5
+
+	_retryMultiplier = 2.0
+	_retryJitter     = 0.5
+)
+
+var (
+	// ErrBackoff - publish is postponed until backoff after previous failure.
+	ErrBackoff = errors.New("publish postponed by backoff")
+	// ErrCircuitOpen - publish is not attempted, server is considered down.
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+)
+
+// RetrySettings - settings of publishers retry policy.
+type RetrySettings struct {
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// FailureThreshold - count of consecutive failures to open breaker.
+	FailureThreshold int
+}
+
+type breakerState int
+
+const (
+	_breakerClosed breakerState = iota
+	_breakerOpen
+	_breakerHalfOpen
+)
+
+// RetryPolicy is a retry policy, shared by publishers of one server. After
+// failure publishes are postponed with exponential backoff with jitter.
+// After FailureThreshold consecutive failures breaker opens and after backoff
+// half-opens to let one probe publish through: success closes breaker,
+// failure opens it again. Nil policy publishes without restrictions.
+type RetryPolicy struct {
+	settings RetrySettings
+
+	mu          sync.Mutex
+	state       breakerState
+	failures    int
+	nextAttempt time.Time
+	probing     bool
+
+	now    func() time.Time
+	random func() float64
+}
+
+func NewRetryPolicy(settings RetrySettings) *RetryPolicy {
+	return &RetryPolicy{settings: settings, now: time.Now, random: rand.Float64}
+}
+
+// Do publishes with fn, if policy allows it, and registers result.
+// Not retryable errors mean that server is available.
+func (r *RetryPolicy) Do(fn func() error) error {
+	if r == nil {
+		return fn()
+	}
+
+	if err := r.allow(); err != nil {
+		return err
+	}
+
+	err := fn()
+	if err != nil && IsRetryable(err) {
+		r.failure()
+	} else {
+		r.success()
+	}
+	return err
+}
+
+func (r *RetryPolicy) allow() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	switch r.state {
+	case _breakerOpen:
+		if now.Before(r.nextAttempt) {
+			return ErrCircuitOpen
+		}
+		r.state, r.probing = _breakerHalfOpen, true
+		return nil
+	case _breakerHalfOpen:
+		if r.probing {
+			return ErrCircuitOpen
+		}
+		r.probing = true
+		return nil
+	default:
+		if now.Before(r.nextAttempt) {
+			return ErrBackoff
+		}
+		return nil
+	}
+}
+
+func (r *RetryPolicy) success() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.state = _breakerClosed
+	r.failures = 0
+	r.nextAttempt = time.Time{}
+	r.probing = false
+}
+
+func (r *RetryPolicy) failure() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failures++
+	r.nextAttempt = r.now().Add(r.backoff())
+	r.probing = false
+	if r.state == _breakerHalfOpen || r.failures >= r.settings.FailureThreshold {
+		r.state = _breakerOpen
+	}
+}
+
+// backoff returns delay after current count of failures. Must be called
+// under lock.
+func (r *RetryPolicy) backoff() time.Duration {
+	delay := float64(r.settings.InitialBackoff) * math.Pow(_retryMultiplier, float64(r.failures-1))
+	if delay > float64(r.settings.MaxBackoff) {
+		delay = float64(r.settings.MaxBackoff)
+	}
+	// Jitter spreads retries of agents, which failed at the same time
+	delay -= delay * _retryJitter * r.random()
+	return time.Duration(delay)
+}
+
+// permanentError - publish error, which must not be retried.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not retryable.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsRetryable checks that publish with err may be retried.
+func IsRetryable(err error) bool {
+	var pErr *permanentError
+	return !errors.As(err, &pErr)
+}
+
+// unauthorizedError - error for request, rejected by server authentication
+// or authorization.
+type unauthorizedError struct {
+	err error
+}
+
+func (e *unauthorizedError) Error() string { return e.err.Error() }
+
+func (e *unauthorizedError) Unwrap() error { return e.err }
+
+// IsUnauthorized checks that request with err was rejected by server
+// authentication or authorization.
+func IsUnauthorized(err error) bool {
+	var uErr *unauthorizedError
+	return errors.As(err, &uErr)
+}
+
+// httpStatusError returns error for HTTP response status. Client errors are
+// not retryable, except timeouts and rate limits.
+func httpStatusError(threadID int, code int) error {
+	err := fmt.Errorf("publisher[%d] failed to send request, code: %d", threadID, code)
+	if code == http.StatusUnauthorized || code == http.StatusForbidden {
+		return Permanent(&unauthorizedError{err: err})
+	}
+	if code >= 400 && code < 500 &&
+		code != http.StatusRequestTimeout &&
+		code != http.StatusTooEarly &&
+		code != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
+
+// grpcStatusError returns error for gRPC call error, classified by status
+// code.
+func grpcStatusError(threadID int, err error) error {
+	wrapped := fmt.Errorf("gRPC publisher[%d] failed to publish metrics: %w", threadID, err)
+	switch status.Code(err) {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return Permanent(&unauthorizedError{err: wrapped})
+	case codes.InvalidArgument,
+		codes.Unimplemented,
+		codes.FailedPrecondition,
+		codes.OutOfRange,
+		codes.AlreadyExists:
+		return Permanent(wrapped)
+	default:
+		return wrapped
+	}
+}
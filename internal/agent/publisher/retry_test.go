@@ -0,0 +1,153 @@
+package publisher
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func newTestRetryPolicy(clock *testClock, jitter float64) *RetryPolicy {
+	r := NewRetryPolicy(RetrySettings{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, FailureThreshold: 3})
+	r.now = clock.Now
+	r.random = func() float64 { return jitter }
+	return r
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	r := newTestRetryPolicy(clock, 0)
+
+	failErr := errors.New("server down")
+	calls := 0
+	fail := func() error { calls++; return failErr }
+
+	// First failure, next attempt after initial backoff
+	assert.ErrorIs(t, r.Do(fail), failErr)
+	assert.ErrorIs(t, r.Do(fail), ErrBackoff)
+	assert.Equal(t, 1, calls)
+
+	clock.now = clock.now.Add(time.Second)
+	assert.ErrorIs(t, r.Do(fail), failErr)
+	assert.Equal(t, 2, calls)
+
+	// Backoff is doubled
+	clock.now = clock.now.Add(time.Second)
+	assert.ErrorIs(t, r.Do(fail), ErrBackoff)
+	clock.now = clock.now.Add(time.Second)
+	assert.NoError(t, r.Do(func() error { calls++; return nil }))
+	assert.Equal(t, 3, calls)
+
+	// Success resets backoff
+	assert.ErrorIs(t, r.Do(fail), failErr)
+	clock.now = clock.now.Add(time.Second)
+	assert.ErrorIs(t, r.Do(fail), failErr)
+	assert.Equal(t, 5, calls)
+}
+
+func TestRetryPolicyJitter(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	r := newTestRetryPolicy(clock, 1)
+
+	assert.Error(t, r.Do(func() error { return errors.New("server down") }))
+	assert.Equal(t, clock.now.Add(500*time.Millisecond), r.nextAttempt)
+
+	// Backoff is limited by max backoff
+	r.failures = 10
+	assert.Equal(t, 2500*time.Millisecond, r.backoff())
+}
+
+func TestRetryPolicyCircuitBreaker(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	r := newTestRetryPolicy(clock, 0)
+
+	failErr := errors.New("server down")
+	for i := 0; i < 3; i++ {
+		clock.now = clock.now.Add(time.Minute)
+		assert.ErrorIs(t, r.Do(func() error { return failErr }), failErr)
+	}
+
+	// Breaker is open after threshold
+	assert.ErrorIs(t, r.Do(func() error { return nil }), ErrCircuitOpen)
+
+	// Breaker half-opens after backoff, only one probe is allowed
+	clock.now = clock.now.Add(4 * time.Second)
+	probeStarted, probeRelease, probeDone := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(probeDone)
+		r.Do(func() error {
+			close(probeStarted)
+			<-probeRelease
+			return failErr
+		})
+	}()
+	<-probeStarted
+	assert.ErrorIs(t, r.Do(func() error { return nil }), ErrCircuitOpen)
+	close(probeRelease)
+	<-probeDone
+
+	// Failed probe opens breaker again
+	assert.Equal(t, _breakerOpen, r.state)
+	assert.ErrorIs(t, r.Do(func() error { return nil }), ErrCircuitOpen)
+
+	// Successful probe closes breaker
+	clock.now = clock.now.Add(5 * time.Second)
+	assert.NoError(t, r.Do(func() error { return nil }))
+	assert.Equal(t, _breakerClosed, r.state)
+	assert.NoError(t, r.Do(func() error { return nil }))
+}
+
+func TestRetryPolicyPermanentError(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	r := newTestRetryPolicy(clock, 0)
+
+	// Not retryable errors mean that server is available
+	for i := 0; i < 5; i++ {
+		err := r.Do(func() error { return httpStatusError(1, http.StatusBadRequest) })
+		assert.False(t, IsRetryable(err))
+	}
+	assert.NoError(t, r.Do(func() error { return nil }))
+}
+
+func TestRetryPolicyDisabled(t *testing.T) {
+	var r *RetryPolicy
+	failErr := errors.New("server down")
+	for i := 0; i < 5; i++ {
+		assert.ErrorIs(t, r.Do(func() error { return failErr }), failErr)
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{name: "network error", err: errors.New("connection refused"), retryable: true},
+		{name: "HTTP 400", err: httpStatusError(1, http.StatusBadRequest)},
+		{name: "HTTP 403", err: httpStatusError(1, http.StatusForbidden)},
+		{name: "HTTP 429", err: httpStatusError(1, http.StatusTooManyRequests), retryable: true},
+		{name: "HTTP 500", err: httpStatusError(1, http.StatusInternalServerError), retryable: true},
+		{name: "HTTP 503", err: httpStatusError(1, http.StatusServiceUnavailable), retryable: true},
+		{name: "gRPC hash check", err: grpcStatusError(1, status.Error(codes.InvalidArgument, metric.ErrMetricHashCheck.Error()))},
+		{name: "gRPC unauthenticated", err: grpcStatusError(1, status.Error(codes.Unauthenticated, "unauthenticated"))},
+		{name: "gRPC unavailable", err: grpcStatusError(1, status.Error(codes.Unavailable, "unavailable")), retryable: true},
+		{name: "gRPC deadline", err: grpcStatusError(1, status.Error(codes.DeadlineExceeded, "deadline")), retryable: true},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.retryable, IsRetryable(tt.err))
+		})
+	}
+}
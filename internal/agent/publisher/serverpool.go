@@ -0,0 +1,101 @@
+package publisher
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/devldavydov/promytheus/internal/common/nettools"
+	"github.com/sirupsen/logrus"
+)
+
+// ServerPool is a list of servers, publishers of one group publish to.
+// Publishers publish to current server, after retryable failure pool fails
+// over to next server, which responds to ping. Each server has own retry
+// policy, shared by all publishers of pool.
+type ServerPool struct {
+	servers []poolServer
+	logger  *logrus.Logger
+
+	mu      sync.Mutex
+	current int
+
+	failoverMu sync.Mutex
+}
+
+type poolServer struct {
+	address nettools.Address
+	retry   *RetryPolicy
+}
+
+// NewServerPool creates pool of servers, first server is current.
+func NewServerPool(addresses []nettools.Address, retrySettings RetrySettings, logger *logrus.Logger) *ServerPool {
+	servers := make([]poolServer, 0, len(addresses))
+	for _, addr := range addresses {
+		servers = append(servers, poolServer{address: addr, retry: NewRetryPolicy(retrySettings)})
+	}
+	return &ServerPool{servers: servers, logger: logger}
+}
+
+// Current returns address of current server.
+func (p *ServerPool) Current() nettools.Address {
+	return p.servers[p.currentIndex()].address
+}
+
+// Publish publishes with send to current server according to its retry
+// policy. If publish fails with retryable error, pool fails over to next
+// healthy server and publishes to it. Server is healthy, if ping succeeds
+// or fails with not retryable error other than rejected credentials.
+func (p *ServerPool) Publish(send func(nettools.Address) error, ping func(nettools.Address) error) error {
+	idx := p.currentIndex()
+	err := p.servers[idx].publish(send)
+
+	// Server in backoff has already failed and failover was tried after that
+	if err == nil || !IsRetryable(err) || errors.Is(err, ErrBackoff) || errors.Is(err, ErrCircuitOpen) {
+		return err
+	}
+
+	next, ok := p.failover(idx, ping)
+	if !ok {
+		return err
+	}
+	return p.servers[next].publish(send)
+}
+
+func (p *ServerPool) failover(failed int, ping func(nettools.Address) error) (int, bool) {
+	p.failoverMu.Lock()
+	defer p.failoverMu.Unlock()
+
+	// Other publisher has already failed over
+	if cur := p.currentIndex(); cur != failed {
+		return cur, true
+	}
+
+	for i := 1; i < len(p.servers); i++ {
+		next := (failed + i) % len(p.servers)
+		addr := p.servers[next].address
+
+		if err := ping(addr); err != nil && (IsRetryable(err) || IsUnauthorized(err)) {
+			p.logger.Warnf("Server [%s] is not healthy: %v", addr, err)
+			continue
+		}
+
+		p.mu.Lock()
+		p.current = next
+		p.mu.Unlock()
+
+		p.logger.Warnf("Failover from server [%s] to [%s]", p.servers[failed].address, addr)
+		return next, true
+	}
+
+	return failed, false
+}
+
+func (p *ServerPool) currentIndex() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.current
+}
+
+func (s poolServer) publish(send func(nettools.Address) error) error {
+	return s.retry.Do(func() error { return send(s.address) })
+}
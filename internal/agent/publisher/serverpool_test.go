@@ -0,0 +1,202 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/devldavydov/promytheus/internal/common/acl"
+	"github.com/devldavydov/promytheus/internal/common/apikey"
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/common/nettools"
+	metrichandler "github.com/devldavydov/promytheus/internal/server/http/handler/metric"
+	"github.com/devldavydov/promytheus/internal/server/http/middleware"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestServerPool(hosts ...string) *ServerPool {
+	addrs := make([]nettools.Address, 0, len(hosts))
+	for _, host := range hosts {
+		addrs = append(addrs, nettools.Address{Host: host, Port: 8080})
+	}
+	return NewServerPool(addrs, RetrySettings{InitialBackoff: 1, MaxBackoff: 1, FailureThreshold: 3}, logrus.New())
+}
+
+func TestServerPoolFailover(t *testing.T) {
+	pool := newTestServerPool("a", "b", "c")
+	failErr := errors.New("server down")
+
+	down := map[string]bool{"a": true, "b": true}
+	var published []string
+	send := func(addr nettools.Address) error {
+		if down[addr.Host] {
+			return failErr
+		}
+		published = append(published, addr.Host)
+		return nil
+	}
+	ping := func(addr nettools.Address) error {
+		if down[addr.Host] {
+			return failErr
+		}
+		return nil
+	}
+
+	// Unhealthy server is skipped
+	assert.NoError(t, pool.Publish(send, ping))
+	assert.Equal(t, "c", pool.Current().Host)
+	assert.Equal(t, []string{"c"}, published)
+
+	// Pool stays on current server, while it is healthy
+	down["a"] = false
+	assert.NoError(t, pool.Publish(send, ping))
+	assert.Equal(t, "c", pool.Current().Host)
+
+	// Failover wraps around
+	down["c"] = true
+	assert.NoError(t, pool.Publish(send, ping))
+	assert.Equal(t, "a", pool.Current().Host)
+	assert.Equal(t, []string{"c", "c", "a"}, published)
+}
+
+func TestServerPoolNoHealthyServer(t *testing.T) {
+	pool := newTestServerPool("a", "b")
+	failErr := errors.New("server down")
+
+	pings := 0
+	err := pool.Publish(
+		func(nettools.Address) error { return failErr },
+		func(nettools.Address) error { pings++; return failErr })
+	assert.ErrorIs(t, err, failErr)
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, "a", pool.Current().Host)
+	assert.Equal(t, 1, pings)
+}
+
+func TestServerPoolPermanentError(t *testing.T) {
+	pool := newTestServerPool("a", "b")
+
+	// Not retryable publish error does not cause failover
+	err := pool.Publish(
+		func(nettools.Address) error { return httpStatusError(1, http.StatusBadRequest) },
+		func(nettools.Address) error { return nil })
+	assert.False(t, IsRetryable(err))
+	assert.Equal(t, "a", pool.Current().Host)
+
+	send := func(addr nettools.Address) error {
+		if addr.Host == "a" {
+			return errors.New("server down")
+		}
+		return nil
+	}
+
+	// Server, which rejects ping credentials, is not healthy
+	pings := 0
+	for _, pingErr := range []error{
+		httpStatusError(1, http.StatusUnauthorized),
+		httpStatusError(1, http.StatusForbidden),
+		grpcStatusError(1, status.Error(codes.PermissionDenied, "denied")),
+	} {
+		pingErr := pingErr
+		err = pool.Publish(send, func(nettools.Address) error { pings++; return pingErr })
+		assert.Error(t, err)
+		assert.Equal(t, "a", pool.Current().Host)
+	}
+	assert.Equal(t, 3, pings)
+
+	// Server with other not retryable ping error is healthy
+	err = pool.Publish(send, func(nettools.Address) error { return httpStatusError(1, http.StatusNotFound) })
+	assert.NoError(t, err)
+	assert.Equal(t, "b", pool.Current().Host)
+}
+
+func TestHTTPPublisherFailover(t *testing.T) {
+	var primaryUpdates, secondaryUpdates, secondaryPings atomic.Int32
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryUpdates.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			secondaryPings.Add(1)
+		case "/updates/":
+			secondaryUpdates.Add(1)
+		}
+	}))
+	defer secondary.Close()
+
+	pool := NewServerPool(
+		[]nettools.Address{testServerAddress(t, primary), testServerAddress(t, secondary)},
+		RetrySettings{InitialBackoff: 1, MaxBackoff: 1, FailureThreshold: 3},
+		logrus.New())
+	pub := NewHTTPPublisher(pool, nil, 1, logrus.New(), PublisherExtraSettings{HostIP: net.IPv4(127, 0, 0, 1)})
+
+	pub.processMetrics([]metric.Metrics{{"m1": metric.Gauge(1)}})
+	pub.processMetrics([]metric.Metrics{{"m1": metric.Gauge(2)}})
+
+	assert.Nil(t, pub.failedCounterMetrics)
+	assert.Equal(t, int32(1), primaryUpdates.Load())
+	assert.Equal(t, int32(1), secondaryPings.Load())
+	assert.Equal(t, int32(2), secondaryUpdates.Load())
+}
+
+func TestHTTPPublisherFailoverWriteOnlyKey(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	// Secondary server allows admin routes only for other host and agent key
+	// has only write scope
+	logger := logrus.New()
+	stg, err := storage.NewMemStorage(context.TODO(), logger, storage.NewPersistSettings(0, "", false), storage.NewHistorySettings(0))
+	require.NoError(t, err)
+	policy, err := acl.ParsePolicy("admin=10.0.0.1")
+	require.NoError(t, err)
+	authenticator, err := apikey.NewAuthenticator([]apikey.KeyConfig{
+		{ID: "agent", KeyHash: apikey.HashKey("key-w"), Scopes: []apikey.Scope{apikey.ScopeWrite}},
+	})
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Use(middleware.NewRealIP(nil).Handle)
+	metrichandler.NewHandler(router, stg, nil, nil, policy, authenticator, nil, logger)
+	secondary := httptest.NewServer(router)
+	defer secondary.Close()
+
+	pool := NewServerPool(
+		[]nettools.Address{testServerAddress(t, primary), testServerAddress(t, secondary)},
+		RetrySettings{InitialBackoff: 1, MaxBackoff: 1, FailureThreshold: 3},
+		logger)
+	apiKey := "key-w"
+	pub := NewHTTPPublisher(pool, nil, 1, logger, PublisherExtraSettings{HostIP: net.IPv4(127, 0, 0, 1), APIKey: &apiKey})
+
+	pub.processMetrics([]metric.Metrics{{"m1": metric.Gauge(1)}})
+
+	assert.Nil(t, pub.failedCounterMetrics)
+	assert.Equal(t, testServerAddress(t, secondary), pool.Current())
+	val, err := stg.GetGaugeMetric("m1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, metric.Gauge(1), val)
+}
+
+func testServerAddress(t *testing.T, srv *httptest.Server) nettools.Address {
+	addr, err := nettools.NewAddress(strings.TrimPrefix(srv.URL, "http://"))
+	require.NoError(t, err)
+	return addr
+}
@@ -2,6 +2,7 @@ package publisher
 
 import (
 	"crypto/rsa"
+	"crypto/tls"
 	"net"
 	"time"
 
@@ -11,17 +12,23 @@ import (
 const (
 	_defaultRequestTimeout  = 15 * time.Second
 	_defaultShutdownTimeout = 5 * time.Second
+	_defaultPingTimeout     = 1 * time.Second
 )
 
 // EncryptionSettings - settings for publishers encryption
 type EncryptionSettings struct {
 	CryptoPubKey   *rsa.PublicKey
+	CryptoKeyID    string
 	TLSCredentials credentials.TransportCredentials
+	HTTPTLSConfig  *tls.Config
 }
 
 type PublisherExtraSettings struct {
 	HmacKey         *string
+	HmacKeyID       string
+	APIKey          *string
 	EncrSettings    EncryptionSettings
 	ShutdownTimeout *time.Duration
 	HostIP          net.IP
+	Spool           *Spool
 }
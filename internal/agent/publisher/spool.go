@@ -0,0 +1,283 @@
+package publisher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	_spoolFileExt    = ".batch"
+	_spoolTmpFileExt = ".tmp"
+)
+
+// Spool is a bounded on-disk queue of batches, which failed to publish.
+// Batches are replayed in order of spooling. Oldest batches are dropped
+// when spool exceeds size limit or batches are older than age limit.
+// Nil spool is disabled: batches are published directly.
+type Spool struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+	logger  *logrus.Logger
+
+	mu      sync.Mutex
+	files   []spoolFile
+	size    int64
+	nextSeq uint64
+
+	replayMu sync.Mutex
+}
+
+type spoolFile struct {
+	name    string
+	seq     uint64
+	size    int64
+	modTime time.Time
+}
+
+// NewSpool creates spool in dir, restoring batches spooled before restart.
+// Zero maxAge means no age limit.
+func NewSpool(dir string, maxSize int64, maxAge time.Duration, logger *logrus.Logger) (*Spool, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("wrong spool max size: %d", maxSize)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create spool dir: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool dir: %w", err)
+	}
+
+	s := &Spool{dir: dir, maxSize: maxSize, maxAge: maxAge, logger: logger}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+
+		// Remove batches, which were not completely written
+		if strings.HasSuffix(name, _spoolTmpFileExt) {
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+
+		seq, ok := parseSpoolFileName(name)
+		if !ok {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read spool dir: %w", err)
+		}
+
+		s.files = append(s.files, spoolFile{name: name, seq: seq, size: info.Size(), modTime: info.ModTime()})
+		s.size += info.Size()
+		if seq >= s.nextSeq {
+			s.nextSeq = seq + 1
+		}
+	}
+
+	sort.Slice(s.files, func(i, j int) bool { return s.files[i].seq < s.files[j].seq })
+
+	s.mu.Lock()
+	s.enforceLimits(time.Now())
+	s.mu.Unlock()
+
+	return s, nil
+}
+
+// Len returns count of spooled batches.
+func (s *Spool) Len() int {
+	if s == nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.files)
+}
+
+// Push persists batch at the end of spool.
+func (s *Spool) Push(batch []metric.MetricsDTO) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to encode spool batch: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq := s.nextSeq
+	name := fmt.Sprintf("%020d%s", seq, _spoolFileExt)
+	tmpPath := filepath.Join(s.dir, name+_spoolTmpFileExt)
+
+	// Batch is written to temporary file first, so that partially written
+	// batch is never replayed
+	if err = os.WriteFile(tmpPath, data, 0600); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write spool batch: %w", err)
+	}
+	if err = os.Rename(tmpPath, filepath.Join(s.dir, name)); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write spool batch: %w", err)
+	}
+
+	now := time.Now()
+	s.nextSeq++
+	s.files = append(s.files, spoolFile{name: name, seq: seq, size: int64(len(data)), modTime: now})
+	s.size += int64(len(data))
+	s.enforceLimits(now)
+
+	return nil
+}
+
+// Replay publishes spooled batches in order and removes published ones.
+// Replay stops on first retryable publish error, batches with not retryable
+// errors are dropped. If other replay is in progress, Replay returns
+// immediately, that replay publishes all batches.
+func (s *Spool) Replay(publish func([]metric.MetricsDTO) error) error {
+	if !s.replayMu.TryLock() {
+		return nil
+	}
+	defer s.replayMu.Unlock()
+
+	for {
+		file, ok := s.head()
+		if !ok {
+			return nil
+		}
+
+		batch, err := s.read(file)
+		if err != nil {
+			s.logger.Errorf("Spool dropped unreadable batch [%s]: %v", file.name, err)
+			s.remove(file)
+			continue
+		}
+
+		if err = publish(batch); err != nil && IsRetryable(err) {
+			return err
+		}
+		if err != nil {
+			s.logger.Errorf("Spool dropped not retryable batch [%s]: %v", file.name, err)
+		}
+		s.remove(file)
+	}
+}
+
+// Send publishes batch after spooled batches. If batch is not published
+// with retryable error, it is spooled. Returns spooled true, if batch was
+// persisted in spool, and error, if batch was not published.
+func (s *Spool) Send(batch []metric.MetricsDTO, publish func([]metric.MetricsDTO) error) (spooled bool, err error) {
+	if s == nil {
+		return false, publish(batch)
+	}
+
+	// Batch is published directly, if there is nothing to replay before it
+	if s.Len() == 0 {
+		if err = publish(batch); err == nil || !IsRetryable(err) {
+			return false, err
+		}
+
+		if pushErr := s.Push(batch); pushErr != nil {
+			return false, fmt.Errorf("%v; %w", err, pushErr)
+		}
+		return true, err
+	}
+
+	if err = s.Push(batch); err != nil {
+		return false, err
+	}
+	return true, s.Replay(publish)
+}
+
+func (s *Spool) head() (spoolFile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enforceLimits(time.Now())
+	if len(s.files) == 0 {
+		return spoolFile{}, false
+	}
+	return s.files[0], true
+}
+
+func (s *Spool) read(file spoolFile) ([]metric.MetricsDTO, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, file.name))
+	if err != nil {
+		return nil, err
+	}
+
+	var batch []metric.MetricsDTO
+	if err = json.Unmarshal(data, &batch); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+func (s *Spool) remove(file spoolFile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, f := range s.files {
+		if f.seq == file.seq {
+			s.dropFile(i)
+			return
+		}
+	}
+}
+
+// enforceLimits drops expired and oldest batches over size limit, newest
+// batch is always kept. Must be called under lock.
+func (s *Spool) enforceLimits(now time.Time) {
+	for len(s.files) > 0 {
+		file := s.files[0]
+		expired := s.maxAge > 0 && now.Sub(file.modTime) > s.maxAge
+		oversized := s.size > s.maxSize && len(s.files) > 1
+		if !expired && !oversized {
+			return
+		}
+
+		if expired {
+			s.logger.Warnf("Spool dropped expired batch [%s]", file.name)
+		} else {
+			s.logger.Warnf("Spool dropped batch [%s] over size limit", file.name)
+		}
+		s.dropFile(0)
+	}
+}
+
+// dropFile removes i-th batch from spool. Must be called under lock.
+func (s *Spool) dropFile(i int) {
+	file := s.files[i]
+	if err := os.Remove(filepath.Join(s.dir, file.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.logger.Errorf("Spool failed to remove batch [%s]: %v", file.name, err)
+	}
+	s.size -= file.size
+	s.files = append(s.files[:i], s.files[i+1:]...)
+}
+
+func parseSpoolFileName(name string) (uint64, bool) {
+	if !strings.HasSuffix(name, _spoolFileExt) {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(strings.TrimSuffix(name, _spoolFileExt), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return seq, true
+}
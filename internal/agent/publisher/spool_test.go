@@ -0,0 +1,169 @@
+package publisher
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func spoolBatch(name string, val float64) []metric.MetricsDTO {
+	return []metric.MetricsDTO{{ID: name, MType: metric.GaugeTypeName, Value: &val}}
+}
+
+func TestSpoolReplayInOrder(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := NewSpool(dir, 1<<20, 0, logrus.New())
+	require.NoError(t, err)
+
+	failErr := errors.New("server down")
+	var published []string
+	publish := func(batch []metric.MetricsDTO) error {
+		published = append(published, batch[0].ID)
+		return nil
+	}
+	fail := func(batch []metric.MetricsDTO) error { return failErr }
+
+	// Server is down, batches are spooled
+	spooled, err := spool.Send(spoolBatch("m1", 1), fail)
+	assert.True(t, spooled)
+	assert.ErrorIs(t, err, failErr)
+	spooled, err = spool.Send(spoolBatch("m2", 2), fail)
+	assert.True(t, spooled)
+	assert.ErrorIs(t, err, failErr)
+	assert.Equal(t, 2, spool.Len())
+
+	// Spool is restored after restart
+	spool, err = NewSpool(dir, 1<<20, 0, logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, 2, spool.Len())
+
+	// Server is up, new batch is sent after spooled ones
+	spooled, err = spool.Send(spoolBatch("m3", 3), publish)
+	assert.True(t, spooled)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"m1", "m2", "m3"}, published)
+	assert.Equal(t, 0, spool.Len())
+
+	// Empty spool, batch is sent directly
+	spooled, err = spool.Send(spoolBatch("m4", 4), publish)
+	assert.False(t, spooled)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"m1", "m2", "m3", "m4"}, published)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestSpoolLimits(t *testing.T) {
+	t.Run("size limit", func(t *testing.T) {
+		dir := t.TempDir()
+		batchSize := int64(len(`[{"id":"m1","type":"gauge","value":1}]`))
+		spool, err := NewSpool(dir, 2*batchSize, 0, logrus.New())
+		require.NoError(t, err)
+
+		for i, name := range []string{"m1", "m2", "m3"} {
+			require.NoError(t, spool.Push(spoolBatch(name, float64(i))))
+		}
+		assert.Equal(t, 2, spool.Len())
+
+		var published []string
+		require.NoError(t, spool.Replay(func(batch []metric.MetricsDTO) error {
+			published = append(published, batch[0].ID)
+			return nil
+		}))
+		assert.Equal(t, []string{"m2", "m3"}, published)
+	})
+
+	t.Run("age limit", func(t *testing.T) {
+		dir := t.TempDir()
+		spool, err := NewSpool(dir, 1<<20, time.Hour, logrus.New())
+		require.NoError(t, err)
+
+		require.NoError(t, spool.Push(spoolBatch("m1", 1)))
+		require.NoError(t, spool.Push(spoolBatch("m2", 2)))
+
+		old := time.Now().Add(-2 * time.Hour)
+		require.NoError(t, os.Chtimes(filepath.Join(dir, spool.files[0].name), old, old))
+
+		// Age is checked by file modification time after restart
+		spool, err = NewSpool(dir, 1<<20, time.Hour, logrus.New())
+		require.NoError(t, err)
+		assert.Equal(t, 1, spool.Len())
+	})
+}
+
+func TestSpoolRestore(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000005.batch"), []byte("not json"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000006.batch.tmp"), []byte("[]"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "foo"), []byte("[]"), 0600))
+
+	spool, err := NewSpool(dir, 1<<20, 0, logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, 1, spool.Len())
+	assert.NoFileExists(t, filepath.Join(dir, "00000000000000000006.batch.tmp"))
+
+	// New batches continue sequence
+	require.NoError(t, spool.Push(spoolBatch("m1", 1)))
+	assert.FileExists(t, filepath.Join(dir, "00000000000000000006.batch"))
+
+	// Unreadable batch is dropped
+	var published []string
+	require.NoError(t, spool.Replay(func(batch []metric.MetricsDTO) error {
+		published = append(published, batch[0].ID)
+		return nil
+	}))
+	assert.Equal(t, []string{"m1"}, published)
+	assert.Equal(t, 0, spool.Len())
+}
+
+func TestSpoolDisabled(t *testing.T) {
+	var spool *Spool
+	failErr := errors.New("server down")
+
+	spooled, err := spool.Send(spoolBatch("m1", 1), func([]metric.MetricsDTO) error { return failErr })
+	assert.False(t, spooled)
+	assert.ErrorIs(t, err, failErr)
+	assert.Equal(t, 0, spool.Len())
+}
+
+func TestNewSpoolError(t *testing.T) {
+	_, err := NewSpool(t.TempDir(), 0, 0, logrus.New())
+	assert.Error(t, err)
+}
+
+func TestSpoolPermanentError(t *testing.T) {
+	spool, err := NewSpool(t.TempDir(), 1<<20, 0, logrus.New())
+	require.NoError(t, err)
+
+	// Not retryable batch is not spooled
+	spooled, err := spool.Send(spoolBatch("m1", 1), func([]metric.MetricsDTO) error {
+		return httpStatusError(1, http.StatusBadRequest)
+	})
+	assert.False(t, spooled)
+	assert.False(t, IsRetryable(err))
+	assert.Equal(t, 0, spool.Len())
+
+	// Not retryable batch is dropped on replay
+	require.NoError(t, spool.Push(spoolBatch("m1", 1)))
+	require.NoError(t, spool.Push(spoolBatch("m2", 2)))
+	var published []string
+	require.NoError(t, spool.Replay(func(batch []metric.MetricsDTO) error {
+		if batch[0].ID == "m1" {
+			return httpStatusError(1, http.StatusBadRequest)
+		}
+		published = append(published, batch[0].ID)
+		return nil
+	}))
+	assert.Equal(t, []string{"m2"}, published)
+	assert.Equal(t, 0, spool.Len())
+}
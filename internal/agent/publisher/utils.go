@@ -2,10 +2,10 @@ package publisher
 
 import "github.com/devldavydov/promytheus/internal/common/metric"
 
-func iterateMetrics(metricsList []metric.Metrics, fn func(name string, value metric.MetricValue)) {
+func iterateMetrics(metricsList []metric.Metrics, fn func(seriesID string, value metric.MetricValue)) {
 	for _, metrics := range metricsList {
-		for name, value := range metrics {
-			fn(name, value)
+		for seriesID, value := range metrics {
+			fn(seriesID, value)
 		}
 	}
 }
@@ -18,22 +18,39 @@ func totalMetrics(metricsList []metric.Metrics) int {
 	return cnt
 }
 
-func prepareMetric(metricName string, metricValue metric.MetricValue, hmacKey *string) metric.MetricsDTO {
+func prepareMetric(seriesID string, metricValue metric.MetricValue, hmacKey *string) (metric.MetricsDTO, error) {
+	metricName, labels, err := metric.ParseSeriesID(seriesID)
+	if err != nil {
+		return metric.MetricsDTO{}, err
+	}
+
 	metricReq := metric.MetricsDTO{
-		ID:    metricName,
-		MType: metricValue.TypeName(),
+		ID:     metricName,
+		Labels: labels,
+		MType:  metricValue.TypeName(),
 	}
 
 	if metric.GaugeTypeName == metricValue.TypeName() {
 		metricReq.Value = metricValue.(metric.Gauge).FloatP()
 	} else if metric.CounterTypeName == metricValue.TypeName() {
 		metricReq.Delta = metricValue.(metric.Counter).IntP()
+	} else if metric.HistogramTypeName == metricValue.TypeName() {
+		hst := metricValue.(metric.Histogram)
+		metricReq.Bounds = hst.Bounds
+		metricReq.Buckets = hst.Buckets
+		metricReq.Sum = hst.SumP()
+		metricReq.Count = hst.CountP()
+	} else if metric.SummaryTypeName == metricValue.TypeName() {
+		smr := metricValue.(metric.Summary)
+		metricReq.Sketch = smr.SketchP()
+		metricReq.Sum = smr.SumP()
+		metricReq.Count = smr.CountP()
 	}
 
 	if hmacKey != nil {
-		hash := metricValue.Hmac(metricName, *hmacKey)
+		hash := metricValue.Hmac(metricName, labels, *hmacKey)
 		metricReq.Hash = &hash
 	}
 
-	return metricReq
+	return metricReq, nil
 }
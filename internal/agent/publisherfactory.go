@@ -19,27 +19,37 @@ func CreatePublisherFactory(
 	shutdownTimeout time.Duration,
 	ch chan metric.Metrics,
 	hostIP net.IP,
+	servers *publisher.ServerPool,
+	spool *publisher.Spool,
 	logger *logrus.Logger,
 ) PublisherFactory {
+	var hmacKeyID string
+	if settings.HmacKeyID != nil {
+		hmacKeyID = *settings.HmacKeyID
+	}
+
 	fn := func(threadID int, encrSettings publisher.EncryptionSettings) Publisher {
 		extraSettings := publisher.PublisherExtraSettings{
 			HmacKey:         settings.HmacKey,
+			HmacKeyID:       hmacKeyID,
+			APIKey:          settings.APIKey,
 			EncrSettings:    encrSettings,
 			ShutdownTimeout: &shutdownTimeout,
 			HostIP:          hostIP,
+			Spool:           spool,
 		}
 
 		switch settings.UseGRPC {
 		case true:
 			return publisher.NewGRPCPublisher(
-				settings.ServerAddress,
+				servers,
 				ch,
 				threadID,
 				logger,
 				extraSettings)
 		default:
 			return publisher.NewHTTPPublisher(
-				settings.ServerAddress,
+				servers,
 				ch,
 				threadID,
 				logger,
@@ -4,6 +4,8 @@ package agent
 import (
 	"context"
 	"crypto/rsa"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,6 +14,7 @@ import (
 	"github.com/devldavydov/promytheus/internal/common/cipher"
 	"github.com/devldavydov/promytheus/internal/common/metric"
 	"github.com/devldavydov/promytheus/internal/common/nettools"
+	"github.com/devldavydov/promytheus/internal/common/tlsconfig"
 	"github.com/devldavydov/promytheus/internal/grpc/gtls"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc/credentials"
@@ -32,34 +35,75 @@ type Publisher interface {
 type Service struct {
 	logger                      *logrus.Logger
 	failedPublishCounterMetrics metric.Metrics
-	publisherFactory            PublisherFactory
-	metricsChan                 chan metric.Metrics
+	publisherGroups             []publisherGroup
 	collectors                  []Collector
 	settings                    ServiceSettings
 }
 
+// publisherGroup - publisher threads with own metrics channel, spool and
+// pool of servers.
+type publisherGroup struct {
+	publisherFactory PublisherFactory
+	metricsChan      chan metric.Metrics
+	addresses        []nettools.Address
+}
+
 // NewService creates new agent service.
 func NewService(settings ServiceSettings, shutdownTimeout time.Duration, logger *logrus.Logger) (*Service, error) {
-	collectors := []Collector{
-		collector.NewRuntimeCollector(settings.PollInterval, logger),
-		collector.NewPsUtilCollector(settings.PollInterval, logger),
-	}
+	var collectors []Collector
+	for _, name := range collector.Registered() {
+		clctrSettings, ok := settings.Collectors[name]
+		if !ok || !clctrSettings.Enabled {
+			continue
+		}
 
-	ch := make(chan metric.Metrics, len(collectors)*2)
+		clctr, err := collector.New(name, clctrSettings, logger)
+		if err != nil {
+			return nil, err
+		}
+		collectors = append(collectors, clctr)
+	}
 
 	hostIP, err := nettools.GetHostIP()
 	if err != nil {
 		return nil, err
 	}
 
+	// In failover mode all servers are in one group, in replicate mode each
+	// server has own group, so that failed server does not block others
+	serverGroups := [][]nettools.Address{settings.ServerAddresses}
+	if settings.ServerMode == ServerModeReplicate {
+		serverGroups = nil
+		for _, addr := range settings.ServerAddresses {
+			serverGroups = append(serverGroups, []nettools.Address{addr})
+		}
+	}
+
+	publisherGroups := make([]publisherGroup, 0, len(serverGroups))
+	for _, addrs := range serverGroups {
+		ch := make(chan metric.Metrics, len(collectors)*2)
+
+		spool, err := createSpool(settings, addrs, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		servers := publisher.NewServerPool(addrs, settings.RetrySettings, logger)
+
+		publisherGroups = append(publisherGroups, publisherGroup{
+			publisherFactory: CreatePublisherFactory(
+				settings, shutdownTimeout, ch, hostIP, servers, spool, logger,
+			),
+			metricsChan: ch,
+			addresses:   addrs,
+		})
+	}
+
 	return &Service{
-		settings:    settings,
-		logger:      logger,
-		collectors:  collectors,
-		metricsChan: ch,
-		publisherFactory: CreatePublisherFactory(
-			settings, shutdownTimeout, ch, hostIP, logger,
-		),
+		settings:        settings,
+		logger:          logger,
+		collectors:      collectors,
+		publisherGroups: publisherGroups,
 	}, nil
 }
 
@@ -83,12 +127,14 @@ func (service *Service) Start(ctx context.Context) error {
 		}(ctx, collector)
 	}
 
-	for i := 0; i < service.settings.RateLimit; i++ {
-		wg.Add(1)
-		go func(ctx context.Context, threadID int) {
-			defer wg.Done()
-			service.publisherFactory(threadID, encrSettings).Publish()
-		}(ctx, i+1)
+	for g, group := range service.publisherGroups {
+		for i := 0; i < service.settings.RateLimit; i++ {
+			wg.Add(1)
+			go func(ctx context.Context, factory PublisherFactory, threadID int) {
+				defer wg.Done()
+				factory(threadID, encrSettings).Publish()
+			}(ctx, group.publisherFactory, g*service.settings.RateLimit+i+1)
+		}
 	}
 
 	service.startMainLoop(ctx)
@@ -114,16 +160,36 @@ func (service *Service) startMainLoop(ctx context.Context) {
 					continue
 				}
 
-				service.metricsChan <- metrics
+				service.sendMetrics(metrics)
 			}
 		case <-ctx.Done():
-			close(service.metricsChan)
+			for _, group := range service.publisherGroups {
+				close(group.metricsChan)
+			}
 			service.logger.Info("Main loop shutdown due to context closed")
 			return
 		}
 	}
 }
 
+// sendMetrics passes metrics to publisher groups. Single group applies
+// backpressure to collecting. Replicated groups do not wait for each other:
+// metrics for group with full channel are dropped.
+func (service *Service) sendMetrics(metrics metric.Metrics) {
+	if len(service.publisherGroups) == 1 {
+		service.publisherGroups[0].metricsChan <- metrics
+		return
+	}
+
+	for _, group := range service.publisherGroups {
+		select {
+		case group.metricsChan <- metrics:
+		default:
+			service.logger.Warnf("Publishers of servers %v are busy, dropping %d metrics", group.addresses, len(metrics))
+		}
+	}
+}
+
 func (service *Service) loadEncryptionSettings() (publisher.EncryptionSettings, error) {
 	var err error
 	encrSettings := publisher.EncryptionSettings{}
@@ -131,8 +197,16 @@ func (service *Service) loadEncryptionSettings() (publisher.EncryptionSettings,
 	if !service.settings.UseGRPC {
 		var cryptoPubKey *rsa.PublicKey
 		cryptoPubKey, err = service.loadHTTPCryptoPubKey()
-		if err == nil {
-			encrSettings.CryptoPubKey = cryptoPubKey
+		if err != nil {
+			return encrSettings, err
+		}
+		encrSettings.CryptoPubKey = cryptoPubKey
+		if service.settings.CryptoKeyID != nil {
+			encrSettings.CryptoKeyID = *service.settings.CryptoKeyID
+		}
+
+		if service.settings.HTTPClientTLS != nil {
+			encrSettings.HTTPTLSConfig, err = service.settings.HTTPClientTLS.Load()
 		}
 	} else {
 		var tlsCredentials credentials.TransportCredentials
@@ -145,6 +219,19 @@ func (service *Service) loadEncryptionSettings() (publisher.EncryptionSettings,
 	return encrSettings, err
 }
 
+func createSpool(settings ServiceSettings, addrs []nettools.Address, logger *logrus.Logger) (*publisher.Spool, error) {
+	if settings.SpoolDir == nil {
+		return nil, nil
+	}
+
+	// Replicated servers have own spools in subdirectories
+	dir := *settings.SpoolDir
+	if settings.ServerMode == ServerModeReplicate {
+		dir = filepath.Join(dir, strings.ReplaceAll(addrs[0].String(), ":", "_"))
+	}
+	return publisher.NewSpool(dir, settings.SpoolMaxSize, settings.SpoolMaxAge, logger)
+}
+
 func (service *Service) loadHTTPCryptoPubKey() (*rsa.PublicKey, error) {
 	if service.settings.CryptoPubKeyPath == nil {
 		return nil, nil
@@ -153,8 +240,19 @@ func (service *Service) loadHTTPCryptoPubKey() (*rsa.PublicKey, error) {
 }
 
 func (service *Service) loadGRPCTLS() (credentials.TransportCredentials, error) {
-	if service.settings.GRPCCACertPath == nil {
-		return nil, nil
+	if service.settings.GRPCCertPath == nil {
+		if service.settings.GRPCCACertPath == nil {
+			return nil, nil
+		}
+		return gtls.LoadCACert(*service.settings.GRPCCACertPath, "")
+	}
+
+	clientTLS := &tlsconfig.ClientSettings{
+		CertPath: *service.settings.GRPCCertPath,
+		KeyPath:  *service.settings.GRPCKeyPath,
+	}
+	if service.settings.GRPCCACertPath != nil {
+		clientTLS.CACertPath = *service.settings.GRPCCACertPath
 	}
-	return gtls.LoadCACert(*service.settings.GRPCCACertPath, "")
+	return gtls.LoadClientCredentials(clientTLS, "")
 }
@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/common/nettools"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCollector struct{}
+
+func (testCollector) Start(context.Context) {}
+
+func (testCollector) Collect() (metric.Metrics, error) {
+	return metric.Metrics{"m1": metric.Gauge(1)}, nil
+}
+
+func TestMainLoopReplicateBlockedServer(t *testing.T) {
+	blocked := publisherGroup{
+		metricsChan: make(chan metric.Metrics, 1),
+		addresses:   []nettools.Address{{Host: "blocked", Port: 8080}},
+	}
+	healthy := publisherGroup{
+		metricsChan: make(chan metric.Metrics, 1),
+		addresses:   []nettools.Address{{Host: "healthy", Port: 8080}},
+	}
+
+	service := &Service{
+		logger:          logrus.New(),
+		collectors:      []Collector{testCollector{}},
+		publisherGroups: []publisherGroup{blocked, healthy},
+		settings:        ServiceSettings{ReportInterval: time.Millisecond},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		service.startMainLoop(ctx)
+		close(done)
+	}()
+
+	// Healthy server keeps receiving metrics, while nobody reads blocked one
+	received := 0
+	for received < 5 {
+		select {
+		case <-healthy.metricsChan:
+			received++
+		case <-time.After(time.Second):
+			t.Fatalf("healthy server received %d reports", received)
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("main loop is not finished")
+	}
+	assert.Len(t, blocked.metricsChan, 1)
+}
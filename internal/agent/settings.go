@@ -1,37 +1,99 @@
 package agent
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/devldavydov/promytheus/internal/agent/collector"
+	"github.com/devldavydov/promytheus/internal/agent/publisher"
+	"github.com/devldavydov/promytheus/internal/common/metric"
 	"github.com/devldavydov/promytheus/internal/common/nettools"
+	"github.com/devldavydov/promytheus/internal/common/tlsconfig"
 )
 
+const (
+	// ServerModeFailover - metrics are published to one server, on failure
+	// agent switches to next healthy server.
+	ServerModeFailover = "failover"
+	// ServerModeReplicate - metrics are published to all servers.
+	ServerModeReplicate = "replicate"
+)
+
+// CollectorConfig - config of collector, zero values mean defaults: collector
+// is enabled and polls with agent poll interval. Opt-in collectors are
+// enabled only if they have config.
+type CollectorConfig struct {
+	Disabled     bool
+	PollInterval time.Duration
+	Prefix       string
+	Options      json.RawMessage
+}
+
 // ServiceSettings represents collecting metrics agent service settings.
 type ServiceSettings struct {
-	ServerAddress    nettools.Address
+	ServerAddresses  []nettools.Address
+	ServerMode       string
 	HmacKey          *string
+	HmacKeyID        *string
+	APIKey           *string
 	CryptoPubKeyPath *string
+	CryptoKeyID      *string
 	PollInterval     time.Duration
 	ReportInterval   time.Duration
 	RateLimit        int
 	UseGRPC          bool
 	GRPCCACertPath   *string
+	GRPCCertPath     *string
+	GRPCKeyPath      *string
+	HTTPClientTLS    *tlsconfig.ClientSettings
+	SpoolDir         *string
+	SpoolMaxSize     int64
+	SpoolMaxAge      time.Duration
+	RetrySettings    publisher.RetrySettings
+	Collectors       map[string]collector.Settings
 }
 
 // NewServiceSettings creates new agent service settings.
 func NewServiceSettings(
 	serverAddress string,
+	serverMode string,
 	pollInterval time.Duration,
 	reportInterval time.Duration,
 	hmacKey string,
+	hmacKeyID string,
+	apiKey string,
 	rateLimit int,
 	cryptoPubKeyPath string,
+	cryptoKeyID string,
 	useGRPC bool,
 	grpcCACertPath string,
+	grpcCertPath string,
+	grpcKeyPath string,
+	tlsCACertPath string,
+	tlsCertPath string,
+	tlsKeyPath string,
+	spoolDir string,
+	spoolMaxSize int64,
+	spoolMaxAge time.Duration,
+	retryInitialBackoff time.Duration,
+	retryMaxBackoff time.Duration,
+	retryFailureThreshold int,
+	collectors map[string]CollectorConfig,
 ) (ServiceSettings, error) {
-	srvAddr, err := nettools.NewAddress(serverAddress)
-	if err != nil {
-		return ServiceSettings{}, err
+	var srvAddrs []nettools.Address
+	for _, addr := range strings.Split(serverAddress, ",") {
+		srvAddr, err := nettools.NewAddress(strings.TrimSpace(addr))
+		if err != nil {
+			return ServiceSettings{}, err
+		}
+		srvAddrs = append(srvAddrs, srvAddr)
+	}
+
+	if serverMode != ServerModeFailover && serverMode != ServerModeReplicate {
+		return ServiceSettings{}, fmt.Errorf("wrong server mode: %s", serverMode)
 	}
 
 	var hmac *string
@@ -39,24 +101,124 @@ func NewServiceSettings(
 		hmac = &hmacKey
 	}
 
+	var hmacID *string
+	if hmacKeyID != "" {
+		hmacID = &hmacKeyID
+	}
+
+	var key *string
+	if apiKey != "" {
+		key = &apiKey
+	}
+
 	var pubKeyPath *string
 	if cryptoPubKeyPath != "" {
 		pubKeyPath = &cryptoPubKeyPath
 	}
 
+	var keyID *string
+	if cryptoKeyID != "" {
+		keyID = &cryptoKeyID
+	}
+
 	var grpcCACert *string
 	if grpcCACertPath != "" {
 		grpcCACert = &grpcCACertPath
 	}
 
+	if (grpcCertPath == "") != (grpcKeyPath == "") {
+		return ServiceSettings{}, errors.New("invalid gRPC client certificate settings")
+	}
+
+	var grpcCert, grpcKey *string
+	if grpcCertPath != "" {
+		grpcCert, grpcKey = &grpcCertPath, &grpcKeyPath
+	}
+
+	httpClientTLS, err := tlsconfig.NewOptionalClientSettings(tlsCACertPath, tlsCertPath, tlsKeyPath)
+	if err != nil {
+		return ServiceSettings{}, err
+	}
+
+	var spool *string
+	if spoolDir != "" {
+		if spoolMaxSize <= 0 {
+			return ServiceSettings{}, fmt.Errorf("wrong spool max size: %d", spoolMaxSize)
+		}
+		if spoolMaxAge < 0 {
+			return ServiceSettings{}, fmt.Errorf("wrong spool max age: %v", spoolMaxAge)
+		}
+		spool = &spoolDir
+	}
+
+	if retryInitialBackoff <= 0 || retryMaxBackoff < retryInitialBackoff {
+		return ServiceSettings{}, fmt.Errorf("wrong retry backoff: %v-%v", retryInitialBackoff, retryMaxBackoff)
+	}
+	if retryFailureThreshold <= 0 {
+		return ServiceSettings{}, fmt.Errorf("wrong retry failure threshold: %d", retryFailureThreshold)
+	}
+
+	collectorSettings, err := newCollectorSettings(collectors, pollInterval)
+	if err != nil {
+		return ServiceSettings{}, err
+	}
+
 	return ServiceSettings{
-		ServerAddress:    srvAddr,
+		ServerAddresses:  srvAddrs,
+		ServerMode:       serverMode,
 		PollInterval:     pollInterval,
 		ReportInterval:   reportInterval,
 		HmacKey:          hmac,
+		HmacKeyID:        hmacID,
+		APIKey:           key,
 		RateLimit:        rateLimit,
 		CryptoPubKeyPath: pubKeyPath,
+		CryptoKeyID:      keyID,
 		UseGRPC:          useGRPC,
 		GRPCCACertPath:   grpcCACert,
+		GRPCCertPath:     grpcCert,
+		GRPCKeyPath:      grpcKey,
+		HTTPClientTLS:    httpClientTLS,
+		SpoolDir:         spool,
+		SpoolMaxSize:     spoolMaxSize,
+		SpoolMaxAge:      spoolMaxAge,
+		RetrySettings: publisher.RetrySettings{
+			InitialBackoff:   retryInitialBackoff,
+			MaxBackoff:       retryMaxBackoff,
+			FailureThreshold: retryFailureThreshold,
+		},
+		Collectors: collectorSettings,
 	}, nil
 }
+
+// newCollectorSettings returns settings of all registered collectors.
+func newCollectorSettings(collectors map[string]CollectorConfig, pollInterval time.Duration) (map[string]collector.Settings, error) {
+	for name, cfg := range collectors {
+		if !collector.IsRegistered(name) {
+			return nil, fmt.Errorf("unknown collector: %s", name)
+		}
+		if cfg.PollInterval < 0 {
+			return nil, fmt.Errorf("wrong collector [%s] poll interval: %v", name, cfg.PollInterval)
+		}
+		if cfg.Prefix != "" && metric.ValidateName(cfg.Prefix) != nil {
+			return nil, fmt.Errorf("wrong collector [%s] prefix: %s", name, cfg.Prefix)
+		}
+	}
+
+	settings := make(map[string]collector.Settings)
+	for _, name := range collector.Registered() {
+		cfg, ok := collectors[name]
+
+		clctrSettings := collector.Settings{
+			Enabled:      !cfg.Disabled && (ok || !collector.IsOptIn(name)),
+			PollInterval: pollInterval,
+			Prefix:       cfg.Prefix,
+			Options:      cfg.Options,
+		}
+		if cfg.PollInterval > 0 {
+			clctrSettings.PollInterval = cfg.PollInterval
+		}
+		settings[name] = clctrSettings
+	}
+	return settings, nil
+}
@@ -0,0 +1,126 @@
+// Package acl provides IP based access control policy for route groups.
+package acl
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/devldavydov/promytheus/internal/common/nettools"
+)
+
+// Group - group of routes with common access policy.
+type Group string
+
+const (
+	GroupWrite Group = "write"
+	GroupRead  Group = "read"
+	GroupAdmin Group = "admin"
+)
+
+var _groups = map[Group]bool{GroupWrite: true, GroupRead: true, GroupAdmin: true}
+
+// Rule - allow and deny subnets of group. Deny takes precedence over allow.
+// Empty allow list allows any address, not denied explicitly.
+type Rule struct {
+	Allow []*net.IPNet
+	Deny  []*net.IPNet
+}
+
+// Policy - access policy of route groups. Nil policy or group without rule
+// allows any address.
+type Policy struct {
+	rules map[Group]*Rule
+}
+
+func NewPolicy() *Policy {
+	return &Policy{rules: make(map[Group]*Rule)}
+}
+
+// ParsePolicy parses policy from spec: semicolon separated group rules as
+// "group=subnet,!subnet", where "!" marks denied subnet. Subnets are CIDRs or
+// single IPs, both IPv4 and IPv6, i.e.
+// "write=10.0.0.0/8,!10.1.0.0/16,fd00::/8;admin=127.0.0.1,::1".
+func ParsePolicy(spec string) (*Policy, error) {
+	policy := NewPolicy()
+	for _, groupSpec := range strings.Split(spec, ";") {
+		groupSpec = strings.TrimSpace(groupSpec)
+		if groupSpec == "" {
+			continue
+		}
+
+		name, items, ok := strings.Cut(groupSpec, "=")
+		group := Group(strings.TrimSpace(name))
+		if !ok || !_groups[group] {
+			return nil, fmt.Errorf("wrong ACL group rule: %s", groupSpec)
+		}
+
+		for _, item := range strings.Split(items, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+
+			deny := strings.HasPrefix(item, "!")
+			subnets, err := nettools.ParseSubnets(strings.TrimPrefix(item, "!"))
+			if err != nil {
+				return nil, err
+			}
+
+			if deny {
+				policy.Deny(group, subnets...)
+			} else {
+				policy.Allow(group, subnets...)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// Allow adds allowed subnets to group.
+func (p *Policy) Allow(group Group, subnets ...*net.IPNet) {
+	rule := p.rule(group)
+	rule.Allow = append(rule.Allow, subnets...)
+}
+
+// Deny adds denied subnets to group.
+func (p *Policy) Deny(group Group, subnets ...*net.IPNet) {
+	rule := p.rule(group)
+	rule.Deny = append(rule.Deny, subnets...)
+}
+
+// Rule returns rule of group, if set.
+func (p *Policy) Rule(group Group) (Rule, bool) {
+	if p == nil {
+		return Rule{}, false
+	}
+
+	rule, ok := p.rules[group]
+	if !ok {
+		return Rule{}, false
+	}
+	return *rule, true
+}
+
+// Allowed checks access of IP to group.
+func (p *Policy) Allowed(group Group, ip net.IP) bool {
+	rule, ok := p.Rule(group)
+	if !ok {
+		return true
+	}
+
+	if ip == nil || nettools.ContainsIP(rule.Deny, ip) {
+		return false
+	}
+
+	return len(rule.Allow) == 0 || nettools.ContainsIP(rule.Allow, ip)
+}
+
+func (p *Policy) rule(group Group) *Rule {
+	rule, ok := p.rules[group]
+	if !ok {
+		rule = &Rule{}
+		p.rules[group] = rule
+	}
+	return rule
+}
@@ -0,0 +1,64 @@
+package acl
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyAllowed(t *testing.T) {
+	policy, err := ParsePolicy("write=10.0.0.0/8, !10.1.0.0/16, fd00::/8; admin=127.0.0.1,::1; read=!192.168.0.0/16")
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		group Group
+		ip    string
+		res   bool
+	}{
+		{group: GroupWrite, ip: "10.0.0.1", res: true},
+		{group: GroupWrite, ip: "10.1.0.1"},
+		{group: GroupWrite, ip: "fd00::1", res: true},
+		{group: GroupWrite, ip: "fe80::1"},
+		{group: GroupWrite, ip: "1.1.1.1"},
+		{group: GroupWrite, ip: "::ffff:10.0.0.1", res: true},
+		{group: GroupWrite},
+		{group: GroupAdmin, ip: "127.0.0.1", res: true},
+		{group: GroupAdmin, ip: "::1", res: true},
+		{group: GroupAdmin, ip: "127.0.0.2"},
+		{group: GroupRead, ip: "1.1.1.1", res: true},
+		{group: GroupRead, ip: "192.168.1.1"},
+	} {
+		assert.Equal(t, tt.res, policy.Allowed(tt.group, net.ParseIP(tt.ip)), "%s %s", tt.group, tt.ip)
+	}
+}
+
+func TestPolicyNoRules(t *testing.T) {
+	var nilPolicy *Policy
+	assert.True(t, nilPolicy.Allowed(GroupWrite, net.ParseIP("1.1.1.1")))
+	assert.True(t, nilPolicy.Allowed(GroupWrite, nil))
+
+	policy, err := ParsePolicy("")
+	require.NoError(t, err)
+	assert.True(t, policy.Allowed(GroupRead, net.ParseIP("1.1.1.1")))
+
+	_, ok := policy.Rule(GroupRead)
+	assert.False(t, ok)
+
+	policy.Allow(GroupRead, &net.IPNet{IP: net.IPv4(1, 1, 1, 0), Mask: net.CIDRMask(24, 32)})
+	assert.True(t, policy.Allowed(GroupRead, net.ParseIP("1.1.1.1")))
+	assert.False(t, policy.Allowed(GroupRead, net.ParseIP("1.1.2.1")))
+}
+
+func TestParsePolicyError(t *testing.T) {
+	for _, spec := range []string{
+		"write",
+		"foo=10.0.0.0/8",
+		"write=10.0.0.0/500",
+		"read=!abc",
+	} {
+		_, err := ParsePolicy(spec)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,157 @@
+// Package apikey provides API key authentication with scopes.
+package apikey
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	AuthorizationHeader = "Authorization"
+	KeyHeader           = "X-API-Key"
+)
+
+// Scope - permission of API key.
+type Scope string
+
+const (
+	ScopeWrite Scope = "metrics:write"
+	ScopeRead  Scope = "metrics:read"
+	ScopeAdmin Scope = "admin"
+)
+
+var _scopes = map[Scope]bool{ScopeWrite: true, ScopeRead: true, ScopeAdmin: true}
+
+var (
+	ErrKeyMissing = errors.New("API key missing")
+	ErrKeyUnknown = errors.New("API key unknown")
+)
+
+// KeyConfig - API key description in keys file. Key itself is not stored,
+// only its SHA-256 hash in hex.
+type KeyConfig struct {
+	ID      string  `json:"id"`
+	KeyHash string  `json:"key_hash"`
+	Scopes  []Scope `json:"scopes"`
+	Prefix  string  `json:"prefix"`
+}
+
+// Key - authenticated API key.
+type Key struct {
+	ID     string
+	Scopes map[Scope]bool
+	// Prefix - if set, key writes only metrics with names with this prefix.
+	Prefix string
+}
+
+// HasScope checks that key has scope.
+func (k *Key) HasScope(scope Scope) bool {
+	return k.Scopes[scope]
+}
+
+// CanWrite checks that key may write metric with name.
+func (k *Key) CanWrite(name string) bool {
+	return k.HasScope(ScopeWrite) && strings.HasPrefix(name, k.Prefix)
+}
+
+// Authenticator authenticates API keys by their hashes.
+type Authenticator struct {
+	keys map[string]*Key
+}
+
+func NewAuthenticator(configs []KeyConfig) (*Authenticator, error) {
+	keys := make(map[string]*Key, len(configs))
+	ids := make(map[string]bool, len(configs))
+	for i, cfg := range configs {
+		if cfg.ID == "" || ids[cfg.ID] {
+			return nil, fmt.Errorf("wrong API key #%d: empty or duplicate ID", i)
+		}
+		ids[cfg.ID] = true
+
+		keyHash := strings.ToLower(cfg.KeyHash)
+		if b, err := hex.DecodeString(keyHash); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("wrong API key %s: wrong hash", cfg.ID)
+		}
+		if _, ok := keys[keyHash]; ok {
+			return nil, fmt.Errorf("wrong API key %s: duplicate hash", cfg.ID)
+		}
+
+		key := &Key{ID: cfg.ID, Scopes: make(map[Scope]bool, len(cfg.Scopes)), Prefix: cfg.Prefix}
+		for _, scope := range cfg.Scopes {
+			if !_scopes[scope] {
+				return nil, fmt.Errorf("wrong API key %s: unknown scope %s", cfg.ID, scope)
+			}
+			key.Scopes[scope] = true
+		}
+		keys[keyHash] = key
+	}
+	return &Authenticator{keys: keys}, nil
+}
+
+// LoadAuthenticator loads API keys from JSON file with list of KeyConfig.
+func LoadAuthenticator(path string) (*Authenticator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []KeyConfig
+	if err = json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("wrong API keys file: %w", err)
+	}
+	return NewAuthenticator(configs)
+}
+
+// Authenticate returns key by its value.
+func (a *Authenticator) Authenticate(key string) (*Key, error) {
+	if key == "" {
+		return nil, ErrKeyMissing
+	}
+
+	k, ok := a.keys[HashKey(key)]
+	if !ok {
+		return nil, ErrKeyUnknown
+	}
+	return k, nil
+}
+
+// HashKey returns hash of key as it is stored in keys file.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// KeyFromHeaders returns key from "Authorization: Bearer" or X-API-Key header
+// values.
+func KeyFromHeaders(authorization, apiKey string) string {
+	if strings.HasPrefix(authorization, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+	}
+	return strings.TrimSpace(apiKey)
+}
+
+type contextKey struct{}
+
+// NewContext returns context with authenticated key.
+func NewContext(ctx context.Context, key *Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// FromContext returns authenticated key from context.
+func FromContext(ctx context.Context) (*Key, bool) {
+	key, ok := ctx.Value(contextKey{}).(*Key)
+	return key, ok
+}
+
+// WriteAllowed checks that request with context may write metric with name.
+// Requests without authenticated key are not restricted.
+func WriteAllowed(ctx context.Context, name string) bool {
+	key, ok := FromContext(ctx)
+	return !ok || key.CanWrite(name)
+}
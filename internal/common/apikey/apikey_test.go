@@ -0,0 +1,88 @@
+package apikey
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticator(t *testing.T) {
+	auth, err := NewAuthenticator([]KeyConfig{
+		{ID: "team1", KeyHash: HashKey("secret1"), Scopes: []Scope{ScopeWrite, ScopeRead}, Prefix: "team1_"},
+		{ID: "admin", KeyHash: HashKey("secret2"), Scopes: []Scope{ScopeAdmin}},
+	})
+	require.NoError(t, err)
+
+	key, err := auth.Authenticate("secret1")
+	require.NoError(t, err)
+	assert.Equal(t, "team1", key.ID)
+	assert.True(t, key.HasScope(ScopeRead))
+	assert.False(t, key.HasScope(ScopeAdmin))
+	assert.True(t, key.CanWrite("team1_requests"))
+	assert.False(t, key.CanWrite("team2_requests"))
+
+	key, err = auth.Authenticate("secret2")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", key.ID)
+	assert.False(t, key.CanWrite("team1_requests"))
+
+	_, err = auth.Authenticate("")
+	assert.ErrorIs(t, err, ErrKeyMissing)
+
+	_, err = auth.Authenticate("secret3")
+	assert.ErrorIs(t, err, ErrKeyUnknown)
+}
+
+func TestNewAuthenticatorError(t *testing.T) {
+	for _, configs := range [][]KeyConfig{
+		{{KeyHash: HashKey("a")}},
+		{{ID: "a", KeyHash: HashKey("a")}, {ID: "a", KeyHash: HashKey("b")}},
+		{{ID: "a", KeyHash: HashKey("a")}, {ID: "b", KeyHash: HashKey("a")}},
+		{{ID: "a", KeyHash: "foobar"}},
+		{{ID: "a", KeyHash: HashKey("a"), Scopes: []Scope{"metrics:delete"}}},
+	} {
+		_, err := NewAuthenticator(configs)
+		assert.Error(t, err)
+	}
+}
+
+func TestLoadAuthenticator(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keys.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"id": "team1", "key_hash": "`+HashKey("secret1")+`", "scopes": ["metrics:write"], "prefix": "team1_"}
+	]`), 0600))
+
+	auth, err := LoadAuthenticator(path)
+	require.NoError(t, err)
+	key, err := auth.Authenticate("secret1")
+	require.NoError(t, err)
+	assert.Equal(t, "team1_", key.Prefix)
+
+	require.NoError(t, os.WriteFile(path, []byte("foobar"), 0600))
+	_, err = LoadAuthenticator(path)
+	assert.Error(t, err)
+
+	_, err = LoadAuthenticator(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestKeyFromHeaders(t *testing.T) {
+	assert.Equal(t, "abc", KeyFromHeaders("Bearer abc", ""))
+	assert.Equal(t, "abc", KeyFromHeaders("Bearer abc", "def"))
+	assert.Equal(t, "def", KeyFromHeaders("Basic abc", "def"))
+	assert.Equal(t, "", KeyFromHeaders("", ""))
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	assert.True(t, WriteAllowed(ctx, "foo"))
+
+	ctx = NewContext(ctx, &Key{ID: "team1", Scopes: map[Scope]bool{ScopeWrite: true}, Prefix: "team1_"})
+	assert.True(t, WriteAllowed(ctx, "team1_foo"))
+	assert.False(t, WriteAllowed(ctx, "foo"))
+}
@@ -1,4 +1,4 @@
-// Package cipher provides RSA encryption/decryption.
+// Package cipher provides RSA and hybrid RSA+AES-GCM encryption/decryption.
 package cipher
 
 import (
@@ -99,6 +99,9 @@ func PublicKeyToBytes(pub *rsa.PublicKey) ([]byte, error) {
 // BytesToPrivateKey converts slice of bytes to RSA private key.
 func BytesToPrivateKey(priv []byte) (*rsa.PrivateKey, error) {
 	block, _ := pem.Decode(priv)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
 	b := block.Bytes
 	key, err := x509.ParsePKCS1PrivateKey(b)
 	if err != nil {
@@ -110,6 +113,9 @@ func BytesToPrivateKey(priv []byte) (*rsa.PrivateKey, error) {
 // BytesToPublicKey converts slice of bytes to RSA public key.
 func BytesToPublicKey(pub []byte) (*rsa.PublicKey, error) {
 	block, _ := pem.Decode(pub)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
 	b := block.Bytes
 	ifc, err := x509.ParsePKIXPublicKey(b)
 	if err != nil {
@@ -123,6 +129,8 @@ func BytesToPublicKey(pub []byte) (*rsa.PublicKey, error) {
 }
 
 // EncryptWithPublicKey encrypts slice of bytes with RSA public key.
+//
+// Deprecated: format of old agents, use EnvelopeWriter.
 func EncryptWithPublicKey(msg []byte, pub *rsa.PublicKey) ([]byte, error) {
 	hash := sha512.New()
 	msgLen := len(msg)
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestEncryptDecrypt(t *testing.T) {
@@ -62,3 +63,66 @@ func TestEncDecrWithBuffer(t *testing.T) {
 
 	assert.Equal(t, testData, decData)
 }
+
+func TestEnvelope(t *testing.T) {
+	privKey, pubKey, err := GenerateKeyPair(2048)
+	require.NoError(t, err)
+
+	encrypt := func(msg []byte) []byte {
+		var buf bytes.Buffer
+		w, err := NewEnvelopeWriter(pubKey, &buf)
+		require.NoError(t, err)
+		_, err = w.Write(msg)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		return buf.Bytes()
+	}
+	decrypt := func(data []byte) ([]byte, error) {
+		r, err := NewEnvelopeReader(privKey, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+
+	for _, size := range []int{0, 1, _chunkSize, _chunkSize + 1, 3*_chunkSize + 100} {
+		msg := bytes.Repeat([]byte("a"), size)
+		decMsg, err := decrypt(encrypt(msg))
+		require.NoError(t, err, size)
+		assert.Equal(t, len(msg), len(decMsg), size)
+	}
+
+	encData := encrypt(bytes.Repeat([]byte("b"), 2*_chunkSize))
+
+	tampered := append([]byte(nil), encData...)
+	tampered[len(tampered)-1] ^= 0xff
+	_, err = decrypt(tampered)
+	assert.ErrorIs(t, err, ErrWrongEnvelope)
+
+	// Envelope without last chunk
+	_, err = decrypt(encData[:len(encData)-(5+_chunkSize+16)])
+	assert.ErrorIs(t, err, ErrWrongEnvelope)
+
+	_, err = decrypt(append(append([]byte(nil), encData...), 0))
+	assert.ErrorIs(t, err, ErrWrongEnvelope)
+
+	otherPrivKey, _, err := GenerateKeyPair(2048)
+	require.NoError(t, err)
+	_, err = NewEnvelopeReader(otherPrivKey, bytes.NewReader(encData))
+	assert.ErrorIs(t, err, ErrWrongEnvelope)
+}
+
+func TestLegacyDecReader(t *testing.T) {
+	privKey, pubKey, err := GenerateKeyPair(2048)
+	require.NoError(t, err)
+
+	msg := []byte(`{"a":123,"b":"foobar"}`)
+	encData, err := EncryptWithPublicKey(msg, pubKey)
+	require.NoError(t, err)
+
+	decRdr := NewLegacyDecReader(privKey, io.NopCloser(bytes.NewReader(encData)))
+	decData, err := io.ReadAll(decRdr)
+	require.NoError(t, err)
+	assert.NoError(t, decRdr.Close())
+	assert.Equal(t, msg, decData)
+}
@@ -3,29 +3,63 @@ package cipher
 import (
 	"bytes"
 	"crypto/rsa"
+	"errors"
 	"io"
 )
 
 // DecReader implements io.ReadCloser and decrypt input data.
 type DecReader struct {
-	privKey   *rsa.PrivateKey
+	privKeys  []*rsa.PrivateKey
 	inp       io.ReadCloser
+	legacy    bool
+	decRdr    io.Reader
 	decBuf    bytes.Buffer
 	decrypted bool
 }
 
+// NewDecReader returns DecReader for data in envelope format.
 func NewDecReader(privKey *rsa.PrivateKey, inp io.ReadCloser) *DecReader {
-	return &DecReader{privKey: privKey, inp: inp}
+	return NewDecReaderKeys([]*rsa.PrivateKey{privKey}, inp)
+}
+
+// NewDecReaderKeys returns DecReader for data in envelope format, encrypted
+// with any of keys.
+func NewDecReaderKeys(privKeys []*rsa.PrivateKey, inp io.ReadCloser) *DecReader {
+	return &DecReader{privKeys: privKeys, inp: inp}
+}
+
+// NewLegacyDecReader returns DecReader for data encrypted with EncryptWithPublicKey.
+func NewLegacyDecReader(privKey *rsa.PrivateKey, inp io.ReadCloser) *DecReader {
+	return NewLegacyDecReaderKeys([]*rsa.PrivateKey{privKey}, inp)
+}
+
+// NewLegacyDecReaderKeys returns DecReader for data encrypted with
+// EncryptWithPublicKey with any of keys.
+func NewLegacyDecReaderKeys(privKeys []*rsa.PrivateKey, inp io.ReadCloser) *DecReader {
+	return &DecReader{privKeys: privKeys, inp: inp, legacy: true}
 }
 
 func (d *DecReader) Read(p []byte) (n int, err error) {
+	if d.legacy {
+		return d.readLegacy(p)
+	}
+
+	if d.decRdr == nil {
+		if d.decRdr, err = NewEnvelopeReaderKeys(d.privKeys, d.inp); err != nil {
+			return 0, err
+		}
+	}
+	return d.decRdr.Read(p)
+}
+
+func (d *DecReader) readLegacy(p []byte) (n int, err error) {
 	if !d.decrypted {
 		encData, err := io.ReadAll(d.inp)
 		if err != nil {
 			return 0, err
 		}
 
-		decData, err := DecryptWithPrivateKey(encData, d.privKey)
+		decData, err := decryptWithPrivateKeys(encData, d.privKeys)
 		if err != nil {
 			return 0, err
 		}
@@ -46,3 +80,14 @@ func (d *DecReader) Close() error {
 	}
 	return nil
 }
+
+func decryptWithPrivateKeys(ciphertext []byte, privKeys []*rsa.PrivateKey) ([]byte, error) {
+	err := errors.New("no private keys")
+	for _, privKey := range privKeys {
+		var plaintext []byte
+		if plaintext, err = DecryptWithPrivateKey(ciphertext, privKey); err == nil {
+			return plaintext, nil
+		}
+	}
+	return nil, err
+}
@@ -8,13 +8,13 @@ import (
 )
 
 // EncBuffer implements io.ReadWriter with encryption.
-// Write appends internal buffer witj plain data.
-// Read returns encrypted data.
+// Write encrypts data in envelope format to internal buffer.
+// Read returns encrypted data, first Read finishes envelope.
 type EncBuffer struct {
-	pubKey  *rsa.PublicKey
-	buf     bytes.Buffer
-	encBuf  bytes.Buffer
-	encoded bool
+	pubKey   *rsa.PublicKey
+	encBuf   bytes.Buffer
+	envelope *EnvelopeWriter
+	encoded  bool
 }
 
 var _ iotools.PoolBuffer = (*EncBuffer)(nil)
@@ -24,18 +24,23 @@ func NewEncBuffer(pubKey *rsa.PublicKey) *EncBuffer {
 }
 
 func (e *EncBuffer) Write(p []byte) (n int, err error) {
-	return e.buf.Write(p)
+	if e.envelope == nil {
+		if e.envelope, err = NewEnvelopeWriter(e.pubKey, &e.encBuf); err != nil {
+			return 0, err
+		}
+	}
+
+	return e.envelope.Write(p)
 }
 
 func (e *EncBuffer) Read(p []byte) (n int, err error) {
 	if !e.encoded {
-		encData, err := EncryptWithPublicKey(e.buf.Bytes(), e.pubKey)
-		if err != nil {
+		// Envelope for empty data
+		if _, err = e.Write(nil); err != nil {
 			return 0, err
 		}
 
-		_, err = e.encBuf.Write(encData)
-		if err != nil {
+		if err = e.envelope.Close(); err != nil {
 			return 0, err
 		}
 		e.encoded = true
@@ -45,7 +50,7 @@ func (e *EncBuffer) Read(p []byte) (n int, err error) {
 }
 
 func (e *EncBuffer) Reset() {
-	e.buf.Reset()
 	e.encBuf.Reset()
+	e.envelope = nil
 	e.encoded = false
 }
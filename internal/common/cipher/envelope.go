@@ -0,0 +1,255 @@
+package cipher
+
+import (
+	"bufio"
+	"crypto/aes"
+	_cipher "crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ContentEncoding - Content-Encoding header value of envelope encrypted body.
+const ContentEncoding = "rsa-aes256gcm"
+
+// Envelope format:
+//
+//	version (1 byte) | wrapped key length (2 bytes) | RSA-OAEP wrapped AES-256 key |
+//	base nonce (12 bytes) | chunks
+//
+// Every chunk is flag (1 byte) | ciphertext length (4 bytes) | ciphertext.
+// Chunk is sealed with AES-GCM, nonce is base nonce XOR chunk number and flag
+// is additional data, so chunks can't be reordered, and last chunk flag
+// protects from truncation.
+const (
+	_envelopeVersion = 1
+	_envelopeKeySize = 32
+	_chunkSize       = 64 * 1024
+	_chunkLast       = 1
+)
+
+// ErrWrongEnvelope - error for incorrect or damaged envelope.
+var ErrWrongEnvelope = errors.New("wrong envelope")
+
+// EnvelopeWriter encrypts data written to it in envelope format.
+// Close must be called to write last chunk.
+type EnvelopeWriter struct {
+	w       io.Writer
+	aead    _cipher.AEAD
+	nonce   []byte
+	counter uint64
+	buf     []byte
+	closed  bool
+}
+
+// NewEnvelopeWriter generates random AES key, writes envelope header with key
+// wrapped with RSA public key to w and returns EnvelopeWriter.
+func NewEnvelopeWriter(pubKey *rsa.PublicKey, w io.Writer) (*EnvelopeWriter, error) {
+	key := make([]byte, _envelopeKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pubKey, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, 3+len(wrappedKey)+len(nonce))
+	header = append(header, _envelopeVersion)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrappedKey)))
+	header = append(header, wrappedKey...)
+	header = append(header, nonce...)
+	if _, err = w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &EnvelopeWriter{w: w, aead: aead, nonce: nonce}, nil
+}
+
+// Write encrypts full chunks of data, rest is buffered until next Write or Close.
+func (e *EnvelopeWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed envelope")
+	}
+
+	e.buf = append(e.buf, p...)
+	for len(e.buf) > _chunkSize {
+		if err := e.writeChunk(e.buf[:_chunkSize], 0); err != nil {
+			return 0, err
+		}
+		e.buf = e.buf[_chunkSize:]
+	}
+	return len(p), nil
+}
+
+// Close writes buffered data as last chunk.
+func (e *EnvelopeWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+
+	err := e.writeChunk(e.buf, _chunkLast)
+	e.buf = nil
+	return err
+}
+
+func (e *EnvelopeWriter) writeChunk(plain []byte, flag byte) error {
+	header := make([]byte, 5, 5+len(plain)+e.aead.Overhead())
+	header[0] = flag
+	chunk := e.aead.Seal(header, chunkNonce(e.nonce, e.counter), plain, header[:1])
+	binary.BigEndian.PutUint32(chunk[1:5], uint32(len(chunk)-5))
+	e.counter++
+
+	_, err := e.w.Write(chunk)
+	return err
+}
+
+// EnvelopeReader decrypts data in envelope format.
+type EnvelopeReader struct {
+	r       *bufio.Reader
+	aead    _cipher.AEAD
+	nonce   []byte
+	counter uint64
+	plain   []byte
+	done    bool
+}
+
+// NewEnvelopeReader reads envelope header from r, unwraps AES key with RSA
+// private key and returns EnvelopeReader.
+func NewEnvelopeReader(privKey *rsa.PrivateKey, r io.Reader) (*EnvelopeReader, error) {
+	return NewEnvelopeReaderKeys([]*rsa.PrivateKey{privKey}, r)
+}
+
+// NewEnvelopeReaderKeys is NewEnvelopeReader, which tries every private key
+// to unwrap AES key.
+func NewEnvelopeReaderKeys(privKeys []*rsa.PrivateKey, r io.Reader) (*EnvelopeReader, error) {
+	br := bufio.NewReader(r)
+
+	var header [3]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, fmt.Errorf("header: %v: %w", err, ErrWrongEnvelope)
+	}
+	if header[0] != _envelopeVersion {
+		return nil, fmt.Errorf("unsupported version %d: %w", header[0], ErrWrongEnvelope)
+	}
+
+	wrappedKey := make([]byte, binary.BigEndian.Uint16(header[1:]))
+	if _, err := io.ReadFull(br, wrappedKey); err != nil {
+		return nil, fmt.Errorf("key: %v: %w", err, ErrWrongEnvelope)
+	}
+
+	key, err := unwrapKey(privKeys, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("key: %v: %w", err, ErrWrongEnvelope)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, fmt.Errorf("key: %v: %w", err, ErrWrongEnvelope)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(br, nonce); err != nil {
+		return nil, fmt.Errorf("nonce: %v: %w", err, ErrWrongEnvelope)
+	}
+
+	return &EnvelopeReader{r: br, aead: aead, nonce: nonce}, nil
+}
+
+// Read returns decrypted data. Only authenticated chunks are returned, io.EOF
+// is returned after last chunk.
+func (e *EnvelopeReader) Read(p []byte) (int, error) {
+	for len(e.plain) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, e.plain)
+	e.plain = e.plain[n:]
+	return n, nil
+}
+
+func (e *EnvelopeReader) readChunk() error {
+	var header [5]byte
+	if _, err := io.ReadFull(e.r, header[:]); err != nil {
+		return fmt.Errorf("chunk %d: %v: %w", e.counter, unexpectedEOF(err), ErrWrongEnvelope)
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > uint32(_chunkSize+e.aead.Overhead()) {
+		return fmt.Errorf("chunk %d: too large: %w", e.counter, ErrWrongEnvelope)
+	}
+
+	chunk := make([]byte, size)
+	if _, err := io.ReadFull(e.r, chunk); err != nil {
+		return fmt.Errorf("chunk %d: %v: %w", e.counter, unexpectedEOF(err), ErrWrongEnvelope)
+	}
+
+	plain, err := e.aead.Open(chunk[:0], chunkNonce(e.nonce, e.counter), chunk, header[:1])
+	if err != nil {
+		return fmt.Errorf("chunk %d: %v: %w", e.counter, err, ErrWrongEnvelope)
+	}
+	e.counter++
+	e.plain = plain
+
+	if header[0] == _chunkLast {
+		if _, err = e.r.ReadByte(); err != io.EOF {
+			return fmt.Errorf("data after last chunk: %w", ErrWrongEnvelope)
+		}
+		e.done = true
+	}
+	return nil
+}
+
+func unwrapKey(privKeys []*rsa.PrivateKey, wrappedKey []byte) ([]byte, error) {
+	err := errors.New("no private keys")
+	for _, privKey := range privKeys {
+		var key []byte
+		if key, err = rsa.DecryptOAEP(sha256.New(), nil, privKey, wrappedKey, nil); err == nil {
+			return key, nil
+		}
+	}
+	return nil, err
+}
+
+func newAEAD(key []byte) (_cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return _cipher.NewGCM(block)
+}
+
+func chunkNonce(base []byte, counter uint64) []byte {
+	nonce := append([]byte(nil), base...)
+	tail := nonce[len(nonce)-8:]
+	binary.BigEndian.PutUint64(tail, binary.BigEndian.Uint64(tail)^counter)
+	return nonce
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
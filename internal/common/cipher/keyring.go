@@ -0,0 +1,155 @@
+package cipher
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// KeyIDHeader - HTTP header with ID of key, used for encryption.
+const KeyIDHeader = "X-Crypto-Key-ID"
+
+// KeyRing - set of RSA private keys by key ID.
+//
+// Keys are loaded from comma separated list of key files and directories,
+// every not hidden file of directory is key file. Key ID is file name without
+// extension.
+type KeyRing struct {
+	source string
+
+	mu   sync.RWMutex
+	keys map[string]*rsa.PrivateKey
+	ids  []string
+}
+
+// NewKeyRing returns KeyRing with keys loaded from source or error.
+func NewKeyRing(source string) (*KeyRing, error) {
+	keyRing := &KeyRing{source: source}
+	if err := keyRing.Reload(); err != nil {
+		return nil, err
+	}
+	return keyRing, nil
+}
+
+// NewKeyRingFromKeys returns KeyRing with keys by ID, Reload doesn't change them.
+func NewKeyRingFromKeys(keys map[string]*rsa.PrivateKey) *KeyRing {
+	keyRing := &KeyRing{}
+	keyRing.set(keys)
+	return keyRing
+}
+
+// Reload loads keys from source again. On error current keys are kept.
+func (k *KeyRing) Reload() error {
+	if k.source == "" {
+		return nil
+	}
+
+	keys, err := loadPrivateKeys(k.source)
+	if err != nil {
+		return err
+	}
+
+	k.set(keys)
+	return nil
+}
+
+// Get returns key by ID.
+func (k *KeyRing) Get(id string) (*rsa.PrivateKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[id]
+	return key, ok
+}
+
+// IDs returns sorted key IDs.
+func (k *KeyRing) IDs() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return append([]string(nil), k.ids...)
+}
+
+// Keys returns keys, sorted by ID.
+func (k *KeyRing) Keys() []*rsa.PrivateKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := make([]*rsa.PrivateKey, 0, len(k.ids))
+	for _, id := range k.ids {
+		keys = append(keys, k.keys[id])
+	}
+	return keys
+}
+
+func (k *KeyRing) set(keys map[string]*rsa.PrivateKey) {
+	ids := make([]string, 0, len(keys))
+	for id := range keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys = keys
+	k.ids = ids
+}
+
+func loadPrivateKeys(source string) (map[string]*rsa.PrivateKey, error) {
+	var files []string
+	for _, path := range strings.Split(source, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	keys := make(map[string]*rsa.PrivateKey, len(files))
+	for _, file := range files {
+		id := KeyID(file)
+		if _, ok := keys[id]; ok {
+			return nil, fmt.Errorf("duplicate key ID %q of file %s", id, file)
+		}
+
+		key, err := PrivateKeyFromFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("key file %s: %w", file, err)
+		}
+		keys[id] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys found in %s", source)
+	}
+	return keys, nil
+}
+
+// KeyID returns key ID of key file.
+func KeyID(filePath string) string {
+	name := filepath.Base(filePath)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
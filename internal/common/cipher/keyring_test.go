@@ -0,0 +1,99 @@
+package cipher
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyRing(t *testing.T) {
+	dir := t.TempDir()
+	keysDir := filepath.Join(dir, "keys")
+	require.NoError(t, os.Mkdir(keysDir, 0700))
+
+	writeKey := func(path string) {
+		privKey, _, err := GenerateKeyPair(2048)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, PrivateKeyToBytes(privKey), 0600))
+	}
+	writeKey(filepath.Join(keysDir, "2023.pem"))
+	writeKey(filepath.Join(keysDir, "2024.pem"))
+	writeKey(filepath.Join(dir, "extra.key"))
+	require.NoError(t, os.WriteFile(filepath.Join(keysDir, ".hidden"), []byte("not a key"), 0600))
+
+	keyRing, err := NewKeyRing(keysDir + "," + filepath.Join(dir, "extra.key"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2023", "2024", "extra"}, keyRing.IDs())
+	assert.Len(t, keyRing.Keys(), 3)
+
+	key2024, ok := keyRing.Get("2024")
+	require.True(t, ok)
+	_, ok = keyRing.Get("2025")
+	assert.False(t, ok)
+
+	// Reload with new key, removed key and broken key
+	writeKey(filepath.Join(keysDir, "2025.pem"))
+	require.NoError(t, os.Remove(filepath.Join(keysDir, "2023.pem")))
+	require.NoError(t, keyRing.Reload())
+	assert.Equal(t, []string{"2024", "2025", "extra"}, keyRing.IDs())
+
+	reloadedKey2024, ok := keyRing.Get("2024")
+	require.True(t, ok)
+	assert.True(t, key2024.Equal(reloadedKey2024))
+
+	require.NoError(t, os.WriteFile(filepath.Join(keysDir, "broken.pem"), []byte("not a key"), 0600))
+	assert.Error(t, keyRing.Reload())
+	assert.Equal(t, []string{"2024", "2025", "extra"}, keyRing.IDs())
+}
+
+func TestKeyRingError(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := NewKeyRing(filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+
+	_, err = NewKeyRing(dir)
+	assert.Error(t, err)
+
+	privKey, _, err := GenerateKeyPair(2048)
+	require.NoError(t, err)
+	for _, name := range []string{"key.pem", "key.rsa"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), PrivateKeyToBytes(privKey), 0600))
+	}
+	_, err = NewKeyRing(dir)
+	assert.Error(t, err)
+}
+
+func TestDecReaderKeys(t *testing.T) {
+	privKey, pubKey, err := GenerateKeyPair(2048)
+	require.NoError(t, err)
+	otherPrivKey, _, err := GenerateKeyPair(2048)
+	require.NoError(t, err)
+
+	msg := []byte("Hello World!")
+
+	buf := NewEncBuffer(pubKey)
+	_, err = buf.Write(msg)
+	require.NoError(t, err)
+	encData, err := io.ReadAll(buf)
+	require.NoError(t, err)
+
+	decData, err := io.ReadAll(NewDecReaderKeys([]*rsa.PrivateKey{otherPrivKey, privKey}, io.NopCloser(bytes.NewReader(encData))))
+	require.NoError(t, err)
+	assert.Equal(t, msg, decData)
+
+	_, err = io.ReadAll(NewDecReaderKeys([]*rsa.PrivateKey{otherPrivKey}, io.NopCloser(bytes.NewReader(encData))))
+	assert.ErrorIs(t, err, ErrWrongEnvelope)
+
+	legacyData, err := EncryptWithPublicKey(msg, pubKey)
+	require.NoError(t, err)
+	decData, err = io.ReadAll(NewLegacyDecReaderKeys([]*rsa.PrivateKey{otherPrivKey, privKey}, io.NopCloser(bytes.NewReader(legacyData))))
+	require.NoError(t, err)
+	assert.Equal(t, msg, decData)
+}
@@ -0,0 +1,144 @@
+package hash
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// KeyIDHeader - HTTP header (and gRPC metadata key) with ID of HMAC key,
+// used by agent.
+const KeyIDHeader = "X-Hmac-Key-ID"
+
+// DefaultKeyID - ID of single HMAC key, set without ID.
+const DefaultKeyID = "default"
+
+var ErrUnknownKeyID = errors.New("unknown HMAC key ID")
+
+// KeyRing - set of active HMAC keys by key ID. Hashes are accepted from any
+// active key, responses are signed with primary key.
+type KeyRing struct {
+	keys    map[string]string
+	ids     []string
+	primary string
+}
+
+// NewKeyRing returns KeyRing with keys by ID and primary key ID. If primary
+// is empty, single key is primary.
+func NewKeyRing(keys map[string]string, primary string) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no HMAC keys")
+	}
+
+	ids := make([]string, 0, len(keys))
+	for id, key := range keys {
+		if id == "" || key == "" {
+			return nil, fmt.Errorf("empty HMAC key or key ID %q", id)
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	if primary == "" {
+		if len(ids) > 1 {
+			return nil, errors.New("primary HMAC key ID not set")
+		}
+		primary = ids[0]
+	}
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary HMAC key %q: %w", primary, ErrUnknownKeyID)
+	}
+
+	return &KeyRing{keys: keys, ids: ids, primary: primary}, nil
+}
+
+// ParseKeyRing returns KeyRing from single key without ID and comma separated
+// list of "id=key" pairs. Single key gets DefaultKeyID. Returns nil, if no keys set.
+func ParseKeyRing(key, keyList, primary string) (*KeyRing, error) {
+	keys := make(map[string]string)
+	if key != "" {
+		keys[DefaultKeyID] = key
+	}
+
+	for i, item := range strings.Split(keyList, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		id, k, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("wrong HMAC key #%d, expected id=key", i+1)
+		}
+		if _, ok = keys[id]; ok {
+			return nil, fmt.Errorf("duplicate HMAC key ID %q", id)
+		}
+		keys[id] = k
+	}
+
+	if len(keys) == 0 {
+		if primary != "" {
+			return nil, fmt.Errorf("primary HMAC key %q: %w", primary, ErrUnknownKeyID)
+		}
+		return nil, nil
+	}
+
+	if primary == "" && key != "" {
+		primary = DefaultKeyID
+	}
+	return NewKeyRing(keys, primary)
+}
+
+// Primary returns ID and value of primary key.
+func (k *KeyRing) Primary() (string, string) {
+	return k.primary, k.keys[k.primary]
+}
+
+// Get returns key by ID.
+func (k *KeyRing) Get(id string) (string, bool) {
+	key, ok := k.keys[id]
+	return key, ok
+}
+
+// IDs returns sorted key IDs.
+func (k *KeyRing) IDs() []string {
+	return append([]string(nil), k.ids...)
+}
+
+// Candidates returns keys to check hash of key ID: key of ID or, if ID is
+// empty, all keys starting with primary.
+func (k *KeyRing) Candidates(id string) ([]string, error) {
+	if id != "" {
+		key, ok := k.keys[id]
+		if !ok {
+			return nil, ErrUnknownKeyID
+		}
+		return []string{key}, nil
+	}
+
+	keys := make([]string, 0, len(k.ids))
+	keys = append(keys, k.keys[k.primary])
+	for _, id := range k.ids {
+		if id != k.primary {
+			keys = append(keys, k.keys[id])
+		}
+	}
+	return keys, nil
+}
+
+// HmacEqual checks, that hmac is equal to hmacFn result for key of ID or,
+// if ID is empty, for any key.
+func (k *KeyRing) HmacEqual(id, hmac string, hmacFn func(key string) string) bool {
+	keys, err := k.Candidates(id)
+	if err != nil {
+		return false
+	}
+
+	for _, key := range keys {
+		if HmacEqual(hmac, hmacFn(key)) {
+			return true
+		}
+	}
+	return false
+}
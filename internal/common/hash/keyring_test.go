@@ -0,0 +1,81 @@
+package hash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeyRing(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		key        string
+		keyList    string
+		primary    string
+		ids        []string
+		primaryID  string
+		primaryKey string
+		err        bool
+		empty      bool
+	}{
+		{name: "empty", empty: true},
+		{name: "single key", key: "foo", ids: []string{"default"}, primaryID: "default", primaryKey: "foo"},
+		{name: "single key in list", keyList: "team1=foo", ids: []string{"team1"}, primaryID: "team1", primaryKey: "foo"},
+		{
+			name: "key and list", key: "foo", keyList: " team1=bar, team2=b=z ",
+			ids: []string{"default", "team1", "team2"}, primaryID: "default", primaryKey: "foo",
+		},
+		{
+			name: "primary from list", key: "foo", keyList: "team1=bar,team2=b=z", primary: "team2",
+			ids: []string{"default", "team1", "team2"}, primaryID: "team2", primaryKey: "b=z",
+		},
+		{name: "no primary", keyList: "team1=bar,team2=baz", err: true},
+		{name: "unknown primary", keyList: "team1=bar", primary: "team2", err: true},
+		{name: "primary without keys", primary: "team2", err: true},
+		{name: "wrong item", keyList: "team1", err: true},
+		{name: "empty key", keyList: "team1=", err: true},
+		{name: "duplicate", key: "foo", keyList: "default=bar", err: true},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			keyRing, err := ParseKeyRing(tt.key, tt.keyList, tt.primary)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			if tt.empty {
+				assert.Nil(t, keyRing)
+				return
+			}
+
+			assert.Equal(t, tt.ids, keyRing.IDs())
+			id, key := keyRing.Primary()
+			assert.Equal(t, tt.primaryID, id)
+			assert.Equal(t, tt.primaryKey, key)
+		})
+	}
+}
+
+func TestKeyRingHmacEqual(t *testing.T) {
+	keyRing, err := NewKeyRing(map[string]string{"team1": "k1", "team2": "k2", "team3": "k3"}, "team2")
+	require.NoError(t, err)
+
+	keys, err := keyRing.Candidates("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"k2", "k1", "k3"}, keys)
+
+	_, err = keyRing.Candidates("team4")
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+
+	hmacFn := func(key string) string { return HmacSHA256("data", key) }
+	hmac := HmacSHA256("data", "k3")
+
+	assert.True(t, keyRing.HmacEqual("", hmac, hmacFn))
+	assert.True(t, keyRing.HmacEqual("team3", hmac, hmacFn))
+	assert.False(t, keyRing.HmacEqual("team1", hmac, hmacFn))
+	assert.False(t, keyRing.HmacEqual("team4", hmac, hmacFn))
+	assert.False(t, keyRing.HmacEqual("", HmacSHA256("data", "k4"), hmacFn))
+}
@@ -0,0 +1,179 @@
+package hash
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SignatureHeader - HTTP header (and gRPC metadata key) with request signature.
+//
+// Header value is "t=<unix timestamp>,n=<nonce>[,k=<key ID>],s=<signature>",
+// where signature is HMAC-SHA256 of request target (HTTP method and URI or
+// gRPC method), timestamp, nonce and SHA-256 of request body.
+const SignatureHeader = "X-Request-Signature"
+
+const (
+	_nonceSize = 16
+
+	// DefaultSignatureWindow - default max clock skew of signed request timestamp.
+	DefaultSignatureWindow = 5 * time.Minute
+)
+
+var (
+	ErrSignatureMissing   = errors.New("request signature missing")
+	ErrSignatureMalformed = errors.New("request signature malformed")
+	ErrSignatureWrong     = errors.New("request signature wrong")
+	ErrSignatureStale     = errors.New("request signature timestamp out of window")
+	ErrSignatureReplayed  = errors.New("request signature nonce already used")
+)
+
+// SignRequest returns signature header value for request target and body.
+// Key ID is optional.
+func SignRequest(key, keyID, target string, body []byte, now time.Time) (string, error) {
+	nonce := make([]byte, _nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	ts := now.Unix()
+	n := hex.EncodeToString(nonce)
+	var k string
+	if keyID != "" {
+		k = ",k=" + keyID
+	}
+	return fmt.Sprintf("t=%d,n=%s%s,s=%s", ts, n, k, requestHmac(key, target, ts, n, body)), nil
+}
+
+// HTTPRequestTarget returns signed target of HTTP request: method and URI.
+func HTTPRequestTarget(r *http.Request) string {
+	return r.Method + " " + r.URL.RequestURI()
+}
+
+func requestHmac(key, target string, ts int64, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return HmacSHA256(fmt.Sprintf("%s\n%d\n%s\n%x", target, ts, nonce, bodyHash), key)
+}
+
+type signature struct {
+	timestamp int64
+	nonce     string
+	keyID     string
+	value     string
+}
+
+func parseSignature(header string) (signature, error) {
+	var sig signature
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return signature{}, ErrSignatureMalformed
+		}
+
+		switch k {
+		case "t":
+			ts, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return signature{}, ErrSignatureMalformed
+			}
+			sig.timestamp = ts
+		case "n":
+			sig.nonce = v
+		case "k":
+			sig.keyID = v
+		case "s":
+			sig.value = v
+		}
+	}
+
+	if sig.timestamp == 0 || sig.nonce == "" || sig.value == "" {
+		return signature{}, ErrSignatureMalformed
+	}
+	return sig, nil
+}
+
+// SignatureVerifier checks request signatures and remembers nonces of
+// accepted requests within window to reject replays.
+type SignatureVerifier struct {
+	keyRing  *KeyRing
+	window   time.Duration
+	required bool
+
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewSignatureVerifier returns SignatureVerifier. If required is false,
+// requests without signature are accepted.
+func NewSignatureVerifier(keyRing *KeyRing, window time.Duration, required bool) *SignatureVerifier {
+	return &SignatureVerifier{
+		keyRing:  keyRing,
+		window:   window,
+		required: required,
+		nonces:   make(map[string]time.Time),
+	}
+}
+
+// Verify checks signature header value for request target and body.
+func (s *SignatureVerifier) Verify(header, target string, body []byte) error {
+	if header == "" {
+		if s.required {
+			return ErrSignatureMissing
+		}
+		return nil
+	}
+
+	sig, err := parseSignature(header)
+	if err != nil {
+		return err
+	}
+
+	if _, err = s.keyRing.Candidates(sig.keyID); err != nil {
+		return err
+	}
+
+	if !s.keyRing.HmacEqual(sig.keyID, sig.value, func(key string) string {
+		return requestHmac(key, target, sig.timestamp, sig.nonce, body)
+	}) {
+		return ErrSignatureWrong
+	}
+
+	now := time.Now()
+	ts := time.Unix(sig.timestamp, 0)
+	if ts.Before(now.Add(-s.window)) || ts.After(now.Add(s.window)) {
+		return ErrSignatureStale
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+	if _, ok := s.nonces[sig.nonce]; ok {
+		return ErrSignatureReplayed
+	}
+	// Nonce may be forgotten, when timestamp leaves window.
+	s.nonces[sig.nonce] = ts.Add(s.window)
+
+	return nil
+}
+
+func (s *SignatureVerifier) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.window/2 {
+		return
+	}
+	s.lastSweep = now
+
+	for nonce, expire := range s.nonces {
+		if now.After(expire) {
+			delete(s.nonces, nonce)
+		}
+	}
+}
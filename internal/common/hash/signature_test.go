@@ -0,0 +1,99 @@
+package hash
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignatureVerifier(t *testing.T) {
+	body := []byte(`[{"id":"foo","type":"counter","delta":1}]`)
+
+	for _, tt := range []struct {
+		name     string
+		key      string
+		keyID    string
+		target   string
+		body     []byte
+		ts       time.Time
+		required bool
+		header   func(sig string) string
+		err      error
+	}{
+		{name: "valid", key: "foobar", target: "POST /updates/", body: body, ts: time.Now()},
+		{name: "clock skew in window", key: "foobar", target: "POST /updates/", body: body, ts: time.Now().Add(4 * time.Minute)},
+		{name: "wrong key", key: "barfoo", target: "POST /updates/", body: body, ts: time.Now(), err: ErrSignatureWrong},
+		{name: "other active key", key: "k1", target: "POST /updates/", body: body, ts: time.Now()},
+		{name: "key ID", key: "k1", keyID: "team1", target: "POST /updates/", body: body, ts: time.Now()},
+		{name: "wrong key ID", key: "k1", keyID: "default", target: "POST /updates/", body: body, ts: time.Now(), err: ErrSignatureWrong},
+		{name: "unknown key ID", key: "k1", keyID: "team2", target: "POST /updates/", body: body, ts: time.Now(), err: ErrUnknownKeyID},
+		{name: "wrong target", key: "foobar", target: "POST /update/", body: body, ts: time.Now(), err: ErrSignatureWrong},
+		{name: "wrong body", key: "foobar", target: "POST /updates/", body: []byte("[]"), ts: time.Now(), err: ErrSignatureWrong},
+		{name: "stale", key: "foobar", target: "POST /updates/", body: body, ts: time.Now().Add(-6 * time.Minute), err: ErrSignatureStale},
+		{name: "future", key: "foobar", target: "POST /updates/", body: body, ts: time.Now().Add(6 * time.Minute), err: ErrSignatureStale},
+		{
+			name: "missing optional", key: "foobar", target: "POST /updates/", body: body, ts: time.Now(),
+			header: func(string) string { return "" },
+		},
+		{
+			name: "missing required", key: "foobar", target: "POST /updates/", body: body, ts: time.Now(), required: true,
+			header: func(string) string { return "" }, err: ErrSignatureMissing,
+		},
+		{
+			name: "malformed", key: "foobar", target: "POST /updates/", body: body, ts: time.Now(),
+			header: func(sig string) string { return strings.Replace(sig, "t=", "t=x", 1) }, err: ErrSignatureMalformed,
+		},
+		{
+			name: "no nonce", key: "foobar", target: "POST /updates/", body: body, ts: time.Now(),
+			header: func(sig string) string { return strings.Replace(sig, "n=", "x=", 1) }, err: ErrSignatureMalformed,
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := NewSignatureVerifier(testKeyRing(t), DefaultSignatureWindow, tt.required)
+
+			sig, err := SignRequest(tt.key, tt.keyID, "POST /updates/", body, tt.ts)
+			require.NoError(t, err)
+			if tt.header != nil {
+				sig = tt.header(sig)
+			}
+
+			assert.ErrorIs(t, verifier.Verify(sig, tt.target, tt.body), tt.err)
+		})
+	}
+}
+
+func TestSignatureVerifierReplay(t *testing.T) {
+	body := []byte("body")
+	verifier := NewSignatureVerifier(testKeyRing(t), DefaultSignatureWindow, false)
+
+	sig, err := SignRequest("foobar", "", "POST /updates/", body, time.Now())
+	require.NoError(t, err)
+	assert.NoError(t, verifier.Verify(sig, "POST /updates/", body))
+	assert.ErrorIs(t, verifier.Verify(sig, "POST /updates/", body), ErrSignatureReplayed)
+
+	// Same body with new nonce is accepted
+	sig2, err := SignRequest("foobar", "", "POST /updates/", body, time.Now())
+	require.NoError(t, err)
+	assert.NotEqual(t, sig, sig2)
+	assert.NoError(t, verifier.Verify(sig2, "POST /updates/", body))
+}
+
+func TestSignatureVerifierSweep(t *testing.T) {
+	verifier := NewSignatureVerifier(testKeyRing(t), DefaultSignatureWindow, false)
+	now := time.Now()
+	verifier.nonces["expired"] = now.Add(-time.Second)
+	verifier.nonces["active"] = now.Add(time.Minute)
+
+	verifier.sweep(now)
+	assert.Equal(t, map[string]time.Time{"active": now.Add(time.Minute)}, verifier.nonces)
+}
+
+func testKeyRing(t *testing.T) *KeyRing {
+	keyRing, err := ParseKeyRing("foobar", "team1=k1", "")
+	require.NoError(t, err)
+	return keyRing
+}
@@ -12,6 +12,7 @@ const (
 	BaseContentTypeApplicationJSON = "application/json"
 	BaseContentTypeCSS             = "text/css"
 	BaseContentTypeHTML            = "text/html"
+	BaseContentTypeOpenMetrics     = "application/openmetrics-text"
 	BaseContentTextPlain           = "text/plain"
 	BaseContentTypeXML             = "text/xml"
 )
@@ -20,6 +21,10 @@ var (
 	ContentTypeApplicationJSON = getFullContentType(BaseContentTypeApplicationJSON, CharsetUTf8)
 	ContentTypeHTML            = getFullContentType(BaseContentTypeHTML, CharsetUTf8)
 	ContentTypeTextPlain       = getFullContentType(BaseContentTextPlain, CharsetUTf8)
+	// ContentTypePrometheusText - Prometheus text exposition format 0.0.4.
+	ContentTypePrometheusText = getFullContentType(BaseContentTextPlain+"; version=0.0.4", CharsetUTf8)
+	// ContentTypeOpenMetrics - OpenMetrics text format 1.0.0.
+	ContentTypeOpenMetrics = getFullContentType(BaseContentTypeOpenMetrics+"; version=1.0.0", CharsetUTf8)
 )
 
 func getFullContentType(contentType string, charset string) string {
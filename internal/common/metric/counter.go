@@ -53,6 +53,6 @@ func (c Counter) TypeName() string {
 }
 
 // Hmac returns hmac value for Counter.
-func (c Counter) Hmac(id, key string) string {
-	return hash.HmacSHA256(fmt.Sprintf("%s:counter:%d", id, c), key)
+func (c Counter) Hmac(id string, labels Labels, key string) string {
+	return hash.HmacSHA256(fmt.Sprintf("%s:counter:%d", SeriesID(id, labels), c), key)
 }
@@ -45,5 +45,14 @@ func TestCounterTypeName(t *testing.T) {
 func TestCounterHmac(t *testing.T) {
 	assert.Equal(t,
 		"83c6f47b3960e54841ddd4e46f925289d9bec6d80faad307c80d0987db15df62",
-		Counter(123).Hmac("foo", "bar"))
+		Counter(123).Hmac("foo", nil, "bar"))
+}
+
+func TestCounterHmacWithLabels(t *testing.T) {
+	assert.NotEqual(t,
+		Counter(123).Hmac("foo", nil, "bar"),
+		Counter(123).Hmac("foo", Labels{"cpu": "1"}, "bar"))
+	assert.Equal(t,
+		Counter(123).Hmac("foo", Labels{"cpu": "1", "host": "a"}, "bar"),
+		Counter(123).Hmac("foo", Labels{"host": "a", "cpu": "1"}, "bar"))
 }
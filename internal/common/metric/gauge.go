@@ -50,6 +50,6 @@ func (g Gauge) TypeName() string {
 }
 
 // Hmac returns hmac value for Gauge.
-func (g Gauge) Hmac(id, key string) string {
-	return hash.HmacSHA256(fmt.Sprintf("%s:gauge:%f", id, g), key)
+func (g Gauge) Hmac(id string, labels Labels, key string) string {
+	return hash.HmacSHA256(fmt.Sprintf("%s:gauge:%f", SeriesID(id, labels), g), key)
 }
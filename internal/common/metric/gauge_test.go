@@ -45,5 +45,11 @@ func TestGaugeTypeName(t *testing.T) {
 func TestGaugeHmac(t *testing.T) {
 	assert.Equal(t,
 		"2f7e24d0b4f8ff42c7ca771b44e80daaf0460ed08cbccb7228b821a9b5204934",
-		Gauge(123.123).Hmac("foo", "bar"))
+		Gauge(123.123).Hmac("foo", nil, "bar"))
+}
+
+func TestGaugeHmacWithLabels(t *testing.T) {
+	assert.NotEqual(t,
+		Gauge(123.123).Hmac("foo", nil, "bar"),
+		Gauge(123.123).Hmac("foo", Labels{"cpu": "1"}, "bar"))
 }
@@ -0,0 +1,225 @@
+package metric
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/devldavydov/promytheus/internal/common/hash"
+)
+
+const HistogramTypeName string = "histogram"
+
+// Histogram - histogram type.
+//
+// Buckets are cumulative: Buckets[i] is the number of observations less than
+// or equal to Bounds[i]. The implicit +Inf bucket equals Count.
+type Histogram struct {
+	Bounds  []float64 `json:"bounds"`  // bucket upper bounds in ascending order
+	Buckets []uint64  `json:"buckets"` // cumulative bucket counts
+	Sum     float64   `json:"sum"`     // sum of observations
+	Count   uint64    `json:"count"`   // count of observations
+}
+
+var _ MetricValue = (*Histogram)(nil)
+
+// NewHistogram returns new empty Histogram with given bucket bounds or error.
+func NewHistogram(bounds []float64) (Histogram, error) {
+	h := Histogram{
+		Bounds:  append([]float64(nil), bounds...),
+		Buckets: make([]uint64, len(bounds)),
+	}
+	if err := h.validate(); err != nil {
+		return Histogram{}, err
+	}
+	return h, nil
+}
+
+// NewHistogramFromParts returns new Histogram from bounds, cumulative buckets,
+// sum and count pointers or error.
+func NewHistogramFromParts(bounds []float64, buckets []uint64, sum *float64, count *uint64) (Histogram, error) {
+	if sum == nil || count == nil {
+		return Histogram{}, errors.New("nil pointer")
+	}
+
+	h := Histogram{
+		Bounds:  append([]float64(nil), bounds...),
+		Buckets: append([]uint64(nil), buckets...),
+		Sum:     *sum,
+		Count:   *count,
+	}
+	if err := h.validate(); err != nil {
+		return Histogram{}, err
+	}
+	return h, nil
+}
+
+// NewHistogramFromString returns new Histogram from string in format
+// "bounds=b1,b2;buckets=c1,c2;sum=s;count=n" or error.
+func NewHistogramFromString(val string) (Histogram, error) {
+	parts := make(map[string]string, 4)
+	for _, part := range strings.Split(val, ";") {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			return Histogram{}, fmt.Errorf("wrong histogram part %q", part)
+		}
+		parts[k] = v
+	}
+
+	var bounds []float64
+	for _, s := range splitList(parts["bounds"]) {
+		b, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return Histogram{}, err
+		}
+		bounds = append(bounds, b)
+	}
+
+	var buckets []uint64
+	for _, s := range splitList(parts["buckets"]) {
+		b, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return Histogram{}, err
+		}
+		buckets = append(buckets, b)
+	}
+
+	sum, err := strconv.ParseFloat(parts["sum"], 64)
+	if err != nil {
+		return Histogram{}, err
+	}
+
+	count, err := strconv.ParseUint(parts["count"], 10, 64)
+	if err != nil {
+		return Histogram{}, err
+	}
+
+	return NewHistogramFromParts(bounds, buckets, &sum, &count)
+}
+
+// Observe adds value to Histogram.
+func (h *Histogram) Observe(val float64) {
+	h.ObserveN(val, 1)
+}
+
+// ObserveN adds value observed n times to Histogram.
+func (h *Histogram) ObserveN(val float64, n uint64) {
+	idx := sort.SearchFloat64s(h.Bounds, val)
+	for i := idx; i < len(h.Buckets); i++ {
+		h.Buckets[i] += n
+	}
+	h.Sum += val * float64(n)
+	h.Count += n
+}
+
+// Merge returns new Histogram with observations of both histograms or error,
+// if bucket bounds differ.
+func (h Histogram) Merge(other Histogram) (Histogram, error) {
+	if !equalBounds(h.Bounds, other.Bounds) {
+		return Histogram{}, fmt.Errorf("histogram bounds mismatch: %w", ErrWrongMetricValue)
+	}
+
+	res := Histogram{
+		Bounds:  append([]float64(nil), h.Bounds...),
+		Buckets: make([]uint64, len(h.Buckets)),
+		Sum:     h.Sum + other.Sum,
+		Count:   h.Count + other.Count,
+	}
+	for i := range res.Buckets {
+		res.Buckets[i] = h.Buckets[i] + other.Buckets[i]
+	}
+	return res, nil
+}
+
+// SumP returns Histogram sum converted to float64 pointer.
+func (h Histogram) SumP() *float64 {
+	v := h.Sum
+	return &v
+}
+
+// CountP returns Histogram count converted to uint64 pointer.
+func (h Histogram) CountP() *uint64 {
+	v := h.Count
+	return &v
+}
+
+// String returns string representation of Histogram value.
+func (h Histogram) String() string {
+	bounds := make([]string, 0, len(h.Bounds))
+	for _, b := range h.Bounds {
+		bounds = append(bounds, strconv.FormatFloat(b, 'g', -1, 64))
+	}
+
+	buckets := make([]string, 0, len(h.Buckets))
+	for _, b := range h.Buckets {
+		buckets = append(buckets, strconv.FormatUint(b, 10))
+	}
+
+	return fmt.Sprintf("bounds=%s;buckets=%s;sum=%s;count=%d",
+		strings.Join(bounds, ","),
+		strings.Join(buckets, ","),
+		strconv.FormatFloat(h.Sum, 'g', -1, 64),
+		h.Count)
+}
+
+// TypeName returns Histogram type name.
+func (h Histogram) TypeName() string {
+	return HistogramTypeName
+}
+
+// Hmac returns hmac value for Histogram.
+func (h Histogram) Hmac(id string, labels Labels, key string) string {
+	return hash.HmacSHA256(fmt.Sprintf("%s:histogram:%s", SeriesID(id, labels), h), key)
+}
+
+func (h Histogram) validate() error {
+	if len(h.Bounds) != len(h.Buckets) {
+		return errors.New("bounds and buckets length mismatch")
+	}
+
+	for i, b := range h.Bounds {
+		if math.IsNaN(b) || math.IsInf(b, 0) {
+			return errors.New("bound is not finite")
+		}
+		if i > 0 && b <= h.Bounds[i-1] {
+			return errors.New("bounds not in ascending order")
+		}
+	}
+
+	for i, c := range h.Buckets {
+		if i > 0 && c < h.Buckets[i-1] {
+			return errors.New("buckets not cumulative")
+		}
+		if c > h.Count {
+			return errors.New("bucket greater than count")
+		}
+	}
+
+	if math.IsNaN(h.Sum) {
+		return errors.New("sum is NaN")
+	}
+
+	return nil
+}
+
+func equalBounds(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func splitList(val string) []string {
+	if val == "" {
+		return nil
+	}
+	return strings.Split(val, ",")
+}
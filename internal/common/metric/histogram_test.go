@@ -0,0 +1,122 @@
+package metric
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHistogram(t *testing.T) {
+	h, err := NewHistogram([]float64{0.1, 0.5, 1})
+	assert.NoError(t, err)
+	assert.Equal(t, Histogram{Bounds: []float64{0.1, 0.5, 1}, Buckets: []uint64{0, 0, 0}}, h)
+}
+
+func TestNewHistogramError(t *testing.T) {
+	for _, bounds := range [][]float64{
+		{1, 0.5},
+		{1, 1},
+		{math.NaN()},
+		{math.Inf(1)},
+	} {
+		_, err := NewHistogram(bounds)
+		assert.Error(t, err)
+	}
+}
+
+func TestHistogramObserve(t *testing.T) {
+	h, err := NewHistogram([]float64{0.1, 0.5, 1})
+	assert.NoError(t, err)
+
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 5} {
+		h.Observe(v)
+	}
+
+	assert.Equal(t, []uint64{2, 3, 4}, h.Buckets)
+	assert.Equal(t, uint64(5), h.Count)
+	assert.InDelta(t, 6.15, h.Sum, 1e-9)
+
+	h.ObserveN(0.3, 1000)
+	assert.Equal(t, []uint64{2, 1003, 1004}, h.Buckets)
+	assert.Equal(t, uint64(1005), h.Count)
+	assert.InDelta(t, 306.15, h.Sum, 1e-9)
+}
+
+func TestNewHistogramFromParts(t *testing.T) {
+	sum, count := 2.5, uint64(5)
+	h, err := NewHistogramFromParts([]float64{0.1, 0.5}, []uint64{1, 3}, &sum, &count)
+	assert.NoError(t, err)
+	assert.Equal(t, Histogram{Bounds: []float64{0.1, 0.5}, Buckets: []uint64{1, 3}, Sum: 2.5, Count: 5}, h)
+}
+
+func TestNewHistogramFromPartsError(t *testing.T) {
+	sum, count := 2.5, uint64(5)
+
+	_, err := NewHistogramFromParts([]float64{0.1}, []uint64{1}, nil, &count)
+	assert.Error(t, err)
+
+	_, err = NewHistogramFromParts([]float64{0.1}, []uint64{1}, &sum, nil)
+	assert.Error(t, err)
+
+	_, err = NewHistogramFromParts([]float64{0.1, 0.5}, []uint64{1}, &sum, &count)
+	assert.Error(t, err)
+
+	_, err = NewHistogramFromParts([]float64{0.1, 0.5}, []uint64{3, 1}, &sum, &count)
+	assert.Error(t, err)
+
+	_, err = NewHistogramFromParts([]float64{0.1}, []uint64{6}, &sum, &count)
+	assert.Error(t, err)
+}
+
+func TestNewHistogramFromString(t *testing.T) {
+	h, err := NewHistogramFromString("bounds=0.1,0.5;buckets=1,3;sum=2.5;count=5")
+	assert.NoError(t, err)
+	assert.Equal(t, Histogram{Bounds: []float64{0.1, 0.5}, Buckets: []uint64{1, 3}, Sum: 2.5, Count: 5}, h)
+
+	h, err = NewHistogramFromString("bounds=;buckets=;sum=0;count=0")
+	assert.NoError(t, err)
+	assert.Equal(t, Histogram{}, h)
+}
+
+func TestNewHistogramFromStringError(t *testing.T) {
+	for _, val := range []string{
+		"abc",
+		"bounds=a;buckets=1;sum=1;count=1",
+		"bounds=1;buckets=-1;sum=1;count=1",
+		"bounds=1;buckets=1;sum=a;count=1",
+		"bounds=1;buckets=1;sum=1",
+		"bounds=1;sum=1;count=1",
+	} {
+		_, err := NewHistogramFromString(val)
+		assert.Error(t, err, val)
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	a := Histogram{Bounds: []float64{0.1, 0.5}, Buckets: []uint64{1, 3}, Sum: 2.5, Count: 5}
+	b := Histogram{Bounds: []float64{0.1, 0.5}, Buckets: []uint64{0, 1}, Sum: 1, Count: 2}
+
+	res, err := a.Merge(b)
+	assert.NoError(t, err)
+	assert.Equal(t, Histogram{Bounds: []float64{0.1, 0.5}, Buckets: []uint64{1, 4}, Sum: 3.5, Count: 7}, res)
+	assert.Equal(t, []uint64{1, 3}, a.Buckets)
+
+	_, err = a.Merge(Histogram{Bounds: []float64{0.1}, Buckets: []uint64{1}, Count: 1})
+	assert.ErrorIs(t, err, ErrWrongMetricValue)
+}
+
+func TestHistogramToString(t *testing.T) {
+	h := Histogram{Bounds: []float64{0.1, 0.5}, Buckets: []uint64{1, 3}, Sum: 2.5, Count: 5}
+	assert.Equal(t, "bounds=0.1,0.5;buckets=1,3;sum=2.5;count=5", h.String())
+}
+
+func TestHistogramTypeName(t *testing.T) {
+	assert.Equal(t, HistogramTypeName, Histogram{}.TypeName())
+}
+
+func TestHistogramHmac(t *testing.T) {
+	h := Histogram{Bounds: []float64{0.1}, Buckets: []uint64{1}, Sum: 0.1, Count: 1}
+	assert.Equal(t, h.Hmac("foo", nil, "bar"), h.Hmac("foo", nil, "bar"))
+	assert.NotEqual(t, h.Hmac("foo", nil, "bar"), Histogram{Bounds: []float64{0.1}, Buckets: []uint64{1}, Sum: 0.1, Count: 2}.Hmac("foo", nil, "bar"))
+}
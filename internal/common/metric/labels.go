@@ -0,0 +1,193 @@
+package metric
+
+import (
+	"sort"
+	"strings"
+)
+
+// Labels - set of metric key/value labels, part of metric series identity.
+type Labels map[string]string
+
+// Validate checks that all label names are correct.
+func (l Labels) Validate() error {
+	for name := range l {
+		if !isValidName(name, false) {
+			return ErrWrongMetricLabels
+		}
+	}
+	return nil
+}
+
+// String returns canonical representation of Labels, sorted by name: {k1="v1",k2="v2"}.
+// Empty Labels represented as empty string.
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name)
+		sb.WriteString(`="`)
+		sb.WriteString(EscapeLabelValue(l[name]))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+
+	return sb.String()
+}
+
+// SeriesID returns metric series identity from metric name and labels: name{k1="v1",k2="v2"}.
+func SeriesID(name string, labels Labels) string {
+	return name + labels.String()
+}
+
+// ParseSeriesID splits metric series identity to metric name and labels or error.
+func ParseSeriesID(id string) (string, Labels, error) {
+	pos := strings.IndexByte(id, '{')
+	if pos == -1 {
+		return id, nil, nil
+	}
+
+	name, rest := id[:pos], id[pos+1:]
+	if !strings.HasSuffix(rest, "}") {
+		return "", nil, ErrWrongMetricLabels
+	}
+	rest = rest[:len(rest)-1]
+
+	labels := make(Labels)
+	for len(rest) > 0 {
+		eq := strings.Index(rest, `="`)
+		if eq == -1 {
+			return "", nil, ErrWrongMetricLabels
+		}
+		labelName := rest[:eq]
+
+		value, tail, err := unescapeLabelValue(rest[eq+2:])
+		if err != nil {
+			return "", nil, err
+		}
+		labels[labelName] = value
+
+		if tail != "" && !strings.HasPrefix(tail, ",") {
+			return "", nil, ErrWrongMetricLabels
+		}
+		rest = strings.TrimPrefix(tail, ",")
+	}
+
+	if err := labels.Validate(); err != nil {
+		return "", nil, err
+	}
+	if len(labels) == 0 {
+		labels = nil
+	}
+
+	return name, labels, nil
+}
+
+// ValidateName checks that metric name matches [a-zA-Z_:][a-zA-Z0-9_:]*,
+// so that name is not confused with labels in series ID.
+func ValidateName(name string) error {
+	if name == "" {
+		return ErrEmptyMetricName
+	}
+	if !isValidName(name, true) {
+		return ErrWrongMetricName
+	}
+	return nil
+}
+
+func isValidName(name string, allowColon bool) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r == ':' && allowColon:
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// SanitizeMetricName returns valid metric name: invalid characters are
+// replaced with underscore, name starting with digit is prefixed with underscore.
+func SanitizeMetricName(name string) string {
+	return sanitize(name, true)
+}
+
+// SanitizeLabelName returns valid label name: invalid characters are
+// replaced with underscore, name starting with digit is prefixed with underscore.
+func SanitizeLabelName(name string) string {
+	return sanitize(name, false)
+}
+
+func sanitize(name string, allowColon bool) string {
+	if name == "" {
+		return "_"
+	}
+
+	b := []byte(name)
+	for i, c := range b {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == ':' && allowColon:
+		default:
+			b[i] = '_'
+		}
+	}
+
+	if b[0] >= '0' && b[0] <= '9' {
+		return "_" + string(b)
+	}
+	return string(b)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// EscapeLabelValue returns label value with backslash, double quote and
+// newline escaped, as in label set text representation.
+func EscapeLabelValue(val string) string {
+	return labelValueEscaper.Replace(val)
+}
+
+// unescapeLabelValue reads escaped label value up to closing quote,
+// returns value and rest of string after closing quote.
+func unescapeLabelValue(s string) (string, string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return sb.String(), s[i+1:], nil
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", "", ErrWrongMetricLabels
+			}
+			switch s[i] {
+			case '\\', '"':
+				sb.WriteByte(s[i])
+			case 'n':
+				sb.WriteByte('\n')
+			default:
+				return "", "", ErrWrongMetricLabels
+			}
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return "", "", ErrWrongMetricLabels
+}
@@ -0,0 +1,93 @@
+package metric
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelsString(t *testing.T) {
+	assert.Equal(t, "", Labels(nil).String())
+	assert.Equal(t, "", Labels{}.String())
+	assert.Equal(t, `{cpu="3"}`, Labels{"cpu": "3"}.String())
+	assert.Equal(t, `{a="1",b="2",c="3"}`, Labels{"c": "3", "a": "1", "b": "2"}.String())
+	assert.Equal(t, `{a="x\"y\\z\n"}`, Labels{"a": "x\"y\\z\n"}.String())
+}
+
+func TestLabelsValidate(t *testing.T) {
+	assert.NoError(t, Labels(nil).Validate())
+	assert.NoError(t, Labels{"cpu": "3", "_host": "", "Region1": "eu"}.Validate())
+
+	for _, name := range []string{"", "1cpu", "cpu-id", "cpu id", "cpu{"} {
+		assert.ErrorIs(t, Labels{name: "3"}.Validate(), ErrWrongMetricLabels)
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	assert.NoError(t, ValidateName("http_requests:sum"))
+	assert.NoError(t, ValidateName("_1xx"))
+	assert.ErrorIs(t, ValidateName(""), ErrEmptyMetricName)
+	for _, name := range []string{"1xx", "cpu.usage", "bad{", `foo{cpu="1"}`, "a}", `a"`} {
+		assert.ErrorIs(t, ValidateName(name), ErrWrongMetricName, name)
+		assert.NoError(t, ValidateName(SanitizeMetricName(name)), name)
+	}
+}
+
+func TestSanitizeMetricName(t *testing.T) {
+	assert.Equal(t, "http_requests:sum", SanitizeMetricName("http_requests:sum"))
+	assert.Equal(t, "cpu_usage_user", SanitizeMetricName("cpu.usage-user"))
+	assert.Equal(t, "_1xx", SanitizeMetricName("1xx"))
+	assert.Equal(t, "_", SanitizeMetricName(""))
+}
+
+func TestSanitizeLabelName(t *testing.T) {
+	assert.Equal(t, "cpu_id", SanitizeLabelName("cpu-id"))
+	assert.Equal(t, "a_b", SanitizeLabelName("a:b"))
+	assert.Equal(t, "_1cpu", SanitizeLabelName("1cpu"))
+	assert.Equal(t, "_", SanitizeLabelName(""))
+	assert.NoError(t, Labels{SanitizeLabelName("host.name"): "a"}.Validate())
+}
+
+func TestSeriesID(t *testing.T) {
+	assert.Equal(t, "foo", SeriesID("foo", nil))
+	assert.Equal(t, `foo{cpu="3",host="a"}`, SeriesID("foo", Labels{"host": "a", "cpu": "3"}))
+}
+
+func TestParseSeriesID(t *testing.T) {
+	for i, tt := range []struct {
+		id     string
+		name   string
+		labels Labels
+	}{
+		{id: "foo", name: "foo"},
+		{id: "foo{}", name: "foo"},
+		{id: `foo{cpu="3"}`, name: "foo", labels: Labels{"cpu": "3"}},
+		{id: `foo{a="1",b=""}`, name: "foo", labels: Labels{"a": "1", "b": ""}},
+		{id: `foo{a="x\"y\\z\n,}"}`, name: "foo", labels: Labels{"a": "x\"y\\z\n,}"}},
+	} {
+		tt := tt
+		t.Run(fmt.Sprintf("Run %d", i), func(t *testing.T) {
+			name, labels, err := ParseSeriesID(tt.id)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.name, name)
+			assert.Equal(t, tt.labels, labels)
+			assert.Equal(t, SeriesID(tt.name, tt.labels), SeriesID(name, labels))
+		})
+	}
+}
+
+func TestParseSeriesIDError(t *testing.T) {
+	for _, id := range []string{
+		`foo{`,
+		`foo{cpu}`,
+		`foo{cpu="3"`,
+		`foo{cpu="3}`,
+		`foo{cpu="3"host="a"}`,
+		`foo{1cpu="3"}`,
+		`foo{cpu="\t"}`,
+	} {
+		_, _, err := ParseSeriesID(id)
+		assert.ErrorIs(t, err, ErrWrongMetricLabels, id)
+	}
+}
@@ -10,14 +10,18 @@ import (
 var (
 	ErrUnknownMetricType = errors.New("unknown metric type")
 	ErrEmptyMetricName   = errors.New("empty metric name")
+	ErrWrongMetricName   = errors.New("wrong metric name")
 	ErrWrongMetricValue  = errors.New("wrong metric value")
 	ErrMetricHashCheck   = errors.New("metric hash check fail")
+	ErrWrongMetricLabels = errors.New("wrong metric labels")
 )
 
 // AllTypes - valid metric types.
 var AllTypes = map[string]bool{
-	GaugeTypeName:   true,
-	CounterTypeName: true,
+	GaugeTypeName:     true,
+	CounterTypeName:   true,
+	HistogramTypeName: true,
+	SummaryTypeName:   true,
 }
 
 // MetricValue - value common interface.
@@ -25,17 +29,23 @@ type MetricValue interface {
 	fmt.Stringer
 
 	TypeName() string
-	Hmac(id, key string) string
+	Hmac(id string, labels Labels, key string) string
 }
 
-// Metrics - represensts map of MetricValue.
+// Metrics - represensts map of MetricValue, keyed by series ID (see SeriesID).
 type Metrics map[string]MetricValue
 
 // MetricsDTO - metric structure for JSON serde.
 type MetricsDTO struct {
-	Delta *int64   `json:"delta,omitempty"` // metric value if counter
-	Value *float64 `json:"value,omitempty"` // metric value if gauge
-	Hash  *string  `json:"hash,omitempty"`  // hash value
-	ID    string   `json:"id"`              // metric name
-	MType string   `json:"type"`            // metric type - gauge|counter
+	Delta   *int64    `json:"delta,omitempty"`   // metric value if counter
+	Value   *float64  `json:"value,omitempty"`   // metric value if gauge
+	Sum     *float64  `json:"sum,omitempty"`     // sum of observations if histogram or summary
+	Count   *uint64   `json:"count,omitempty"`   // count of observations if histogram or summary
+	Hash    *string   `json:"hash,omitempty"`    // hash value
+	Sketch  *Sketch   `json:"sketch,omitempty"`  // quantile sketch if summary
+	Labels  Labels    `json:"labels,omitempty"`  // metric labels
+	Bounds  []float64 `json:"bounds,omitempty"`  // bucket upper bounds if histogram
+	Buckets []uint64  `json:"buckets,omitempty"` // cumulative bucket counts if histogram
+	ID      string    `json:"id"`                // metric name
+	MType   string    `json:"type"`              // metric type - gauge|counter|histogram|summary
 }
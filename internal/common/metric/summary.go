@@ -0,0 +1,277 @@
+package metric
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/devldavydov/promytheus/internal/common/hash"
+)
+
+const SummaryTypeName string = "summary"
+
+// DefaultSummaryAlpha - default relative accuracy of Summary quantiles.
+const DefaultSummaryAlpha = 0.01
+
+// Sketch - DDSketch bins. Value x > 0 falls into positive bin
+// ceil(log(x)/log(gamma)), where gamma = (1+Alpha)/(1-Alpha); negative values
+// use the same mapping on -x. Sketches with equal Alpha merge by adding bins.
+type Sketch struct {
+	Positive map[int32]uint64 `json:"positive,omitempty"` // positive value bins
+	Negative map[int32]uint64 `json:"negative,omitempty"` // negative value bins
+	Alpha    float64          `json:"alpha"`              // relative accuracy
+	Zero     uint64           `json:"zero,omitempty"`     // zero values count
+}
+
+// Summary - summary type with quantiles estimated by DDSketch.
+type Summary struct {
+	Sketch Sketch  `json:"sketch"` // quantile sketch
+	Sum    float64 `json:"sum"`    // sum of observations
+	Count  uint64  `json:"count"`  // count of observations
+}
+
+var _ MetricValue = (*Summary)(nil)
+
+// NewSummary returns new empty Summary with given relative accuracy or error.
+func NewSummary(alpha float64) (Summary, error) {
+	s := Summary{Sketch: Sketch{Alpha: alpha}}
+	if err := s.validate(); err != nil {
+		return Summary{}, err
+	}
+	return s, nil
+}
+
+// NewSummaryFromString returns new Summary with default accuracy and single
+// observation parsed from string or error.
+func NewSummaryFromString(val string) (Summary, error) {
+	flVal, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return Summary{}, err
+	}
+	if math.IsNaN(flVal) || math.IsInf(flVal, 0) {
+		return Summary{}, errors.New("value is not finite")
+	}
+
+	s, err := NewSummary(DefaultSummaryAlpha)
+	if err != nil {
+		return Summary{}, err
+	}
+	s.Observe(flVal)
+	return s, nil
+}
+
+// NewSummaryFromParts returns new Summary from sketch, sum and count pointers or error.
+func NewSummaryFromParts(sketch *Sketch, sum *float64, count *uint64) (Summary, error) {
+	if sketch == nil || sum == nil || count == nil {
+		return Summary{}, errors.New("nil pointer")
+	}
+
+	s := Summary{
+		Sketch: Sketch{
+			Positive: copyBins(sketch.Positive),
+			Negative: copyBins(sketch.Negative),
+			Alpha:    sketch.Alpha,
+			Zero:     sketch.Zero,
+		},
+		Sum:   *sum,
+		Count: *count,
+	}
+	if err := s.validate(); err != nil {
+		return Summary{}, err
+	}
+	return s, nil
+}
+
+// Observe adds value to Summary.
+func (s *Summary) Observe(val float64) {
+	switch {
+	case val > 0:
+		if s.Sketch.Positive == nil {
+			s.Sketch.Positive = make(map[int32]uint64)
+		}
+		s.Sketch.Positive[s.index(val)]++
+	case val < 0:
+		if s.Sketch.Negative == nil {
+			s.Sketch.Negative = make(map[int32]uint64)
+		}
+		s.Sketch.Negative[s.index(-val)]++
+	default:
+		s.Sketch.Zero++
+	}
+	s.Sum += val
+	s.Count++
+}
+
+// Merge returns new Summary with observations of both summaries or error,
+// if sketch accuracy differ.
+func (s Summary) Merge(other Summary) (Summary, error) {
+	if s.Sketch.Alpha != other.Sketch.Alpha {
+		return Summary{}, fmt.Errorf("summary accuracy mismatch: %w", ErrWrongMetricValue)
+	}
+
+	res := Summary{
+		Sketch: Sketch{
+			Positive: copyBins(s.Sketch.Positive),
+			Negative: copyBins(s.Sketch.Negative),
+			Alpha:    s.Sketch.Alpha,
+			Zero:     s.Sketch.Zero + other.Sketch.Zero,
+		},
+		Sum:   s.Sum + other.Sum,
+		Count: s.Count + other.Count,
+	}
+	res.Sketch.Positive = addBins(res.Sketch.Positive, other.Sketch.Positive)
+	res.Sketch.Negative = addBins(res.Sketch.Negative, other.Sketch.Negative)
+	return res, nil
+}
+
+// Quantile returns estimated q-quantile of observations or NaN, if Summary is
+// empty. Quantile q is clamped to [0, 1].
+func (s Summary) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return math.NaN()
+	}
+	q = math.Max(0, math.Min(1, q))
+
+	rank := q * float64(s.Count-1)
+	var cum uint64
+
+	negKeys := sortedKeys(s.Sketch.Negative)
+	for i := len(negKeys) - 1; i >= 0; i-- {
+		cum += s.Sketch.Negative[negKeys[i]]
+		if float64(cum) > rank {
+			return -s.value(negKeys[i])
+		}
+	}
+
+	cum += s.Sketch.Zero
+	if float64(cum) > rank {
+		return 0
+	}
+
+	posKeys := sortedKeys(s.Sketch.Positive)
+	for _, k := range posKeys {
+		cum += s.Sketch.Positive[k]
+		if float64(cum) > rank {
+			return s.value(k)
+		}
+	}
+
+	return math.NaN()
+}
+
+// SumP returns Summary sum converted to float64 pointer.
+func (s Summary) SumP() *float64 {
+	v := s.Sum
+	return &v
+}
+
+// CountP returns Summary count converted to uint64 pointer.
+func (s Summary) CountP() *uint64 {
+	v := s.Count
+	return &v
+}
+
+// SketchP returns copy of Summary sketch as pointer.
+func (s Summary) SketchP() *Sketch {
+	v := Sketch{
+		Positive: copyBins(s.Sketch.Positive),
+		Negative: copyBins(s.Sketch.Negative),
+		Alpha:    s.Sketch.Alpha,
+		Zero:     s.Sketch.Zero,
+	}
+	return &v
+}
+
+// String returns string representation of Summary value.
+func (s Summary) String() string {
+	return fmt.Sprintf("p50=%s;p90=%s;p99=%s;sum=%s;count=%d",
+		Gauge(s.Quantile(0.5)),
+		Gauge(s.Quantile(0.9)),
+		Gauge(s.Quantile(0.99)),
+		Gauge(s.Sum),
+		s.Count)
+}
+
+// TypeName returns Summary type name.
+func (s Summary) TypeName() string {
+	return SummaryTypeName
+}
+
+// Hmac returns hmac value for Summary.
+func (s Summary) Hmac(id string, labels Labels, key string) string {
+	// JSON encoding sorts map keys, so representation is canonical
+	data, _ := json.Marshal(s)
+	return hash.HmacSHA256(fmt.Sprintf("%s:summary:%s", SeriesID(id, labels), data), key)
+}
+
+func (s Summary) gamma() float64 {
+	return (1 + s.Sketch.Alpha) / (1 - s.Sketch.Alpha)
+}
+
+func (s Summary) index(val float64) int32 {
+	return int32(math.Ceil(math.Log(val) / math.Log(s.gamma())))
+}
+
+func (s Summary) value(idx int32) float64 {
+	gamma := s.gamma()
+	return 2 * math.Pow(gamma, float64(idx)) / (gamma + 1)
+}
+
+func (s Summary) validate() error {
+	if !(s.Sketch.Alpha > 0 && s.Sketch.Alpha < 1) {
+		return errors.New("accuracy not in (0, 1)")
+	}
+
+	total := s.Sketch.Zero
+	for _, c := range s.Sketch.Positive {
+		total += c
+	}
+	for _, c := range s.Sketch.Negative {
+		total += c
+	}
+	if total != s.Count {
+		return errors.New("sketch and count mismatch")
+	}
+
+	if math.IsNaN(s.Sum) {
+		return errors.New("sum is NaN")
+	}
+
+	return nil
+}
+
+func copyBins(bins map[int32]uint64) map[int32]uint64 {
+	if len(bins) == 0 {
+		return nil
+	}
+	res := make(map[int32]uint64, len(bins))
+	for k, v := range bins {
+		res[k] = v
+	}
+	return res
+}
+
+func addBins(dst, src map[int32]uint64) map[int32]uint64 {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[int32]uint64, len(src))
+	}
+	for k, v := range src {
+		dst[k] += v
+	}
+	return dst
+}
+
+func sortedKeys(bins map[int32]uint64) []int32 {
+	keys := make([]int32, 0, len(bins))
+	for k := range bins {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,132 @@
+package metric
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSummaryError(t *testing.T) {
+	for _, alpha := range []float64{0, 1, -0.1, math.NaN()} {
+		_, err := NewSummary(alpha)
+		assert.Error(t, err)
+	}
+}
+
+func TestSummaryQuantile(t *testing.T) {
+	s, err := NewSummary(DefaultSummaryAlpha)
+	assert.NoError(t, err)
+	assert.True(t, math.IsNaN(s.Quantile(0.5)))
+
+	for i := 1; i <= 1000; i++ {
+		s.Observe(float64(i))
+	}
+
+	assert.Equal(t, uint64(1000), s.Count)
+	assert.Equal(t, float64(500500), s.Sum)
+	for _, tt := range []struct {
+		q   float64
+		exp float64
+	}{
+		{q: 0, exp: 1},
+		{q: 0.5, exp: 500},
+		{q: 0.9, exp: 900},
+		{q: 0.99, exp: 990},
+		{q: 1, exp: 1000},
+	} {
+		assert.InEpsilon(t, tt.exp, s.Quantile(tt.q), DefaultSummaryAlpha, tt.q)
+	}
+}
+
+func TestSummaryQuantileNegativeAndZero(t *testing.T) {
+	s, err := NewSummary(DefaultSummaryAlpha)
+	assert.NoError(t, err)
+
+	for _, v := range []float64{-10, -5, 0, 0, 5} {
+		s.Observe(v)
+	}
+
+	assert.InEpsilon(t, -10, s.Quantile(0), DefaultSummaryAlpha)
+	assert.InEpsilon(t, -5, s.Quantile(0.25), DefaultSummaryAlpha)
+	assert.Equal(t, float64(0), s.Quantile(0.5))
+	assert.InEpsilon(t, 5, s.Quantile(1), DefaultSummaryAlpha)
+}
+
+func TestSummaryMerge(t *testing.T) {
+	a, _ := NewSummary(DefaultSummaryAlpha)
+	b, _ := NewSummary(DefaultSummaryAlpha)
+	all, _ := NewSummary(DefaultSummaryAlpha)
+	for i := 1; i <= 100; i++ {
+		if i%2 == 0 {
+			a.Observe(float64(i))
+			all.Observe(float64(i))
+		} else {
+			b.Observe(float64(-i))
+			all.Observe(float64(-i))
+		}
+	}
+
+	res, err := a.Merge(b)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), res.Count)
+	assert.Equal(t, all.Sum, res.Sum)
+	assert.Equal(t, all.Quantile(0.5), res.Quantile(0.5))
+	assert.Equal(t, all.Quantile(0.99), res.Quantile(0.99))
+	assert.Equal(t, uint64(50), a.Count)
+
+	c, _ := NewSummary(0.05)
+	_, err = a.Merge(c)
+	assert.ErrorIs(t, err, ErrWrongMetricValue)
+}
+
+func TestNewSummaryFromString(t *testing.T) {
+	s, err := NewSummaryFromString("12.5")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), s.Count)
+	assert.Equal(t, 12.5, s.Sum)
+	assert.InEpsilon(t, 12.5, s.Quantile(0.5), DefaultSummaryAlpha)
+
+	for _, val := range []string{"abc", "NaN", "+Inf"} {
+		_, err = NewSummaryFromString(val)
+		assert.Error(t, err, val)
+	}
+}
+
+func TestNewSummaryFromParts(t *testing.T) {
+	sum, count := 3.0, uint64(2)
+	sketch := &Sketch{Alpha: 0.01, Positive: map[int32]uint64{0: 1, 55: 1}}
+
+	s, err := NewSummaryFromParts(sketch, &sum, &count)
+	assert.NoError(t, err)
+	assert.Equal(t, Summary{Sketch: *sketch, Sum: 3, Count: 2}, s)
+
+	_, err = NewSummaryFromParts(nil, &sum, &count)
+	assert.Error(t, err)
+
+	_, err = NewSummaryFromParts(sketch, nil, &count)
+	assert.Error(t, err)
+
+	_, err = NewSummaryFromParts(sketch, &sum, nil)
+	assert.Error(t, err)
+
+	badCount := uint64(3)
+	_, err = NewSummaryFromParts(sketch, &sum, &badCount)
+	assert.Error(t, err)
+}
+
+func TestSummaryToString(t *testing.T) {
+	s, _ := NewSummaryFromString("1")
+	assert.Equal(t, "p50=0.990;p90=0.990;p99=0.990;sum=1.000;count=1", s.String())
+}
+
+func TestSummaryTypeName(t *testing.T) {
+	assert.Equal(t, SummaryTypeName, Summary{}.TypeName())
+}
+
+func TestSummaryHmac(t *testing.T) {
+	a, _ := NewSummaryFromString("1")
+	b, _ := NewSummaryFromString("2")
+	assert.Equal(t, a.Hmac("foo", nil, "bar"), a.Hmac("foo", nil, "bar"))
+	assert.NotEqual(t, a.Hmac("foo", nil, "bar"), b.Hmac("foo", nil, "bar"))
+}
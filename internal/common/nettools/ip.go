@@ -3,10 +3,15 @@ package nettools
 
 import (
 	"errors"
+	"fmt"
 	"net"
+	"strings"
 )
 
-const RealIPHeader = "X-Real-IP"
+const (
+	RealIPHeader       = "X-Real-IP"
+	ForwardedForHeader = "X-Forwarded-For"
+)
 
 var ErrHostIPFailed = errors.New("unable to define host IP")
 
@@ -52,3 +57,81 @@ func GetHostIP() (net.IP, error) {
 
 	return nil, ErrHostIPFailed
 }
+
+// ParseSubnets parses comma separated list of subnets in CIDR notation.
+// Single IP is treated as subnet of this IP only.
+func ParseSubnets(s string) ([]*net.IPNet, error) {
+	var subnets []*net.IPNet
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("wrong subnet: %s", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			subnets = append(subnets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, subnet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		subnets = append(subnets, subnet)
+	}
+	return subnets, nil
+}
+
+// ContainsIP checks that IP is in one of subnets.
+func ContainsIP(subnets []*net.IPNet, ip net.IP) bool {
+	for _, subnet := range subnets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns IP of client. Peer address is the address of connection
+// ("host:port" or IP). X-Forwarded-For is honoured only if peer is trusted
+// proxy, otherwise peer IP is returned. It is walked from the right,
+// skipping trusted proxies, so hops added by client itself are not used.
+// X-Real-IP is not used, as proxy may pass it from client unchanged.
+func ClientIP(peerAddr string, trustedProxies []*net.IPNet, forwardedFor string) net.IP {
+	ip := parseAddrIP(peerAddr)
+	if ip == nil || !ContainsIP(trustedProxies, ip) {
+		return ip
+	}
+
+	if forwardedFor == "" {
+		return ip
+	}
+
+	hops := strings.Split(forwardedFor, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !ContainsIP(trustedProxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+func parseAddrIP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(addr)
+}
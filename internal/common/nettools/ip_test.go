@@ -1,6 +1,7 @@
 package nettools
 
 import (
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -11,3 +12,57 @@ func TestGetHostIP(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, res)
 }
+
+func TestParseSubnets(t *testing.T) {
+	subnets, err := ParseSubnets("10.0.0.0/8, 127.0.0.1,::1,fd00::/8")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8", "127.0.0.1/32", "::1/128", "fd00::/8"}, subnetStrings(subnets))
+
+	subnets, err = ParseSubnets("")
+	assert.NoError(t, err)
+	assert.Nil(t, subnets)
+
+	for _, s := range []string{"foobar", "10.0.0.0/500", "10.0.0.1,abc"} {
+		_, err = ParseSubnets(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, _ := ParseSubnets("10.0.0.0/8")
+
+	for _, tt := range []struct {
+		name         string
+		peerAddr     string
+		forwardedFor string
+		res          string
+	}{
+		{name: "direct client", peerAddr: "1.1.1.1:5000", res: "1.1.1.1"},
+		{name: "direct client, spoofed X-Forwarded-For", peerAddr: "1.1.1.1:5000", forwardedFor: "10.0.0.5", res: "1.1.1.1"},
+		{name: "proxy, X-Forwarded-For", peerAddr: "10.0.0.1:5000", forwardedFor: "3.3.3.3, 2.2.2.2, 10.0.0.2", res: "2.2.2.2"},
+		{name: "proxy, X-Forwarded-For with spoofed hop", peerAddr: "10.0.0.1:5000", forwardedFor: "10.0.0.5, 2.2.2.2", res: "2.2.2.2"},
+		{name: "proxy, X-Forwarded-For of proxies", peerAddr: "10.0.0.1:5000", forwardedFor: "10.0.0.3, 10.0.0.2", res: "10.0.0.3"},
+		{name: "proxy, no headers", peerAddr: "10.0.0.1:5000", res: "10.0.0.1"},
+		{name: "IPv6 peer", peerAddr: "[::1]:5000", res: "::1"},
+		{name: "IP peer", peerAddr: "1.1.1.1", res: "1.1.1.1"},
+		{name: "wrong peer", peerAddr: "bufconn", forwardedFor: "2.2.2.2"},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ip := ClientIP(tt.peerAddr, proxies, tt.forwardedFor)
+			if tt.res == "" {
+				assert.Nil(t, ip)
+				return
+			}
+			assert.Equal(t, tt.res, ip.String())
+		})
+	}
+}
+
+func subnetStrings(subnets []*net.IPNet) []string {
+	res := make([]string, 0, len(subnets))
+	for _, s := range subnets {
+		res = append(res, s.String())
+	}
+	return res
+}
@@ -0,0 +1,135 @@
+// Package snappy provides functions to work with snappy block format,
+// used by Prometheus remote_write protocol.
+package snappy
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// MaxDecodedLen - max allowed length of decoded data.
+const MaxDecodedLen = 32 << 20
+
+const (
+	_tagLiteral = 0x00
+	_tagCopy1   = 0x01
+	_tagCopy2   = 0x02
+	_tagCopy4   = 0x03
+
+	// _maxLiteralLen - max literal length, encoded with 4 bytes.
+	_maxLiteralLen = 1 << 16
+)
+
+var (
+	// ErrCorrupt - error for corrupted input.
+	ErrCorrupt = errors.New("snappy: corrupt input")
+	// ErrTooLarge - error for decoded length over MaxDecodedLen.
+	ErrTooLarge = errors.New("snappy: decoded block is too large")
+)
+
+// Decode returns decoded snappy block or error.
+func Decode(src []byte) ([]byte, error) {
+	n, hdr := binary.Uvarint(src)
+	if hdr <= 0 {
+		return nil, ErrCorrupt
+	}
+	if n > MaxDecodedLen {
+		return nil, ErrTooLarge
+	}
+	src = src[hdr:]
+
+	dst := make([]byte, 0, n)
+	for len(src) > 0 {
+		var length, offset int
+
+		tag := src[0]
+		switch tag & 0x03 {
+		case _tagLiteral:
+			length = int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				size := length - 59
+				if len(src) < size {
+					return nil, ErrCorrupt
+				}
+				length = 0
+				for i := size - 1; i >= 0; i-- {
+					length = length<<8 | int(src[i])
+				}
+				src = src[size:]
+			}
+			length++
+			if length <= 0 || length > len(src) || len(dst)+length > int(n) {
+				return nil, ErrCorrupt
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+
+		case _tagCopy1:
+			if len(src) < 2 {
+				return nil, ErrCorrupt
+			}
+			length = 4 + int(tag>>2)&0x07
+			offset = int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+
+		case _tagCopy2:
+			if len(src) < 3 {
+				return nil, ErrCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+
+		case _tagCopy4:
+			if len(src) < 5 {
+				return nil, ErrCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+
+		if offset <= 0 || offset > len(dst) || len(dst)+length > int(n) {
+			return nil, ErrCorrupt
+		}
+		// Copy byte by byte, source and destination may overlap
+		for start := len(dst) - offset; length > 0; length-- {
+			dst = append(dst, dst[start])
+			start++
+		}
+	}
+
+	if len(dst) != int(n) {
+		return nil, ErrCorrupt
+	}
+	return dst, nil
+}
+
+// Encode returns src as snappy block. Data is stored as literals
+// without compression, which is valid input for any snappy decoder.
+func Encode(src []byte) []byte {
+	dst := binary.AppendUvarint(make([]byte, 0, len(src)+len(src)/_maxLiteralLen*5+15), uint64(len(src)))
+
+	for len(src) > 0 {
+		chunk := src
+		if len(chunk) > _maxLiteralLen {
+			chunk = chunk[:_maxLiteralLen]
+		}
+		src = src[len(chunk):]
+
+		l := len(chunk) - 1
+		switch {
+		case l < 60:
+			dst = append(dst, byte(l)<<2|_tagLiteral)
+		case l < 1<<8:
+			dst = append(dst, 60<<2|_tagLiteral, byte(l))
+		default:
+			dst = append(dst, 61<<2|_tagLiteral, byte(l), byte(l>>8))
+		}
+		dst = append(dst, chunk...)
+	}
+
+	return dst
+}
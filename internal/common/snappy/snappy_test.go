@@ -0,0 +1,48 @@
+package snappy
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	for _, size := range []int{0, 1, 59, 60, 61, 255, 256, 257, 65536, 100000} {
+		src := bytes.Repeat([]byte("promytheus"), size/10+1)[:size]
+
+		res, err := Decode(Encode(src))
+		require.NoError(t, err, size)
+		assert.Equal(t, src, res, size)
+	}
+}
+
+func TestDecodeCopy(t *testing.T) {
+	// "abcd" literal, then copy1 of length 8 with offset 4 (overlapping),
+	// then copy2 of length 2 with offset 12.
+	src := []byte{14, 3 << 2, 'a', 'b', 'c', 'd', (8-4)<<2 | _tagCopy1, 4, (2-1)<<2 | _tagCopy2, 12, 0}
+
+	res, err := Decode(src)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("abcdabcdabcdab"), res)
+}
+
+func TestDecodeError(t *testing.T) {
+	for _, src := range [][]byte{
+		{},
+		{0xff},
+		{5, 3 << 2, 'a'},
+		{4, 3 << 2, 'a', 'b', 'c', 'd', 'e'},
+		{8, 3 << 2, 'a', 'b', 'c', 'd', (8-4)<<2 | _tagCopy1, 5},
+		{8, 3 << 2, 'a', 'b', 'c', 'd', (8-4)<<2 | _tagCopy1, 0},
+		{2, 3 << 2, 'a', 'b', 'c', 'd'},
+		{8, 3 << 2, 'a', 'b', 'c', 'd', _tagCopy2, 1},
+	} {
+		_, err := Decode(src)
+		assert.ErrorIs(t, err, ErrCorrupt, src)
+	}
+
+	_, err := Decode([]byte{0x80, 0x80, 0x80, 0x80, 0x01})
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
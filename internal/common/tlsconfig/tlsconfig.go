@@ -0,0 +1,115 @@
+// Package tlsconfig provides TLS settings for servers and clients.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ServerSettings - server TLS settings. If ClientCACertPath is set, clients
+// must present certificate, signed by this CA.
+type ServerSettings struct {
+	CertPath         string
+	KeyPath          string
+	ClientCACertPath string
+}
+
+// NewOptionalServerSettings returns ServerSettings or nil, if TLS not set.
+func NewOptionalServerSettings(certPath, keyPath, clientCACertPath string) (*ServerSettings, error) {
+	if certPath == "" && keyPath == "" && clientCACertPath == "" {
+		// No TLS
+		return nil, nil
+	}
+
+	if certPath == "" || keyPath == "" {
+		return nil, errors.New("invalid TLS server settings")
+	}
+
+	return &ServerSettings{CertPath: certPath, KeyPath: keyPath, ClientCACertPath: clientCACertPath}, nil
+}
+
+// Load returns server TLS config.
+func (s *ServerSettings) Load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(s.CertPath, s.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.NoClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if s.ClientCACertPath != "" {
+		config.ClientCAs, err = LoadCertPool(s.ClientCACertPath)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// ClientSettings - client TLS settings. If CACertPath is empty, system CAs
+// are used; client certificate is optional.
+type ClientSettings struct {
+	CACertPath string
+	CertPath   string
+	KeyPath    string
+}
+
+// NewOptionalClientSettings returns ClientSettings or nil, if TLS not set.
+func NewOptionalClientSettings(caCertPath, certPath, keyPath string) (*ClientSettings, error) {
+	if caCertPath == "" && certPath == "" && keyPath == "" {
+		// No TLS
+		return nil, nil
+	}
+
+	if (certPath == "") != (keyPath == "") {
+		return nil, errors.New("invalid TLS client settings")
+	}
+
+	return &ClientSettings{CACertPath: caCertPath, CertPath: certPath, KeyPath: keyPath}, nil
+}
+
+// Load returns client TLS config.
+func (c *ClientSettings) Load() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if c.CACertPath != "" {
+		certPool, err := LoadCertPool(c.CACertPath)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = certPool
+	}
+
+	if c.CertPath != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertPath, c.KeyPath)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// LoadCertPool returns cert pool with PEM certificates from file.
+func LoadCertPool(caCertPath string) (*x509.CertPool, error) {
+	pemCA, err := os.ReadFile(caCertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(pemCA) {
+		return nil, fmt.Errorf("failed to add CA's certificate from %s", caCertPath)
+	}
+	return certPool, nil
+}
@@ -0,0 +1,217 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOptionalServerSettings(t *testing.T) {
+	for _, tt := range []struct {
+		cert, key, clientCA string
+		res                 *ServerSettings
+		err                 bool
+	}{
+		{},
+		{cert: "c", key: "k", res: &ServerSettings{CertPath: "c", KeyPath: "k"}},
+		{cert: "c", key: "k", clientCA: "ca", res: &ServerSettings{CertPath: "c", KeyPath: "k", ClientCACertPath: "ca"}},
+		{cert: "c", err: true},
+		{key: "k", err: true},
+		{clientCA: "ca", err: true},
+	} {
+		res, err := NewOptionalServerSettings(tt.cert, tt.key, tt.clientCA)
+		if tt.err {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.res, res)
+	}
+}
+
+func TestNewOptionalClientSettings(t *testing.T) {
+	for _, tt := range []struct {
+		ca, cert, key string
+		res           *ClientSettings
+		err           bool
+	}{
+		{},
+		{ca: "ca", res: &ClientSettings{CACertPath: "ca"}},
+		{cert: "c", key: "k", res: &ClientSettings{CertPath: "c", KeyPath: "k"}},
+		{ca: "ca", cert: "c", key: "k", res: &ClientSettings{CACertPath: "ca", CertPath: "c", KeyPath: "k"}},
+		{ca: "ca", cert: "c", err: true},
+		{key: "k", err: true},
+	} {
+		res, err := NewOptionalClientSettings(tt.ca, tt.cert, tt.key)
+		if tt.err {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.res, res)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeCert(t, dir, "ca", nil, nil, true)
+	writeCert(t, dir, "server", ca, caKey, false)
+	writeCert(t, dir, "client", ca, caKey, false)
+	otherCA, otherCAKey := writeCert(t, dir, "other-ca", nil, nil, true)
+	writeCert(t, dir, "other-client", otherCA, otherCAKey, false)
+
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	for _, tt := range []struct {
+		name   string
+		server ServerSettings
+		client ClientSettings
+		ok     bool
+	}{
+		{
+			name:   "TLS",
+			server: ServerSettings{CertPath: path("server.pem"), KeyPath: path("server.key")},
+			client: ClientSettings{CACertPath: path("ca.pem")},
+			ok:     true,
+		},
+		{
+			name:   "TLS, unknown server CA",
+			server: ServerSettings{CertPath: path("server.pem"), KeyPath: path("server.key")},
+			client: ClientSettings{CACertPath: path("other-ca.pem")},
+		},
+		{
+			name: "mTLS",
+			server: ServerSettings{
+				CertPath: path("server.pem"), KeyPath: path("server.key"), ClientCACertPath: path("ca.pem"),
+			},
+			client: ClientSettings{
+				CACertPath: path("ca.pem"), CertPath: path("client.pem"), KeyPath: path("client.key"),
+			},
+			ok: true,
+		},
+		{
+			name: "mTLS, no client certificate",
+			server: ServerSettings{
+				CertPath: path("server.pem"), KeyPath: path("server.key"), ClientCACertPath: path("ca.pem"),
+			},
+			client: ClientSettings{CACertPath: path("ca.pem")},
+		},
+		{
+			name: "mTLS, client certificate of other CA",
+			server: ServerSettings{
+				CertPath: path("server.pem"), KeyPath: path("server.key"), ClientCACertPath: path("ca.pem"),
+			},
+			client: ClientSettings{
+				CACertPath: path("ca.pem"), CertPath: path("other-client.pem"), KeyPath: path("other-client.key"),
+			},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			srvConfig, err := tt.server.Load()
+			require.NoError(t, err)
+
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			ts.TLS = srvConfig
+			ts.StartTLS()
+			defer ts.Close()
+
+			cltConfig, err := tt.client.Load()
+			require.NoError(t, err)
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: cltConfig}}
+
+			resp, err := client.Get(ts.URL)
+			if !tt.ok {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "not.pem")
+	require.NoError(t, os.WriteFile(notPEM, []byte("foobar"), 0600))
+
+	_, err := LoadCertPool(notPEM)
+	assert.Error(t, err)
+
+	_, err = LoadCertPool(filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+
+	_, err = (&ServerSettings{CertPath: notPEM, KeyPath: notPEM}).Load()
+	assert.Error(t, err)
+
+	_, err = (&ClientSettings{CertPath: notPEM, KeyPath: notPEM}).Load()
+	assert.Error(t, err)
+}
+
+// writeCert writes <name>.pem and <name>.key to dir: CA certificate, if
+// parent is nil, or 127.0.0.1 certificate, signed by parent.
+func writeCert(
+	t *testing.T,
+	dir, name string,
+	parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey,
+	isCA bool,
+) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if isCA {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+		tmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, name+".pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		0600))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, name+".key"),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+		0600))
+
+	return cert, key
+}
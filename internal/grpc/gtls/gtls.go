@@ -2,44 +2,58 @@
 package gtls
 
 import (
-	"crypto/tls"
-	"crypto/x509"
 	"errors"
-	"fmt"
-	"os"
 
+	"github.com/devldavydov/promytheus/internal/common/tlsconfig"
 	"google.golang.org/grpc/credentials"
 )
 
 type TLSServerSettings struct {
-	ServerCertPath string
-	ServerKeyPath  string
+	ServerCertPath   string
+	ServerKeyPath    string
+	ClientCACertPath string
+	// AllowedClients - CN/SAN of clients, allowed to call protected methods.
+	// Empty - any client with verified certificate.
+	AllowedClients []string
 }
 
-func NewOptionalTLSServerSettings(certPath, keyPath string) (*TLSServerSettings, error) {
-	if certPath == "" && keyPath == "" {
+func NewOptionalTLSServerSettings(
+	certPath, keyPath, clientCACertPath string,
+	allowedClients []string,
+) (*TLSServerSettings, error) {
+	if certPath == "" && keyPath == "" && clientCACertPath == "" && len(allowedClients) == 0 {
 		// No TLS
 		return nil, nil
 	}
 
-	if (certPath == "" && keyPath != "") || (certPath != "" && keyPath == "") {
+	if certPath == "" || keyPath == "" {
 		return nil, errors.New("invalid TLS server settings")
 	}
 
-	return &TLSServerSettings{ServerCertPath: certPath, ServerKeyPath: keyPath}, nil
+	if len(allowedClients) > 0 && clientCACertPath == "" {
+		return nil, errors.New("allowed clients require client CA certificate")
+	}
+
+	return &TLSServerSettings{
+		ServerCertPath:   certPath,
+		ServerKeyPath:    keyPath,
+		ClientCACertPath: clientCACertPath,
+		AllowedClients:   allowedClients,
+	}, nil
 }
 
+// Load returns server credentials. If client CA is set, clients must present
+// certificate, signed by this CA.
 func (t *TLSServerSettings) Load() (credentials.TransportCredentials, error) {
-	serverCert, err := tls.LoadX509KeyPair(t.ServerCertPath, t.ServerKeyPath)
+	config, err := (&tlsconfig.ServerSettings{
+		CertPath:         t.ServerCertPath,
+		KeyPath:          t.ServerKeyPath,
+		ClientCACertPath: t.ClientCACertPath,
+	}).Load()
 	if err != nil {
 		return nil, err
 	}
 
-	config := &tls.Config{
-		Certificates: []tls.Certificate{serverCert},
-		ClientAuth:   tls.NoClientCert,
-	}
-
 	return credentials.NewTLS(config), nil
 }
 
@@ -49,19 +63,17 @@ func LoadCACert(caCertPath string, customServerName string) (credentials.Transpo
 		return nil, nil
 	}
 
-	pemServerCA, err := os.ReadFile(caCertPath)
+	return LoadClientCredentials(&tlsconfig.ClientSettings{CACertPath: caCertPath}, customServerName)
+}
+
+// LoadClientCredentials returns client credentials with optional client
+// certificate.
+func LoadClientCredentials(settings *tlsconfig.ClientSettings, customServerName string) (credentials.TransportCredentials, error) {
+	config, err := settings.Load()
 	if err != nil {
 		return nil, err
 	}
 
-	certPool := x509.NewCertPool()
-	if !certPool.AppendCertsFromPEM(pemServerCA) {
-		return nil, fmt.Errorf("failed to add server CA's certificate")
-	}
-
-	config := &tls.Config{
-		RootCAs: certPool,
-	}
 	if customServerName != "" {
 		config.ServerName = customServerName
 	}
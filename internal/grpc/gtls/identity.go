@@ -0,0 +1,53 @@
+package gtls
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// ClientIdentity - identity of client from verified TLS certificate.
+type ClientIdentity struct {
+	CommonName string
+	DNSNames   []string
+	URIs       []string
+	Emails     []string
+}
+
+// Names returns common name and all SANs of client.
+func (c ClientIdentity) Names() []string {
+	names := make([]string, 0, 1+len(c.DNSNames)+len(c.URIs)+len(c.Emails))
+	if c.CommonName != "" {
+		names = append(names, c.CommonName)
+	}
+	names = append(names, c.DNSNames...)
+	names = append(names, c.URIs...)
+	names = append(names, c.Emails...)
+	return names
+}
+
+// ClientIdentityFromContext returns identity of client with verified TLS
+// certificate from gRPC server handler context.
+func ClientIdentityFromContext(ctx context.Context) (ClientIdentity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ClientIdentity{}, false
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return ClientIdentity{}, false
+	}
+
+	cert := tlsInfo.State.VerifiedChains[0][0]
+	identity := ClientIdentity{
+		CommonName: cert.Subject.CommonName,
+		DNSNames:   cert.DNSNames,
+		Emails:     cert.EmailAddresses,
+	}
+	for _, uri := range cert.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+	}
+	return identity, true
+}
@@ -0,0 +1,82 @@
+package interceptor
+
+import (
+	"context"
+	"strings"
+
+	"github.com/devldavydov/promytheus/internal/common/apikey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	_authorizationMetadataKey = strings.ToLower(apikey.AuthorizationHeader)
+	_apiKeyMetadataKey        = strings.ToLower(apikey.KeyHeader)
+)
+
+// APIKeyInterceptor authenticates API key of request and checks its scope
+// for method. Authenticated key is stored in request context.
+type APIKeyInterceptor struct {
+	authenticator *apikey.Authenticator
+	methodScopes  map[string]apikey.Scope
+}
+
+func NewAPIKeyInterceptor(authenticator *apikey.Authenticator, methodScopes map[string]apikey.Scope) *APIKeyInterceptor {
+	return &APIKeyInterceptor{authenticator: authenticator, methodScopes: methodScopes}
+}
+
+func (a *APIKeyInterceptor) Handle(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	scope, ok := a.methodScopes[info.FullMethod]
+	if a.authenticator == nil || !ok {
+		return handler(ctx, req)
+	}
+
+	var authorization, apiKey string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vals := md.Get(_authorizationMetadataKey); len(vals) > 0 {
+			authorization = vals[0]
+		}
+		if vals := md.Get(_apiKeyMetadataKey); len(vals) > 0 {
+			apiKey = vals[0]
+		}
+	}
+
+	key, err := a.authenticator.Authenticate(apikey.KeyFromHeaders(authorization, apiKey))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+
+	if !key.HasScope(scope) {
+		return nil, status.Error(codes.PermissionDenied, "forbidden")
+	}
+
+	return handler(apikey.NewContext(ctx, key), req)
+}
+
+// APIKeyClientInterceptor adds API key to outgoing request metadata.
+type APIKeyClientInterceptor struct {
+	key string
+}
+
+func NewAPIKeyClientInterceptor(key string) *APIKeyClientInterceptor {
+	return &APIKeyClientInterceptor{key: key}
+}
+
+func (a *APIKeyClientInterceptor) Handle(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, _authorizationMetadataKey, "Bearer "+a.key)
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
@@ -0,0 +1,81 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/devldavydov/promytheus/internal/common/apikey"
+	pb "github.com/devldavydov/promytheus/internal/grpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAPIKeyInterceptor(t *testing.T) {
+	authenticator, err := apikey.NewAuthenticator([]apikey.KeyConfig{
+		{ID: "team-a", KeyHash: apikey.HashKey("key-a"), Scopes: []apikey.Scope{apikey.ScopeWrite}, Prefix: "team_a_"},
+		{ID: "reader", KeyHash: apikey.HashKey("key-r"), Scopes: []apikey.Scope{apikey.ScopeRead}},
+	})
+	require.NoError(t, err)
+
+	srvInterceptor := NewAPIKeyInterceptor(authenticator, map[string]apikey.Scope{_updateMethod: apikey.ScopeWrite})
+	call := func(ctx context.Context, method string) (*apikey.Key, error) {
+		var key *apikey.Key
+		_, err := srvInterceptor.Handle(
+			ctx,
+			&pb.UpdateMetricsRequest{},
+			&grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				key, _ = apikey.FromContext(ctx)
+				return nil, nil
+			})
+		return key, err
+	}
+	mdCtx := func(kv ...string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(kv...))
+	}
+
+	for _, tt := range []struct {
+		name   string
+		ctx    context.Context
+		method string
+		code   codes.Code
+		keyID  string
+	}{
+		{name: "bearer key", ctx: mdCtx("authorization", "Bearer key-a"), method: _updateMethod, keyID: "team-a"},
+		{name: "API key header", ctx: mdCtx("x-api-key", "key-a"), method: _updateMethod, keyID: "team-a"},
+		{name: "missing key", ctx: context.Background(), method: _updateMethod, code: codes.Unauthenticated},
+		{name: "unknown key", ctx: mdCtx("authorization", "Bearer key-x"), method: _updateMethod, code: codes.Unauthenticated},
+		{name: "key without scope", ctx: mdCtx("authorization", "Bearer key-r"), method: _updateMethod, code: codes.PermissionDenied},
+		{name: "method without scope", ctx: context.Background(), method: "/grpc.MetricService/Ping"},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := call(tt.ctx, tt.method)
+			assert.Equal(t, tt.code, status.Code(err))
+			if tt.keyID != "" {
+				require.NotNil(t, key)
+				assert.Equal(t, tt.keyID, key.ID)
+			}
+		})
+	}
+}
+
+func TestAPIKeyClientInterceptor(t *testing.T) {
+	var md metadata.MD
+	err := NewAPIKeyClientInterceptor("key-a").Handle(
+		context.Background(),
+		_updateMethod,
+		&pb.UpdateMetricsRequest{},
+		&pb.UpdateMetricsResponse{},
+		nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			md, _ = metadata.FromOutgoingContext(ctx)
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer key-a"}, md.Get("authorization"))
+}
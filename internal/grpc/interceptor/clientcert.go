@@ -0,0 +1,53 @@
+package interceptor
+
+import (
+	"context"
+
+	"github.com/devldavydov/promytheus/internal/grpc/gtls"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ClientCertInterceptor allows protected methods only for clients, whose
+// verified TLS certificate CN or SAN is in allowed list.
+type ClientCertInterceptor struct {
+	allowedClients   map[string]bool
+	protectedMethods map[string]bool
+}
+
+func NewClientCertInterceptor(allowedClients []string, protectedMethods []string) *ClientCertInterceptor {
+	ac := make(map[string]bool, len(allowedClients))
+	for _, c := range allowedClients {
+		ac[c] = true
+	}
+	pm := make(map[string]bool, len(protectedMethods))
+	for _, p := range protectedMethods {
+		pm[p] = true
+	}
+	return &ClientCertInterceptor{allowedClients: ac, protectedMethods: pm}
+}
+
+func (c *ClientCertInterceptor) Handle(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if len(c.allowedClients) == 0 || !c.protectedMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	identity, ok := gtls.ClientIdentityFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.PermissionDenied, "forbidden")
+	}
+
+	for _, name := range identity.Names() {
+		if c.allowedClients[name] {
+			return handler(ctx, req)
+		}
+	}
+
+	return nil, status.Error(codes.PermissionDenied, "forbidden")
+}
@@ -0,0 +1,78 @@
+package interceptor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+
+	pb "github.com/devldavydov/promytheus/internal/grpc"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestClientCertInterceptor(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.com/agent3")
+	certCtx := func(cert *x509.Certificate) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{
+			AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{cert}},
+			}},
+		})
+	}
+
+	srvInterceptor := NewClientCertInterceptor(
+		[]string{"agent1", "agent2.example.com", "spiffe://example.com/agent3"},
+		[]string{_updateMethod})
+	call := func(ctx context.Context, method string) error {
+		_, err := srvInterceptor.Handle(
+			ctx,
+			&pb.UpdateMetricsRequest{},
+			&grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+		return err
+	}
+
+	for _, tt := range []struct {
+		name   string
+		ctx    context.Context
+		method string
+		code   codes.Code
+	}{
+		{name: "allowed CN", ctx: certCtx(&x509.Certificate{Subject: pkix.Name{CommonName: "agent1"}}), method: _updateMethod},
+		{
+			name:   "allowed DNS SAN",
+			ctx:    certCtx(&x509.Certificate{Subject: pkix.Name{CommonName: "foo"}, DNSNames: []string{"agent2.example.com"}}),
+			method: _updateMethod,
+		},
+		{name: "allowed URI SAN", ctx: certCtx(&x509.Certificate{URIs: []*url.URL{spiffe}}), method: _updateMethod},
+		{
+			name:   "not allowed",
+			ctx:    certCtx(&x509.Certificate{Subject: pkix.Name{CommonName: "agent4"}}),
+			method: _updateMethod,
+			code:   codes.PermissionDenied,
+		},
+		{name: "no certificate", ctx: context.Background(), method: _updateMethod, code: codes.PermissionDenied},
+		{name: "not protected method", ctx: context.Background(), method: "/grpc.MetricService/GetAllMetrics"},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.code, status.Code(call(tt.ctx, tt.method)))
+		})
+	}
+}
+
+func TestClientCertInterceptorDisabled(t *testing.T) {
+	_, err := NewClientCertInterceptor(nil, []string{_updateMethod}).Handle(
+		context.Background(),
+		&pb.UpdateMetricsRequest{},
+		&grpc.UnaryServerInfo{FullMethod: _updateMethod},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+	assert.NoError(t, err)
+}
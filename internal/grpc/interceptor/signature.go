@@ -0,0 +1,107 @@
+package interceptor
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/hash"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	_signatureMetadataKey = strings.ToLower(hash.SignatureHeader)
+	_hmacKeyIDMetadataKey = strings.ToLower(hash.KeyIDHeader)
+)
+
+// SignatureInterceptor checks request signature of protected methods.
+// Signature covers method name and deterministically marshaled request.
+type SignatureInterceptor struct {
+	verifier         *hash.SignatureVerifier
+	protectedMethods map[string]bool
+}
+
+func NewSignatureInterceptor(verifier *hash.SignatureVerifier, protectedMethods []string) *SignatureInterceptor {
+	pm := make(map[string]bool, len(protectedMethods))
+	for _, p := range protectedMethods {
+		pm[p] = true
+	}
+	return &SignatureInterceptor{verifier: verifier, protectedMethods: pm}
+}
+
+func (s *SignatureInterceptor) Handle(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if s.verifier == nil || !s.protectedMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	var sig string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vals := md.Get(_signatureMetadataKey); len(vals) > 0 {
+			sig = vals[0]
+		}
+	}
+
+	body, err := marshalRequest(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "wrong request")
+	}
+
+	if err = s.verifier.Verify(sig, info.FullMethod, body); err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return handler(ctx, req)
+}
+
+// SignatureClientInterceptor signs every request with HMAC key and sends
+// HMAC key ID, if set.
+type SignatureClientInterceptor struct {
+	hmacKey   string
+	hmacKeyID string
+}
+
+func NewSignatureClientInterceptor(hmacKey, hmacKeyID string) *SignatureClientInterceptor {
+	return &SignatureClientInterceptor{hmacKey: hmacKey, hmacKeyID: hmacKeyID}
+}
+
+func (s *SignatureClientInterceptor) Handle(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	body, err := marshalRequest(req)
+	if err != nil {
+		return err
+	}
+
+	sig, err := hash.SignRequest(s.hmacKey, s.hmacKeyID, method, body, time.Now())
+	if err != nil {
+		return err
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, _signatureMetadataKey, sig)
+	if s.hmacKeyID != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, _hmacKeyIDMetadataKey, s.hmacKeyID)
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func marshalRequest(req interface{}) ([]byte, error) {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "not a protobuf message")
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
@@ -0,0 +1,77 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/hash"
+	pb "github.com/devldavydov/promytheus/internal/grpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const _updateMethod = "/grpc.MetricService/UpdateMetrics"
+
+func TestSignatureInterceptor(t *testing.T) {
+	req := &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "PollCount", Type: pb.MetricType_COUNTER, Delta: 5, Labels: map[string]string{"a": "1", "b": "2"}},
+	}}
+
+	// Sign request with client interceptor
+	var outMD metadata.MD
+	err := NewSignatureClientInterceptor("foobar", "team1").Handle(
+		context.Background(), _updateMethod, req, nil, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			outMD, _ = metadata.FromOutgoingContext(ctx)
+			return nil
+		})
+	require.NoError(t, err)
+	require.Len(t, outMD.Get(_signatureMetadataKey), 1)
+	assert.Equal(t, []string{"team1"}, outMD.Get(_hmacKeyIDMetadataKey))
+
+	hmacKeys, err := hash.NewKeyRing(map[string]string{"team1": "foobar", "team2": "barfoo"}, "team2")
+	require.NoError(t, err)
+	srvInterceptor := NewSignatureInterceptor(
+		hash.NewSignatureVerifier(hmacKeys, hash.DefaultSignatureWindow, true),
+		[]string{_updateMethod})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &pb.UpdateMetricsResponse{}, nil
+	}
+	call := func(md metadata.MD, req interface{}, method string) error {
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+		_, err := srvInterceptor.Handle(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	// Correct signature
+	assert.NoError(t, call(outMD, req, _updateMethod))
+
+	// Replay
+	assert.Equal(t, codes.Unauthenticated, status.Code(call(outMD, req, _updateMethod)))
+
+	// Changed request
+	sig, err := hash.SignRequest("foobar", "", _updateMethod, []byte("other"), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(call(metadata.Pairs(_signatureMetadataKey, sig), req, _updateMethod)))
+
+	// Missing required signature
+	assert.Equal(t, codes.Unauthenticated, status.Code(call(metadata.MD{}, req, _updateMethod)))
+
+	// Not protected method
+	assert.NoError(t, call(metadata.MD{}, &pb.EmptyRequest{}, "/grpc.MetricService/GetAllMetrics"))
+}
+
+func TestSignatureInterceptorDisabled(t *testing.T) {
+	srvInterceptor := NewSignatureInterceptor(nil, []string{_updateMethod})
+	_, err := srvInterceptor.Handle(
+		context.Background(),
+		&pb.UpdateMetricsRequest{},
+		&grpc.UnaryServerInfo{FullMethod: _updateMethod},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+	assert.NoError(t, err)
+}
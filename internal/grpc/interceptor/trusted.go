@@ -3,25 +3,32 @@ package interceptor
 import (
 	"context"
 	"net"
+	"strings"
 
+	"github.com/devldavydov/promytheus/internal/common/acl"
 	"github.com/devldavydov/promytheus/internal/common/nettools"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
+// TrustedSubnetIncerceptor checks client IP according to ACL policy of method
+// group. Client IP is peer address, or forwarded IP from metadata, if peer is
+// trusted proxy.
 type TrustedSubnetIncerceptor struct {
-	trustedSubnet    *net.IPNet
-	protectedMethods map[string]bool
+	policy         *acl.Policy
+	trustedProxies []*net.IPNet
+	methodGroups   map[string]acl.Group
 }
 
-func NewTrustedSubnetInterceptor(trustedSubnet *net.IPNet, protectedMethods []string) *TrustedSubnetIncerceptor {
-	pm := make(map[string]bool, len(protectedMethods))
-	for _, p := range protectedMethods {
-		pm[p] = true
-	}
-	return &TrustedSubnetIncerceptor{trustedSubnet: trustedSubnet, protectedMethods: pm}
+func NewTrustedSubnetInterceptor(
+	policy *acl.Policy,
+	trustedProxies []*net.IPNet,
+	methodGroups map[string]acl.Group,
+) *TrustedSubnetIncerceptor {
+	return &TrustedSubnetIncerceptor{policy: policy, trustedProxies: trustedProxies, methodGroups: methodGroups}
 }
 
 func (t *TrustedSubnetIncerceptor) Handle(
@@ -30,17 +37,26 @@ func (t *TrustedSubnetIncerceptor) Handle(
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler,
 ) (interface{}, error) {
-	if t.trustedSubnet == nil || !t.protectedMethods[info.FullMethod] {
+	group, ok := t.methodGroups[info.FullMethod]
+	if !ok {
+		return handler(ctx, req)
+	}
+	if _, ok = t.policy.Rule(group); !ok {
 		return handler(ctx, req)
 	}
 
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
 		return nil, status.Error(codes.PermissionDenied, "forbidden")
 	}
 
-	vals := md.Get(nettools.RealIPHeader)
-	if len(vals) == 0 || !t.trustedSubnet.Contains(net.ParseIP(vals[0])) {
+	var forwardedFor string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		forwardedFor = strings.Join(md.Get(nettools.ForwardedForHeader), ",")
+	}
+
+	ip := nettools.ClientIP(p.Addr.String(), t.trustedProxies, forwardedFor)
+	if !t.policy.Allowed(group, ip) {
 		return nil, status.Error(codes.PermissionDenied, "forbidden")
 	}
 
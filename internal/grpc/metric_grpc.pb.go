@@ -22,6 +22,7 @@ const (
 	MetricService_UpdateMetrics_FullMethodName = "/grpc.MetricService/UpdateMetrics"
 	MetricService_GetMetric_FullMethodName     = "/grpc.MetricService/GetMetric"
 	MetricService_GetAllMetrics_FullMethodName = "/grpc.MetricService/GetAllMetrics"
+	MetricService_QueryRange_FullMethodName    = "/grpc.MetricService/QueryRange"
 	MetricService_Ping_FullMethodName          = "/grpc.MetricService/Ping"
 )
 
@@ -32,6 +33,7 @@ type MetricServiceClient interface {
 	UpdateMetrics(ctx context.Context, in *UpdateMetricsRequest, opts ...grpc.CallOption) (*UpdateMetricsResponse, error)
 	GetMetric(ctx context.Context, in *GetMetricRequest, opts ...grpc.CallOption) (*GetMetricResponse, error)
 	GetAllMetrics(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*GetAllMetricsResponse, error)
+	QueryRange(ctx context.Context, in *QueryRangeRequest, opts ...grpc.CallOption) (*QueryRangeResponse, error)
 	Ping(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*EmptyResponse, error)
 }
 
@@ -70,6 +72,15 @@ func (c *metricServiceClient) GetAllMetrics(ctx context.Context, in *EmptyReques
 	return out, nil
 }
 
+func (c *metricServiceClient) QueryRange(ctx context.Context, in *QueryRangeRequest, opts ...grpc.CallOption) (*QueryRangeResponse, error) {
+	out := new(QueryRangeResponse)
+	err := c.cc.Invoke(ctx, MetricService_QueryRange_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *metricServiceClient) Ping(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*EmptyResponse, error) {
 	out := new(EmptyResponse)
 	err := c.cc.Invoke(ctx, MetricService_Ping_FullMethodName, in, out, opts...)
@@ -86,6 +97,7 @@ type MetricServiceServer interface {
 	UpdateMetrics(context.Context, *UpdateMetricsRequest) (*UpdateMetricsResponse, error)
 	GetMetric(context.Context, *GetMetricRequest) (*GetMetricResponse, error)
 	GetAllMetrics(context.Context, *EmptyRequest) (*GetAllMetricsResponse, error)
+	QueryRange(context.Context, *QueryRangeRequest) (*QueryRangeResponse, error)
 	Ping(context.Context, *EmptyRequest) (*EmptyResponse, error)
 	mustEmbedUnimplementedMetricServiceServer()
 }
@@ -103,6 +115,9 @@ func (UnimplementedMetricServiceServer) GetMetric(context.Context, *GetMetricReq
 func (UnimplementedMetricServiceServer) GetAllMetrics(context.Context, *EmptyRequest) (*GetAllMetricsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetAllMetrics not implemented")
 }
+func (UnimplementedMetricServiceServer) QueryRange(context.Context, *QueryRangeRequest) (*QueryRangeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryRange not implemented")
+}
 func (UnimplementedMetricServiceServer) Ping(context.Context, *EmptyRequest) (*EmptyResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
 }
@@ -173,6 +188,24 @@ func _MetricService_GetAllMetrics_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MetricService_QueryRange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryRangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricServiceServer).QueryRange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricService_QueryRange_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricServiceServer).QueryRange(ctx, req.(*QueryRangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _MetricService_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(EmptyRequest)
 	if err := dec(in); err != nil {
@@ -210,6 +243,10 @@ var MetricService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetAllMetrics",
 			Handler:    _MetricService_GetAllMetrics_Handler,
 		},
+		{
+			MethodName: "QueryRange",
+			Handler:    _MetricService_QueryRange_Handler,
+		},
 		{
 			MethodName: "Ping",
 			Handler:    _MetricService_Ping_Handler,
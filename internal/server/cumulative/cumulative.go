@@ -0,0 +1,268 @@
+// Package cumulative converts cumulative metric values, sent by Prometheus
+// and OpenTelemetry clients, to deltas for additive storage counters and histograms.
+package cumulative
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+)
+
+// Tracker keeps last cumulative value per series and converts new values
+// to deltas with it. Value less than last one, or with changed start time,
+// is series reset and stored as is. First value of series, already present
+// in storage, is used as baseline only, so increments between tracker
+// restart and first value are not counted. Series, not written for
+// SeriesTTL, are forgotten, their next value is baseline only.
+type Tracker struct {
+	storage storage.Storage
+	now     func() time.Time
+
+	mu        sync.Mutex
+	series    map[string]state // by type and series ID
+	lastEvict time.Time
+}
+
+// SeriesTTL - time since last write, after which series is forgotten.
+const SeriesTTL = time.Hour
+
+type state struct {
+	value     metric.MetricValue
+	startTime uint64
+	lastSeen  time.Time
+}
+
+// NewTracker - constructor for Tracker.
+func NewTracker(stg storage.Storage) *Tracker {
+	return &Tracker{storage: stg, now: time.Now, series: make(map[string]state), lastEvict: time.Now()}
+}
+
+// Write fills batch with fn and saves it in storage. Batches are processed
+// one by one. Last values are remembered only after successful save, so
+// retried request gives the same deltas.
+func (t *Tracker) Write(fn func(b *Batch) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := &Batch{
+		tracker:    t,
+		series:     make(map[string]state),
+		gauges:     make(map[string]metric.Gauge),
+		histograms: make(map[string]metric.Histogram),
+	}
+	if err := fn(b); err != nil {
+		return err
+	}
+	if len(b.items) == 0 {
+		return nil
+	}
+
+	if err := t.storage.SetMetrics(b.items); err != nil {
+		return err
+	}
+
+	now := t.now()
+	for key, st := range b.series {
+		st.lastSeen = now
+		t.series[key] = st
+	}
+	t.evict(now)
+	return nil
+}
+
+// evict forgets series, not written for SeriesTTL. Series are checked
+// not more often than once per SeriesTTL. Must be called under lock.
+func (t *Tracker) evict(now time.Time) {
+	if now.Sub(t.lastEvict) < SeriesTTL {
+		return
+	}
+	t.lastEvict = now
+
+	for key, st := range t.series {
+		if now.Sub(st.lastSeen) >= SeriesTTL {
+			delete(t.series, key)
+		}
+	}
+}
+
+// Batch - storage items of single write.
+type Batch struct {
+	tracker    *Tracker
+	items      []storage.StorageItem
+	series     map[string]state
+	gauges     map[string]metric.Gauge
+	histograms map[string]metric.Histogram
+}
+
+// Add adds item to batch as is.
+func (b *Batch) Add(item storage.StorageItem) {
+	if g, ok := item.Value.(metric.Gauge); ok {
+		b.gauges[metric.SeriesID(item.MetricName, item.Labels)] = g
+	}
+	b.items = append(b.items, item)
+}
+
+// AddGaugeDelta adds delta to current gauge value.
+func (b *Batch) AddGaugeDelta(name string, labels metric.Labels, delta float64) error {
+	id := metric.SeriesID(name, labels)
+
+	current, ok := b.gauges[id]
+	if !ok {
+		var err error
+		current, err = b.tracker.storage.GetGaugeMetric(name, labels)
+		if err != nil && !errors.Is(err, storage.ErrMetricNotFound) {
+			return err
+		}
+	}
+
+	b.Add(storage.StorageItem{MetricName: name, Labels: labels, Value: current + metric.Gauge(delta)})
+	return nil
+}
+
+// AddHistogramDelta adds delta histogram. Histogram with bounds, other than
+// bounds of series in batch or storage, is not added and error wrapping
+// metric.ErrWrongMetricValue is returned.
+func (b *Batch) AddHistogramDelta(name string, labels metric.Labels, value metric.Histogram) error {
+	if err := b.checkHistogram(name, labels, value); err != nil {
+		return err
+	}
+	b.items = append(b.items, storage.StorageItem{MetricName: name, Labels: labels, Value: value})
+	return nil
+}
+
+// AddCounter adds delta of cumulative counter value. Start time is series
+// start in any units, 0 if unknown.
+func (b *Batch) AddCounter(name string, labels metric.Labels, value float64, startTime uint64) error {
+	key := metric.CounterTypeName + ":" + metric.SeriesID(name, labels)
+	cur := metric.Counter(math.Round(value))
+
+	last, ok, err := b.last(key, startTime, func() error {
+		_, err := b.tracker.storage.GetCounterMetric(name, labels)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	b.series[key] = state{value: cur, startTime: startTime}
+
+	delta := cur
+	switch lastVal, isCounter := last.(metric.Counter); {
+	case ok && !isCounter:
+		delta = 0
+	case ok && cur >= lastVal:
+		delta = cur - lastVal
+	}
+	b.items = append(b.items, storage.StorageItem{MetricName: name, Labels: labels, Value: delta})
+	return nil
+}
+
+// AddHistogram adds delta of cumulative histogram. Start time is series
+// start in any units, 0 if unknown. Histogram with bounds, other than
+// bounds of series in batch or storage, is not added and error wrapping
+// metric.ErrWrongMetricValue is returned.
+func (b *Batch) AddHistogram(name string, labels metric.Labels, value metric.Histogram, startTime uint64) error {
+	key := metric.HistogramTypeName + ":" + metric.SeriesID(name, labels)
+
+	if err := b.checkHistogram(name, labels, value); err != nil {
+		return err
+	}
+
+	last, ok, err := b.last(key, startTime, func() error {
+		_, err := b.tracker.storage.GetHistogramMetric(name, labels)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	b.series[key] = state{value: value, startTime: startTime}
+
+	if !ok {
+		b.items = append(b.items, storage.StorageItem{MetricName: name, Labels: labels, Value: value})
+		return nil
+	}
+	if last == nil {
+		return nil
+	}
+
+	delta, isReset := histogramDelta(last.(metric.Histogram), value)
+	if isReset {
+		delta = value
+	}
+	b.items = append(b.items, storage.StorageItem{MetricName: name, Labels: labels, Value: delta})
+	return nil
+}
+
+// checkHistogram checks, that histogram bounds are the same as bounds of
+// series in batch or storage, so batch histograms can be merged in storage.
+func (b *Batch) checkHistogram(name string, labels metric.Labels, value metric.Histogram) error {
+	id := metric.SeriesID(name, labels)
+
+	stored, ok := b.histograms[id]
+	if !ok {
+		var err error
+		stored, err = b.tracker.storage.GetHistogramMetric(name, labels)
+		if errors.Is(err, storage.ErrMetricNotFound) {
+			b.histograms[id] = value
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		b.histograms[id] = stored
+	}
+
+	_, err := stored.Merge(value)
+	return err
+}
+
+// last returns last value of series in batch or tracker and ok flag, false
+// for new or reset series. For unknown series, present in storage, ok is
+// true with nil value - new value is baseline only.
+func (b *Batch) last(key string, startTime uint64, getStored func() error) (metric.MetricValue, bool, error) {
+	st, ok := b.series[key]
+	if !ok {
+		st, ok = b.tracker.series[key]
+	}
+
+	if ok {
+		if st.startTime != 0 && startTime != 0 && st.startTime != startTime {
+			return nil, false, nil
+		}
+		return st.value, true, nil
+	}
+
+	err := getStored()
+	if errors.Is(err, storage.ErrMetricNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return nil, true, nil
+}
+
+// histogramDelta returns difference of cumulative histograms or reset flag,
+// if bounds changed or any count decreased.
+func histogramDelta(last, cur metric.Histogram) (metric.Histogram, bool) {
+	if len(last.Bounds) != len(cur.Bounds) || cur.Count < last.Count {
+		return metric.Histogram{}, true
+	}
+
+	delta, err := metric.NewHistogram(cur.Bounds)
+	if err != nil {
+		return metric.Histogram{}, true
+	}
+	for i := range cur.Bounds {
+		if cur.Bounds[i] != last.Bounds[i] || cur.Buckets[i] < last.Buckets[i] {
+			return metric.Histogram{}, true
+		}
+		delta.Buckets[i] = cur.Buckets[i] - last.Buckets[i]
+	}
+	delta.Count = cur.Count - last.Count
+	delta.Sum = cur.Sum - last.Sum
+	return delta, false
+}
@@ -0,0 +1,147 @@
+package cumulative
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _labels = metric.Labels{"job": "node"}
+
+func TestCounter(t *testing.T) {
+	stg := createTestStorage(t)
+	tr := NewTracker(stg)
+
+	write := func(value float64, startTime uint64) {
+		require.NoError(t, tr.Write(func(b *Batch) error {
+			return b.AddCounter("foo", _labels, value, startTime)
+		}))
+	}
+
+	write(10, 1)
+	write(15, 1)
+	assertCounter(t, stg, 15)
+
+	// Decrease is reset
+	write(3, 1)
+	assertCounter(t, stg, 18)
+
+	// Start time change is reset
+	write(5, 2)
+	assertCounter(t, stg, 23)
+}
+
+func TestCounterStoredBaseline(t *testing.T) {
+	stg := createTestStorage(t)
+	_, err := stg.SetCounterMetric("foo", _labels, 100)
+	require.NoError(t, err)
+
+	tr := NewTracker(stg)
+	require.NoError(t, tr.Write(func(b *Batch) error {
+		if err := b.AddCounter("foo", _labels, 500, 0); err != nil {
+			return err
+		}
+		return b.AddCounter("foo", _labels, 510, 0)
+	}))
+	assertCounter(t, stg, 110)
+}
+
+func TestSeriesEviction(t *testing.T) {
+	stg := createTestStorage(t)
+	tr := NewTracker(stg)
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr.now = func() time.Time { return now }
+	tr.lastEvict = now
+
+	write := func(name string, value float64) {
+		require.NoError(t, tr.Write(func(b *Batch) error {
+			return b.AddCounter(name, _labels, value, 0)
+		}))
+	}
+
+	write("foo", 10)
+	now = now.Add(SeriesTTL / 2)
+	write("bar", 1)
+	assert.Len(t, tr.series, 2)
+
+	// Series not written for TTL is forgotten
+	now = now.Add(SeriesTTL / 2)
+	write("bar", 2)
+	assert.Len(t, tr.series, 1)
+
+	// Next value of forgotten series is baseline only
+	write("foo", 20)
+	assertCounter(t, stg, 10)
+	write("foo", 25)
+	assertCounter(t, stg, 15)
+}
+
+func TestHistogram(t *testing.T) {
+	stg := createTestStorage(t)
+	tr := NewTracker(stg)
+
+	write := func(buckets []uint64, sum float64, count uint64, startTime uint64) {
+		h, err := metric.NewHistogramFromParts([]float64{1, 5}, buckets, &sum, &count)
+		require.NoError(t, err)
+		require.NoError(t, tr.Write(func(b *Batch) error {
+			return b.AddHistogram("bar", _labels, h, startTime)
+		}))
+	}
+
+	write([]uint64{1, 2}, 4, 3, 1)
+	write([]uint64{2, 4}, 10, 6, 1)
+	assertHistogram(t, stg, []uint64{2, 4}, 10, 6)
+
+	// Start time change is reset
+	write([]uint64{1, 1}, 1, 1, 2)
+	assertHistogram(t, stg, []uint64{3, 5}, 11, 7)
+
+	// Count decrease is reset
+	write([]uint64{0, 0}, 2, 1, 2)
+	assertHistogram(t, stg, []uint64{3, 5}, 13, 8)
+}
+
+func TestGaugeDelta(t *testing.T) {
+	stg := createTestStorage(t)
+	_, err := stg.SetGaugeMetric("baz", _labels, 1.5)
+	require.NoError(t, err)
+
+	tr := NewTracker(stg)
+	require.NoError(t, tr.Write(func(b *Batch) error {
+		if err := b.AddGaugeDelta("baz", _labels, 2); err != nil {
+			return err
+		}
+		return b.AddGaugeDelta("baz", _labels, -0.5)
+	}))
+
+	val, err := stg.GetGaugeMetric("baz", _labels)
+	require.NoError(t, err)
+	assert.Equal(t, metric.Gauge(3), val)
+}
+
+func assertCounter(t *testing.T, stg storage.Storage, exp int64) {
+	val, err := stg.GetCounterMetric("foo", _labels)
+	require.NoError(t, err)
+	assert.Equal(t, metric.Counter(exp), val)
+}
+
+func assertHistogram(t *testing.T, stg storage.Storage, buckets []uint64, sum float64, count uint64) {
+	val, err := stg.GetHistogramMetric("bar", _labels)
+	require.NoError(t, err)
+	assert.Equal(t, buckets, val.Buckets)
+	assert.Equal(t, sum, val.Sum)
+	assert.Equal(t, count, val.Count)
+}
+
+func createTestStorage(t *testing.T) *storage.MemStorage {
+	stg, err := storage.NewMemStorage(context.TODO(), logrus.New(), storage.NewPersistSettings(0, "", false), storage.NewHistorySettings(0))
+	require.NoError(t, err)
+	t.Cleanup(stg.Close)
+	return stg
+}
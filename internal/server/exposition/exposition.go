@@ -0,0 +1,260 @@
+// Package exposition renders metrics in Prometheus text and OpenMetrics formats.
+package exposition
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	_http "github.com/devldavydov/promytheus/internal/common/http"
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+)
+
+// Format - exposition format.
+type Format int
+
+const (
+	// FormatText - Prometheus text format 0.0.4.
+	FormatText Format = iota
+	// FormatOpenMetrics - OpenMetrics text format 1.0.0.
+	FormatOpenMetrics
+)
+
+// _summaryQuantiles - quantiles exposed for summary metrics.
+var _summaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+// NegotiateFormat returns format requested by Accept header value,
+// Prometheus text format by default.
+func NegotiateFormat(accept string) Format {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != _http.BaseContentTypeOpenMetrics {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		return FormatOpenMetrics
+	}
+	return FormatText
+}
+
+// ContentType returns HTTP content type of format.
+func (f Format) ContentType() string {
+	if f == FormatOpenMetrics {
+		return _http.ContentTypeOpenMetrics
+	}
+	return _http.ContentTypePrometheusText
+}
+
+type family struct {
+	name   string
+	mtype  string
+	items  []storage.StorageItem
+	series map[string]bool
+}
+
+type labelPair struct {
+	name  string
+	value string
+}
+
+// Encode writes metrics grouped by families in given format. Metrics, which
+// sanitized name and labels clash with already written ones, are skipped and
+// returned. Families, which name clashes with sample name of other family
+// (e.g. gauge foo_sum and histogram foo), and histograms and summaries with
+// le and quantile labels are skipped too.
+func Encode(w io.Writer, items []storage.StorageItem, format Format) ([]storage.StorageItem, error) {
+	families := make(map[string]*family)
+	var (
+		names   []string
+		skipped []storage.StorageItem
+	)
+
+	for _, item := range items {
+		mtype := item.Value.TypeName()
+		name := metric.SanitizeMetricName(item.MetricName)
+		if format == FormatOpenMetrics && mtype == metric.CounterTypeName {
+			name = strings.TrimSuffix(name, "_total")
+		}
+
+		f, ok := families[name]
+		if !ok {
+			f = &family{name: name, mtype: mtype, series: make(map[string]bool)}
+			families[name] = f
+			names = append(names, name)
+		}
+
+		labels := sanitizeLabels(item.Labels)
+		seriesKey := labelsString(labels)
+		if f.mtype != mtype || f.series[seriesKey] || hasReservedLabel(labels, mtype) {
+			skipped = append(skipped, item)
+			continue
+		}
+		f.series[seriesKey] = true
+		f.items = append(f.items, item)
+	}
+
+	// Sample names of all families are unique
+	sampleNames := make(map[string]bool)
+	for _, name := range names {
+		if f := families[name]; len(f.items) > 0 {
+			for _, sampleName := range f.sampleNames(format) {
+				sampleNames[sampleName] = true
+			}
+		}
+	}
+	kept := names[:0]
+	for _, name := range names {
+		if len(families[name].items) == 0 {
+			continue
+		}
+		if sampleNames[name] {
+			skipped = append(skipped, families[name].items...)
+			continue
+		}
+		kept = append(kept, name)
+	}
+	names = kept
+
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		writeFamily(bw, families[name], format)
+	}
+	if format == FormatOpenMetrics {
+		bw.WriteString("# EOF\n")
+	}
+
+	return skipped, bw.Flush()
+}
+
+// sampleNames returns names of family samples, other than family name.
+func (f *family) sampleNames(format Format) []string {
+	switch f.mtype {
+	case metric.CounterTypeName:
+		if format == FormatOpenMetrics {
+			return []string{f.name + "_total"}
+		}
+	case metric.HistogramTypeName:
+		return []string{f.name + "_bucket", f.name + "_sum", f.name + "_count"}
+	case metric.SummaryTypeName:
+		return []string{f.name + "_sum", f.name + "_count"}
+	}
+	return nil
+}
+
+// hasReservedLabel checks that labels contain label, added to samples of type.
+func hasReservedLabel(labels []labelPair, mtype string) bool {
+	var reserved string
+	switch mtype {
+	case metric.HistogramTypeName:
+		reserved = "le"
+	case metric.SummaryTypeName:
+		reserved = "quantile"
+	default:
+		return false
+	}
+
+	for _, l := range labels {
+		if l.name == reserved {
+			return true
+		}
+	}
+	return false
+}
+
+func writeFamily(w *bufio.Writer, f *family, format Format) {
+	sort.Slice(f.items, func(i, j int) bool {
+		return labelsString(sanitizeLabels(f.items[i].Labels)) < labelsString(sanitizeLabels(f.items[j].Labels))
+	})
+
+	w.WriteString("# TYPE " + f.name + " " + f.mtype + "\n")
+
+	for _, item := range f.items {
+		labels := sanitizeLabels(item.Labels)
+
+		switch val := item.Value.(type) {
+		case metric.Gauge:
+			writeSample(w, f.name, labels, formatFloat(float64(val)))
+		case metric.Counter:
+			name := f.name
+			if format == FormatOpenMetrics {
+				name += "_total"
+			}
+			writeSample(w, name, labels, strconv.FormatInt(int64(val), 10))
+		case metric.Histogram:
+			for i, bound := range val.Bounds {
+				writeSample(w, f.name+"_bucket", withLabel(labels, "le", formatFloat(bound)), strconv.FormatUint(val.Buckets[i], 10))
+			}
+			writeSample(w, f.name+"_bucket", withLabel(labels, "le", "+Inf"), strconv.FormatUint(val.Count, 10))
+			writeSample(w, f.name+"_sum", labels, formatFloat(val.Sum))
+			writeSample(w, f.name+"_count", labels, strconv.FormatUint(val.Count, 10))
+		case metric.Summary:
+			for _, q := range _summaryQuantiles {
+				writeSample(w, f.name, withLabel(labels, "quantile", formatFloat(q)), formatFloat(val.Quantile(q)))
+			}
+			writeSample(w, f.name+"_sum", labels, formatFloat(val.Sum))
+			writeSample(w, f.name+"_count", labels, strconv.FormatUint(val.Count, 10))
+		}
+	}
+}
+
+func writeSample(w *bufio.Writer, name string, labels []labelPair, value string) {
+	w.WriteString(name)
+	w.WriteString(labelsString(labels))
+	w.WriteByte(' ')
+	w.WriteString(value)
+	w.WriteByte('\n')
+}
+
+func sanitizeLabels(labels metric.Labels) []labelPair {
+	pairs := make([]labelPair, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, labelPair{name: metric.SanitizeLabelName(name), value: value})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].name < pairs[j].name })
+	return pairs
+}
+
+func withLabel(labels []labelPair, name, value string) []labelPair {
+	return append(append(make([]labelPair, 0, len(labels)+1), labels...), labelPair{name: name, value: value})
+}
+
+func labelsString(labels []labelPair) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.name)
+		b.WriteString(`="`)
+		b.WriteString(metric.EscapeLabelValue(l.value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
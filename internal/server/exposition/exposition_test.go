@@ -0,0 +1,141 @@
+package exposition
+
+import (
+	"bytes"
+	"testing"
+
+	_http "github.com/devldavydov/promytheus/internal/common/http"
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	for _, tt := range []struct {
+		accept string
+		exp    Format
+	}{
+		{accept: "", exp: FormatText},
+		{accept: "text/plain", exp: FormatText},
+		{accept: "application/openmetrics-text; version=1.0.0", exp: FormatOpenMetrics},
+		{accept: "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5,*/*;q=0.1", exp: FormatOpenMetrics},
+		{accept: "application/openmetrics-text;q=0,text/plain", exp: FormatText},
+	} {
+		assert.Equal(t, tt.exp, NegotiateFormat(tt.accept), tt.accept)
+	}
+
+	assert.Equal(t, _http.ContentTypePrometheusText, FormatText.ContentType())
+	assert.Equal(t, _http.ContentTypeOpenMetrics, FormatOpenMetrics.ContentType())
+}
+
+func TestEncodeText(t *testing.T) {
+	items := []storage.StorageItem{
+		{MetricName: "requests", Labels: metric.Labels{"path": `/a"b`}, Value: metric.Counter(5)},
+		{MetricName: "requests", Value: metric.Counter(1)},
+		{MetricName: "cpu.usage", Labels: metric.Labels{"core": "0"}, Value: metric.Gauge(0.5)},
+		{MetricName: "latency", Value: metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{1, 2}, Sum: 1.5, Count: 3}},
+	}
+
+	var buf bytes.Buffer
+	skipped, err := Encode(&buf, items, FormatText)
+	assert.NoError(t, err)
+	assert.Empty(t, skipped)
+	assert.Equal(t, `# TYPE cpu_usage gauge
+cpu_usage{core="0"} 0.5
+# TYPE latency histogram
+latency_bucket{le="0.1"} 1
+latency_bucket{le="1"} 2
+latency_bucket{le="+Inf"} 3
+latency_sum 1.5
+latency_count 3
+# TYPE requests counter
+requests 1
+requests{path="/a\"b"} 5
+`, buf.String())
+}
+
+func TestEncodeOpenMetrics(t *testing.T) {
+	s, _ := metric.NewSummaryFromString("1")
+	items := []storage.StorageItem{
+		{MetricName: "requests_total", Value: metric.Counter(5)},
+		{MetricName: "duration", Labels: metric.Labels{"host": "a"}, Value: s},
+	}
+
+	var buf bytes.Buffer
+	skipped, err := Encode(&buf, items, FormatOpenMetrics)
+	assert.NoError(t, err)
+	assert.Empty(t, skipped)
+	assert.Equal(t, `# TYPE duration summary
+duration{host="a",quantile="0.5"} 0.9900000000000001
+duration{host="a",quantile="0.9"} 0.9900000000000001
+duration{host="a",quantile="0.99"} 0.9900000000000001
+duration_sum{host="a"} 1
+duration_count{host="a"} 1
+# TYPE requests counter
+requests_total 5
+# EOF
+`, buf.String())
+}
+
+func TestEncodeSkipClashes(t *testing.T) {
+	items := []storage.StorageItem{
+		{MetricName: "foo", Value: metric.Counter(1)},
+		{MetricName: "foo", Value: metric.Gauge(1)},
+		{MetricName: "a.b", Value: metric.Gauge(1)},
+		{MetricName: "a_b", Value: metric.Gauge(2)},
+	}
+
+	var buf bytes.Buffer
+	skipped, err := Encode(&buf, items, FormatText)
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.StorageItem{items[1], items[3]}, skipped)
+	assert.Equal(t, `# TYPE a_b gauge
+a_b 1
+# TYPE foo counter
+foo 1
+`, buf.String())
+}
+
+func TestEncodeSkipFamilyClashes(t *testing.T) {
+	h, _ := metric.NewHistogram([]float64{1})
+	s, _ := metric.NewSummaryFromString("1")
+	items := []storage.StorageItem{
+		{MetricName: "foo", Value: h},
+		{MetricName: "foo_sum", Value: metric.Gauge(1)},
+		{MetricName: "foo_bucket", Labels: metric.Labels{"a": "b"}, Value: metric.Gauge(2)},
+		{MetricName: "bar", Labels: metric.Labels{"le": "1"}, Value: h},
+		{MetricName: "baz", Labels: metric.Labels{"quantile": "0.5"}, Value: s},
+		{MetricName: "qux_total", Value: metric.Gauge(3)},
+		{MetricName: "qux_total", Value: metric.Counter(4)},
+	}
+
+	var buf bytes.Buffer
+	skipped, err := Encode(&buf, items, FormatText)
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.StorageItem{items[3], items[4], items[6], items[1], items[2]}, skipped)
+	assert.Equal(t, `# TYPE foo histogram
+foo_bucket{le="1"} 0
+foo_bucket{le="+Inf"} 0
+foo_sum 0
+foo_count 0
+# TYPE qux_total gauge
+qux_total 3
+`, buf.String())
+
+	// OpenMetrics counter sample name clashes with gauge
+	buf.Reset()
+	skipped, err = Encode(&buf, []storage.StorageItem{items[6], items[5]}, FormatOpenMetrics)
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.StorageItem{items[5]}, skipped)
+	assert.Equal(t, `# TYPE qux counter
+qux_total 4
+# EOF
+`, buf.String())
+}
+
+func TestEncodeEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := Encode(&buf, nil, FormatOpenMetrics)
+	assert.NoError(t, err)
+	assert.Equal(t, "# EOF\n", buf.String())
+}
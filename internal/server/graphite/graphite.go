@@ -0,0 +1,245 @@
+// Package graphite provides Graphite plaintext protocol TCP listener.
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/acl"
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// _maxLineSize - max length of line, connection with longer line is closed.
+	_maxLineSize = 64 * 1024
+	// _defaultIdleTimeout - connection without data for timeout is closed.
+	_defaultIdleTimeout = 5 * time.Minute
+)
+
+// ErrWrongLine - error for incorrect Graphite line.
+var ErrWrongLine = errors.New("wrong graphite line")
+
+// Listener - Graphite plaintext protocol TCP listener. Every line in format
+// "path value timestamp" is stored as gauge, name and labels are taken from
+// first matching template, full path without labels is used otherwise.
+type Listener struct {
+	listener  net.Listener
+	storage   storage.Storage
+	templates []Template
+	policy    *acl.Policy
+	logger    *logrus.Logger
+
+	idleTimeout time.Duration
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	shutdown bool
+}
+
+// NewListener - constructor for Listener, starts listening TCP address.
+// Connections from addresses, not allowed to write by ACL policy, are rejected.
+func NewListener(address string, stg storage.Storage, templates []Template, policy *acl.Policy, logger *logrus.Logger) (*Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Listener{
+		listener:    listener,
+		storage:     stg,
+		templates:   templates,
+		policy:      policy,
+		logger:      logger,
+		idleTimeout: _defaultIdleTimeout,
+		conns:       make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Addr returns listener local address.
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Serve accepts connections until listener is shut down.
+func (l *Listener) Serve() error {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		if !l.isTrusted(conn.RemoteAddr()) {
+			l.logger.Warnf("Graphite connection from untrusted address [%s] rejected", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+
+		if !l.trackConn(conn) {
+			conn.Close()
+			return nil
+		}
+
+		go l.handleConn(conn)
+	}
+}
+
+// Shutdown stops accepting connections and interrupts reading of active ones.
+// Already received lines are stored. If ctx is done before connections are
+// finished, they are closed and ctx error is returned.
+func (l *Listener) Shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	l.shutdown = true
+	err := l.listener.Close()
+	for conn := range l.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	l.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		l.mu.Lock()
+		for conn := range l.conns {
+			conn.Close()
+		}
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (l *Listener) trackConn(conn net.Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.shutdown {
+		return false
+	}
+	l.conns[conn] = struct{}{}
+	l.wg.Add(1)
+	return true
+}
+
+func (l *Listener) untrackConn(conn net.Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.conns, conn)
+	l.wg.Done()
+}
+
+// setIdleDeadline sets read deadline of connection to idle timeout, unless
+// listener is shut down.
+func (l *Listener) setIdleDeadline(conn net.Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.shutdown {
+		return false
+	}
+	conn.SetReadDeadline(time.Now().Add(l.idleTimeout))
+	return true
+}
+
+func (l *Listener) isTrusted(addr net.Addr) bool {
+	var ip net.IP
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		ip = tcpAddr.IP
+	}
+	return l.policy.Allowed(acl.GroupWrite, ip)
+}
+
+func (l *Listener) handleConn(conn net.Conn) {
+	defer l.untrackConn(conn)
+	defer conn.Close()
+
+	// Incomplete line is processed only on EOF
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), _maxLineSize)
+	for l.setIdleDeadline(conn) && scanner.Scan() {
+		l.handleLine(scanner.Text())
+	}
+
+	err := scanner.Err()
+	switch {
+	case errors.Is(err, bufio.ErrTooLong):
+		l.logger.Warnf("Graphite connection [%s] closed: line is longer than %d bytes", conn.RemoteAddr(), _maxLineSize)
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		l.logger.Debugf("Graphite connection [%s] closed on timeout", conn.RemoteAddr())
+	case err != nil && !errors.Is(err, net.ErrClosed):
+		l.logger.Errorf("Graphite connection [%s] read error: %v", conn.RemoteAddr(), err)
+	}
+}
+
+func (l *Listener) handleLine(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+
+	name, labels, value, err := l.parseLine(line)
+	if err != nil {
+		l.logger.Warnf("Skipping Graphite line [%s]: %v", line, err)
+		return
+	}
+
+	if _, err = l.storage.SetGaugeMetric(name, labels, value); err != nil {
+		l.logger.Errorf("Failed to store Graphite metric [%s]: %v", line, err)
+	}
+}
+
+// parseLine parses line in format "path value timestamp". Timestamp is
+// validated only, metric is stored with receive time.
+func (l *Listener) parseLine(line string) (string, metric.Labels, metric.Gauge, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return "", nil, 0, fmt.Errorf("expected path, value and timestamp: %w", ErrWrongLine)
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return "", nil, 0, fmt.Errorf("incorrect value %q: %w", fields[1], ErrWrongLine)
+	}
+
+	if _, err = strconv.ParseFloat(fields[2], 64); err != nil {
+		return "", nil, 0, fmt.Errorf("incorrect timestamp %q: %w", fields[2], ErrWrongLine)
+	}
+
+	name, labels := l.applyTemplates(fields[0])
+	if name == "" {
+		return "", nil, 0, fmt.Errorf("empty metric name for path %q: %w", fields[0], ErrWrongLine)
+	}
+
+	return metric.SanitizeMetricName(name), labels, metric.Gauge(value), nil
+}
+
+func (l *Listener) applyTemplates(path string) (string, metric.Labels) {
+	parts := strings.Split(path, ".")
+	for _, t := range l.templates {
+		if t.Match(parts) {
+			return t.Apply(parts)
+		}
+	}
+	return path, nil
+}
@@ -0,0 +1,149 @@
+package graphite
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/acl"
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	templates, err := ParseTemplates("servers.* .host.measurement*")
+	require.NoError(t, err)
+	l := &Listener{templates: templates, logger: logrus.New()}
+
+	name, labels, value, err := l.parseLine("servers.web01.cpu.load 0.5 1681000000")
+	assert.NoError(t, err)
+	assert.Equal(t, "cpu_load", name)
+	assert.Equal(t, metric.Labels{"host": "web01"}, labels)
+	assert.Equal(t, metric.Gauge(0.5), value)
+
+	name, labels, value, err = l.parseLine("collectd.web01.load   2 -1")
+	assert.NoError(t, err)
+	assert.Equal(t, "collectd_web01_load", name)
+	assert.Nil(t, labels)
+	assert.Equal(t, metric.Gauge(2), value)
+
+	for _, line := range []string{
+		"foo 1",
+		"foo 1 2 3",
+		"foo abc 1681000000",
+		"foo NaN 1681000000",
+		"foo 1 abc",
+	} {
+		_, _, _, err = l.parseLine(line)
+		assert.ErrorIs(t, err, ErrWrongLine, line)
+	}
+
+	// Path is shorter than template measurement position
+	templates, err = ParseTemplates("host.region.measurement")
+	require.NoError(t, err)
+	l.templates = templates
+	_, _, _, err = l.parseLine("web01.eu 1 1681000000")
+	assert.ErrorIs(t, err, ErrWrongLine)
+}
+
+func TestListener(t *testing.T) {
+	stg := createTestStorage(t)
+	templates, err := ParseTemplates("servers.* .host.measurement*")
+	require.NoError(t, err)
+
+	l, err := NewListener("127.0.0.1:0", stg, templates, nil, logrus.New())
+	require.NoError(t, err)
+
+	errCh := make(chan error)
+	go func() { errCh <- l.Serve() }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("servers.web01.cpu.load 0.5 1681000000\nbad line\nmem.free 1024 1681000000\n"))
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		load, err := stg.GetGaugeMetric("cpu_load", metric.Labels{"host": "web01"})
+		if err != nil || load != metric.Gauge(0.5) {
+			return false
+		}
+		free, err := stg.GetGaugeMetric("mem_free", nil)
+		return err == nil && free == metric.Gauge(1024)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Shutdown interrupts idle client connection
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, l.Shutdown(ctx))
+	assert.NoError(t, <-errCh)
+}
+
+func TestListenerConnLimits(t *testing.T) {
+	stg := createTestStorage(t)
+	l, err := NewListener("127.0.0.1:0", stg, nil, nil, logrus.New())
+	require.NoError(t, err)
+	l.idleTimeout = 100 * time.Millisecond
+
+	errCh := make(chan error)
+	go func() { errCh <- l.Serve() }()
+
+	// Idle connection is closed
+	idleConn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer idleConn.Close()
+	assertClosed(t, idleConn)
+
+	// Connection with too long line is closed, lines before it are stored
+	longConn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer longConn.Close()
+	_, err = longConn.Write([]byte("first 1 1681000000\n" + strings.Repeat("a", _maxLineSize+1)))
+	require.NoError(t, err)
+	assertClosed(t, longConn)
+
+	value, err := stg.GetGaugeMetric("first", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, metric.Gauge(1), value)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, l.Shutdown(ctx))
+	assert.NoError(t, <-errCh)
+}
+
+// assertClosed checks that connection is closed by server: read returns EOF
+// or reset, not timeout.
+func assertClosed(t *testing.T, conn net.Conn) {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err := conn.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, os.ErrDeadlineExceeded)
+}
+
+func TestListenerUntrusted(t *testing.T) {
+	policy, err := acl.ParsePolicy("write=10.0.0.0/8,fd00::/8,!10.1.0.0/16")
+	require.NoError(t, err)
+	l, err := NewListener("127.0.0.1:0", createTestStorage(t), nil, policy, logrus.New())
+	require.NoError(t, err)
+	defer l.Shutdown(context.Background())
+
+	assert.False(t, l.isTrusted(&net.TCPAddr{IP: net.ParseIP("127.0.0.1")}))
+	assert.True(t, l.isTrusted(&net.TCPAddr{IP: net.ParseIP("10.2.3.4")}))
+	assert.True(t, l.isTrusted(&net.TCPAddr{IP: net.ParseIP("fd00::1")}))
+	assert.False(t, l.isTrusted(&net.TCPAddr{IP: net.ParseIP("10.1.2.3")}))
+}
+
+func createTestStorage(t *testing.T) *storage.MemStorage {
+	stg, err := storage.NewMemStorage(context.TODO(), logrus.New(), storage.NewPersistSettings(0, "", false), storage.NewHistorySettings(0))
+	require.NoError(t, err)
+	t.Cleanup(stg.Close)
+	return stg
+}
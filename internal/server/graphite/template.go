@@ -0,0 +1,131 @@
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+)
+
+// Template parts with special meaning.
+const (
+	_partMeasurement     = "measurement"
+	_partMeasurementRest = "measurement*"
+	_partWildcard        = "*"
+)
+
+// ErrWrongTemplate - error for incorrect template.
+var ErrWrongTemplate = errors.New("wrong graphite template")
+
+// Template - rule for converting Graphite path to metric name and labels.
+//
+// Template is written as "[filter ]template", both are dot separated.
+// Filter parts are compared with path parts, "*" matches any part. Template
+// part "measurement" adds path part to metric name, "measurement*" adds
+// the rest of path, empty part skips path part, any other part is label
+// name for path part value. Template without filter matches every path.
+type Template struct {
+	filter []string
+	parts  []string
+}
+
+// ParseTemplates parses comma separated templates.
+func ParseTemplates(val string) ([]Template, error) {
+	if strings.TrimSpace(val) == "" {
+		return nil, nil
+	}
+
+	var templates []Template
+	for _, s := range strings.Split(val, ",") {
+		t, err := NewTemplate(s)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+// NewTemplate returns new Template from string or error.
+func NewTemplate(val string) (Template, error) {
+	fields := strings.Fields(val)
+
+	var t Template
+	switch len(fields) {
+	case 1:
+		t.parts = strings.Split(fields[0], ".")
+	case 2:
+		t.filter = strings.Split(fields[0], ".")
+		t.parts = strings.Split(fields[1], ".")
+	default:
+		return Template{}, fmt.Errorf("template %q: %w", val, ErrWrongTemplate)
+	}
+
+	hasMeasurement := false
+	for i, part := range t.parts {
+		switch part {
+		case "":
+		case _partMeasurement:
+			hasMeasurement = true
+		case _partMeasurementRest:
+			if i != len(t.parts)-1 {
+				return Template{}, fmt.Errorf("template %q, %s is not last: %w", val, part, ErrWrongTemplate)
+			}
+			hasMeasurement = true
+		default:
+			if err := (metric.Labels{part: ""}).Validate(); err != nil {
+				return Template{}, fmt.Errorf("template %q, label %q: %w", val, part, ErrWrongTemplate)
+			}
+		}
+	}
+
+	if !hasMeasurement {
+		return Template{}, fmt.Errorf("template %q without measurement: %w", val, ErrWrongTemplate)
+	}
+
+	return t, nil
+}
+
+// Match checks that path parts match template filter.
+func (t Template) Match(path []string) bool {
+	if len(t.filter) > len(path) {
+		return false
+	}
+
+	for i, f := range t.filter {
+		if f != _partWildcard && f != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns metric name and labels for path parts.
+func (t Template) Apply(path []string) (string, metric.Labels) {
+	var (
+		name   []string
+		labels metric.Labels
+	)
+
+	for i, part := range t.parts {
+		if i >= len(path) {
+			break
+		}
+
+		switch part {
+		case "":
+		case _partMeasurement:
+			name = append(name, path[i])
+		case _partMeasurementRest:
+			name = append(name, path[i:]...)
+		default:
+			if labels == nil {
+				labels = make(metric.Labels)
+			}
+			labels[part] = path[i]
+		}
+	}
+
+	return strings.Join(name, "."), labels
+}
@@ -0,0 +1,86 @@
+package graphite
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTemplates(t *testing.T) {
+	templates, err := ParseTemplates("servers.* .host.measurement*, collectd.*.cpu host.measurement.cpu.measurement,measurement.measurement")
+	require.NoError(t, err)
+	assert.Len(t, templates, 3)
+
+	templates, err = ParseTemplates("  ")
+	assert.NoError(t, err)
+	assert.Nil(t, templates)
+}
+
+func TestNewTemplateError(t *testing.T) {
+	for _, val := range []string{
+		"",
+		"a b c",
+		"host.region",
+		"measurement*.host",
+		"host-name.measurement",
+	} {
+		_, err := NewTemplate(val)
+		assert.ErrorIs(t, err, ErrWrongTemplate, val)
+	}
+}
+
+func TestTemplateApply(t *testing.T) {
+	for _, tt := range []struct {
+		template string
+		path     string
+		match    bool
+		name     string
+		labels   metric.Labels
+	}{
+		{
+			template: "servers.* .host.measurement*",
+			path:     "servers.web01.cpu.load.avg",
+			match:    true,
+			name:     "cpu.load.avg",
+			labels:   metric.Labels{"host": "web01"},
+		},
+		{
+			template: "servers.* .host.measurement*",
+			path:     "hosts.web01.cpu",
+		},
+		{
+			template: "servers.*.cpu .host.measurement",
+			path:     "servers.web01",
+		},
+		{
+			template: "host.measurement.cpu.measurement",
+			path:     "web01.cpu.0.idle",
+			match:    true,
+			name:     "cpu.idle",
+			labels:   metric.Labels{"host": "web01", "cpu": "0"},
+		},
+		{
+			template: "host.measurement",
+			path:     "web01.load.shortterm",
+			match:    true,
+			name:     "load",
+			labels:   metric.Labels{"host": "web01"},
+		},
+	} {
+		tmpl, err := NewTemplate(tt.template)
+		require.NoError(t, err)
+
+		path := strings.Split(tt.path, ".")
+		assert.Equal(t, tt.match, tmpl.Match(path), tt.path)
+		if !tt.match {
+			continue
+		}
+
+		name, labels := tmpl.Apply(path)
+		assert.Equal(t, tt.name, name, tt.path)
+		assert.Equal(t, tt.labels, labels, tt.path)
+	}
+}
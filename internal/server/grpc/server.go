@@ -6,33 +6,86 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
+	"time"
 
+	"github.com/devldavydov/promytheus/internal/common/acl"
+	"github.com/devldavydov/promytheus/internal/common/apikey"
 	"github.com/devldavydov/promytheus/internal/common/hash"
 	"github.com/devldavydov/promytheus/internal/common/metric"
 	pb "github.com/devldavydov/promytheus/internal/grpc"
 	"github.com/devldavydov/promytheus/internal/grpc/interceptor"
+	"github.com/devldavydov/promytheus/internal/server/history"
 	"github.com/devldavydov/promytheus/internal/server/storage"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
 
 	_ "google.golang.org/grpc/encoding/gzip"
 
 	"google.golang.org/grpc/status"
 )
 
+var _hmacKeyIDMetadataKey = strings.ToLower(hash.KeyIDHeader)
+
+// _methodGroups - ACL groups of methods. Health service methods are not
+// restricted, so agents are able to check server before failover.
+var _methodGroups = map[string]acl.Group{
+	"/grpc.MetricService/UpdateMetrics": acl.GroupWrite,
+	"/grpc.MetricService/GetMetric":     acl.GroupRead,
+	"/grpc.MetricService/GetAllMetrics": acl.GroupRead,
+	"/grpc.MetricService/QueryRange":    acl.GroupRead,
+	"/grpc.MetricService/Ping":          acl.GroupAdmin,
+}
+
+// _methodScopes - API key scopes of methods.
+var _methodScopes = map[string]apikey.Scope{
+	"/grpc.MetricService/UpdateMetrics": apikey.ScopeWrite,
+	"/grpc.MetricService/GetMetric":     apikey.ScopeRead,
+	"/grpc.MetricService/GetAllMetrics": apikey.ScopeRead,
+	"/grpc.MetricService/QueryRange":    apikey.ScopeRead,
+	"/grpc.MetricService/Ping":          apikey.ScopeAdmin,
+}
+
+var _pbAggs = map[pb.Aggregation]string{
+	pb.Aggregation_AVG:  history.AggAvg,
+	pb.Aggregation_MIN:  history.AggMin,
+	pb.Aggregation_MAX:  history.AggMax,
+	pb.Aggregation_SUM:  history.AggSum,
+	pb.Aggregation_LAST: history.AggLast,
+	pb.Aggregation_RATE: history.AggRate,
+}
+
 type Server struct {
 	pb.UnimplementedMetricServiceServer
-	storage storage.Storage
-	hmacKey *string
-	logger  *logrus.Logger
+	storage  storage.Storage
+	hmacKeys *hash.KeyRing
+	logger   *logrus.Logger
 }
 
 // NewServer - constructor for gRPC server.
-func NewServer(stg storage.Storage, hmacKey *string, trustedSubnet *net.IPNet, tlsCredentials credentials.TransportCredentials, logger *logrus.Logger) (*grpc.Server, *Server) {
+func NewServer(
+	stg storage.Storage,
+	hmacKeys *hash.KeyRing,
+	policy *acl.Policy,
+	trustedProxies []*net.IPNet,
+	authenticator *apikey.Authenticator,
+	signVerifier *hash.SignatureVerifier,
+	tlsCredentials credentials.TransportCredentials,
+	allowedClients []string,
+	logger *logrus.Logger,
+) (*grpc.Server, *Server) {
+	protectedMethods := []string{"/grpc.MetricService/UpdateMetrics"}
 	opts := []grpc.ServerOption{
-		grpc.UnaryInterceptor(interceptor.NewTrustedSubnetInterceptor(trustedSubnet, []string{"/grpc.MetricService/UpdateMetrics"}).Handle),
+		grpc.ChainUnaryInterceptor(
+			interceptor.NewTrustedSubnetInterceptor(policy, trustedProxies, _methodGroups).Handle,
+			interceptor.NewClientCertInterceptor(allowedClients, protectedMethods).Handle,
+			interceptor.NewAPIKeyInterceptor(authenticator, _methodScopes).Handle,
+			interceptor.NewSignatureInterceptor(signVerifier, protectedMethods).Handle,
+		),
 	}
 
 	if tlsCredentials != nil {
@@ -40,14 +93,29 @@ func NewServer(stg storage.Storage, hmacKey *string, trustedSubnet *net.IPNet, t
 	}
 
 	grpcSrv := grpc.NewServer(opts...)
-	srv := &Server{storage: stg, hmacKey: hmacKey, logger: logger}
+	srv := &Server{storage: stg, hmacKeys: hmacKeys, logger: logger}
 	pb.RegisterMetricServiceServer(grpcSrv, srv)
+	grpc_health_v1.RegisterHealthServer(grpcSrv, &healthServer{storage: stg})
 	return grpcSrv, srv
 }
 
 // UpdateMetrics - method for update batch of metrics.
 func (s *Server) UpdateMetrics(ctx context.Context, in *pb.UpdateMetricsRequest) (*pb.UpdateMetricsResponse, error) {
-	metrics, err := s.parseUpdateRequest(in.Metrics)
+	for _, m := range in.Metrics {
+		if !apikey.WriteAllowed(ctx, m.Id) {
+			s.logger.Errorf("failed to update metric '%s': forbidden by API key prefix", m.Id)
+			return nil, status.Error(codes.PermissionDenied, "forbidden")
+		}
+	}
+
+	var hmacKeyID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vals := md.Get(_hmacKeyIDMetadataKey); len(vals) > 0 {
+			hmacKeyID = vals[0]
+		}
+	}
+
+	metrics, err := s.parseUpdateRequest(in.Metrics, hmacKeyID)
 	if err != nil {
 		s.logger.Errorf("failed to parse update metrics %v: %v", in.Metrics, err)
 		return nil, getErrorStatus(err)
@@ -70,7 +138,7 @@ func (s *Server) GetAllMetrics(ctx context.Context, in *pb.EmptyRequest) (*pb.Ge
 
 	resMetrics := make([]*pb.Metric, 0, len(metrics))
 	for _, item := range metrics {
-		res := &pb.Metric{Id: item.MetricName}
+		res := &pb.Metric{Id: item.MetricName, Labels: item.Labels}
 
 		switch item.Value.TypeName() {
 		case metric.CounterTypeName:
@@ -79,9 +147,16 @@ func (s *Server) GetAllMetrics(ctx context.Context, in *pb.EmptyRequest) (*pb.Ge
 		case metric.GaugeTypeName:
 			res.Type = pb.MetricType_GAUGE
 			res.Value = *item.Value.(metric.Gauge).FloatP()
+		case metric.HistogramTypeName:
+			res.Type = pb.MetricType_HISTOGRAM
+			res.Histogram = histogramToPb(item.Value.(metric.Histogram))
+		case metric.SummaryTypeName:
+			res.Type = pb.MetricType_SUMMARY
+			res.Summary = summaryToPb(item.Value.(metric.Summary))
 		}
-		if s.hmacKey != nil {
-			res.Hash = item.Value.Hmac(item.MetricName, *s.hmacKey)
+		if s.hmacKeys != nil {
+			_, key := s.hmacKeys.Primary()
+			res.Hash = item.Value.Hmac(item.MetricName, item.Labels, key)
 		}
 
 		resMetrics = append(resMetrics, res)
@@ -92,15 +167,21 @@ func (s *Server) GetAllMetrics(ctx context.Context, in *pb.EmptyRequest) (*pb.Ge
 
 // GetMetric retruns one metric by name and type.
 func (s *Server) GetMetric(ctx context.Context, in *pb.GetMetricRequest) (*pb.GetMetricResponse, error) {
-	if in.Id == "" {
-		s.logger.Errorf("failed to get '%s' metric '%s': %v", in.Type, in.Id, metric.ErrEmptyMetricName)
-		return nil, getErrorStatus(metric.ErrEmptyMetricName)
+	if err := metric.ValidateName(in.Id); err != nil {
+		s.logger.Errorf("failed to get '%s' metric '%s': %v", in.Type, in.Id, err)
+		return nil, getErrorStatus(err)
+	}
+
+	labels := metric.Labels(in.Labels)
+	if err := labels.Validate(); err != nil {
+		s.logger.Errorf("failed to get '%s' metric '%s': %v", in.Type, in.Id, err)
+		return nil, getErrorStatus(err)
 	}
 
-	resp := &pb.GetMetricResponse{Metric: &pb.Metric{Id: in.Id}}
+	resp := &pb.GetMetricResponse{Metric: &pb.Metric{Id: in.Id, Labels: in.Labels}}
 	var val metric.MetricValue
 	if in.Type == pb.MetricType_COUNTER {
-		cnt, err := s.storage.GetCounterMetric(in.Id)
+		cnt, err := s.storage.GetCounterMetric(in.Id, labels)
 		if err != nil {
 			s.logger.Errorf("failed to get '%s' metric '%s': %v", in.Type, in.Id, err)
 			return nil, getErrorStatus(err)
@@ -109,7 +190,7 @@ func (s *Server) GetMetric(ctx context.Context, in *pb.GetMetricRequest) (*pb.Ge
 		resp.Metric.Delta = *cnt.IntP()
 		val = cnt
 	} else if in.Type == pb.MetricType_GAUGE {
-		gg, err := s.storage.GetGaugeMetric(in.Id)
+		gg, err := s.storage.GetGaugeMetric(in.Id, labels)
 		if err != nil {
 			s.logger.Errorf("failed to get '%s' metric '%s': %v", in.Type, in.Id, err)
 			return nil, getErrorStatus(err)
@@ -117,15 +198,90 @@ func (s *Server) GetMetric(ctx context.Context, in *pb.GetMetricRequest) (*pb.Ge
 		resp.Metric.Type = pb.MetricType_GAUGE
 		resp.Metric.Value = *gg.FloatP()
 		val = gg
+	} else if in.Type == pb.MetricType_HISTOGRAM {
+		hst, err := s.storage.GetHistogramMetric(in.Id, labels)
+		if err != nil {
+			s.logger.Errorf("failed to get '%s' metric '%s': %v", in.Type, in.Id, err)
+			return nil, getErrorStatus(err)
+		}
+		resp.Metric.Type = pb.MetricType_HISTOGRAM
+		resp.Metric.Histogram = histogramToPb(hst)
+		val = hst
+	} else if in.Type == pb.MetricType_SUMMARY {
+		smr, err := s.storage.GetSummaryMetric(in.Id, labels)
+		if err != nil {
+			s.logger.Errorf("failed to get '%s' metric '%s': %v", in.Type, in.Id, err)
+			return nil, getErrorStatus(err)
+		}
+		resp.Metric.Type = pb.MetricType_SUMMARY
+		resp.Metric.Summary = summaryToPb(smr)
+		val = smr
 	} else {
 		s.logger.Errorf("failed to get '%s' metric '%s': %v", in.Type, in.Id, metric.ErrUnknownMetricType)
 		return nil, getErrorStatus(metric.ErrUnknownMetricType)
 	}
 
-	if s.hmacKey != nil {
-		resp.Metric.Hash = val.Hmac(in.Id, *s.hmacKey)
+	if s.hmacKeys != nil {
+		_, key := s.hmacKeys.Primary()
+		resp.Metric.Hash = val.Hmac(in.Id, labels, key)
+	}
+
+	return resp, nil
+}
+
+// QueryRange returns metric history aggregated by steps.
+func (s *Server) QueryRange(ctx context.Context, in *pb.QueryRangeRequest) (*pb.QueryRangeResponse, error) {
+	if err := metric.ValidateName(in.Id); err != nil {
+		s.logger.Errorf("failed to query '%s' metric '%s' range: %v", in.Type, in.Id, err)
+		return nil, getErrorStatus(err)
+	}
+
+	labels := metric.Labels(in.Labels)
+	if err := labels.Validate(); err != nil {
+		s.logger.Errorf("failed to query '%s' metric '%s' range: %v", in.Type, in.Id, err)
+		return nil, getErrorStatus(err)
+	}
+	if len(labels) == 0 {
+		labels = nil
+	}
+
+	var metricType string
+	switch in.Type {
+	case pb.MetricType_GAUGE:
+		metricType = metric.GaugeTypeName
+	case pb.MetricType_COUNTER:
+		metricType = metric.CounterTypeName
+	case pb.MetricType_HISTOGRAM:
+		metricType = metric.HistogramTypeName
+	case pb.MetricType_SUMMARY:
+		metricType = metric.SummaryTypeName
+	default:
+		s.logger.Errorf("failed to query '%s' metric '%s' range: %v", in.Type, in.Id, metric.ErrUnknownMetricType)
+		return nil, getErrorStatus(metric.ErrUnknownMetricType)
+	}
+
+	agg, ok := _pbAggs[in.Agg]
+	if !ok {
+		s.logger.Errorf("failed to query '%s' metric '%s' range: unknown aggregation %v", in.Type, in.Id, in.Agg)
+		return nil, getErrorStatus(history.ErrWrongQuery)
 	}
 
+	r, err := history.NewRange(time.UnixMilli(in.Start), time.UnixMilli(in.End), time.Duration(in.Step)*time.Millisecond, agg)
+	if err != nil {
+		s.logger.Errorf("failed to query '%s' metric '%s' range: %v", in.Type, in.Id, err)
+		return nil, getErrorStatus(err)
+	}
+
+	points, err := history.Query(s.storage, metricType, in.Id, labels, r)
+	if err != nil {
+		s.logger.Errorf("failed to query '%s' metric '%s' range: %v", in.Type, in.Id, err)
+		return nil, getErrorStatus(err)
+	}
+
+	resp := &pb.QueryRangeResponse{Points: make([]*pb.Point, 0, len(points))}
+	for _, p := range points {
+		resp.Points = append(resp.Points, &pb.Point{Timestamp: p.Timestamp.UnixMilli(), Value: p.Value})
+	}
 	return resp, nil
 }
 
@@ -138,14 +294,37 @@ func (s *Server) Ping(ctx context.Context, in *pb.EmptyRequest) (*pb.EmptyRespon
 	return &pb.EmptyResponse{}, nil
 }
 
-func (s *Server) parseUpdateRequest(inMetrics []*pb.Metric) ([]storage.StorageItem, error) {
+// healthServer - standard gRPC health service for agents. It is not restricted
+// by ACL and API keys, unlike Ping.
+type healthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+	storage storage.Storage
+}
+
+// Check reports serving status of storage connection.
+func (h *healthServer) Check(ctx context.Context, in *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	if !h.storage.Ping() {
+		return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_NOT_SERVING}, nil
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+func (s *Server) parseUpdateRequest(inMetrics []*pb.Metric, hmacKeyID string) ([]storage.StorageItem, error) {
 	metrics := make([]storage.StorageItem, 0, len(inMetrics))
 	for _, inMetric := range inMetrics {
-		if inMetric.Id == "" {
-			return nil, metric.ErrEmptyMetricName
+		if err := metric.ValidateName(inMetric.Id); err != nil {
+			return nil, err
+		}
+
+		labels := metric.Labels(inMetric.Labels)
+		if err := labels.Validate(); err != nil {
+			return nil, fmt.Errorf("incorrect labels '%s': %w", inMetric.Id, err)
+		}
+		if len(labels) == 0 {
+			labels = nil
 		}
 
-		stMetric := storage.StorageItem{MetricName: inMetric.Id}
+		stMetric := storage.StorageItem{MetricName: inMetric.Id, Labels: labels}
 		if inMetric.Type == pb.MetricType_COUNTER {
 			val, err := metric.NewCounterFromIntP(&inMetric.Delta)
 			if err != nil {
@@ -153,7 +332,7 @@ func (s *Server) parseUpdateRequest(inMetrics []*pb.Metric) ([]storage.StorageIt
 			}
 			stMetric.Value = val
 
-			if err = s.hmacCheck(inMetric.Hash, inMetric.Id, val); err != nil {
+			if err = s.hmacCheck(inMetric.Hash, hmacKeyID, inMetric.Id, labels, val); err != nil {
 				return nil, fmt.Errorf("incorrect %s '%s': %w", metric.CounterTypeName, inMetric.Id, err)
 			}
 
@@ -164,9 +343,49 @@ func (s *Server) parseUpdateRequest(inMetrics []*pb.Metric) ([]storage.StorageIt
 			}
 			stMetric.Value = val
 
-			if err = s.hmacCheck(inMetric.Hash, inMetric.Id, val); err != nil {
+			if err = s.hmacCheck(inMetric.Hash, hmacKeyID, inMetric.Id, labels, val); err != nil {
 				return nil, fmt.Errorf("incorrect %s '%s': %w", metric.GaugeTypeName, inMetric.Id, err)
 			}
+		} else if inMetric.Type == pb.MetricType_HISTOGRAM {
+			if inMetric.Histogram == nil {
+				return nil, fmt.Errorf("incorrect %s '%s': %w", metric.HistogramTypeName, inMetric.Id, metric.ErrWrongMetricValue)
+			}
+
+			val, err := metric.NewHistogramFromParts(
+				inMetric.Histogram.Bounds,
+				inMetric.Histogram.Buckets,
+				&inMetric.Histogram.Sum,
+				&inMetric.Histogram.Count)
+			if err != nil {
+				return nil, fmt.Errorf("incorrect %s '%s': %w", metric.HistogramTypeName, inMetric.Id, metric.ErrWrongMetricValue)
+			}
+			stMetric.Value = val
+
+			if err = s.hmacCheck(inMetric.Hash, hmacKeyID, inMetric.Id, labels, val); err != nil {
+				return nil, fmt.Errorf("incorrect %s '%s': %w", metric.HistogramTypeName, inMetric.Id, err)
+			}
+		} else if inMetric.Type == pb.MetricType_SUMMARY {
+			if inMetric.Summary == nil {
+				return nil, fmt.Errorf("incorrect %s '%s': %w", metric.SummaryTypeName, inMetric.Id, metric.ErrWrongMetricValue)
+			}
+
+			val, err := metric.NewSummaryFromParts(
+				&metric.Sketch{
+					Positive: inMetric.Summary.Positive,
+					Negative: inMetric.Summary.Negative,
+					Alpha:    inMetric.Summary.Alpha,
+					Zero:     inMetric.Summary.Zero,
+				},
+				&inMetric.Summary.Sum,
+				&inMetric.Summary.Count)
+			if err != nil {
+				return nil, fmt.Errorf("incorrect %s '%s': %w", metric.SummaryTypeName, inMetric.Id, metric.ErrWrongMetricValue)
+			}
+			stMetric.Value = val
+
+			if err = s.hmacCheck(inMetric.Hash, hmacKeyID, inMetric.Id, labels, val); err != nil {
+				return nil, fmt.Errorf("incorrect %s '%s': %w", metric.SummaryTypeName, inMetric.Id, err)
+			}
 		} else {
 			return nil, metric.ErrUnknownMetricType
 		}
@@ -176,17 +395,39 @@ func (s *Server) parseUpdateRequest(inMetrics []*pb.Metric) ([]storage.StorageIt
 	return metrics, nil
 }
 
-func (s *Server) hmacCheck(reqHash string, reqID string, value metric.MetricValue) error {
-	if s.hmacKey == nil {
+func (s *Server) hmacCheck(reqHash, hmacKeyID, reqID string, labels metric.Labels, value metric.MetricValue) error {
+	if s.hmacKeys == nil {
 		return nil
 	}
 
-	if !hash.HmacEqual(reqHash, value.Hmac(reqID, *s.hmacKey)) {
+	if !s.hmacKeys.HmacEqual(hmacKeyID, reqHash, func(key string) string {
+		return value.Hmac(reqID, labels, key)
+	}) {
 		return metric.ErrMetricHashCheck
 	}
 	return nil
 }
 
+func histogramToPb(val metric.Histogram) *pb.Histogram {
+	return &pb.Histogram{
+		Bounds:  val.Bounds,
+		Buckets: val.Buckets,
+		Sum:     val.Sum,
+		Count:   val.Count,
+	}
+}
+
+func summaryToPb(val metric.Summary) *pb.Summary {
+	return &pb.Summary{
+		Alpha:    val.Sketch.Alpha,
+		Positive: val.Sketch.Positive,
+		Negative: val.Sketch.Negative,
+		Zero:     val.Sketch.Zero,
+		Sum:      val.Sum,
+		Count:    val.Count,
+	}
+}
+
 func getErrorStatus(err error) error {
 	if err == nil {
 		return nil
@@ -202,10 +443,18 @@ func getErrorStatus(err error) error {
 		code, msg = codes.InvalidArgument, err.Error()
 	case errors.Is(err, metric.ErrEmptyMetricName):
 		code, msg = codes.InvalidArgument, err.Error()
+	case errors.Is(err, metric.ErrWrongMetricName):
+		code, msg = codes.InvalidArgument, err.Error()
 	case errors.Is(err, metric.ErrWrongMetricValue):
 		code, msg = codes.InvalidArgument, err.Error()
+	case errors.Is(err, metric.ErrWrongMetricLabels):
+		code, msg = codes.InvalidArgument, err.Error()
+	case errors.Is(err, history.ErrWrongQuery):
+		code, msg = codes.InvalidArgument, err.Error()
 	case errors.Is(err, storage.ErrMetricNotFound):
 		code, msg = codes.NotFound, err.Error()
+	case errors.Is(err, storage.ErrHistoryDisabled):
+		code, msg = codes.Unimplemented, err.Error()
 	default:
 		code, msg = codes.NotFound, "internal error"
 	}
@@ -7,7 +7,11 @@ import (
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 
+	"github.com/devldavydov/promytheus/internal/common/acl"
+	"github.com/devldavydov/promytheus/internal/common/apikey"
+	"github.com/devldavydov/promytheus/internal/common/hash"
 	"github.com/devldavydov/promytheus/internal/common/metric"
 	"github.com/devldavydov/promytheus/internal/common/nettools"
 	pb "github.com/devldavydov/promytheus/internal/grpc"
@@ -21,6 +25,7 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
@@ -28,11 +33,12 @@ import (
 
 type GrpcServerSuite struct {
 	suite.Suite
-	testSrv   *Server
-	testClt   pb.MetricServiceClient
-	stg       storage.Storage
-	logger    *logrus.Logger
-	fTeardown func()
+	testSrv       *Server
+	testClt       pb.MetricServiceClient
+	testHealthClt grpc_health_v1.HealthClient
+	stg           storage.Storage
+	logger        *logrus.Logger
+	fTeardown     func()
 }
 
 func (gs *GrpcServerSuite) SetupSuite() {
@@ -41,7 +47,7 @@ func (gs *GrpcServerSuite) SetupSuite() {
 
 func (gs *GrpcServerSuite) SetupSubTest() {
 	var err error
-	gs.stg, err = storage.NewMemStorage(context.TODO(), gs.logger, storage.NewPersistSettings(0, "", false))
+	gs.stg, err = storage.NewMemStorage(context.TODO(), gs.logger, storage.NewPersistSettings(0, "", false), storage.NewHistorySettings(10))
 	require.NoError(gs.T(), err)
 }
 
@@ -128,19 +134,53 @@ func (gs *GrpcServerSuite) TestUpdateMetrics() {
 				},
 			},
 			stgInitFunc: func() {
-				gs.stg.SetCounterMetric("counter2", metric.Counter(2))
+				gs.stg.SetCounterMetric("counter2", nil, metric.Counter(2))
 			},
 			stgCheckFunc: func() {
-				vC, _ := gs.stg.GetCounterMetric("counter1")
+				vC, _ := gs.stg.GetCounterMetric("counter1", nil)
 				gs.Equal(metric.Counter(3), vC)
 
-				vC, _ = gs.stg.GetCounterMetric("counter2")
+				vC, _ = gs.stg.GetCounterMetric("counter2", nil)
 				gs.Equal(metric.Counter(5), vC)
 
-				vG, _ := gs.stg.GetGaugeMetric("gauge1")
+				vG, _ := gs.stg.GetGaugeMetric("gauge1", nil)
 				gs.Equal(metric.Gauge(123.123), vG)
 			},
 		},
+		{
+			name:     "correct update with labels",
+			respCode: codes.OK,
+			req: &pb.UpdateMetricsRequest{
+				Metrics: []*pb.Metric{
+					{Type: pb.MetricType_COUNTER, Id: "counter1", Delta: 1, Labels: map[string]string{"host": "a"}},
+					{Type: pb.MetricType_COUNTER, Id: "counter1", Delta: 2, Labels: map[string]string{"host": "b"}},
+					{Type: pb.MetricType_GAUGE, Id: "gauge1", Value: 123.123, Labels: map[string]string{"cpu": "1"}},
+				},
+			},
+			stgCheckFunc: func() {
+				vC, _ := gs.stg.GetCounterMetric("counter1", metric.Labels{"host": "a"})
+				gs.Equal(metric.Counter(1), vC)
+
+				vC, _ = gs.stg.GetCounterMetric("counter1", metric.Labels{"host": "b"})
+				gs.Equal(metric.Counter(2), vC)
+
+				_, err := gs.stg.GetCounterMetric("counter1", nil)
+				gs.ErrorIs(err, storage.ErrMetricNotFound)
+
+				vG, _ := gs.stg.GetGaugeMetric("gauge1", metric.Labels{"cpu": "1"})
+				gs.Equal(metric.Gauge(123.123), vG)
+			},
+		},
+		{
+			name:     "invalid labels",
+			respCode: codes.InvalidArgument,
+			req: &pb.UpdateMetricsRequest{
+				Metrics: []*pb.Metric{
+					{Type: pb.MetricType_COUNTER, Id: "ttt", Delta: 1, Labels: map[string]string{"host-name": "a"}},
+				},
+			},
+			respErr: errors.New("incorrect labels 'ttt': wrong metric labels"),
+		},
 		{
 			name:     "correct update with hash check",
 			respCode: codes.OK,
@@ -153,10 +193,10 @@ func (gs *GrpcServerSuite) TestUpdateMetrics() {
 			},
 			hmacKey: strPointer("foobar"),
 			stgCheckFunc: func() {
-				vC, _ := gs.stg.GetCounterMetric("PollCount")
+				vC, _ := gs.stg.GetCounterMetric("PollCount", nil)
 				gs.Equal(metric.Counter(10), vC)
 
-				vG, _ := gs.stg.GetGaugeMetric("Sys")
+				vG, _ := gs.stg.GetGaugeMetric("Sys", nil)
 				gs.Equal(metric.Gauge(13220880), vG)
 			},
 		},
@@ -187,19 +227,90 @@ func (gs *GrpcServerSuite) TestUpdateMetrics() {
 			trustedSubnet: getSubnet("192.168.0.0/16"),
 			cltIP:         strPointer("192.168.1.1"),
 			stgInitFunc: func() {
-				gs.stg.SetCounterMetric("counter2", metric.Counter(2))
+				gs.stg.SetCounterMetric("counter2", nil, metric.Counter(2))
 			},
 			stgCheckFunc: func() {
-				vC, _ := gs.stg.GetCounterMetric("counter1")
+				vC, _ := gs.stg.GetCounterMetric("counter1", nil)
 				gs.Equal(metric.Counter(3), vC)
 
-				vC, _ = gs.stg.GetCounterMetric("counter2")
+				vC, _ = gs.stg.GetCounterMetric("counter2", nil)
 				gs.Equal(metric.Counter(5), vC)
 
-				vG, _ := gs.stg.GetGaugeMetric("gauge1")
+				vG, _ := gs.stg.GetGaugeMetric("gauge1", nil)
 				gs.Equal(metric.Gauge(123.123), vG)
 			},
 		},
+		{
+			name:     "correct update histogram",
+			respCode: codes.OK,
+			req: &pb.UpdateMetricsRequest{
+				Metrics: []*pb.Metric{
+					{Type: pb.MetricType_HISTOGRAM, Id: "latency", Histogram: &pb.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{1, 2}, Sum: 1.5, Count: 3}},
+					{Type: pb.MetricType_HISTOGRAM, Id: "latency", Histogram: &pb.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{0, 1}, Sum: 0.5, Count: 1}},
+				},
+			},
+			stgCheckFunc: func() {
+				vH, _ := gs.stg.GetHistogramMetric("latency", nil)
+				gs.Equal(metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{1, 3}, Sum: 2, Count: 4}, vH)
+			},
+		},
+		{
+			name:     "invalid histogram",
+			respCode: codes.InvalidArgument,
+			req: &pb.UpdateMetricsRequest{
+				Metrics: []*pb.Metric{
+					{Type: pb.MetricType_HISTOGRAM, Id: "latency", Histogram: &pb.Histogram{Bounds: []float64{1, 0.1}, Buckets: []uint64{1, 2}, Sum: 1.5, Count: 3}},
+				},
+			},
+			respErr: errors.New("incorrect histogram 'latency': wrong metric value"),
+		},
+		{
+			name:     "empty histogram",
+			respCode: codes.InvalidArgument,
+			req: &pb.UpdateMetricsRequest{
+				Metrics: []*pb.Metric{
+					{Type: pb.MetricType_HISTOGRAM, Id: "latency"},
+				},
+			},
+			respErr: errors.New("incorrect histogram 'latency': wrong metric value"),
+		},
+		{
+			name:     "histogram bounds mismatch",
+			respCode: codes.InvalidArgument,
+			req: &pb.UpdateMetricsRequest{
+				Metrics: []*pb.Metric{
+					{Type: pb.MetricType_HISTOGRAM, Id: "latency", Histogram: &pb.Histogram{Bounds: []float64{0.5}, Buckets: []uint64{1}, Sum: 0.3, Count: 1}},
+				},
+			},
+			stgInitFunc: func() {
+				gs.stg.SetHistogramMetric("latency", nil, metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{1, 1}, Sum: 0.1, Count: 1})
+			},
+			respErr: errors.New("histogram bounds mismatch: wrong metric value"),
+		},
+		{
+			name:     "correct update summary",
+			respCode: codes.OK,
+			req: &pb.UpdateMetricsRequest{
+				Metrics: []*pb.Metric{
+					{Type: pb.MetricType_SUMMARY, Id: "latency", Summary: &pb.Summary{Alpha: 0.01, Positive: map[int32]uint64{0: 1}, Sum: 1, Count: 1}},
+					{Type: pb.MetricType_SUMMARY, Id: "latency", Summary: &pb.Summary{Alpha: 0.01, Positive: map[int32]uint64{55: 1}, Sum: 3, Count: 1}},
+				},
+			},
+			stgCheckFunc: func() {
+				vS, _ := gs.stg.GetSummaryMetric("latency", nil)
+				gs.Equal(metric.Summary{Sketch: metric.Sketch{Alpha: 0.01, Positive: map[int32]uint64{0: 1, 55: 1}}, Sum: 4, Count: 2}, vS)
+			},
+		},
+		{
+			name:     "invalid summary",
+			respCode: codes.InvalidArgument,
+			req: &pb.UpdateMetricsRequest{
+				Metrics: []*pb.Metric{
+					{Type: pb.MetricType_SUMMARY, Id: "latency", Summary: &pb.Summary{Alpha: 0.01, Positive: map[int32]uint64{0: 1}, Sum: 1, Count: 2}},
+				},
+			},
+			respErr: errors.New("incorrect summary 'latency': wrong metric value"),
+		},
 		{
 			name: "update failed because of subnet check",
 			req: &pb.UpdateMetricsRequest{
@@ -228,10 +339,10 @@ func (gs *GrpcServerSuite) TestUpdateMetrics() {
 			tls:     true,
 			hmacKey: strPointer("foobar"),
 			stgCheckFunc: func() {
-				vC, _ := gs.stg.GetCounterMetric("PollCount")
+				vC, _ := gs.stg.GetCounterMetric("PollCount", nil)
 				gs.Equal(metric.Counter(10), vC)
 
-				vG, _ := gs.stg.GetGaugeMetric("Sys")
+				vG, _ := gs.stg.GetGaugeMetric("Sys", nil)
 				gs.Equal(metric.Gauge(13220880), vG)
 			},
 		},
@@ -246,7 +357,7 @@ func (gs *GrpcServerSuite) TestUpdateMetrics() {
 
 			cltCtx := ctx
 			if tt.cltIP != nil {
-				md := metadata.New(map[string]string{nettools.RealIPHeader: *tt.cltIP})
+				md := metadata.New(map[string]string{nettools.ForwardedForHeader: *tt.cltIP})
 				cltCtx = metadata.NewOutgoingContext(ctx, md)
 			}
 
@@ -267,6 +378,133 @@ func (gs *GrpcServerSuite) TestUpdateMetrics() {
 	}
 }
 
+func (gs *GrpcServerSuite) TestUpdateMetricsTrustedProxy() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req := &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{{Type: pb.MetricType_COUNTER, Id: "counter1", Delta: 1}}}
+
+	for _, tt := range []struct {
+		name           string
+		trustedSubnet  *net.IPNet
+		trustedProxies string
+		md             metadata.MD
+		respCode       codes.Code
+	}{
+		{
+			name:          "spoofed X-Forwarded-For from not trusted proxy",
+			trustedSubnet: getSubnet("192.168.0.0/16"),
+			md:            metadata.Pairs(nettools.ForwardedForHeader, "192.168.1.1"),
+			respCode:      codes.PermissionDenied,
+		},
+		{
+			name:           "X-Real-IP from trusted proxy is ignored",
+			trustedSubnet:  getSubnet("192.168.0.0/16"),
+			trustedProxies: "127.0.0.1",
+			md:             metadata.Pairs(nettools.RealIPHeader, "192.168.1.1", nettools.ForwardedForHeader, "10.10.1.1"),
+			respCode:       codes.PermissionDenied,
+		},
+		{
+			name:          "peer address in trusted subnet",
+			trustedSubnet: getSubnet("127.0.0.0/8"),
+			md:            metadata.Pairs(nettools.ForwardedForHeader, "10.10.1.1"),
+		},
+		{
+			name:           "X-Forwarded-For from trusted proxy",
+			trustedSubnet:  getSubnet("192.168.0.0/16"),
+			trustedProxies: "127.0.0.1",
+			md:             metadata.Pairs(nettools.ForwardedForHeader, "10.10.1.1, 192.168.1.1"),
+		},
+	} {
+		tt := tt
+		gs.Run(tt.name, func() {
+			trustedProxies, err := nettools.ParseSubnets(tt.trustedProxies)
+			gs.NoError(err)
+			gs.createTestServerWithProxies(nil, subnetPolicy(tt.trustedSubnet), trustedProxies, nil, false)
+
+			_, err = gs.testClt.UpdateMetrics(metadata.NewOutgoingContext(ctx, tt.md), req)
+			gs.Equal(tt.respCode, status.Code(err))
+		})
+	}
+}
+
+func (gs *GrpcServerSuite) TestACL() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	policy, err := acl.ParsePolicy("read=!127.0.0.0/8;admin=127.0.0.1")
+	gs.Require().NoError(err)
+
+	gs.Run("read denied, admin allowed", func() {
+		gs.createTestServerWithProxies(nil, policy, nil, nil, false)
+
+		_, err := gs.testClt.GetAllMetrics(ctx, &pb.EmptyRequest{})
+		gs.Equal(codes.PermissionDenied, status.Code(err))
+
+		_, err = gs.testClt.Ping(ctx, &pb.EmptyRequest{})
+		gs.NoError(err)
+
+		_, err = gs.testClt.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{})
+		gs.NoError(err)
+	})
+}
+
+func (gs *GrpcServerSuite) TestHealth() {
+	policy, err := acl.ParsePolicy("admin=10.0.0.1")
+	gs.Require().NoError(err)
+	authenticator, err := apikey.NewAuthenticator([]apikey.KeyConfig{
+		{ID: "agent", KeyHash: apikey.HashKey("key-w"), Scopes: []apikey.Scope{apikey.ScopeWrite}},
+	})
+	gs.Require().NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer key-w")
+
+	gs.Run("write-only key, admin denied", func() {
+		gs.createTestServerWithProxies(nil, policy, nil, authenticator, false)
+
+		_, err := gs.testClt.Ping(ctx, &pb.EmptyRequest{})
+		gs.Equal(codes.PermissionDenied, status.Code(err))
+
+		resp, err := gs.testHealthClt.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		gs.NoError(err)
+		gs.Equal(grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+	})
+}
+
+func (gs *GrpcServerSuite) TestUpdateMetricsAPIKeyPrefix() {
+	key := &apikey.Key{ID: "team-a", Scopes: map[apikey.Scope]bool{apikey.ScopeWrite: true}, Prefix: "team_a_"}
+	ctx := apikey.NewContext(context.Background(), key)
+
+	gs.Run("metric outside of prefix", func() {
+		gs.createTestServer(nil, nil, false)
+
+		_, err := gs.testSrv.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+			{Id: "team_a_counter", Type: pb.MetricType_COUNTER, Delta: 1},
+			{Id: "team_b_counter", Type: pb.MetricType_COUNTER, Delta: 1},
+		}})
+		gs.Equal(codes.PermissionDenied, status.Code(err))
+
+		metrics, err := gs.stg.GetAllMetrics()
+		gs.NoError(err)
+		gs.Equal(0, len(metrics))
+	})
+
+	gs.Run("metrics inside of prefix", func() {
+		gs.createTestServer(nil, nil, false)
+
+		_, err := gs.testSrv.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+			{Id: "team_a_counter", Type: pb.MetricType_COUNTER, Delta: 1},
+		}})
+		gs.NoError(err)
+
+		cnt, err := gs.stg.GetCounterMetric("team_a_counter", nil)
+		gs.NoError(err)
+		gs.Equal(metric.Counter(1), cnt)
+	})
+}
+
 func (gs *GrpcServerSuite) TestGetAllMetrics() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -281,8 +519,8 @@ func (gs *GrpcServerSuite) TestGetAllMetrics() {
 	gs.Run("get from storage with hash and ignore subnet check", func() {
 		gs.createTestServer(strPointer("foobar"), getSubnet("10.0.0.0/16"), false)
 
-		gs.stg.SetCounterMetric("counter", metric.Counter(123))
-		gs.stg.SetGaugeMetric("gauge", metric.Gauge(123.123))
+		gs.stg.SetCounterMetric("counter", nil, metric.Counter(123))
+		gs.stg.SetGaugeMetric("gauge", nil, metric.Gauge(123.123))
 
 		resp, err := gs.testSrv.GetAllMetrics(ctx, &pb.EmptyRequest{})
 		gs.NoError(err)
@@ -362,7 +600,27 @@ func (gs *GrpcServerSuite) TestGetMetric() {
 				},
 			},
 			stgInitFunc: func() {
-				gs.stg.SetCounterMetric("counter", metric.Counter(123))
+				gs.stg.SetCounterMetric("counter", nil, metric.Counter(123))
+			},
+		},
+		{
+			name: "get counter with labels",
+			req: &pb.GetMetricRequest{
+				Type:   pb.MetricType_COUNTER,
+				Id:     "counter",
+				Labels: map[string]string{"host": "a"},
+			},
+			resp: &pb.GetMetricResponse{
+				Metric: &pb.Metric{
+					Type:   pb.MetricType_COUNTER,
+					Id:     "counter",
+					Delta:  5,
+					Labels: map[string]string{"host": "a"},
+				},
+			},
+			stgInitFunc: func() {
+				gs.stg.SetCounterMetric("counter", nil, metric.Counter(123))
+				gs.stg.SetCounterMetric("counter", metric.Labels{"host": "a"}, metric.Counter(5))
 			},
 		},
 		{
@@ -381,7 +639,7 @@ func (gs *GrpcServerSuite) TestGetMetric() {
 			},
 			hmacKey: strPointer("foobar"),
 			stgInitFunc: func() {
-				gs.stg.SetCounterMetric("counter", metric.Counter(123))
+				gs.stg.SetCounterMetric("counter", nil, metric.Counter(123))
 			},
 		},
 		{
@@ -398,7 +656,7 @@ func (gs *GrpcServerSuite) TestGetMetric() {
 				},
 			},
 			stgInitFunc: func() {
-				gs.stg.SetGaugeMetric("gauge", metric.Gauge(123.123))
+				gs.stg.SetGaugeMetric("gauge", nil, metric.Gauge(123.123))
 			},
 		},
 		{
@@ -417,7 +675,42 @@ func (gs *GrpcServerSuite) TestGetMetric() {
 			},
 			hmacKey: strPointer("foobar"),
 			stgInitFunc: func() {
-				gs.stg.SetGaugeMetric("gauge", metric.Gauge(123.123))
+				gs.stg.SetGaugeMetric("gauge", nil, metric.Gauge(123.123))
+			},
+		},
+		{
+			name: "get histogram",
+			req: &pb.GetMetricRequest{
+				Type: pb.MetricType_HISTOGRAM,
+				Id:   "latency",
+			},
+			resp: &pb.GetMetricResponse{
+				Metric: &pb.Metric{
+					Type:      pb.MetricType_HISTOGRAM,
+					Id:        "latency",
+					Histogram: &pb.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{1, 2}, Sum: 1.5, Count: 3},
+				},
+			},
+			stgInitFunc: func() {
+				gs.stg.SetHistogramMetric("latency", nil, metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{1, 2}, Sum: 1.5, Count: 3})
+			},
+		},
+		{
+			name: "get summary",
+			req: &pb.GetMetricRequest{
+				Type: pb.MetricType_SUMMARY,
+				Id:   "latency",
+			},
+			resp: &pb.GetMetricResponse{
+				Metric: &pb.Metric{
+					Type:    pb.MetricType_SUMMARY,
+					Id:      "latency",
+					Summary: &pb.Summary{Alpha: 0.01, Positive: map[int32]uint64{0: 1}, Sum: 1, Count: 1},
+				},
+			},
+			stgInitFunc: func() {
+				val, _ := metric.NewSummaryFromString("1")
+				gs.stg.SetSummaryMetric("latency", nil, val)
 			},
 		},
 		{
@@ -435,7 +728,7 @@ func (gs *GrpcServerSuite) TestGetMetric() {
 			},
 			trustedSubnet: getSubnet("10.0.0.0/16"),
 			stgInitFunc: func() {
-				gs.stg.SetGaugeMetric("gauge", metric.Gauge(123.123))
+				gs.stg.SetGaugeMetric("gauge", nil, metric.Gauge(123.123))
 			},
 		},
 	} {
@@ -461,15 +754,135 @@ func (gs *GrpcServerSuite) TestGetMetric() {
 	}
 }
 
+func (gs *GrpcServerSuite) TestQueryRange() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start, end := time.Now().Add(-time.Hour).UnixMilli(), time.Now().Add(time.Hour).UnixMilli()
+	step := (2 * time.Hour).Milliseconds()
+
+	for _, tt := range []struct {
+		name        string
+		req         *pb.QueryRangeRequest
+		stgInitFunc func()
+		resp        *pb.QueryRangeResponse
+		respCode    codes.Code
+		respErr     error
+	}{
+		{
+			name:     "unknown metric type",
+			req:      &pb.QueryRangeRequest{Type: pb.MetricType_UNKNOWN, Id: "foo", Start: start, End: end, Step: step},
+			respCode: codes.Unimplemented,
+			respErr:  metric.ErrUnknownMetricType,
+		},
+		{
+			name:     "empty metric name",
+			req:      &pb.QueryRangeRequest{Type: pb.MetricType_GAUGE, Start: start, End: end, Step: step},
+			respCode: codes.InvalidArgument,
+			respErr:  metric.ErrEmptyMetricName,
+		},
+		{
+			name:     "wrong step",
+			req:      &pb.QueryRangeRequest{Type: pb.MetricType_GAUGE, Id: "foo", Start: start, End: end},
+			respCode: codes.InvalidArgument,
+			respErr:  errors.New("step not positive: wrong range query"),
+		},
+		{
+			name:     "rate for gauge",
+			req:      &pb.QueryRangeRequest{Type: pb.MetricType_GAUGE, Id: "foo", Start: start, End: end, Step: step, Agg: pb.Aggregation_RATE},
+			respCode: codes.InvalidArgument,
+			respErr:  errors.New("rate supported only for counter: wrong range query"),
+		},
+		{
+			name: "history disabled",
+			req:  &pb.QueryRangeRequest{Type: pb.MetricType_GAUGE, Id: "foo", Start: start, End: end, Step: step},
+			stgInitFunc: func() {
+				gs.stg, _ = storage.NewMemStorage(context.TODO(), gs.logger, storage.NewPersistSettings(0, "", false), storage.NewHistorySettings(0))
+			},
+			respCode: codes.Unimplemented,
+			respErr:  storage.ErrHistoryDisabled,
+		},
+		{
+			name: "no samples",
+			req:  &pb.QueryRangeRequest{Type: pb.MetricType_GAUGE, Id: "foo", Start: start, End: end, Step: step},
+			resp: &pb.QueryRangeResponse{Points: []*pb.Point{}},
+		},
+		{
+			name: "gauge max",
+			req: &pb.QueryRangeRequest{
+				Type: pb.MetricType_GAUGE, Id: "foo", Labels: map[string]string{"host": "a"},
+				Start: start, End: end, Step: step, Agg: pb.Aggregation_MAX,
+			},
+			stgInitFunc: func() {
+				gs.stg.SetGaugeMetric("foo", metric.Labels{"host": "a"}, metric.Gauge(3))
+				gs.stg.SetGaugeMetric("foo", metric.Labels{"host": "a"}, metric.Gauge(1))
+				gs.stg.SetGaugeMetric("foo", nil, metric.Gauge(10))
+			},
+			resp: &pb.QueryRangeResponse{Points: []*pb.Point{{Timestamp: start, Value: 3}}},
+		},
+		{
+			name: "counter sum",
+			req:  &pb.QueryRangeRequest{Type: pb.MetricType_COUNTER, Id: "foo", Start: start, End: end, Step: step, Agg: pb.Aggregation_SUM},
+			stgInitFunc: func() {
+				gs.stg.SetCounterMetric("foo", nil, metric.Counter(1))
+				gs.stg.SetCounterMetric("foo", nil, metric.Counter(2))
+			},
+			resp: &pb.QueryRangeResponse{Points: []*pb.Point{{Timestamp: start, Value: 4}}},
+		},
+	} {
+		tt := tt
+		gs.Run(tt.name, func() {
+			if tt.stgInitFunc != nil {
+				tt.stgInitFunc()
+			}
+
+			gs.createTestServer(nil, nil, false)
+
+			resp, err := gs.testClt.QueryRange(ctx, tt.req)
+			if tt.respErr != nil {
+				respStatus, ok := status.FromError(err)
+				gs.True(ok)
+				gs.Equal(tt.respCode, respStatus.Code())
+				gs.Equal(tt.respErr.Error(), respStatus.Message())
+			} else {
+				gs.NoError(err)
+				gs.Equal(len(tt.resp.Points), len(resp.Points))
+				for i := range tt.resp.Points {
+					gs.Equal(tt.resp.Points[i].Timestamp, resp.Points[i].Timestamp)
+					gs.Equal(tt.resp.Points[i].Value, resp.Points[i].Value)
+				}
+			}
+		})
+	}
+}
+
+// createTestServer creates server, which trusts forwarded client IP of test
+// client, like it is behind local proxy.
 func (gs *GrpcServerSuite) createTestServer(hmacKey *string, trustedSubnet *net.IPNet, tls bool) {
+	trustedProxies, _ := nettools.ParseSubnets("127.0.0.1")
+	gs.createTestServerWithProxies(hmacKey, subnetPolicy(trustedSubnet), trustedProxies, nil, tls)
+}
+
+func (gs *GrpcServerSuite) createTestServerWithProxies(
+	hmacKey *string,
+	policy *acl.Policy,
+	trustedProxies []*net.IPNet,
+	authenticator *apikey.Authenticator,
+	tls bool,
+) {
 	buffer := 101024 * 1024
-	lis := bufconn.Listen(buffer)
+	lis := loopbackListener{bufconn.Listen(buffer)}
 
 	srvCredentials := getServerCredentials(tls)
 	cltCredentials := getClientCredentials(tls)
 
+	var hmacKeys *hash.KeyRing
+	if hmacKey != nil {
+		hmacKeys, _ = hash.ParseKeyRing(*hmacKey, "", "")
+	}
+
 	var grpcSrv *grpc.Server
-	grpcSrv, gs.testSrv = NewServer(gs.stg, hmacKey, trustedSubnet, srvCredentials, gs.logger)
+	grpcSrv, gs.testSrv = NewServer(gs.stg, hmacKeys, policy, trustedProxies, authenticator, nil, srvCredentials, nil, gs.logger)
 
 	go func() {
 		grpcSrv.Serve(lis)
@@ -491,10 +904,40 @@ func (gs *GrpcServerSuite) createTestServer(hmacKey *string, trustedSubnet *net.
 	}
 
 	gs.testClt = pb.NewMetricServiceClient(conn)
+	gs.testHealthClt = grpc_health_v1.NewHealthClient(conn)
+}
+
+// loopbackListener reports 127.0.0.1 as remote address of accepted connections.
+type loopbackListener struct {
+	*bufconn.Listener
+}
+
+func (l loopbackListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return loopbackConn{conn}, nil
+}
+
+type loopbackConn struct {
+	net.Conn
+}
+
+func (c loopbackConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000}
 }
 
 func strPointer(s string) *string { return &s }
 
+func subnetPolicy(trustedSubnet *net.IPNet) *acl.Policy {
+	policy := acl.NewPolicy()
+	if trustedSubnet != nil {
+		policy.Allow(acl.GroupWrite, trustedSubnet)
+	}
+	return policy
+}
+
 func getSubnet(s string) *net.IPNet {
 	_, subnet, _ := net.ParseCIDR(s)
 	return subnet
@@ -505,7 +948,7 @@ func getServerCredentials(tls bool) credentials.TransportCredentials {
 		return nil
 	}
 
-	tlsServerSettings, _ := gtls.NewOptionalTLSServerSettings(getTLSFile("server-cert.pem"), getTLSFile("server-key.pem"))
+	tlsServerSettings, _ := gtls.NewOptionalTLSServerSettings(getTLSFile("server-cert.pem"), getTLSFile("server-key.pem"), "", nil)
 	tlsCredentials, _ := tlsServerSettings.Load()
 	return tlsCredentials
 }
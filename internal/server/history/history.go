@@ -0,0 +1,203 @@
+// Package history provides range queries over metric samples history.
+package history
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+)
+
+const (
+	AggAvg  = "avg"
+	AggMin  = "min"
+	AggMax  = "max"
+	AggSum  = "sum"
+	AggLast = "last"
+	AggRate = "rate"
+)
+
+// AllAggs - valid step aggregations.
+var AllAggs = map[string]bool{
+	AggAvg:  true,
+	AggMin:  true,
+	AggMax:  true,
+	AggSum:  true,
+	AggLast: true,
+	AggRate: true,
+}
+
+var ErrWrongQuery = errors.New("wrong range query")
+
+// Range - range query parameters.
+type Range struct {
+	Start time.Time
+	End   time.Time
+	Step  time.Duration
+	Agg   string
+}
+
+// Point - aggregated value of one step, timestamp is step start.
+type Point struct {
+	Timestamp time.Time `json:"ts"`
+	Value     float64   `json:"value"`
+}
+
+// RangeDTO - range query response.
+type RangeDTO struct {
+	Labels metric.Labels `json:"labels,omitempty"` // metric labels
+	ID     string        `json:"id"`               // metric name
+	MType  string        `json:"type"`             // gauge|counter
+	Agg    string        `json:"agg"`              // step aggregation
+	Step   string        `json:"step"`             // step duration
+	Points []Point       `json:"points"`           // aggregated points
+}
+
+// NewRange returns new validated Range or error.
+func NewRange(start, end time.Time, step time.Duration, agg string) (Range, error) {
+	if step <= 0 {
+		return Range{}, fmt.Errorf("step not positive: %w", ErrWrongQuery)
+	}
+	if end.Before(start) {
+		return Range{}, fmt.Errorf("end before start: %w", ErrWrongQuery)
+	}
+	if !AllAggs[agg] {
+		return Range{}, fmt.Errorf("unknown aggregation %q: %w", agg, ErrWrongQuery)
+	}
+	return Range{Start: start, End: end, Step: step, Agg: agg}, nil
+}
+
+// Query reads metric samples from storage and returns them aggregated by
+// range steps. Only gauge and counter metrics are supported, rate - only for counter.
+func Query(stg storage.Storage, metricType, metricName string, labels metric.Labels, r Range) ([]Point, error) {
+	if metricType != metric.GaugeTypeName && metricType != metric.CounterTypeName {
+		return nil, fmt.Errorf("%s not supported: %w", metricType, ErrWrongQuery)
+	}
+	if r.Agg == AggRate && metricType != metric.CounterTypeName {
+		return nil, fmt.Errorf("%s supported only for %s: %w", AggRate, metric.CounterTypeName, ErrWrongQuery)
+	}
+
+	// For rate previous step is read too, so first step has base value
+	from := r.Start
+	if r.Agg == AggRate {
+		from = from.Add(-r.Step)
+	}
+
+	samples, err := stg.GetMetricRange(metricType, metricName, labels, from, r.End)
+	if err != nil {
+		return nil, err
+	}
+
+	return Aggregate(samples, r), nil
+}
+
+// Aggregate groups samples into range steps and returns aggregated points
+// in time order. Steps without samples are skipped, samples before range
+// start are used only as rate base value.
+func Aggregate(samples []storage.Sample, r Range) []Point {
+	points := []Point{}
+
+	var (
+		prev    float64
+		hasPrev bool
+		cur     *stepAcc
+	)
+	for _, s := range samples {
+		val := sampleValue(s)
+
+		if s.Timestamp.Before(r.Start) {
+			prev, hasPrev = val, true
+			continue
+		}
+
+		idx := int64(s.Timestamp.Sub(r.Start) / r.Step)
+		if cur == nil || cur.idx != idx {
+			if cur != nil && cur.ok {
+				points = append(points, cur.point(r))
+			}
+			cur = newStepAcc(idx)
+		}
+
+		if r.Agg == AggRate {
+			if hasPrev {
+				cur.addIncrease(prev, val)
+			}
+			prev, hasPrev = val, true
+			continue
+		}
+		cur.add(val)
+	}
+
+	if cur != nil && cur.ok {
+		points = append(points, cur.point(r))
+	}
+
+	return points
+}
+
+// stepAcc accumulates samples of one step.
+type stepAcc struct {
+	idx   int64
+	count int
+	sum   float64
+	min   float64
+	max   float64
+	last  float64
+	ok    bool
+}
+
+func newStepAcc(idx int64) *stepAcc {
+	return &stepAcc{idx: idx, min: math.Inf(1), max: math.Inf(-1)}
+}
+
+func (acc *stepAcc) add(val float64) {
+	acc.count++
+	acc.sum += val
+	acc.min = math.Min(acc.min, val)
+	acc.max = math.Max(acc.max, val)
+	acc.last = val
+	acc.ok = true
+}
+
+// addIncrease adds counter increase, value less than previous is counter reset.
+func (acc *stepAcc) addIncrease(prev, val float64) {
+	if val >= prev {
+		acc.sum += val - prev
+	} else {
+		acc.sum += val
+	}
+	acc.ok = true
+}
+
+func (acc *stepAcc) point(r Range) Point {
+	p := Point{Timestamp: r.Start.Add(time.Duration(acc.idx) * r.Step)}
+
+	switch r.Agg {
+	case AggAvg:
+		p.Value = acc.sum / float64(acc.count)
+	case AggMin:
+		p.Value = acc.min
+	case AggMax:
+		p.Value = acc.max
+	case AggSum:
+		p.Value = acc.sum
+	case AggLast:
+		p.Value = acc.last
+	case AggRate:
+		p.Value = acc.sum / r.Step.Seconds()
+	}
+	return p
+}
+
+func sampleValue(s storage.Sample) float64 {
+	switch v := s.Value.(type) {
+	case metric.Gauge:
+		return float64(v)
+	case metric.Counter:
+		return float64(v)
+	}
+	return math.NaN()
+}
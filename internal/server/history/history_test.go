@@ -0,0 +1,135 @@
+package history
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/server/mocks"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+var _base = time.Unix(1000, 0)
+
+func at(sec int) time.Time {
+	return _base.Add(time.Duration(sec) * time.Second)
+}
+
+func TestNewRangeError(t *testing.T) {
+	for _, tt := range []struct {
+		start time.Time
+		end   time.Time
+		step  time.Duration
+		agg   string
+	}{
+		{start: at(0), end: at(10), step: 0, agg: AggAvg},
+		{start: at(0), end: at(10), step: -time.Second, agg: AggAvg},
+		{start: at(10), end: at(0), step: time.Second, agg: AggAvg},
+		{start: at(0), end: at(10), step: time.Second, agg: "median"},
+	} {
+		_, err := NewRange(tt.start, tt.end, tt.step, tt.agg)
+		assert.ErrorIs(t, err, ErrWrongQuery)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	samples := []storage.Sample{
+		{Timestamp: at(0), Value: metric.Gauge(1)},
+		{Timestamp: at(3), Value: metric.Gauge(5)},
+		{Timestamp: at(9), Value: metric.Gauge(3)},
+		{Timestamp: at(25), Value: metric.Gauge(-2)},
+		{Timestamp: at(29), Value: metric.Gauge(4)},
+	}
+
+	for _, tt := range []struct {
+		agg string
+		exp []Point
+	}{
+		{agg: AggAvg, exp: []Point{{Timestamp: at(0), Value: 3}, {Timestamp: at(20), Value: 1}}},
+		{agg: AggMin, exp: []Point{{Timestamp: at(0), Value: 1}, {Timestamp: at(20), Value: -2}}},
+		{agg: AggMax, exp: []Point{{Timestamp: at(0), Value: 5}, {Timestamp: at(20), Value: 4}}},
+		{agg: AggSum, exp: []Point{{Timestamp: at(0), Value: 9}, {Timestamp: at(20), Value: 2}}},
+		{agg: AggLast, exp: []Point{{Timestamp: at(0), Value: 3}, {Timestamp: at(20), Value: 4}}},
+	} {
+		r, err := NewRange(at(0), at(30), 10*time.Second, tt.agg)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.exp, Aggregate(samples, r), tt.agg)
+	}
+}
+
+func TestAggregateEmpty(t *testing.T) {
+	r, _ := NewRange(at(0), at(30), 10*time.Second, AggAvg)
+	assert.Equal(t, []Point{}, Aggregate(nil, r))
+}
+
+func TestAggregateRate(t *testing.T) {
+	samples := []storage.Sample{
+		{Timestamp: at(-5), Value: metric.Counter(10)},
+		{Timestamp: at(2), Value: metric.Counter(30)},
+		{Timestamp: at(8), Value: metric.Counter(50)},
+		// counter reset
+		{Timestamp: at(12), Value: metric.Counter(20)},
+		{Timestamp: at(18), Value: metric.Counter(30)},
+	}
+
+	r, err := NewRange(at(0), at(20), 10*time.Second, AggRate)
+	assert.NoError(t, err)
+	assert.Equal(t, []Point{
+		{Timestamp: at(0), Value: 4},
+		{Timestamp: at(10), Value: 3},
+	}, Aggregate(samples, r))
+}
+
+func TestAggregateRateNoBase(t *testing.T) {
+	samples := []storage.Sample{
+		{Timestamp: at(2), Value: metric.Counter(30)},
+		{Timestamp: at(12), Value: metric.Counter(40)},
+	}
+
+	r, _ := NewRange(at(0), at(20), 10*time.Second, AggRate)
+	assert.Equal(t, []Point{{Timestamp: at(10), Value: 1}}, Aggregate(samples, r))
+}
+
+func TestQuery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	labels := metric.Labels{"host": "a"}
+	stg := mocks.NewMockStorage(ctrl)
+	stg.EXPECT().
+		GetMetricRange(metric.CounterTypeName, "foo", labels, at(-10), at(20)).
+		Return([]storage.Sample{
+			{Timestamp: at(-5), Value: metric.Counter(10)},
+			{Timestamp: at(5), Value: metric.Counter(20)},
+		}, nil)
+
+	r, _ := NewRange(at(0), at(20), 10*time.Second, AggRate)
+	points, err := Query(stg, metric.CounterTypeName, "foo", labels, r)
+	assert.NoError(t, err)
+	assert.Equal(t, []Point{{Timestamp: at(0), Value: 1}}, points)
+}
+
+func TestQueryError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	stg := mocks.NewMockStorage(ctrl)
+	stg.EXPECT().
+		GetMetricRange(metric.GaugeTypeName, "foo", nil, at(0), at(20)).
+		Return(nil, storage.ErrHistoryDisabled)
+
+	r, _ := NewRange(at(0), at(20), 10*time.Second, AggAvg)
+	_, err := Query(stg, metric.GaugeTypeName, "foo", nil, r)
+	assert.ErrorIs(t, err, storage.ErrHistoryDisabled)
+
+	_, err = Query(stg, metric.HistogramTypeName, "foo", nil, r)
+	assert.ErrorIs(t, err, ErrWrongQuery)
+
+	r, _ = NewRange(at(0), at(20), 10*time.Second, AggRate)
+	_, err = Query(stg, metric.GaugeTypeName, "foo", nil, r)
+	assert.ErrorIs(t, err, ErrWrongQuery)
+	assert.False(t, errors.Is(err, storage.ErrHistoryDisabled))
+}
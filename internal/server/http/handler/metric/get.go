@@ -8,8 +8,10 @@ import (
 	"html/template"
 	"net/http"
 
+	"github.com/devldavydov/promytheus/internal/common/hash"
 	_http "github.com/devldavydov/promytheus/internal/common/http"
 	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/server/exposition"
 	"github.com/devldavydov/promytheus/internal/server/storage"
 	"github.com/go-chi/chi/v5"
 )
@@ -20,6 +22,8 @@ import (
 //	@Produce	plain/text
 //	@Param		metricType	path	string	true	"Metric Type"
 //	@Param		metricName	path	string	true	"Metric Name"
+//	@Param		label		query	[]string	false	"Metric label in format name:value"	collectionFormat(multi)
+//	@Param		q			query	number		false	"Quantile in [0, 1], for summary only"
 //	@Success	200			"Returns metric"
 //	@Failure	400			"Bad request"
 //	@Failure	404			"Metric not found"
@@ -29,18 +33,39 @@ import (
 func (handler *MetricHandler) GetMetric(rw http.ResponseWriter, req *http.Request) {
 	metricType, metricName := chi.URLParam(req, "metricType"), chi.URLParam(req, "metricName")
 
-	err := handler.checkMetricsCommon(metricType, metricName)
+	labels, err := handler.parseURLLabels(req.URL.Query())
 	if err != nil {
 		handler.logger.Errorf("Incorrect get metric request [%s], err: %v", req.URL, err)
 		CreateResponseOnRequestError(rw, err)
 		return
 	}
 
+	err = handler.checkMetricsCommon(metricType, metricName, labels)
+	if err != nil {
+		handler.logger.Errorf("Incorrect get metric request [%s], err: %v", req.URL, err)
+		CreateResponseOnRequestError(rw, err)
+		return
+	}
+
+	var quantile *float64
+	if metric.SummaryTypeName == metricType {
+		quantile, err = handler.parseURLQuantile(req.URL.Query())
+		if err != nil {
+			handler.logger.Errorf("Incorrect get metric request [%s], err: %v", req.URL, err)
+			CreateResponseOnRequestError(rw, err)
+			return
+		}
+	}
+
 	var value fmt.Stringer
 	if metric.GaugeTypeName == metricType {
-		value, err = handler.storage.GetGaugeMetric(metricName)
+		value, err = handler.storage.GetGaugeMetric(metricName, labels)
 	} else if metric.CounterTypeName == metricType {
-		value, err = handler.storage.GetCounterMetric(metricName)
+		value, err = handler.storage.GetCounterMetric(metricName, labels)
+	} else if metric.HistogramTypeName == metricType {
+		value, err = handler.storage.GetHistogramMetric(metricName, labels)
+	} else if metric.SummaryTypeName == metricType {
+		value, err = handler.storage.GetSummaryMetric(metricName, labels)
 	}
 
 	if err != nil {
@@ -54,6 +79,10 @@ func (handler *MetricHandler) GetMetric(rw http.ResponseWriter, req *http.Reques
 		return
 	}
 
+	if quantile != nil {
+		value = metric.Gauge(value.(metric.Summary).Quantile(*quantile))
+	}
+
 	_http.CreateResponse(rw, _http.ContentTypeTextPlain, http.StatusOK, value.String())
 }
 
@@ -78,20 +107,24 @@ func (handler *MetricHandler) GetMetricJSON(rw http.ResponseWriter, req *http.Re
 		return
 	}
 
-	err = handler.checkMetricsCommon(metricReq.MType, metricReq.ID)
+	err = handler.checkMetricsCommon(metricReq.MType, metricReq.ID, metricReq.Labels)
 	if err != nil {
 		handler.logger.Errorf("Incorrect get metric request [%s], JSON: [%v], err: %v", req.URL, metricReq, err)
 		CreateResponseOnRequestError(rw, err)
 		return
 	}
 
-	metricResp := metric.MetricsDTO{ID: metricReq.ID, MType: metricReq.MType}
+	metricResp := metric.MetricsDTO{ID: metricReq.ID, MType: metricReq.MType, Labels: metricReq.Labels}
 	var val interface{}
 
 	if metric.GaugeTypeName == metricReq.MType {
-		val, err = handler.storage.GetGaugeMetric(metricReq.ID)
+		val, err = handler.storage.GetGaugeMetric(metricReq.ID, metricReq.Labels)
 	} else if metric.CounterTypeName == metricReq.MType {
-		val, err = handler.storage.GetCounterMetric(metricReq.ID)
+		val, err = handler.storage.GetCounterMetric(metricReq.ID, metricReq.Labels)
+	} else if metric.HistogramTypeName == metricReq.MType {
+		val, err = handler.storage.GetHistogramMetric(metricReq.ID, metricReq.Labels)
+	} else if metric.SummaryTypeName == metricReq.MType {
+		val, err = handler.storage.GetSummaryMetric(metricReq.ID, metricReq.Labels)
 	}
 
 	if err != nil {
@@ -109,11 +142,17 @@ func (handler *MetricHandler) GetMetricJSON(rw http.ResponseWriter, req *http.Re
 		metricResp.Value = val.(metric.Gauge).FloatP()
 	} else if metric.CounterTypeName == metricReq.MType {
 		metricResp.Delta = val.(metric.Counter).IntP()
+	} else if metric.HistogramTypeName == metricReq.MType {
+		setHistogramResponse(&metricResp, val.(metric.Histogram))
+	} else if metric.SummaryTypeName == metricReq.MType {
+		setSummaryResponse(&metricResp, val.(metric.Summary))
 	}
 
-	if handler.hmacKey != nil {
-		hash := val.(metric.MetricValue).Hmac(metricReq.ID, *handler.hmacKey)
-		metricResp.Hash = &hash
+	if handler.hmacKeys != nil {
+		keyID, key := handler.hmacKeys.Primary()
+		hmac := val.(metric.MetricValue).Hmac(metricReq.ID, metricReq.Labels, key)
+		metricResp.Hash = &hmac
+		rw.Header().Set(hash.KeyIDHeader, keyID)
 	}
 
 	_http.CreateJSONResponse(rw, http.StatusOK, metricResp)
@@ -139,7 +178,7 @@ func (handler *MetricHandler) GetMetrics(rw http.ResponseWriter, req *http.Reque
 				{{ range . }}
 				<tr>
 					<td>{{ .Value.TypeName }}</td>
-					<td>{{ .MetricName }}</td>
+					<td>{{ .MetricName }}{{ .Labels }}</td>
 					<td>{{ .Value }}</td>
 				</tr>
 				{{ end }}
@@ -159,3 +198,34 @@ func (handler *MetricHandler) GetMetrics(rw http.ResponseWriter, req *http.Reque
 	tmpl.Execute(buf, metrics)
 	_http.CreateResponse(rw, _http.ContentTypeHTML, http.StatusOK, buf.String())
 }
+
+// GetMetricsExposition returns all metrics for Prometheus scrape.
+//
+//	@Summary	Get all metrics in Prometheus text or OpenMetrics format
+//	@Produce	plain/text
+//	@Produce	application/openmetrics-text
+//	@Success	200	"Returns metrics, OpenMetrics if requested by Accept header"
+//	@Failure	500	"Internal error"
+//	@Router		/metrics [get]
+func (handler *MetricHandler) GetMetricsExposition(rw http.ResponseWriter, req *http.Request) {
+	metrics, err := handler.storage.GetAllMetrics()
+	if err != nil {
+		handler.logger.Errorf("Get all metrics error: %v", err)
+		_http.CreateStatusResponse(rw, http.StatusInternalServerError)
+		return
+	}
+
+	format := exposition.NegotiateFormat(req.Header.Get("Accept"))
+	buf := new(bytes.Buffer)
+	skipped, err := exposition.Encode(buf, metrics, format)
+	if err != nil {
+		handler.logger.Errorf("Metrics exposition error: %v", err)
+		_http.CreateStatusResponse(rw, http.StatusInternalServerError)
+		return
+	}
+	for _, item := range skipped {
+		handler.logger.Warnf("Metric [%s] of type [%s] skipped in exposition: name clash", metric.SeriesID(item.MetricName, item.Labels), item.Value.TypeName())
+	}
+
+	_http.CreateResponse(rw, format.ContentType(), http.StatusOK, buf.String())
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/devldavydov/promytheus/internal/common/apikey"
 	_http "github.com/devldavydov/promytheus/internal/common/http"
 	"github.com/devldavydov/promytheus/internal/common/metric"
 	"github.com/devldavydov/promytheus/internal/server/mocks"
@@ -40,6 +41,65 @@ func TestGetMetric(t *testing.T) {
 				contentType: _http.ContentTypeTextPlain,
 			},
 		},
+		{
+			name: "get metric: API key without read scope",
+			req: testRequest{
+				method:  http.MethodGet,
+				url:     "/value/counter/metric1",
+				headers: map[string][]string{apikey.AuthorizationHeader: {"Bearer key-a"}},
+			},
+			resp: testResponse{
+				code:        http.StatusForbidden,
+				body:        "",
+				contentType: "",
+			},
+			authenticator: newTestAuthenticator(t),
+		},
+		{
+			name: "get metric: API key with read scope",
+			req: testRequest{
+				method:  http.MethodGet,
+				url:     "/value/counter/metric1",
+				headers: map[string][]string{apikey.KeyHeader: {"key-r"}},
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        "1",
+				contentType: _http.ContentTypeTextPlain,
+			},
+			stgInitFunc: func(s storage.Storage) {
+				s.SetCounterMetric("metric1", nil, metric.Counter(1))
+			},
+			authenticator: newTestAuthenticator(t),
+		},
+		{
+			name: "get metric: denied by read ACL",
+			req: testRequest{
+				method:  http.MethodGet,
+				url:     "/value/counter/metric1",
+				headers: map[string][]string{"X-Forwarded-For": {"fd00::1"}},
+			},
+			resp: testResponse{
+				code:        http.StatusForbidden,
+				body:        "",
+				contentType: "",
+			},
+			aclSpec: "read=fd00::/8,!fd00::/64",
+		},
+		{
+			name: "get metric: allowed by read ACL",
+			req: testRequest{
+				method:  http.MethodGet,
+				url:     "/value/counter/metric1",
+				headers: map[string][]string{"X-Forwarded-For": {"fd00:0:0:1::1"}},
+			},
+			resp: testResponse{
+				code:        http.StatusNotFound,
+				body:        http.StatusText(http.StatusNotFound),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			aclSpec: "read=fd00::/8,!fd00::/64;write=!fd00::/8",
+		},
 		{
 			name: "get metric: not in storage",
 			req: testRequest{
@@ -64,7 +124,7 @@ func TestGetMetric(t *testing.T) {
 				contentType: _http.ContentTypeTextPlain,
 			},
 			stgInitFunc: func(s storage.Storage) {
-				s.SetCounterMetric("metric1", 123)
+				s.SetCounterMetric("metric1", nil, 123)
 			},
 		},
 		{
@@ -79,7 +139,7 @@ func TestGetMetric(t *testing.T) {
 				contentType: _http.ContentTypeTextPlain,
 			},
 			stgInitFunc: func(s storage.Storage) {
-				s.SetGaugeMetric("metric1", 1.23)
+				s.SetGaugeMetric("metric1", nil, 1.23)
 			},
 		},
 		{
@@ -94,7 +154,199 @@ func TestGetMetric(t *testing.T) {
 				contentType: _http.ContentTypeTextPlain,
 			},
 			stgInitFunc: func(s storage.Storage) {
-				s.SetGaugeMetric("metric1", 1.23456)
+				s.SetGaugeMetric("metric1", nil, 1.23456)
+			},
+		},
+	}
+
+	runTests(t, tests)
+}
+
+func TestGetMetricWithLabels(t *testing.T) {
+	tests := []testItem{
+		{
+			name: "get metric: gauge with URL labels",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/value/gauge/CPUutilization?label=cpu:1",
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        "2.000",
+				contentType: _http.ContentTypeTextPlain,
+			},
+			stgInitFunc: func(s storage.Storage) {
+				s.SetGaugeMetric("CPUutilization", metric.Labels{"cpu": "0"}, 1)
+				s.SetGaugeMetric("CPUutilization", metric.Labels{"cpu": "1"}, 2)
+			},
+		},
+		{
+			name: "get metric: gauge with unknown URL labels",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/value/gauge/CPUutilization?label=cpu:2",
+			},
+			resp: testResponse{
+				code:        http.StatusNotFound,
+				body:        http.StatusText(http.StatusNotFound),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			stgInitFunc: func(s storage.Storage) {
+				s.SetGaugeMetric("CPUutilization", metric.Labels{"cpu": "0"}, 1)
+			},
+		},
+		{
+			name: "get JSON metric: counter with labels",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/value/",
+				body:        bodyStringReader(`{"id": "foo", "type": "counter", "labels": {"host": "a"}}`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `{"id": "foo", "type": "counter", "delta": 5, "labels": {"host": "a"}}`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			stgInitFunc: func(s storage.Storage) {
+				s.SetCounterMetric("foo", nil, 1)
+				s.SetCounterMetric("foo", metric.Labels{"host": "a"}, 5)
+			},
+		},
+	}
+
+	runTests(t, tests)
+}
+
+func TestGetHistogramMetric(t *testing.T) {
+	tests := []testItem{
+		{
+			name: "get metric: histogram",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/value/histogram/latency",
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        "bounds=0.1,1;buckets=1,2;sum=1.5;count=3",
+				contentType: _http.ContentTypeTextPlain,
+			},
+			stgInitFunc: func(s storage.Storage) {
+				s.SetHistogramMetric("latency", nil, metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{1, 2}, Sum: 1.5, Count: 3})
+			},
+		},
+		{
+			name: "get metric: histogram not found",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/value/histogram/latency",
+			},
+			resp: testResponse{
+				code:        http.StatusNotFound,
+				body:        http.StatusText(http.StatusNotFound),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "get JSON metric: histogram",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/value/",
+				body:        bodyStringReader(`{"id": "latency", "type": "histogram"}`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `{"id": "latency", "type": "histogram", "bounds": [0.1, 1], "buckets": [1, 2], "sum": 1.5, "count": 3}`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			stgInitFunc: func(s storage.Storage) {
+				s.SetHistogramMetric("latency", nil, metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{1, 2}, Sum: 1.5, Count: 3})
+			},
+		},
+	}
+
+	runTests(t, tests)
+}
+
+func TestGetSummaryMetric(t *testing.T) {
+	initSummary := func(s storage.Storage) {
+		for i := 1; i <= 100; i++ {
+			val, _ := metric.NewSummaryFromString(fmt.Sprint(i))
+			s.SetSummaryMetric("latency", nil, val)
+		}
+	}
+
+	tests := []testItem{
+		{
+			name: "get metric: summary",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/value/summary/latency",
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        "p50=49.903;p90=89.130;p99=98.505;sum=5050.000;count=100",
+				contentType: _http.ContentTypeTextPlain,
+			},
+			stgInitFunc: initSummary,
+		},
+		{
+			name: "get metric: summary quantile",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/value/summary/latency?q=0.99",
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        "98.505",
+				contentType: _http.ContentTypeTextPlain,
+			},
+			stgInitFunc: initSummary,
+		},
+		{
+			name: "get metric: summary incorrect quantile",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/value/summary/latency?q=1.5",
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			stgInitFunc: initSummary,
+		},
+		{
+			name: "get metric: summary not found",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/value/summary/latency?q=0.5",
+			},
+			resp: testResponse{
+				code:        http.StatusNotFound,
+				body:        http.StatusText(http.StatusNotFound),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "get JSON metric: summary",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/value/",
+				body:        bodyStringReader(`{"id": "latency", "type": "summary"}`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `{"id": "latency", "type": "summary", "sketch": {"alpha": 0.01, "positive": {"0": 1}, "zero": 1}, "sum": 1, "count": 2}`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			stgInitFunc: func(s storage.Storage) {
+				val, _ := metric.NewSummaryFromString("1")
+				s.SetSummaryMetric("latency", nil, val)
+				val, _ = metric.NewSummaryFromString("0")
+				s.SetSummaryMetric("latency", nil, val)
 			},
 		},
 	}
@@ -117,7 +369,7 @@ func TestGetMetricFromDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().GetCounterMetric("metric1").Return(metric.Counter(123), nil)
+				ms.EXPECT().GetCounterMetric("metric1", nil).Return(metric.Counter(123), nil)
 			},
 		},
 		{
@@ -133,7 +385,7 @@ func TestGetMetricFromDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().GetCounterMetric("metric1").Return(metric.Counter(0), storage.ErrMetricNotFound)
+				ms.EXPECT().GetCounterMetric("metric1", nil).Return(metric.Counter(0), storage.ErrMetricNotFound)
 			},
 		},
 		{
@@ -149,7 +401,7 @@ func TestGetMetricFromDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().GetCounterMetric("metric1").Return(metric.Counter(0), errors.New("db error"))
+				ms.EXPECT().GetCounterMetric("metric1", nil).Return(metric.Counter(0), errors.New("db error"))
 			},
 		},
 		{
@@ -165,7 +417,7 @@ func TestGetMetricFromDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().GetGaugeMetric("metric1").Return(metric.Gauge(1.230), nil)
+				ms.EXPECT().GetGaugeMetric("metric1", nil).Return(metric.Gauge(1.230), nil)
 			},
 		},
 		{
@@ -181,7 +433,7 @@ func TestGetMetricFromDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().GetGaugeMetric("metric1").Return(metric.Gauge(0), storage.ErrMetricNotFound)
+				ms.EXPECT().GetGaugeMetric("metric1", nil).Return(metric.Gauge(0), storage.ErrMetricNotFound)
 			},
 		},
 		{
@@ -197,7 +449,7 @@ func TestGetMetricFromDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().GetGaugeMetric("metric1").Return(metric.Gauge(0), errors.New("db error"))
+				ms.EXPECT().GetGaugeMetric("metric1", nil).Return(metric.Gauge(0), errors.New("db error"))
 			},
 		},
 	}
@@ -278,7 +530,7 @@ func TestGetJSONMetric(t *testing.T) {
 				contentType: _http.ContentTypeApplicationJSON,
 			},
 			stgInitFunc: func(s storage.Storage) {
-				s.SetGaugeMetric("foo", 123.0)
+				s.SetGaugeMetric("foo", nil, 123.0)
 			},
 		},
 		{
@@ -295,7 +547,7 @@ func TestGetJSONMetric(t *testing.T) {
 				contentType: _http.ContentTypeApplicationJSON,
 			},
 			stgInitFunc: func(s storage.Storage) {
-				s.SetGaugeMetric("foo", 1.23456)
+				s.SetGaugeMetric("foo", nil, 1.23456)
 			},
 		},
 		{
@@ -312,7 +564,7 @@ func TestGetJSONMetric(t *testing.T) {
 				contentType: _http.ContentTypeApplicationJSON,
 			},
 			stgInitFunc: func(s storage.Storage) {
-				s.SetCounterMetric("foo", 123)
+				s.SetCounterMetric("foo", nil, 123)
 			},
 		},
 	}
@@ -337,7 +589,7 @@ func TestGetJSONMetricFromDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().GetGaugeMetric("foo").Return(metric.Gauge(1.230), nil)
+				ms.EXPECT().GetGaugeMetric("foo", nil).Return(metric.Gauge(1.230), nil)
 			},
 		},
 		{
@@ -355,7 +607,7 @@ func TestGetJSONMetricFromDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().GetGaugeMetric("foo").Return(metric.Gauge(0), storage.ErrMetricNotFound)
+				ms.EXPECT().GetGaugeMetric("foo", nil).Return(metric.Gauge(0), storage.ErrMetricNotFound)
 			},
 		},
 		{
@@ -373,7 +625,7 @@ func TestGetJSONMetricFromDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().GetGaugeMetric("foo").Return(metric.Gauge(0), errors.New("db error"))
+				ms.EXPECT().GetGaugeMetric("foo", nil).Return(metric.Gauge(0), errors.New("db error"))
 			},
 		},
 		{
@@ -391,7 +643,7 @@ func TestGetJSONMetricFromDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().GetCounterMetric("foo").Return(metric.Counter(123), nil)
+				ms.EXPECT().GetCounterMetric("foo", nil).Return(metric.Counter(123), nil)
 			},
 		},
 		{
@@ -409,7 +661,7 @@ func TestGetJSONMetricFromDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().GetCounterMetric("foo").Return(metric.Counter(0), storage.ErrMetricNotFound)
+				ms.EXPECT().GetCounterMetric("foo", nil).Return(metric.Counter(0), storage.ErrMetricNotFound)
 			},
 		},
 		{
@@ -427,7 +679,7 @@ func TestGetJSONMetricFromDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().GetCounterMetric("foo").Return(metric.Counter(0), errors.New("db error"))
+				ms.EXPECT().GetCounterMetric("foo", nil).Return(metric.Counter(0), errors.New("db error"))
 			},
 		},
 	}
@@ -452,7 +704,7 @@ func TestGetJSONMetricWithHash(t *testing.T) {
 				contentType: _http.ContentTypeApplicationJSON,
 			},
 			stgInitFunc: func(s storage.Storage) {
-				s.SetGaugeMetric("Sys", 13220880)
+				s.SetGaugeMetric("Sys", nil, 13220880)
 			},
 		},
 		{
@@ -470,7 +722,7 @@ func TestGetJSONMetricWithHash(t *testing.T) {
 				contentType: _http.ContentTypeApplicationJSON,
 			},
 			stgInitFunc: func(s storage.Storage) {
-				s.SetCounterMetric("PollCount", 5)
+				s.SetCounterMetric("PollCount", nil, 5)
 			},
 		},
 	}
@@ -496,7 +748,7 @@ func TestGetJSONMetricWithHashFromDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().GetGaugeMetric("Sys").Return(metric.Gauge(13220880), nil)
+				ms.EXPECT().GetGaugeMetric("Sys", nil).Return(metric.Gauge(13220880), nil)
 			},
 		},
 		{
@@ -515,7 +767,7 @@ func TestGetJSONMetricWithHashFromDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().GetCounterMetric("PollCount").Return(metric.Counter(5), nil)
+				ms.EXPECT().GetCounterMetric("PollCount", nil).Return(metric.Counter(5), nil)
 			},
 		},
 	}
@@ -575,11 +827,27 @@ func TestGetAllMetricsPage(t *testing.T) {
 				contentType: _http.ContentTypeHTML,
 			},
 			stgInitFunc: func(s storage.Storage) {
-				s.SetGaugeMetric("foo", 1.23456)
-				s.SetGaugeMetric("bar", 1.23456)
-				s.SetCounterMetric("aaa", 1)
-				s.SetCounterMetric("aaa", 1)
-				s.SetCounterMetric("zzz", 3)
+				s.SetGaugeMetric("foo", nil, 1.23456)
+				s.SetGaugeMetric("bar", nil, 1.23456)
+				s.SetCounterMetric("aaa", nil, 1)
+				s.SetCounterMetric("aaa", nil, 1)
+				s.SetCounterMetric("zzz", nil, 3)
+			},
+		},
+		{
+			name: "get all metrics page: with histogram",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/",
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        data.AllMetricsResponseWithHistogram,
+				contentType: _http.ContentTypeHTML,
+			},
+			stgInitFunc: func(s storage.Storage) {
+				s.SetHistogramMetric("latency", nil, metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{1, 2}, Sum: 1.5, Count: 3})
+				s.SetCounterMetric("aaa", nil, 1)
 			},
 		},
 	}
@@ -673,3 +941,70 @@ func ExampleMetricHandler_GetMetricJSON() {
 
 	fmt.Println(res)
 }
+
+func TestGetMetricsExposition(t *testing.T) {
+	tests := []testItem{
+		{
+			name: "get metrics exposition: empty",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/metrics",
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        "",
+				contentType: _http.ContentTypePrometheusText,
+			},
+		},
+		{
+			name: "get metrics exposition: text",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/metrics",
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        "# TYPE aaa counter\naaa{host=\"a\"} 2\n# TYPE foo_bar gauge\nfoo_bar 1.5\n",
+				contentType: _http.ContentTypePrometheusText,
+			},
+			stgInitFunc: func(s storage.Storage) {
+				s.SetGaugeMetric("foo_bar", nil, 1.5)
+				s.SetCounterMetric("aaa", metric.Labels{"host": "a"}, 2)
+			},
+		},
+		{
+			name: "get metrics exposition: openmetrics",
+			req: testRequest{
+				method:  http.MethodGet,
+				url:     "/metrics",
+				headers: map[string][]string{"Accept": {"application/openmetrics-text; version=1.0.0"}},
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        "# TYPE aaa counter\naaa_total{host=\"a\"} 2\n# EOF\n",
+				contentType: _http.ContentTypeOpenMetrics,
+			},
+			stgInitFunc: func(s storage.Storage) {
+				s.SetCounterMetric("aaa", metric.Labels{"host": "a"}, 2)
+			},
+		},
+		{
+			name: "get metrics exposition: db error",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/metrics",
+			},
+			resp: testResponse{
+				code:        http.StatusInternalServerError,
+				body:        http.StatusText(http.StatusInternalServerError),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			dbStg: true,
+			stgMockFunc: func(ms *mocks.MockStorage) {
+				ms.EXPECT().GetAllMetrics().Return(nil, errors.New("db error"))
+			},
+		},
+	}
+
+	runTests(t, tests)
+}
@@ -3,12 +3,17 @@ package metric
 
 import (
 	"errors"
-	"net"
 	"net/http"
 
+	"github.com/devldavydov/promytheus/internal/common/acl"
+	"github.com/devldavydov/promytheus/internal/common/apikey"
+	"github.com/devldavydov/promytheus/internal/common/cipher"
+	"github.com/devldavydov/promytheus/internal/common/hash"
 	_http "github.com/devldavydov/promytheus/internal/common/http"
 	"github.com/devldavydov/promytheus/internal/common/metric"
 	_middleware "github.com/devldavydov/promytheus/internal/server/http/middleware"
+	"github.com/devldavydov/promytheus/internal/server/otlp"
+	"github.com/devldavydov/promytheus/internal/server/remotewrite"
 	"github.com/devldavydov/promytheus/internal/server/storage"
 	"github.com/go-chi/chi/v5"
 	"github.com/sirupsen/logrus"
@@ -24,43 +29,100 @@ import (
 */
 
 type MetricHandler struct {
-	storage storage.Storage
-	hmacKey *string
-	logger  *logrus.Logger
+	storage     storage.Storage
+	remoteWrite *remotewrite.Receiver
+	otlp        *otlp.Receiver
+	hmacKeys    *hash.KeyRing
+	logger      *logrus.Logger
 }
 
 func NewHandler(
 	router chi.Router,
 	storage storage.Storage,
-	hmacKey *string,
-	trustedSubnet *net.IPNet,
+	hmacKeys *hash.KeyRing,
+	keyRing *cipher.KeyRing,
+	policy *acl.Policy,
+	authenticator *apikey.Authenticator,
+	signVerifier *hash.SignatureVerifier,
 	logger *logrus.Logger,
 ) *MetricHandler {
-	handler := &MetricHandler{storage: storage, hmacKey: hmacKey, logger: logger}
+	handler := &MetricHandler{
+		storage:     storage,
+		remoteWrite: remotewrite.NewReceiver(storage),
+		otlp:        otlp.NewReceiver(storage),
+		hmacKeys:    hmacKeys,
+		logger:      logger,
+	}
+
+	mdlwrSignature := _middleware.NewSignature(signVerifier)
+
+	router.Group(func(r chi.Router) {
+		r.Use(
+			_middleware.NewTrusted(policy, acl.GroupWrite).Handle,
+			_middleware.NewAuth(authenticator, apikey.ScopeWrite).Handle)
+
+		// Only agent routes accept encrypted body
+		r.Group(func(r chi.Router) {
+			r.Use(_middleware.NewDecrpyt(keyRing).Handle, mdlwrSignature.Handle)
+
+			r.Post("/update/{metricType}/{metricName}/{metricValue}", handler.UpdateMetric)
+			r.Post("/update/", handler.UpdateMetricJSON)
+			r.Post("/updates/", handler.UpdateMetricJSONBatch)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(mdlwrSignature.Handle)
+
+			r.Post("/write", handler.WriteLineProtocol)
+			r.Post("/api/v1/write", handler.RemoteWrite)
+			r.Post("/v1/metrics", handler.OTLPMetrics)
+		})
+	})
 
-	mdlwrTrusted := _middleware.NewTrusted(trustedSubnet)
+	router.Group(func(r chi.Router) {
+		r.Use(
+			_middleware.NewTrusted(policy, acl.GroupRead).Handle,
+			_middleware.NewAuth(authenticator, apikey.ScopeRead).Handle)
+
+		r.Get("/value/{metricType}/{metricName}", handler.GetMetric)
+		r.Post("/value/", handler.GetMetricJSON)
+		r.Get("/query_range", handler.QueryRange)
+		r.Get("/", handler.GetMetrics)
+		r.Get("/metrics", handler.GetMetricsExposition)
+	})
 
 	router.Group(func(r chi.Router) {
-		r.Use(mdlwrTrusted.Handle)
+		r.Use(
+			_middleware.NewTrusted(policy, acl.GroupAdmin).Handle,
+			_middleware.NewAuth(authenticator, apikey.ScopeAdmin).Handle)
 
-		r.Post("/update/{metricType}/{metricName}/{metricValue}", handler.UpdateMetric)
-		r.Post("/update/", handler.UpdateMetricJSON)
-		r.Post("/updates/", handler.UpdateMetricJSONBatch)
+		r.Get("/ping", handler.Ping)
 	})
 
-	router.Get("/value/{metricType}/{metricName}", handler.GetMetric)
-	router.Post("/value/", handler.GetMetricJSON)
-	router.Get("/", handler.GetMetrics)
-	router.Get("/ping", handler.Ping)
+	router.Get("/health", handler.Health)
 
 	return handler
 }
 
+// writeAllowed checks that API key of request is allowed to write metrics.
+func writeAllowed(req *http.Request, names ...string) bool {
+	for _, name := range names {
+		if !apikey.WriteAllowed(req.Context(), name) {
+			return false
+		}
+	}
+	return true
+}
+
 func CreateResponseOnRequestError(rw http.ResponseWriter, err error) {
 	if errors.Is(err, metric.ErrUnknownMetricType) {
 		_http.CreateStatusResponse(rw, http.StatusNotImplemented)
 		return
 	}
+	if errors.Is(err, storage.ErrHistoryDisabled) {
+		_http.CreateStatusResponse(rw, http.StatusNotImplemented)
+		return
+	}
 	if errors.Is(err, metric.ErrMetricHashCheck) {
 		_http.CreateStatusResponse(rw, http.StatusBadRequest)
 		return
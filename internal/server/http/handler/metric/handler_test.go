@@ -13,13 +13,16 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/devldavydov/promytheus/internal/common/acl"
+	"github.com/devldavydov/promytheus/internal/common/apikey"
 	"github.com/devldavydov/promytheus/internal/common/cipher"
+	"github.com/devldavydov/promytheus/internal/common/hash"
 	_http "github.com/devldavydov/promytheus/internal/common/http"
+	"github.com/devldavydov/promytheus/internal/common/nettools"
 	_middleware "github.com/devldavydov/promytheus/internal/server/http/middleware"
 	"github.com/devldavydov/promytheus/internal/server/mocks"
 	"github.com/devldavydov/promytheus/internal/server/storage"
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 	"github.com/golang/mock/gomock"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -54,18 +57,36 @@ type testItem struct {
 	xfail         bool
 	dbStg         bool
 	trustedSubnet *net.IPNet
+	aclSpec       string
+	directClient  bool
+	signVerifier  *hash.SignatureVerifier
+	hmacKeys      *hash.KeyRing
+	authenticator *apikey.Authenticator
 }
 
 var (
-	privKey *rsa.PrivateKey
-	pubKey  *rsa.PublicKey
+	privKey      *rsa.PrivateKey
+	pubKey       *rsa.PublicKey
+	otherPrivKey *rsa.PrivateKey
 )
 
 func TestMain(m *testing.M) {
 	privKey, pubKey, _ = cipher.GenerateKeyPair(2048)
+	otherPrivKey, _, _ = cipher.GenerateKeyPair(2048)
 	os.Exit(m.Run())
 }
 
+// newTestAuthenticator returns authenticator with writer of "team_a_" prefix
+// (key-a) and reader (key-r).
+func newTestAuthenticator(t *testing.T) *apikey.Authenticator {
+	authenticator, err := apikey.NewAuthenticator([]apikey.KeyConfig{
+		{ID: "team-a", KeyHash: apikey.HashKey("key-a"), Scopes: []apikey.Scope{apikey.ScopeWrite}, Prefix: "team_a_"},
+		{ID: "reader", KeyHash: apikey.HashKey("key-r"), Scopes: []apikey.Scope{apikey.ScopeRead}},
+	})
+	require.NoError(t, err)
+	return authenticator
+}
+
 func runTests(t *testing.T, tests []testItem) {
 	for _, tt := range tests {
 		tt := tt
@@ -86,7 +107,7 @@ func runTests(t *testing.T, tests []testItem) {
 				}
 				stg = pgStg
 			} else {
-				memStg, _ := storage.NewMemStorage(context.TODO(), logger, storage.NewPersistSettings(0, "", false))
+				memStg, _ := storage.NewMemStorage(context.TODO(), logger, storage.NewPersistSettings(0, "", false), storage.NewHistorySettings(0))
 				if tt.stgInitFunc != nil {
 					tt.stgInitFunc(memStg)
 				}
@@ -95,15 +116,32 @@ func runTests(t *testing.T, tests []testItem) {
 
 			router := chi.NewRouter()
 
-			var cryptoPrivKey *rsa.PrivateKey
+			var keyRing *cipher.KeyRing
 			if tt.req.encryption {
-				cryptoPrivKey = privKey
+				keyRing = cipher.NewKeyRingFromKeys(map[string]*rsa.PrivateKey{"key1": otherPrivKey, "key2": privKey})
+			}
+
+			// Test client is local proxy, unless it is direct client
+			var trustedProxies []*net.IPNet
+			if !tt.directClient {
+				trustedProxies, _ = nettools.ParseSubnets("127.0.0.1")
+			}
+			mdlwrRealIP := _middleware.NewRealIP(trustedProxies)
+
+			router.Use(mdlwrRealIP.Handle, _middleware.Gzip)
+
+			hmacKeys := tt.hmacKeys
+			if tt.req.hmacKey != nil {
+				hmacKeys, _ = hash.ParseKeyRing(*tt.req.hmacKey, "", "")
 			}
-			mdlwrDecr := _middleware.NewDecrpyt(cryptoPrivKey)
 
-			router.Use(middleware.RealIP, _middleware.Gzip, mdlwrDecr.Handle)
+			policy, err := acl.ParsePolicy(tt.aclSpec)
+			require.NoError(t, err)
+			if tt.trustedSubnet != nil {
+				policy.Allow(acl.GroupWrite, tt.trustedSubnet)
+			}
 
-			NewHandler(router, stg, tt.req.hmacKey, tt.trustedSubnet, logger)
+			NewHandler(router, stg, hmacKeys, keyRing, policy, tt.authenticator, tt.signVerifier, logger)
 			ts := httptest.NewServer(router)
 			defer ts.Close()
 
@@ -183,7 +221,14 @@ func bodyGzipReader(val string) io.Reader {
 	return &buf
 }
 
+// encryptString encrypts val in chunked RSA-OAEP format of old agents.
 func encryptString(val string) string {
+	encData, _ := cipher.EncryptWithPublicKey([]byte(val), pubKey)
+	return string(encData)
+}
+
+// encryptEnvelopeString encrypts val in envelope format.
+func encryptEnvelopeString(val string) string {
 	encBuf := cipher.NewEncBuffer(pubKey)
 	encBuf.Write([]byte(val))
 	encData, _ := io.ReadAll(encBuf)
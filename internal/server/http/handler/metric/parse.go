@@ -1,33 +1,144 @@
 package metric
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/devldavydov/promytheus/internal/common/hash"
 	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/server/history"
+)
+
+const (
+	// _labelQueryParam - URL query parameter for metric label in format name:value.
+	_labelQueryParam = "label"
+	// _quantileQueryParam - URL query parameter for summary quantile.
+	_quantileQueryParam = "q"
+	// Range query URL parameters.
+	_nameQueryParam  = "name"
+	_typeQueryParam  = "type"
+	_startQueryParam = "start"
+	_endQueryParam   = "end"
+	_stepQueryParam  = "step"
+	_aggQueryParam   = "agg"
 )
 
 type requestParams struct {
-	metricType   string
-	metricName   string
-	gaugeValue   metric.Gauge
-	counterValue metric.Counter
+	labels         metric.Labels
+	metricType     string
+	metricName     string
+	histogramValue metric.Histogram
+	summaryValue   metric.Summary
+	gaugeValue     metric.Gauge
+	counterValue   metric.Counter
 }
 
-func (handler *MetricHandler) checkMetricsCommon(metricType, metricName string) error {
+func (handler *MetricHandler) checkMetricsCommon(metricType, metricName string, labels metric.Labels) error {
 	if !metric.AllTypes[metricType] {
 		return metric.ErrUnknownMetricType
 	}
 
-	if len(metricName) == 0 {
-		return metric.ErrEmptyMetricName
+	if err := metric.ValidateName(metricName); err != nil {
+		return err
 	}
 
-	return nil
+	return labels.Validate()
+}
+
+func (handler *MetricHandler) parseURLLabels(query url.Values) (metric.Labels, error) {
+	values := query[_labelQueryParam]
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	labels := make(metric.Labels, len(values))
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, ":")
+		if !ok {
+			return nil, metric.ErrWrongMetricLabels
+		}
+		labels[name] = value
+	}
+
+	return labels, nil
 }
 
-func (handler *MetricHandler) parseUpdateRequest(metricType, metricName, metricValue string) (*requestParams, error) {
-	err := handler.checkMetricsCommon(metricType, metricName)
+func (handler *MetricHandler) parseURLQuantile(query url.Values) (*float64, error) {
+	if !query.Has(_quantileQueryParam) {
+		return nil, nil
+	}
+
+	q, err := strconv.ParseFloat(query.Get(_quantileQueryParam), 64)
+	if err != nil || !(q >= 0 && q <= 1) {
+		return nil, fmt.Errorf("incorrect quantile: %w", metric.ErrWrongMetricValue)
+	}
+
+	return &q, nil
+}
+
+// parseURLRange parses range query parameters. Start and end are in RFC3339
+// or unix seconds, step is Go duration or seconds, agg is avg by default.
+func (handler *MetricHandler) parseURLRange(query url.Values) (history.Range, error) {
+	start, err := parseTimestamp(query.Get(_startQueryParam))
+	if err != nil {
+		return history.Range{}, fmt.Errorf("incorrect %s: %w", _startQueryParam, history.ErrWrongQuery)
+	}
+
+	end, err := parseTimestamp(query.Get(_endQueryParam))
+	if err != nil {
+		return history.Range{}, fmt.Errorf("incorrect %s: %w", _endQueryParam, history.ErrWrongQuery)
+	}
+
+	step, err := parseStep(query.Get(_stepQueryParam))
+	if err != nil {
+		return history.Range{}, fmt.Errorf("incorrect %s: %w", _stepQueryParam, history.ErrWrongQuery)
+	}
+
+	agg := history.AggAvg
+	if query.Has(_aggQueryParam) {
+		agg = query.Get(_aggQueryParam)
+	}
+
+	return history.NewRange(start, end, step, agg)
+}
+
+func parseTimestamp(val string) (time.Time, error) {
+	if ts, err := time.Parse(time.RFC3339Nano, val); err == nil {
+		return ts, nil
+	}
+
+	sec, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if math.IsNaN(sec) || math.IsInf(sec, 0) {
+		return time.Time{}, errors.New("timestamp is not finite")
+	}
+	whole, frac := math.Modf(sec)
+	return time.Unix(int64(whole), int64(frac*float64(time.Second))), nil
+}
+
+func parseStep(val string) (time.Duration, error) {
+	if step, err := time.ParseDuration(val); err == nil {
+		return step, nil
+	}
+
+	sec, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(sec) || math.IsInf(sec, 0) {
+		return 0, errors.New("step is not finite")
+	}
+	return time.Duration(sec * float64(time.Second)), nil
+}
+
+func (handler *MetricHandler) parseUpdateRequest(metricType, metricName, metricValue string, labels metric.Labels) (*requestParams, error) {
+	err := handler.checkMetricsCommon(metricType, metricName, labels)
 	if err != nil {
 		return nil, err
 	}
@@ -42,10 +153,41 @@ func (handler *MetricHandler) parseUpdateRequest(metricType, metricName, metricV
 		return &requestParams{
 			metricType: metric.GaugeTypeName,
 			metricName: metricName,
+			labels:     labels,
 			gaugeValue: gaugeVal,
 		}, nil
 	}
 
+	// histogram
+	if metric.HistogramTypeName == metricType {
+		var histogramVal metric.Histogram
+		histogramVal, err = metric.NewHistogramFromString(metricValue)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect %s: %w", metric.HistogramTypeName, metric.ErrWrongMetricValue)
+		}
+		return &requestParams{
+			metricType:     metric.HistogramTypeName,
+			metricName:     metricName,
+			labels:         labels,
+			histogramValue: histogramVal,
+		}, nil
+	}
+
+	// summary
+	if metric.SummaryTypeName == metricType {
+		var summaryVal metric.Summary
+		summaryVal, err = metric.NewSummaryFromString(metricValue)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect %s: %w", metric.SummaryTypeName, metric.ErrWrongMetricValue)
+		}
+		return &requestParams{
+			metricType:   metric.SummaryTypeName,
+			metricName:   metricName,
+			labels:       labels,
+			summaryValue: summaryVal,
+		}, nil
+	}
+
 	// counter
 	counterVal, err := metric.NewCounterFromString(metricValue)
 	if err != nil {
@@ -54,12 +196,13 @@ func (handler *MetricHandler) parseUpdateRequest(metricType, metricName, metricV
 	return &requestParams{
 		metricType:   metric.CounterTypeName,
 		metricName:   metricName,
+		labels:       labels,
 		counterValue: counterVal,
 	}, nil
 }
 
-func (handler *MetricHandler) parseUpdateRequestJSON(metricReq metric.MetricsDTO) (*requestParams, error) {
-	err := handler.checkMetricsCommon(metricReq.MType, metricReq.ID)
+func (handler *MetricHandler) parseUpdateRequestJSON(metricReq metric.MetricsDTO, hmacKeyID string) (*requestParams, error) {
+	err := handler.checkMetricsCommon(metricReq.MType, metricReq.ID, metricReq.Labels)
 	if err != nil {
 		return nil, err
 	}
@@ -72,39 +215,81 @@ func (handler *MetricHandler) parseUpdateRequestJSON(metricReq metric.MetricsDTO
 			return nil, fmt.Errorf("incorrect %s: %w", metric.GaugeTypeName, metric.ErrWrongMetricValue)
 		}
 
-		if err = handler.hmacCheck(metricReq, gaugeVal); err != nil {
+		if err = handler.hmacCheck(metricReq, hmacKeyID, gaugeVal); err != nil {
 			return nil, fmt.Errorf("incorrect %s: %w", metric.GaugeTypeName, err)
 		}
 
 		return &requestParams{
 			metricType: metric.GaugeTypeName,
 			metricName: metricReq.ID,
+			labels:     metricReq.Labels,
 			gaugeValue: gaugeVal,
 		}, nil
 	}
 
+	// histogram
+	if metric.HistogramTypeName == metricReq.MType {
+		var histogramVal metric.Histogram
+		histogramVal, err = metric.NewHistogramFromParts(metricReq.Bounds, metricReq.Buckets, metricReq.Sum, metricReq.Count)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect %s: %w", metric.HistogramTypeName, metric.ErrWrongMetricValue)
+		}
+
+		if err = handler.hmacCheck(metricReq, hmacKeyID, histogramVal); err != nil {
+			return nil, fmt.Errorf("incorrect %s: %w", metric.HistogramTypeName, err)
+		}
+
+		return &requestParams{
+			metricType:     metric.HistogramTypeName,
+			metricName:     metricReq.ID,
+			labels:         metricReq.Labels,
+			histogramValue: histogramVal,
+		}, nil
+	}
+
+	// summary
+	if metric.SummaryTypeName == metricReq.MType {
+		var summaryVal metric.Summary
+		summaryVal, err = metric.NewSummaryFromParts(metricReq.Sketch, metricReq.Sum, metricReq.Count)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect %s: %w", metric.SummaryTypeName, metric.ErrWrongMetricValue)
+		}
+
+		if err = handler.hmacCheck(metricReq, hmacKeyID, summaryVal); err != nil {
+			return nil, fmt.Errorf("incorrect %s: %w", metric.SummaryTypeName, err)
+		}
+
+		return &requestParams{
+			metricType:   metric.SummaryTypeName,
+			metricName:   metricReq.ID,
+			labels:       metricReq.Labels,
+			summaryValue: summaryVal,
+		}, nil
+	}
+
 	// counter
 	counterVal, err := metric.NewCounterFromIntP(metricReq.Delta)
 	if err != nil {
 		return nil, fmt.Errorf("incorrect %s: %w", metric.CounterTypeName, metric.ErrWrongMetricValue)
 	}
 
-	if err = handler.hmacCheck(metricReq, counterVal); err != nil {
+	if err = handler.hmacCheck(metricReq, hmacKeyID, counterVal); err != nil {
 		return nil, fmt.Errorf("incorrect %s: %w", metric.CounterTypeName, err)
 	}
 
 	return &requestParams{
 		metricType:   metric.CounterTypeName,
 		metricName:   metricReq.ID,
+		labels:       metricReq.Labels,
 		counterValue: counterVal,
 	}, nil
 }
 
-func (handler *MetricHandler) parseUpdateRequestJSONBatch(metricReqList []metric.MetricsDTO) ([]requestParams, error) {
+func (handler *MetricHandler) parseUpdateRequestJSONBatch(metricReqList []metric.MetricsDTO, hmacKeyID string) ([]requestParams, error) {
 	requestParamsList := make([]requestParams, 0, len(metricReqList))
 
 	for _, metricReq := range metricReqList {
-		requestParams, err := handler.parseUpdateRequestJSON(metricReq)
+		requestParams, err := handler.parseUpdateRequestJSON(metricReq, hmacKeyID)
 		if err != nil {
 			return nil, err
 		}
@@ -114,12 +299,14 @@ func (handler *MetricHandler) parseUpdateRequestJSONBatch(metricReqList []metric
 	return requestParamsList, nil
 }
 
-func (handler *MetricHandler) hmacCheck(metricReq metric.MetricsDTO, value metric.MetricValue) error {
-	if handler.hmacKey == nil {
+func (handler *MetricHandler) hmacCheck(metricReq metric.MetricsDTO, hmacKeyID string, value metric.MetricValue) error {
+	if handler.hmacKeys == nil {
 		return nil
 	}
 
-	if !hash.HmacEqual(*metricReq.Hash, value.Hmac(metricReq.ID, *handler.hmacKey)) {
+	if !handler.hmacKeys.HmacEqual(hmacKeyID, *metricReq.Hash, func(key string) string {
+		return value.Hmac(metricReq.ID, metricReq.Labels, key)
+	}) {
 		return metric.ErrMetricHashCheck
 	}
 	return nil
@@ -13,14 +13,14 @@ func BenchmarkParseUpdateRequest(b *testing.B) {
 
 	b.Run("parse plain gauge", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			_, err := handler.parseUpdateRequest(metric.GaugeTypeName, "test", "123.123")
+			_, err := handler.parseUpdateRequest(metric.GaugeTypeName, "test", "123.123", nil)
 			assert.NoError(b, err)
 		}
 	})
 
 	b.Run("parse plain counter", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			_, err := handler.parseUpdateRequest(metric.CounterTypeName, "test", "123")
+			_, err := handler.parseUpdateRequest(metric.CounterTypeName, "test", "123", nil)
 			assert.NoError(b, err)
 		}
 	})
@@ -39,7 +39,7 @@ func BenchmarkParseUpdateJSONRequest(b *testing.B) {
 		b.ResetTimer()
 
 		for i := 0; i < b.N; i++ {
-			_, err := handler.parseUpdateRequestJSON(req)
+			_, err := handler.parseUpdateRequestJSON(req, "")
 			assert.NoError(b, err)
 		}
 	})
@@ -54,7 +54,7 @@ func BenchmarkParseUpdateJSONRequest(b *testing.B) {
 		b.ResetTimer()
 
 		for i := 0; i < b.N; i++ {
-			_, err := handler.parseUpdateRequestJSON(req)
+			_, err := handler.parseUpdateRequestJSON(req, "")
 			assert.NoError(b, err)
 		}
 	})
@@ -84,7 +84,7 @@ func BenchmarkParseUpdateRequestJSONBatch(b *testing.B) {
 
 	b.Run("parse json batch", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			_, err := handler.parseUpdateRequestJSONBatch(reqList)
+			_, err := handler.parseUpdateRequestJSONBatch(reqList, "")
 			assert.NoError(b, err)
 		}
 	})
@@ -20,3 +20,16 @@ func (handler *MetricHandler) Ping(rw http.ResponseWriter, req *http.Request) {
 	}
 	_http.CreateStatusResponse(rw, http.StatusInternalServerError)
 }
+
+// Health checks storage connection for agents. Unlike Ping, it is not
+// restricted by ACL and API keys, so agents with write-only access are able
+// to check server health before failover.
+//
+//	@Summary	Check server health
+//	@Produce	plain/text
+//	@Success	200	"Check successful"
+//	@Failure	500	"Internal error"
+//	@Router		/health [get]
+func (handler *MetricHandler) Health(rw http.ResponseWriter, req *http.Request) {
+	handler.Ping(rw, req)
+}
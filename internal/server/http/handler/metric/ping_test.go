@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/devldavydov/promytheus/internal/common/apikey"
 	_http "github.com/devldavydov/promytheus/internal/common/http"
 	"github.com/devldavydov/promytheus/internal/server/mocks"
 )
@@ -54,6 +55,116 @@ func TestPing(t *testing.T) {
 				ms.EXPECT().Ping().Return(false)
 			},
 		},
+		{
+			name: "ping db connection: denied by admin ACL",
+			req: testRequest{
+				method:  http.MethodGet,
+				url:     "/ping",
+				headers: map[string][]string{"X-Forwarded-For": {"10.0.0.1"}},
+			},
+			resp: testResponse{
+				code:        http.StatusForbidden,
+				body:        "",
+				contentType: "",
+			},
+			aclSpec: "admin=127.0.0.1,::1",
+		},
+		{
+			name: "ping db connection: allowed by admin ACL",
+			req: testRequest{
+				method:  http.MethodGet,
+				url:     "/ping",
+				headers: map[string][]string{"X-Forwarded-For": {"::1"}},
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        http.StatusText(http.StatusOK),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			aclSpec: "admin=127.0.0.1,::1;read=!::1",
+			dbStg:   true,
+			stgMockFunc: func(ms *mocks.MockStorage) {
+				ms.EXPECT().Ping().Return(true)
+			},
+		},
+	}
+
+	runTests(t, tests)
+}
+
+func TestHealth(t *testing.T) {
+	writeKey := map[string][]string{
+		"X-Forwarded-For":          {"::1"},
+		apikey.AuthorizationHeader: {"Bearer key-a"},
+	}
+
+	tests := []testItem{
+		{
+			name: "health: success check",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/health",
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        http.StatusText(http.StatusOK),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			dbStg: true,
+			stgMockFunc: func(ms *mocks.MockStorage) {
+				ms.EXPECT().Ping().Return(true)
+			},
+		},
+		{
+			name: "health: fail check",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/health",
+			},
+			resp: testResponse{
+				code:        http.StatusInternalServerError,
+				body:        http.StatusText(http.StatusInternalServerError),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			dbStg: true,
+			stgMockFunc: func(ms *mocks.MockStorage) {
+				ms.EXPECT().Ping().Return(false)
+			},
+		},
+		{
+			name: "health: write-only key, admin ACL denied ping",
+			req: testRequest{
+				method:  http.MethodGet,
+				url:     "/ping",
+				headers: writeKey,
+			},
+			resp: testResponse{
+				code:        http.StatusForbidden,
+				body:        "",
+				contentType: "",
+			},
+			aclSpec:       "admin=10.0.0.1",
+			authenticator: newTestAuthenticator(t),
+		},
+		{
+			name: "health: write-only key, admin ACL allowed health",
+			req: testRequest{
+				method:  http.MethodGet,
+				url:     "/health",
+				headers: writeKey,
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        http.StatusText(http.StatusOK),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			aclSpec:       "admin=10.0.0.1",
+			authenticator: newTestAuthenticator(t),
+			dbStg:         true,
+			stgMockFunc: func(ms *mocks.MockStorage) {
+				ms.EXPECT().Ping().Return(true)
+			},
+		},
 	}
 
 	runTests(t, tests)
@@ -0,0 +1,74 @@
+package metric
+
+import (
+	"errors"
+	"net/http"
+
+	_http "github.com/devldavydov/promytheus/internal/common/http"
+	"github.com/devldavydov/promytheus/internal/server/history"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+)
+
+// QueryRange returns metric history aggregated by steps.
+//
+//	@Summary	Query metric history range
+//	@Produce	json
+//	@Param		name	query		string		true	"Metric Name"
+//	@Param		type	query		string		true	"Metric Type (gauge|counter)"
+//	@Param		start	query		string		true	"Range start, RFC3339 or unix seconds"
+//	@Param		end		query		string		true	"Range end, RFC3339 or unix seconds"
+//	@Param		step	query		string		true	"Step, duration (15s) or seconds"
+//	@Param		agg		query		string		false	"Step aggregation (avg|min|max|sum|last|rate), avg by default"
+//	@Param		label	query		[]string	false	"Metric label in format name:value"	collectionFormat(multi)
+//	@Success	200		{object}	history.RangeDTO	"Returns aggregated points"
+//	@Failure	400		"Bad request"
+//	@Failure	500		"Internal error"
+//	@Failure	501		"Metric type not found or history disabled"
+//	@Router		/query_range [get]
+func (handler *MetricHandler) QueryRange(rw http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	metricType, metricName := query.Get(_typeQueryParam), query.Get(_nameQueryParam)
+
+	labels, err := handler.parseURLLabels(query)
+	if err != nil {
+		handler.logger.Errorf("Incorrect query range request [%s], err: %v", req.URL, err)
+		CreateResponseOnRequestError(rw, err)
+		return
+	}
+
+	err = handler.checkMetricsCommon(metricType, metricName, labels)
+	if err != nil {
+		handler.logger.Errorf("Incorrect query range request [%s], err: %v", req.URL, err)
+		CreateResponseOnRequestError(rw, err)
+		return
+	}
+
+	r, err := handler.parseURLRange(query)
+	if err != nil {
+		handler.logger.Errorf("Incorrect query range request [%s], err: %v", req.URL, err)
+		CreateResponseOnRequestError(rw, err)
+		return
+	}
+
+	points, err := history.Query(handler.storage, metricType, metricName, labels, r)
+	if err != nil {
+		if errors.Is(err, history.ErrWrongQuery) || errors.Is(err, storage.ErrHistoryDisabled) {
+			handler.logger.Errorf("Incorrect query range request [%s], err: %v", req.URL, err)
+			CreateResponseOnRequestError(rw, err)
+			return
+		}
+
+		handler.logger.Errorf("Query range error on request [%s], err: %v", req.URL, err)
+		_http.CreateStatusResponse(rw, http.StatusInternalServerError)
+		return
+	}
+
+	_http.CreateJSONResponse(rw, http.StatusOK, history.RangeDTO{
+		ID:     metricName,
+		MType:  metricType,
+		Labels: labels,
+		Agg:    r.Agg,
+		Step:   r.Step.String(),
+		Points: points,
+	})
+}
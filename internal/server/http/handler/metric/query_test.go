@@ -0,0 +1,165 @@
+package metric
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	_http "github.com/devldavydov/promytheus/internal/common/http"
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/server/mocks"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+)
+
+func TestQueryRange(t *testing.T) {
+	start, end := time.Unix(1000, 0), time.Unix(1030, 0)
+
+	tests := []testItem{
+		{
+			name: "query range: unknown metric type",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/query_range?name=foo&type=fuzzbuzz&start=1000&end=1030&step=10s",
+			},
+			resp: testResponse{
+				code:        http.StatusNotImplemented,
+				body:        http.StatusText(http.StatusNotImplemented),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "query range: empty name",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/query_range?type=gauge&start=1000&end=1030&step=10s",
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "query range: wrong start",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/query_range?name=foo&type=gauge&start=abc&end=1030&step=10s",
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "query range: wrong step",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/query_range?name=foo&type=gauge&start=1000&end=1030&step=0",
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "query range: unknown aggregation",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/query_range?name=foo&type=gauge&start=1000&end=1030&step=10s&agg=median",
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "query range: rate for gauge",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/query_range?name=foo&type=gauge&start=1000&end=1030&step=10s&agg=rate",
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "query range: history disabled",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/query_range?name=foo&type=gauge&start=1000&end=1030&step=10s",
+			},
+			resp: testResponse{
+				code:        http.StatusNotImplemented,
+				body:        http.StatusText(http.StatusNotImplemented),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "query range: gauge avg",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/query_range?name=foo&type=gauge&start=1000&end=1030&step=10&label=host:a",
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `{"id":"foo","type":"gauge","labels":{"host":"a"},"agg":"avg","step":"10s","points":[{"ts":"` + formatTS(start) + `","value":2},{"ts":"` + formatTS(start.Add(20*time.Second)) + `","value":5}]}`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			dbStg: true,
+			stgMockFunc: func(ms *mocks.MockStorage) {
+				ms.EXPECT().GetMetricRange(metric.GaugeTypeName, "foo", metric.Labels{"host": "a"}, start, end).Return([]storage.Sample{
+					{Timestamp: start.Add(time.Second), Value: metric.Gauge(1)},
+					{Timestamp: start.Add(2 * time.Second), Value: metric.Gauge(3)},
+					{Timestamp: start.Add(25 * time.Second), Value: metric.Gauge(5)},
+				}, nil)
+			},
+		},
+		{
+			name: "query range: counter rate",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/query_range?name=foo&type=counter&start=1000&end=1030&step=10s&agg=rate",
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `{"id":"foo","type":"counter","agg":"rate","step":"10s","points":[{"ts":"` + formatTS(start) + `","value":0.5}]}`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			dbStg: true,
+			stgMockFunc: func(ms *mocks.MockStorage) {
+				ms.EXPECT().GetMetricRange(metric.CounterTypeName, "foo", nil, start.Add(-10*time.Second), end).Return([]storage.Sample{
+					{Timestamp: start.Add(-time.Second), Value: metric.Counter(10)},
+					{Timestamp: start.Add(time.Second), Value: metric.Counter(15)},
+				}, nil)
+			},
+		},
+		{
+			name: "query range: db err",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/query_range?name=foo&type=counter&start=1000&end=1030&step=10s&agg=sum",
+			},
+			resp: testResponse{
+				code:        http.StatusInternalServerError,
+				body:        http.StatusText(http.StatusInternalServerError),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			dbStg: true,
+			stgMockFunc: func(ms *mocks.MockStorage) {
+				ms.EXPECT().GetMetricRange(metric.CounterTypeName, "foo", nil, start, end).Return(nil, errors.New("db error"))
+			},
+		},
+	}
+
+	runTests(t, tests)
+}
+
+func formatTS(ts time.Time) string {
+	return ts.Format(time.RFC3339Nano)
+}
@@ -2,8 +2,10 @@ package metric
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"github.com/devldavydov/promytheus/internal/common/hash"
 	_http "github.com/devldavydov/promytheus/internal/common/http"
 	"github.com/devldavydov/promytheus/internal/common/metric"
 	"github.com/devldavydov/promytheus/internal/server/storage"
@@ -17,6 +19,7 @@ import (
 //	@Param		metricType	path	string	true	"Metric Type"
 //	@Param		metricName	path	string	true	"Metric Name"
 //	@Param		metricValue	path	string	true	"Metric Value"
+//	@Param		label		query	[]string	false	"Metric label in format name:value"	collectionFormat(multi)
 //	@Success	200			"Updated successfully"
 //	@Failure	400			"Bad request"
 //	@Failure	403			"Forbidden"
@@ -24,17 +27,40 @@ import (
 //	@Failure	501			"Metric type not found"
 //	@Router		/update/{metricType}/{metricName}/{metricValue} [post]
 func (handler *MetricHandler) UpdateMetric(rw http.ResponseWriter, req *http.Request) {
-	params, err := handler.parseUpdateRequest(chi.URLParam(req, "metricType"), chi.URLParam(req, "metricName"), chi.URLParam(req, "metricValue"))
+	labels, err := handler.parseURLLabels(req.URL.Query())
 	if err != nil {
 		handler.logger.Errorf("Incorrect update metric request [%s], err: %v", req.URL, err)
 		CreateResponseOnRequestError(rw, err)
 		return
 	}
 
+	params, err := handler.parseUpdateRequest(chi.URLParam(req, "metricType"), chi.URLParam(req, "metricName"), chi.URLParam(req, "metricValue"), labels)
+	if err != nil {
+		handler.logger.Errorf("Incorrect update metric request [%s], err: %v", req.URL, err)
+		CreateResponseOnRequestError(rw, err)
+		return
+	}
+
+	if !writeAllowed(req, params.metricName) {
+		handler.logger.Errorf("Forbidden update metric request [%s] by API key prefix", req.URL)
+		_http.CreateStatusResponse(rw, http.StatusForbidden)
+		return
+	}
+
 	if metric.GaugeTypeName == params.metricType {
-		_, err = handler.storage.SetGaugeMetric(params.metricName, params.gaugeValue)
+		_, err = handler.storage.SetGaugeMetric(params.metricName, params.labels, params.gaugeValue)
 	} else if metric.CounterTypeName == params.metricType {
-		_, err = handler.storage.SetCounterMetric(params.metricName, params.counterValue)
+		_, err = handler.storage.SetCounterMetric(params.metricName, params.labels, params.counterValue)
+	} else if metric.HistogramTypeName == params.metricType {
+		_, err = handler.storage.SetHistogramMetric(params.metricName, params.labels, params.histogramValue)
+	} else if metric.SummaryTypeName == params.metricType {
+		_, err = handler.storage.SetSummaryMetric(params.metricName, params.labels, params.summaryValue)
+	}
+
+	if errors.Is(err, metric.ErrWrongMetricValue) {
+		handler.logger.Errorf("Incorrect update metric request [%s], err: %v", req.URL, err)
+		CreateResponseOnRequestError(rw, err)
+		return
 	}
 
 	if err != nil {
@@ -67,20 +93,36 @@ func (handler *MetricHandler) UpdateMetricJSON(rw http.ResponseWriter, req *http
 		return
 	}
 
-	params, err := handler.parseUpdateRequestJSON(metricReq)
+	params, err := handler.parseUpdateRequestJSON(metricReq, req.Header.Get(hash.KeyIDHeader))
 	if err != nil {
 		handler.logger.Errorf("Incorrect update metric request [%s], JSON: [%v] , err: %v", req.URL, metricReq, err)
 		CreateResponseOnRequestError(rw, err)
 		return
 	}
 
-	metricResp := metric.MetricsDTO{ID: metricReq.ID, MType: metricReq.MType}
+	if !writeAllowed(req, params.metricName) {
+		handler.logger.Errorf("Forbidden update metric request [%s], JSON: [%v] by API key prefix", req.URL, metricReq)
+		_http.CreateStatusResponse(rw, http.StatusForbidden)
+		return
+	}
+
+	metricResp := metric.MetricsDTO{ID: metricReq.ID, MType: metricReq.MType, Labels: metricReq.Labels}
 	var val interface{}
 
 	if metric.GaugeTypeName == params.metricType {
-		val, err = handler.storage.SetGaugeMetric(params.metricName, params.gaugeValue)
+		val, err = handler.storage.SetGaugeMetric(params.metricName, params.labels, params.gaugeValue)
 	} else if metric.CounterTypeName == params.metricType {
-		val, err = handler.storage.SetCounterMetric(params.metricName, params.counterValue)
+		val, err = handler.storage.SetCounterMetric(params.metricName, params.labels, params.counterValue)
+	} else if metric.HistogramTypeName == params.metricType {
+		val, err = handler.storage.SetHistogramMetric(params.metricName, params.labels, params.histogramValue)
+	} else if metric.SummaryTypeName == params.metricType {
+		val, err = handler.storage.SetSummaryMetric(params.metricName, params.labels, params.summaryValue)
+	}
+
+	if errors.Is(err, metric.ErrWrongMetricValue) {
+		handler.logger.Errorf("Incorrect update metric request [%s], JSON: [%v] , err: %v", req.URL, metricReq, err)
+		CreateResponseOnRequestError(rw, err)
+		return
 	}
 
 	if err != nil {
@@ -93,11 +135,17 @@ func (handler *MetricHandler) UpdateMetricJSON(rw http.ResponseWriter, req *http
 		metricResp.Value = val.(metric.Gauge).FloatP()
 	} else if metric.CounterTypeName == params.metricType {
 		metricResp.Delta = val.(metric.Counter).IntP()
+	} else if metric.HistogramTypeName == params.metricType {
+		setHistogramResponse(&metricResp, val.(metric.Histogram))
+	} else if metric.SummaryTypeName == params.metricType {
+		setSummaryResponse(&metricResp, val.(metric.Summary))
 	}
 
-	if handler.hmacKey != nil {
-		hash := val.(metric.MetricValue).Hmac(params.metricName, *handler.hmacKey)
-		metricResp.Hash = &hash
+	if handler.hmacKeys != nil {
+		keyID, key := handler.hmacKeys.Primary()
+		hmac := val.(metric.MetricValue).Hmac(params.metricName, params.labels, key)
+		metricResp.Hash = &hmac
+		rw.Header().Set(hash.KeyIDHeader, keyID)
 	}
 
 	_http.CreateJSONResponse(rw, http.StatusOK, metricResp)
@@ -125,15 +173,31 @@ func (handler *MetricHandler) UpdateMetricJSONBatch(rw http.ResponseWriter, req
 	}
 
 	// Parse params
-	paramsList, err := handler.parseUpdateRequestJSONBatch(metricReqList)
+	paramsList, err := handler.parseUpdateRequestJSONBatch(metricReqList, req.Header.Get(hash.KeyIDHeader))
 	if err != nil {
 		handler.logger.Errorf("Incorrect update metric request [%s], JSON: [%v] , err: %v", req.URL, metricReqList, err)
 		CreateResponseOnRequestError(rw, err)
 		return
 	}
 
+	// Check API key prefix
+	for _, params := range paramsList {
+		if !writeAllowed(req, params.metricName) {
+			handler.logger.Errorf("Forbidden update metric request [%s], JSON: [%v] by API key prefix", req.URL, metricReqList)
+			_http.CreateStatusResponse(rw, http.StatusForbidden)
+			return
+		}
+	}
+
 	// Save in storage
-	if err = handler.storage.SetMetrics(handler.convertFromParams(paramsList)); err != nil {
+	err = handler.storage.SetMetrics(handler.convertFromParams(paramsList))
+	if errors.Is(err, metric.ErrWrongMetricValue) {
+		handler.logger.Errorf("Incorrect update metric request [%s], JSON: [%v] , err: %v", req.URL, metricReqList, err)
+		CreateResponseOnRequestError(rw, err)
+		return
+	}
+
+	if err != nil {
 		handler.logger.Errorf("Update metric error on request [%s], JSON: [%v], err: %v", req.URL, metricReqList, err)
 		_http.CreateStatusResponse(rw, http.StatusInternalServerError)
 		return
@@ -146,14 +210,31 @@ func (handler *MetricHandler) UpdateMetricJSONBatch(rw http.ResponseWriter, req
 func (handler *MetricHandler) convertFromParams(items []requestParams) []storage.StorageItem {
 	storageItemList := make([]storage.StorageItem, 0, len(items))
 	for _, params := range items {
-		stgItem := storage.StorageItem{MetricName: params.metricName}
+		stgItem := storage.StorageItem{MetricName: params.metricName, Labels: params.labels}
 		if params.metricType == metric.CounterTypeName {
 			stgItem.Value = params.counterValue
 		} else if params.metricType == metric.GaugeTypeName {
 			stgItem.Value = params.gaugeValue
+		} else if params.metricType == metric.HistogramTypeName {
+			stgItem.Value = params.histogramValue
+		} else if params.metricType == metric.SummaryTypeName {
+			stgItem.Value = params.summaryValue
 		}
 
 		storageItemList = append(storageItemList, stgItem)
 	}
 	return storageItemList
 }
+
+func setHistogramResponse(metricResp *metric.MetricsDTO, val metric.Histogram) {
+	metricResp.Bounds = val.Bounds
+	metricResp.Buckets = val.Buckets
+	metricResp.Sum = val.SumP()
+	metricResp.Count = val.CountP()
+}
+
+func setSummaryResponse(metricResp *metric.MetricsDTO, val metric.Summary) {
+	metricResp.Sketch = val.SketchP()
+	metricResp.Sum = val.SumP()
+	metricResp.Count = val.CountP()
+}
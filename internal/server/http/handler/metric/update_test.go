@@ -4,13 +4,19 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/devldavydov/promytheus/internal/common/apikey"
+	"github.com/devldavydov/promytheus/internal/common/cipher"
+	"github.com/devldavydov/promytheus/internal/common/hash"
 	_http "github.com/devldavydov/promytheus/internal/common/http"
 	"github.com/devldavydov/promytheus/internal/common/metric"
 	"github.com/devldavydov/promytheus/internal/server/mocks"
 	"github.com/devldavydov/promytheus/internal/server/storage"
 	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/require"
 )
 
 func TestUpdateMetric(t *testing.T) {
@@ -75,6 +81,18 @@ func TestUpdateMetric(t *testing.T) {
 				contentType: _http.ContentTypeTextPlain,
 			},
 		},
+		{
+			name: "update metric: wrong metric name",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/update/gauge/bad%7B/1",
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
 		{
 			name: "update metric: incorrect gauge val, #1",
 			req: testRequest{
@@ -152,7 +170,7 @@ func TestUpdateMetric(t *testing.T) {
 			req: testRequest{
 				method:  http.MethodPost,
 				url:     "/update/gauge/metric2/1.234",
-				headers: map[string][]string{"X-Real-IP": {"1.1.1.1"}},
+				headers: map[string][]string{"X-Forwarded-For": {"1.1.1.1"}},
 			},
 			resp: testResponse{
 				code:        http.StatusForbidden,
@@ -166,7 +184,7 @@ func TestUpdateMetric(t *testing.T) {
 			req: testRequest{
 				method:  http.MethodPost,
 				url:     "/update/counter/metric2/1234",
-				headers: map[string][]string{"X-Real-IP": {"1.1.1.1"}},
+				headers: map[string][]string{"X-Forwarded-For": {"1.1.1.1"}},
 			},
 			resp: testResponse{
 				code:        http.StatusForbidden,
@@ -175,12 +193,56 @@ func TestUpdateMetric(t *testing.T) {
 			},
 			trustedSubnet: getIPNet("10.0.0.0/16"),
 		},
+		{
+			name: "update metric: correct gauge, spoofed subnet",
+			req: testRequest{
+				method:  http.MethodPost,
+				url:     "/update/gauge/metric2/1.234",
+				headers: map[string][]string{"X-Forwarded-For": {"192.168.0.100"}},
+			},
+			resp: testResponse{
+				code:        http.StatusForbidden,
+				body:        "",
+				contentType: "",
+			},
+			trustedSubnet: getIPNet("192.168.0.0/16"),
+			directClient:  true,
+		},
+		{
+			name: "update metric: correct gauge, X-Real-IP from proxy ignored",
+			req: testRequest{
+				method:  http.MethodPost,
+				url:     "/update/gauge/metric2/1.234",
+				headers: map[string][]string{"X-Real-IP": {"192.168.0.100"}, "X-Forwarded-For": {"1.1.1.1"}},
+			},
+			resp: testResponse{
+				code:        http.StatusForbidden,
+				body:        "",
+				contentType: "",
+			},
+			trustedSubnet: getIPNet("192.168.0.0/16"),
+		},
+		{
+			name: "update metric: correct gauge, direct client in subnet",
+			req: testRequest{
+				method:  http.MethodPost,
+				url:     "/update/gauge/metric2/1.234",
+				headers: map[string][]string{"X-Forwarded-For": {"1.1.1.1"}},
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        http.StatusText(http.StatusOK),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			trustedSubnet: getIPNet("127.0.0.0/8"),
+			directClient:  true,
+		},
 		{
 			name: "update metric: correct gauge, correct subnet",
 			req: testRequest{
 				method:  http.MethodPost,
 				url:     "/update/gauge/metric2/1.234",
-				headers: map[string][]string{"X-Real-IP": {"192.168.0.100"}},
+				headers: map[string][]string{"X-Forwarded-For": {"192.168.0.100"}},
 			},
 			resp: testResponse{
 				code:        http.StatusOK,
@@ -194,7 +256,7 @@ func TestUpdateMetric(t *testing.T) {
 			req: testRequest{
 				method:  http.MethodPost,
 				url:     "/update/counter/metric2/1234",
-				headers: map[string][]string{"X-Real-IP": {"192.168.0.100"}},
+				headers: map[string][]string{"X-Forwarded-For": {"192.168.0.100"}},
 			},
 			resp: testResponse{
 				code:        http.StatusOK,
@@ -223,7 +285,7 @@ func TestUpdateMetricInDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().SetGaugeMetric("metric1", metric.Gauge(1.234)).Return(metric.Gauge(1.234), nil)
+				ms.EXPECT().SetGaugeMetric("metric1", nil, metric.Gauge(1.234)).Return(metric.Gauge(1.234), nil)
 			},
 		},
 		{
@@ -239,7 +301,7 @@ func TestUpdateMetricInDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().SetGaugeMetric("metric1", metric.Gauge(1.234)).Return(metric.Gauge(0), errors.New("db error"))
+				ms.EXPECT().SetGaugeMetric("metric1", nil, metric.Gauge(1.234)).Return(metric.Gauge(0), errors.New("db error"))
 			},
 		},
 		{
@@ -255,7 +317,7 @@ func TestUpdateMetricInDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().SetCounterMetric("metric1", metric.Counter(1234)).Return(metric.Counter(1234), nil)
+				ms.EXPECT().SetCounterMetric("metric1", nil, metric.Counter(1234)).Return(metric.Counter(1234), nil)
 			},
 		},
 		{
@@ -271,7 +333,7 @@ func TestUpdateMetricInDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().SetCounterMetric("metric1", metric.Counter(1234)).Return(metric.Counter(0), errors.New("db error"))
+				ms.EXPECT().SetCounterMetric("metric1", nil, metric.Counter(1234)).Return(metric.Counter(0), errors.New("db error"))
 			},
 		},
 	}
@@ -435,7 +497,7 @@ func TestUpdateJsonMetric(t *testing.T) {
 				contentType: _http.ContentTypeApplicationJSON,
 			},
 			stgInitFunc: func(s storage.Storage) {
-				s.SetCounterMetric("foo", 123)
+				s.SetCounterMetric("foo", nil, 123)
 			},
 		},
 		{
@@ -454,7 +516,7 @@ func TestUpdateJsonMetric(t *testing.T) {
 				headers:     map[string][]string{"Content-Encoding": {"gzip"}},
 			},
 			stgInitFunc: func(s storage.Storage) {
-				s.SetCounterMetric("foo", 123)
+				s.SetCounterMetric("foo", nil, 123)
 			},
 		},
 		{
@@ -504,7 +566,7 @@ func TestUpdateJsonMetric(t *testing.T) {
 				headers:     map[string][]string{"Content-Encoding": {"gzip"}},
 			},
 			stgInitFunc: func(s storage.Storage) {
-				s.SetCounterMetric("foo", 123)
+				s.SetCounterMetric("foo", nil, 123)
 			},
 		},
 		{
@@ -514,7 +576,7 @@ func TestUpdateJsonMetric(t *testing.T) {
 				url:         "/update/",
 				body:        bodyGzipReader(encryptString(`{"id": "foo_encr_gz2", "type": "counter", "delta": 123}`)),
 				contentType: strPointer(_http.ContentTypeApplicationJSON),
-				headers:     map[string][]string{"Accept-Encoding": {"gzip"}, "Content-Encoding": {"gzip"}, "X-Real-IP": {"192.168.0.100"}},
+				headers:     map[string][]string{"Accept-Encoding": {"gzip"}, "Content-Encoding": {"gzip"}, "X-Forwarded-For": {"192.168.0.100"}},
 				encryption:  true,
 			},
 			resp: testResponse{
@@ -525,7 +587,7 @@ func TestUpdateJsonMetric(t *testing.T) {
 			},
 			trustedSubnet: getIPNet("192.168.0.0/16"),
 			stgInitFunc: func(s storage.Storage) {
-				s.SetCounterMetric("foo_encr_gz2", 123)
+				s.SetCounterMetric("foo_encr_gz2", nil, 123)
 			},
 		},
 		{
@@ -535,7 +597,7 @@ func TestUpdateJsonMetric(t *testing.T) {
 				url:         "/update/",
 				body:        bodyGzipReader(encryptString(`{"id": "foo_encr_gz3", "type": "counter", "delta": 123}`)),
 				contentType: strPointer(_http.ContentTypeApplicationJSON),
-				headers:     map[string][]string{"Accept-Encoding": {"gzip"}, "Content-Encoding": {"gzip"}, "X-Real-IP": {"10.10.10.10"}},
+				headers:     map[string][]string{"Accept-Encoding": {"gzip"}, "Content-Encoding": {"gzip"}, "X-Forwarded-For": {"10.10.10.10"}},
 				encryption:  true,
 			},
 			resp: testResponse{
@@ -546,7 +608,7 @@ func TestUpdateJsonMetric(t *testing.T) {
 			},
 			trustedSubnet: getIPNet("192.168.0.0/16"),
 			stgInitFunc: func(s storage.Storage) {
-				s.SetCounterMetric("foo_encr_gz3", 123)
+				s.SetCounterMetric("foo_encr_gz3", nil, 123)
 			},
 		},
 	}
@@ -571,7 +633,7 @@ func TestUpdateJsonMetricInDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().SetGaugeMetric("foo", metric.Gauge(123.0)).Return(metric.Gauge(123.0), nil)
+				ms.EXPECT().SetGaugeMetric("foo", nil, metric.Gauge(123.0)).Return(metric.Gauge(123.0), nil)
 			},
 		},
 		{
@@ -589,7 +651,7 @@ func TestUpdateJsonMetricInDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().SetGaugeMetric("foo", metric.Gauge(123.0)).Return(metric.Gauge(0), errors.New("db error"))
+				ms.EXPECT().SetGaugeMetric("foo", nil, metric.Gauge(123.0)).Return(metric.Gauge(0), errors.New("db error"))
 			},
 		},
 		{
@@ -607,7 +669,7 @@ func TestUpdateJsonMetricInDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().SetCounterMetric("foo", metric.Counter(123)).Return(metric.Counter(123), nil)
+				ms.EXPECT().SetCounterMetric("foo", nil, metric.Counter(123)).Return(metric.Counter(123), nil)
 			},
 		},
 		{
@@ -625,7 +687,7 @@ func TestUpdateJsonMetricInDb(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().SetCounterMetric("foo", metric.Counter(123)).Return(metric.Counter(0), errors.New("db error"))
+				ms.EXPECT().SetCounterMetric("foo", nil, metric.Counter(123)).Return(metric.Counter(0), errors.New("db error"))
 			},
 		},
 	}
@@ -718,7 +780,7 @@ func TestUpdateJSONMetricInDbWithHash(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().SetGaugeMetric("Sys", metric.Gauge(13220880)).Return(metric.Gauge(13220880), nil)
+				ms.EXPECT().SetGaugeMetric("Sys", nil, metric.Gauge(13220880)).Return(metric.Gauge(13220880), nil)
 			},
 		},
 		{
@@ -737,7 +799,7 @@ func TestUpdateJSONMetricInDbWithHash(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().SetGaugeMetric("Sys", metric.Gauge(13220880)).Return(metric.Gauge(0), errors.New("db error"))
+				ms.EXPECT().SetGaugeMetric("Sys", nil, metric.Gauge(13220880)).Return(metric.Gauge(0), errors.New("db error"))
 			},
 		},
 		{
@@ -756,7 +818,7 @@ func TestUpdateJSONMetricInDbWithHash(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().SetCounterMetric("PollCount", metric.Counter(5)).Return(metric.Counter(5), nil)
+				ms.EXPECT().SetCounterMetric("PollCount", nil, metric.Counter(5)).Return(metric.Counter(5), nil)
 			},
 		},
 		{
@@ -775,7 +837,7 @@ func TestUpdateJSONMetricInDbWithHash(t *testing.T) {
 			},
 			dbStg: true,
 			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().SetCounterMetric("PollCount", metric.Counter(5)).Return(metric.Counter(5), errors.New("db error"))
+				ms.EXPECT().SetCounterMetric("PollCount", nil, metric.Counter(5)).Return(metric.Counter(5), errors.New("db error"))
 			},
 		},
 	}
@@ -949,7 +1011,7 @@ func TestUpdateMetricJSONBatch(t *testing.T) {
 				contentType: _http.ContentTypeApplicationJSON,
 			},
 			stgInitFunc: func(s storage.Storage) {
-				s.SetCounterMetric("foo", 123)
+				s.SetCounterMetric("foo", nil, 123)
 			},
 			stgCheckFunc: func() []storage.StorageItem {
 				return []storage.StorageItem{
@@ -973,7 +1035,7 @@ func TestUpdateMetricJSONBatch(t *testing.T) {
 				headers:     map[string][]string{"Content-Encoding": {"gzip"}},
 			},
 			stgInitFunc: func(s storage.Storage) {
-				s.SetCounterMetric("foo", 123)
+				s.SetCounterMetric("foo", nil, 123)
 			},
 			stgCheckFunc: func() []storage.StorageItem {
 				return []storage.StorageItem{
@@ -1003,7 +1065,7 @@ func TestUpdateMetricJSONBatch(t *testing.T) {
 				contentType: _http.ContentTypeApplicationJSON,
 			},
 			stgInitFunc: func(s storage.Storage) {
-				s.SetCounterMetric("foo", 1)
+				s.SetCounterMetric("foo", nil, 1)
 			},
 			stgCheckFunc: func() []storage.StorageItem {
 				return []storage.StorageItem{
@@ -1030,7 +1092,7 @@ func TestUpdateMetricJSONBatch(t *testing.T) {
 				]`)),
 				contentType: strPointer(_http.ContentTypeApplicationJSON),
 				encryption:  true,
-				headers:     map[string][]string{"Accept-Encoding": {"gzip"}, "Content-Encoding": {"gzip"}, "X-Real-IP": {"192.168.0.1"}},
+				headers:     map[string][]string{"Accept-Encoding": {"gzip"}, "Content-Encoding": {"gzip"}, "X-Forwarded-For": {"192.168.0.1"}},
 			},
 			resp: testResponse{
 				code:        http.StatusOK,
@@ -1040,7 +1102,7 @@ func TestUpdateMetricJSONBatch(t *testing.T) {
 			},
 			trustedSubnet: getIPNet("192.168.0.0/16"),
 			stgInitFunc: func(s storage.Storage) {
-				s.SetCounterMetric("foo_enc", 1)
+				s.SetCounterMetric("foo_enc", nil, 1)
 			},
 			stgCheckFunc: func() []storage.StorageItem {
 				return []storage.StorageItem{
@@ -1051,6 +1113,101 @@ func TestUpdateMetricJSONBatch(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "update JSON metric: multiple values, envelope encrypted and gziped",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/updates/",
+				body: bodyGzipReader(encryptEnvelopeString(`[
+					{"id": "bar_env", "type": "gauge", "value": 123.123},
+					{"id": "foo_env", "type": "counter", "delta": 1},
+					{"id": "foo_env", "type": "counter", "delta": 2}
+				]`)),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				encryption:  true,
+				headers:     map[string][]string{"Accept-Encoding": {"gzip"}, "Content-Encoding": {"rsa-aes256gcm, gzip"}},
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `[]`,
+				contentType: _http.ContentTypeApplicationJSON,
+				headers:     map[string][]string{"Content-Encoding": {"gzip"}},
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{
+					{MetricName: "foo_env", Value: metric.Counter(3)},
+					{MetricName: "bar_env", Value: metric.Gauge(123.123)},
+				}
+			},
+		},
+		{
+			name: "update JSON metric: envelope encrypted with key ID",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(encryptEnvelopeString(`[{"id": "bar_env", "type": "gauge", "value": 1}]`)),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				encryption:  true,
+				headers:     map[string][]string{"Content-Encoding": {"rsa-aes256gcm"}, "X-Crypto-Key-ID": {"key2"}},
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `[]`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{
+					{MetricName: "bar_env", Value: metric.Gauge(1)},
+				}
+			},
+		},
+		{
+			name: "update JSON metric: envelope encrypted with other key ID",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(encryptEnvelopeString(`[{"id": "bar_env", "type": "gauge", "value": 1}]`)),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				encryption:  true,
+				headers:     map[string][]string{"Content-Encoding": {"rsa-aes256gcm"}, "X-Crypto-Key-ID": {"key1"}},
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "update JSON metric: envelope encrypted with unknown key ID",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(encryptEnvelopeString(`[{"id": "bar_env", "type": "gauge", "value": 1}]`)),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				encryption:  true,
+				headers:     map[string][]string{"Content-Encoding": {"rsa-aes256gcm"}, "X-Crypto-Key-ID": {"key3"}},
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "update JSON metric: envelope encrypted without content encoding",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(encryptEnvelopeString(`[{"id": "bar_env", "type": "gauge", "value": 1}]`)),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				encryption:  true,
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
 	}
 
 	runTests(t, tests)
@@ -1193,99 +1350,689 @@ func TestUpdateMetricJSONBatchWithHash(t *testing.T) {
 	runTests(t, tests)
 }
 
-func TestUpdateMetricJSONBatchWithHashInDb(t *testing.T) {
+func TestUpdateMetricJSONBatchWithSignature(t *testing.T) {
+	body := `[{"id":"PollCount","type":"counter","delta":5}]`
+	signBody := func(body string, ts time.Time) map[string][]string {
+		sig, err := hash.SignRequest("foobar", "", "POST /updates/", []byte(body), ts)
+		require.NoError(t, err)
+		return map[string][]string{hash.SignatureHeader: {sig}}
+	}
+
+	hmacKeys, _ := hash.ParseKeyRing("foobar", "", "")
+	verifier := hash.NewSignatureVerifier(hmacKeys, hash.DefaultSignatureWindow, false)
+	requiredVerifier := hash.NewSignatureVerifier(hmacKeys, hash.DefaultSignatureWindow, true)
+	replayedHeaders := signBody(body, time.Now())
+	encryptedHeaders := signBody(body, time.Now())
+	encryptedHeaders["Content-Encoding"] = []string{cipher.ContentEncoding + ", gzip"}
+
 	tests := []testItem{
 		{
-			name: "update JSON metric: multiple with correct hash",
+			name: "update JSON metric: correct signature",
 			req: testRequest{
-				method: http.MethodPost,
-				url:    "/updates/",
-				body: bodyStringReader(`[
-					{"id":"Sys","type":"gauge","value":13220880,"hash":"48a93e5dde0297029bf66cc10a1cdda9be6f858667ea885dc1b0d810032aa292"},
-					{"id":"PollCount","type":"counter","delta":5,"hash":"b9203cac5904e73da2504aabfb77a419d3d3f9a0baee3707c55070432c6ff5a8"},
-					{"id":"PollCount","type":"counter","delta":5,"hash":"b9203cac5904e73da2504aabfb77a419d3d3f9a0baee3707c55070432c6ff5a8"}
-				]`),
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(body),
 				contentType: strPointer(_http.ContentTypeApplicationJSON),
-				hmacKey:     strPointer("foobar"),
+				headers:     replayedHeaders,
 			},
 			resp: testResponse{
 				code:        http.StatusOK,
 				body:        `[]`,
 				contentType: _http.ContentTypeApplicationJSON,
 			},
-			dbStg: true,
-			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().
-					SetMetrics([]storage.StorageItem{
-						{MetricName: "Sys", Value: metric.Gauge(13220880)},
-						{MetricName: "PollCount", Value: metric.Counter(5)},
-						{MetricName: "PollCount", Value: metric.Counter(5)},
-					}).
-					Return(nil)
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{{MetricName: "PollCount", Value: metric.Counter(5)}}
 			},
+			signVerifier: verifier,
 		},
 		{
-			name: "update JSON metric: multiple with correct hash db error",
+			name: "update JSON metric: replayed signature",
 			req: testRequest{
-				method: http.MethodPost,
-				url:    "/updates/",
-				body: bodyStringReader(`[
-					{"id":"Sys","type":"gauge","value":13220880,"hash":"48a93e5dde0297029bf66cc10a1cdda9be6f858667ea885dc1b0d810032aa292"},
-					{"id":"PollCount","type":"counter","delta":5,"hash":"b9203cac5904e73da2504aabfb77a419d3d3f9a0baee3707c55070432c6ff5a8"},
-					{"id":"PollCount","type":"counter","delta":5,"hash":"b9203cac5904e73da2504aabfb77a419d3d3f9a0baee3707c55070432c6ff5a8"}
-				]`),
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(body),
 				contentType: strPointer(_http.ContentTypeApplicationJSON),
-				hmacKey:     strPointer("foobar"),
+				headers:     replayedHeaders,
 			},
 			resp: testResponse{
-				code:        http.StatusInternalServerError,
-				body:        http.StatusText(http.StatusInternalServerError),
+				code: http.StatusUnauthorized,
+			},
+			signVerifier: verifier,
+		},
+		{
+			name: "update JSON metric: stale signature",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(body),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				headers:     signBody(body, time.Now().Add(-time.Hour)),
+			},
+			resp: testResponse{
+				code: http.StatusUnauthorized,
+			},
+			signVerifier: verifier,
+		},
+		{
+			name: "update JSON metric: signature of other body",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(`[{"id":"PollCount","type":"counter","delta":500}]`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				headers:     signBody(body, time.Now()),
+			},
+			resp: testResponse{
+				code: http.StatusUnauthorized,
+			},
+			signVerifier: verifier,
+		},
+		{
+			name: "update JSON metric: no signature, optional",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(body),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `[]`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			signVerifier: verifier,
+		},
+		{
+			name: "update JSON metric: no signature, required",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(body),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+			},
+			resp: testResponse{
+				code: http.StatusUnauthorized,
+			},
+			signVerifier: requiredVerifier,
+		},
+		{
+			name: "update JSON metric: signature of gzipped and encrypted body",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyGzipReader(encryptEnvelopeString(body)),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				headers:     encryptedHeaders,
+				encryption:  true,
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `[]`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{{MetricName: "PollCount", Value: metric.Counter(5)}}
+			},
+			signVerifier: requiredVerifier,
+		},
+		{
+			name: "get metric: read routes are not signed",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/value/counter/PollCount",
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        "5",
 				contentType: _http.ContentTypeTextPlain,
 			},
-			dbStg: true,
-			stgMockFunc: func(ms *mocks.MockStorage) {
-				ms.EXPECT().
-					SetMetrics([]storage.StorageItem{
-						{MetricName: "Sys", Value: metric.Gauge(13220880)},
-						{MetricName: "PollCount", Value: metric.Counter(5)},
-						{MetricName: "PollCount", Value: metric.Counter(5)},
-					}).
-					Return(errors.New("db error"))
+			stgInitFunc: func(stg storage.Storage) {
+				stg.SetCounterMetric("PollCount", nil, 5)
 			},
+			signVerifier: requiredVerifier,
 		},
 	}
 	runTests(t, tests)
 }
 
-func ExampleMetricHandler_UpdateMetric_counter() {
-	// Create HTTP client
-	client := resty.New()
-
-	// Create request object
-	var v int64 = 123
-	req := &metric.MetricsDTO{
-		MType: "counter",
-		ID:    "Counter1",
-		Delta: &v,
-	}
-	var res metric.MetricsDTO
-
-	// Send request
-	_, err := client.R().
-		SetBody(req).
-		SetResult(&res).
-		Post("http://localhost:8080/update/")
-
-	if err != nil {
-		panic(err)
-	}
+func TestUpdateMetricJSONBatchWithHmacKeyRing(t *testing.T) {
+	hmacKeys, err := hash.NewKeyRing(map[string]string{"old": "foobar", "new": "barfoo"}, "new")
+	require.NoError(t, err)
 
-	fmt.Println(res)
-}
+	oldHash := metric.Counter(5).Hmac("PollCount", nil, "foobar")
+	body := fmt.Sprintf(`[{"id":"PollCount","type":"counter","delta":5,"hash":"%s"}]`, oldHash)
 
-func ExampleMetricHandler_UpdateMetric_gauge() {
-	// Create HTTP client
-	client := resty.New()
+	tests := []testItem{
+		{
+			name: "update JSON metric: hash of not primary key",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(body),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `[]`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{{MetricName: "PollCount", Value: metric.Counter(5)}}
+			},
+			hmacKeys: hmacKeys,
+		},
+		{
+			name: "update JSON metric: hash with key ID",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(body),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				headers:     map[string][]string{hash.KeyIDHeader: {"old"}},
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `[]`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			hmacKeys: hmacKeys,
+		},
+		{
+			name: "update JSON metric: hash of other key ID",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(body),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				headers:     map[string][]string{hash.KeyIDHeader: {"new"}},
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			hmacKeys: hmacKeys,
+		},
+		{
+			name: "update JSON metric: unknown key ID",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(body),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				headers:     map[string][]string{hash.KeyIDHeader: {"revoked"}},
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			hmacKeys: hmacKeys,
+		},
+		{
+			name: "update JSON metric: response signed with primary key",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/update/",
+				body:        bodyStringReader(strings.TrimSuffix(strings.TrimPrefix(body, "["), "]")),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+			},
+			resp: testResponse{
+				code: http.StatusOK,
+				body: fmt.Sprintf(`{"id":"PollCount","type":"counter","delta":5,"hash":"%s"}`,
+					metric.Counter(5).Hmac("PollCount", nil, "barfoo")),
+				contentType: _http.ContentTypeApplicationJSON,
+				headers:     map[string][]string{http.CanonicalHeaderKey(hash.KeyIDHeader): {"new"}},
+			},
+			hmacKeys: hmacKeys,
+		},
+	}
+	runTests(t, tests)
+}
+
+func TestUpdateMetricWithLabels(t *testing.T) {
+	tests := []testItem{
+		{
+			name: "update metric: with URL labels",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/update/gauge/CPUutilization/12.5?label=cpu:3&label=host:a",
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        http.StatusText(http.StatusOK),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{
+					{MetricName: "CPUutilization", Labels: metric.Labels{"cpu": "3", "host": "a"}, Value: metric.Gauge(12.5)},
+				}
+			},
+		},
+		{
+			name: "update metric: incorrect URL label format",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/update/gauge/CPUutilization/12.5?label=cpu",
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "update metric: incorrect URL label name",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/update/gauge/CPUutilization/12.5?label=1cpu:3",
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "update JSON metric: with labels",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/update/",
+				body:        bodyStringReader(`{"id": "foo", "type": "counter", "delta": 3, "labels": {"host": "a"}}`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `{"id": "foo", "type": "counter", "delta": 13, "labels": {"host": "a"}}`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			stgInitFunc: func(s storage.Storage) {
+				s.SetCounterMetric("foo", nil, 1)
+				s.SetCounterMetric("foo", metric.Labels{"host": "a"}, 10)
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{
+					{MetricName: "foo", Value: metric.Counter(1)},
+					{MetricName: "foo", Labels: metric.Labels{"host": "a"}, Value: metric.Counter(13)},
+				}
+			},
+		},
+		{
+			name: "update JSON metric: incorrect labels",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/update/",
+				body:        bodyStringReader(`{"id": "foo", "type": "counter", "delta": 3, "labels": {"host-name": "a"}}`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "update JSON metric: batch with labels and hash",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/updates/",
+				body: bodyStringReader(`[
+					{"id":"PollCount","type":"counter","delta":5,"labels":{"host":"a"},"hash":"0f8a21bdeaf43758b2fdd37b427b08a2db8ebc7c3ca93fbeaca060e82602e316"},
+					{"id":"PollCount","type":"counter","delta":5,"labels":{"host":"a"},"hash":"0f8a21bdeaf43758b2fdd37b427b08a2db8ebc7c3ca93fbeaca060e82602e316"}
+				]`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				hmacKey:     strPointer("foobar"),
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `[]`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{
+					{MetricName: "PollCount", Labels: metric.Labels{"host": "a"}, Value: metric.Counter(10)},
+				}
+			},
+		},
+		{
+			name: "update JSON metric: batch with labels and hash without labels",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/updates/",
+				body: bodyStringReader(`[
+					{"id":"PollCount","type":"counter","delta":5,"labels":{"host":"a"},"hash":"b9203cac5904e73da2504aabfb77a419d3d3f9a0baee3707c55070432c6ff5a8"}
+				]`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				hmacKey:     strPointer("foobar"),
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+	}
+	runTests(t, tests)
+}
+
+func TestUpdateHistogramMetric(t *testing.T) {
+	tests := []testItem{
+		{
+			name: "update metric: histogram",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/update/histogram/latency/bounds=0.1,1;buckets=1,2;sum=1.5;count=3",
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        http.StatusText(http.StatusOK),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			stgInitFunc: func(s storage.Storage) {
+				s.SetHistogramMetric("latency", nil, metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{1, 1}, Sum: 0.1, Count: 1})
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{
+					{MetricName: "latency", Value: metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{2, 3}, Sum: 1.6, Count: 4}},
+				}
+			},
+		},
+		{
+			name: "update metric: incorrect histogram val",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/update/histogram/latency/bounds=1,0.1;buckets=1,2;sum=1.5;count=3",
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "update metric: histogram bounds mismatch",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/update/histogram/latency/bounds=0.5;buckets=1;sum=0.3;count=1",
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			stgInitFunc: func(s storage.Storage) {
+				s.SetHistogramMetric("latency", nil, metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{1, 1}, Sum: 0.1, Count: 1})
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{
+					{MetricName: "latency", Value: metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{1, 1}, Sum: 0.1, Count: 1}},
+				}
+			},
+		},
+		{
+			name: "update JSON metric: histogram",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/update/",
+				body:        bodyStringReader(`{"id": "latency", "type": "histogram", "bounds": [0.1, 1], "buckets": [1, 2], "sum": 1.5, "count": 3}`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `{"id": "latency", "type": "histogram", "bounds": [0.1, 1], "buckets": [2, 3], "sum": 1.6, "count": 4}`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			stgInitFunc: func(s storage.Storage) {
+				s.SetHistogramMetric("latency", nil, metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{1, 1}, Sum: 0.1, Count: 1})
+			},
+		},
+		{
+			name: "update JSON metric: histogram without count",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/update/",
+				body:        bodyStringReader(`{"id": "latency", "type": "histogram", "bounds": [0.1, 1], "buckets": [1, 2], "sum": 1.5}`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "update JSON metric: histogram batch",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/updates/",
+				body: bodyStringReader(`[
+					{"id": "latency", "type": "histogram", "bounds": [1], "buckets": [1], "sum": 0.5, "count": 2},
+					{"id": "latency", "type": "histogram", "bounds": [1], "buckets": [2], "sum": 1.5, "count": 2},
+					{"id": "cnt", "type": "counter", "delta": 1}
+				]`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `[]`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{
+					{MetricName: "cnt", Value: metric.Counter(1)},
+					{MetricName: "latency", Value: metric.Histogram{Bounds: []float64{1}, Buckets: []uint64{3}, Sum: 2, Count: 4}},
+				}
+			},
+		},
+		{
+			name: "update JSON metric: histogram batch bounds mismatch",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/updates/",
+				body: bodyStringReader(`[
+					{"id": "latency", "type": "histogram", "bounds": [1], "buckets": [1], "sum": 0.5, "count": 2},
+					{"id": "latency", "type": "histogram", "bounds": [2], "buckets": [2], "sum": 1.5, "count": 2}
+				]`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+	}
+	runTests(t, tests)
+}
+
+func TestUpdateSummaryMetric(t *testing.T) {
+	s1, _ := metric.NewSummaryFromString("1")
+	s2, _ := metric.NewSummaryFromString("3")
+	s12, _ := s1.Merge(s2)
+
+	tests := []testItem{
+		{
+			name: "update metric: summary",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/update/summary/latency/3",
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        http.StatusText(http.StatusOK),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			stgInitFunc: func(s storage.Storage) {
+				s.SetSummaryMetric("latency", nil, s1)
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{
+					{MetricName: "latency", Value: s12},
+				}
+			},
+		},
+		{
+			name: "update metric: incorrect summary val",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/update/summary/latency/abc",
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "update JSON metric: summary batch",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/updates/",
+				body: bodyStringReader(`[
+					{"id": "latency", "type": "summary", "sketch": {"alpha": 0.01, "positive": {"0": 1}}, "sum": 1, "count": 1},
+					{"id": "latency", "type": "summary", "sketch": {"alpha": 0.01, "positive": {"55": 1}}, "sum": 3, "count": 1}
+				]`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `[]`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{
+					{MetricName: "latency", Value: s12},
+				}
+			},
+		},
+		{
+			name: "update JSON metric: summary count mismatch",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/update/",
+				body:        bodyStringReader(`{"id": "latency", "type": "summary", "sketch": {"alpha": 0.01, "positive": {"0": 1}}, "sum": 1, "count": 2}`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "update JSON metric: summary accuracy mismatch",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/update/",
+				body:        bodyStringReader(`{"id": "latency", "type": "summary", "sketch": {"alpha": 0.05, "positive": {"0": 1}}, "sum": 1, "count": 1}`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			stgInitFunc: func(s storage.Storage) {
+				s.SetSummaryMetric("latency", nil, s1)
+			},
+		},
+	}
+	runTests(t, tests)
+}
+
+func TestUpdateMetricJSONBatchWithHashInDb(t *testing.T) {
+	tests := []testItem{
+		{
+			name: "update JSON metric: multiple with correct hash",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/updates/",
+				body: bodyStringReader(`[
+					{"id":"Sys","type":"gauge","value":13220880,"hash":"48a93e5dde0297029bf66cc10a1cdda9be6f858667ea885dc1b0d810032aa292"},
+					{"id":"PollCount","type":"counter","delta":5,"hash":"b9203cac5904e73da2504aabfb77a419d3d3f9a0baee3707c55070432c6ff5a8"},
+					{"id":"PollCount","type":"counter","delta":5,"hash":"b9203cac5904e73da2504aabfb77a419d3d3f9a0baee3707c55070432c6ff5a8"}
+				]`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				hmacKey:     strPointer("foobar"),
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `[]`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			dbStg: true,
+			stgMockFunc: func(ms *mocks.MockStorage) {
+				ms.EXPECT().
+					SetMetrics([]storage.StorageItem{
+						{MetricName: "Sys", Value: metric.Gauge(13220880)},
+						{MetricName: "PollCount", Value: metric.Counter(5)},
+						{MetricName: "PollCount", Value: metric.Counter(5)},
+					}).
+					Return(nil)
+			},
+		},
+		{
+			name: "update JSON metric: multiple with correct hash db error",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/updates/",
+				body: bodyStringReader(`[
+					{"id":"Sys","type":"gauge","value":13220880,"hash":"48a93e5dde0297029bf66cc10a1cdda9be6f858667ea885dc1b0d810032aa292"},
+					{"id":"PollCount","type":"counter","delta":5,"hash":"b9203cac5904e73da2504aabfb77a419d3d3f9a0baee3707c55070432c6ff5a8"},
+					{"id":"PollCount","type":"counter","delta":5,"hash":"b9203cac5904e73da2504aabfb77a419d3d3f9a0baee3707c55070432c6ff5a8"}
+				]`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				hmacKey:     strPointer("foobar"),
+			},
+			resp: testResponse{
+				code:        http.StatusInternalServerError,
+				body:        http.StatusText(http.StatusInternalServerError),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			dbStg: true,
+			stgMockFunc: func(ms *mocks.MockStorage) {
+				ms.EXPECT().
+					SetMetrics([]storage.StorageItem{
+						{MetricName: "Sys", Value: metric.Gauge(13220880)},
+						{MetricName: "PollCount", Value: metric.Counter(5)},
+						{MetricName: "PollCount", Value: metric.Counter(5)},
+					}).
+					Return(errors.New("db error"))
+			},
+		},
+	}
+	runTests(t, tests)
+}
+
+func ExampleMetricHandler_UpdateMetric_counter() {
+	// Create HTTP client
+	client := resty.New()
+
+	// Create request object
+	var v int64 = 123
+	req := &metric.MetricsDTO{
+		MType: "counter",
+		ID:    "Counter1",
+		Delta: &v,
+	}
+	var res metric.MetricsDTO
+
+	// Send request
+	_, err := client.R().
+		SetBody(req).
+		SetResult(&res).
+		Post("http://localhost:8080/update/")
+
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(res)
+}
+
+func ExampleMetricHandler_UpdateMetric_gauge() {
+	// Create HTTP client
+	client := resty.New()
 
 	// Create request object
 	v := 123.123
@@ -1308,3 +2055,111 @@ func ExampleMetricHandler_UpdateMetric_gauge() {
 
 	fmt.Println(res)
 }
+
+func TestUpdateMetricJSONBatchWithAPIKey(t *testing.T) {
+	authenticator := newTestAuthenticator(t)
+
+	tests := []testItem{
+		{
+			name: "update JSON metric: missing API key",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(`[{"id": "team_a_foo", "type": "gauge", "value": 1.0}]`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+			},
+			resp: testResponse{
+				code:        http.StatusUnauthorized,
+				body:        "",
+				contentType: "",
+				headers:     map[string][]string{"Www-Authenticate": {"Bearer"}},
+			},
+			authenticator: authenticator,
+		},
+		{
+			name: "update JSON metric: unknown API key",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(`[{"id": "team_a_foo", "type": "gauge", "value": 1.0}]`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				headers:     map[string][]string{apikey.AuthorizationHeader: {"Bearer key-x"}},
+			},
+			resp: testResponse{
+				code:        http.StatusUnauthorized,
+				body:        "",
+				contentType: "",
+			},
+			authenticator: authenticator,
+		},
+		{
+			name: "update JSON metric: API key without write scope",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(`[{"id": "team_a_foo", "type": "gauge", "value": 1.0}]`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				headers:     map[string][]string{apikey.KeyHeader: {"key-r"}},
+			},
+			resp: testResponse{
+				code:        http.StatusForbidden,
+				body:        "",
+				contentType: "",
+			},
+			authenticator: authenticator,
+		},
+		{
+			name: "update JSON metric: metric outside of API key prefix",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(`[{"id": "team_a_foo", "type": "gauge", "value": 1.0}, {"id": "team_b_foo", "type": "gauge", "value": 2.0}]`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				headers:     map[string][]string{apikey.AuthorizationHeader: {"Bearer key-a"}},
+			},
+			resp: testResponse{
+				code:        http.StatusForbidden,
+				body:        http.StatusText(http.StatusForbidden),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{}
+			},
+			authenticator: authenticator,
+		},
+		{
+			name: "update JSON metric: metrics inside of API key prefix",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/updates/",
+				body:        bodyStringReader(`[{"id": "team_a_foo", "type": "gauge", "value": 1.0}]`),
+				contentType: strPointer(_http.ContentTypeApplicationJSON),
+				headers:     map[string][]string{apikey.AuthorizationHeader: {"Bearer key-a"}},
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        `[]`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{{MetricName: "team_a_foo", Value: metric.Gauge(1)}}
+			},
+			authenticator: authenticator,
+		},
+		{
+			name: "update metric: metric outside of API key prefix",
+			req: testRequest{
+				method:  http.MethodPost,
+				url:     "/update/gauge/team_b_foo/1",
+				headers: map[string][]string{apikey.AuthorizationHeader: {"Bearer key-a"}},
+			},
+			resp: testResponse{
+				code:        http.StatusForbidden,
+				body:        http.StatusText(http.StatusForbidden),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			authenticator: authenticator,
+		},
+	}
+	runTests(t, tests)
+}
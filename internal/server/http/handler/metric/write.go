@@ -0,0 +1,175 @@
+package metric
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	_http "github.com/devldavydov/promytheus/internal/common/http"
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/server/influx"
+	"github.com/devldavydov/promytheus/internal/server/otlp"
+	"github.com/devldavydov/promytheus/internal/server/remotewrite"
+)
+
+// WriteLineProtocol set new values for metrics in InfluxDB line protocol.
+// Request with incorrect lines is rejected, nothing is saved.
+//
+//	@Summary	Update metrics in InfluxDB line protocol
+//	@Accept		plain
+//	@Produce	json
+//	@Param		message	body	string	true	"Metrics in line protocol, one per line"
+//	@Success	204		"Updated successfully"
+//	@Failure	400		{object}	influx.WriteErrorDTO	"Incorrect lines"
+//	@Failure	403		"Forbidden"
+//	@Failure	500		"Internal error"
+//	@Router		/write [post]
+func (handler *MetricHandler) WriteLineProtocol(rw http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		_http.CreateStatusResponse(rw, http.StatusBadRequest)
+		return
+	}
+
+	items, lineErrs := influx.Parse(body)
+	if len(lineErrs) > 0 {
+		handler.logger.Errorf("Incorrect lines in write request [%s]: %v", req.URL, lineErrs)
+		_http.CreateJSONResponse(rw, http.StatusBadRequest, influx.NewWriteErrorDTO(lineErrs))
+		return
+	}
+
+	// Check API key prefix
+	for _, item := range items {
+		if !writeAllowed(req, item.MetricName) {
+			handler.logger.Errorf("Forbidden write request [%s] by API key prefix", req.URL)
+			_http.CreateStatusResponse(rw, http.StatusForbidden)
+			return
+		}
+	}
+
+	// Save in storage
+	if len(items) > 0 {
+		err = handler.storage.SetMetrics(items)
+		if errors.Is(err, metric.ErrWrongMetricValue) {
+			handler.logger.Errorf("Incorrect write request [%s], err: %v", req.URL, err)
+			CreateResponseOnRequestError(rw, err)
+			return
+		}
+
+		if err != nil {
+			handler.logger.Errorf("Write error on request [%s], err: %v", req.URL, err)
+			_http.CreateStatusResponse(rw, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// RemoteWrite set new values for metrics from Prometheus remote_write request.
+//
+//	@Summary	Update metrics with Prometheus remote_write protocol
+//	@Accept		application/x-protobuf
+//	@Param		message	body	string	true	"Snappy compressed protobuf WriteRequest"
+//	@Success	204		"Updated successfully"
+//	@Failure	400		"Bad request"
+//	@Failure	403		"Forbidden"
+//	@Failure	500		"Internal error"
+//	@Router		/api/v1/write [post]
+func (handler *MetricHandler) RemoteWrite(rw http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		_http.CreateStatusResponse(rw, http.StatusBadRequest)
+		return
+	}
+
+	writeReq, err := remotewrite.Decode(body)
+	if err != nil {
+		handler.logger.Errorf("Incorrect remote write request [%s], err: %v", req.URL, err)
+		_http.CreateStatusResponse(rw, http.StatusBadRequest)
+		return
+	}
+
+	// Check API key prefix
+	if !writeAllowed(req, remotewrite.MetricNames(writeReq)...) {
+		handler.logger.Errorf("Forbidden remote write request [%s] by API key prefix", req.URL)
+		_http.CreateStatusResponse(rw, http.StatusForbidden)
+		return
+	}
+
+	err = handler.remoteWrite.Write(writeReq)
+	if errors.Is(err, remotewrite.ErrWrongRequest) || errors.Is(err, metric.ErrWrongMetricValue) {
+		handler.logger.Errorf("Incorrect remote write request [%s], err: %v", req.URL, err)
+		_http.CreateStatusResponse(rw, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		handler.logger.Errorf("Remote write error on request [%s], err: %v", req.URL, err)
+		_http.CreateStatusResponse(rw, http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// OTLPMetrics set new values for metrics from OpenTelemetry OTLP/HTTP export
+// request in protobuf or JSON format. Response is in request format,
+// rejected data points are reported in partial success.
+//
+//	@Summary	Update metrics with OpenTelemetry OTLP/HTTP protocol
+//	@Accept		application/x-protobuf,json
+//	@Produce	application/x-protobuf,json
+//	@Param		message	body	string	true	"ExportMetricsServiceRequest"
+//	@Success	200		"ExportMetricsServiceResponse"
+//	@Failure	400		"Bad request"
+//	@Failure	403		"Forbidden"
+//	@Failure	415		"Unsupported content type"
+//	@Failure	500		"Internal error"
+//	@Router		/v1/metrics [post]
+func (handler *MetricHandler) OTLPMetrics(rw http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		_http.CreateStatusResponse(rw, http.StatusBadRequest)
+		return
+	}
+
+	exportReq, contentType, err := otlp.Decode(body, req.Header.Get("Content-Type"))
+	if errors.Is(err, otlp.ErrUnsupportedContentType) {
+		_http.CreateStatusResponse(rw, http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		handler.logger.Errorf("Incorrect OTLP request [%s], err: %v", req.URL, err)
+		_http.CreateStatusResponse(rw, http.StatusBadRequest)
+		return
+	}
+
+	// Check API key prefix
+	if !writeAllowed(req, otlp.MetricNames(exportReq)...) {
+		handler.logger.Errorf("Forbidden OTLP request [%s] by API key prefix", req.URL)
+		_http.CreateStatusResponse(rw, http.StatusForbidden)
+		return
+	}
+
+	exportResp, err := handler.otlp.Write(exportReq)
+	if errors.Is(err, metric.ErrWrongMetricValue) {
+		handler.logger.Errorf("Incorrect OTLP request [%s], err: %v", req.URL, err)
+		_http.CreateStatusResponse(rw, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		handler.logger.Errorf("OTLP write error on request [%s], err: %v", req.URL, err)
+		_http.CreateStatusResponse(rw, http.StatusInternalServerError)
+		return
+	}
+
+	respBody, err := otlp.Encode(exportResp, contentType)
+	if err != nil {
+		handler.logger.Errorf("OTLP response encode error on request [%s], err: %v", req.URL, err)
+		_http.CreateStatusResponse(rw, http.StatusInternalServerError)
+		return
+	}
+
+	_http.CreateResponse(rw, contentType, http.StatusOK, string(respBody))
+}
@@ -0,0 +1,517 @@
+package metric
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/devldavydov/promytheus/internal/common/apikey"
+	_http "github.com/devldavydov/promytheus/internal/common/http"
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/common/snappy"
+	"github.com/devldavydov/promytheus/internal/otlpb"
+	"github.com/devldavydov/promytheus/internal/prompb"
+	"github.com/devldavydov/promytheus/internal/server/mocks"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestWriteLineProtocol(t *testing.T) {
+	tests := []testItem{
+		{
+			name: "write: failed GET request",
+			req: testRequest{
+				method: http.MethodGet,
+				url:    "/write",
+			},
+			resp: testResponse{
+				code:        http.StatusMethodNotAllowed,
+				body:        "",
+				contentType: "",
+			},
+		},
+		{
+			name: "write: correct lines",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/write?db=telegraf",
+				body:   bodyStringReader("cpu,host=a usage=0.5,count=3i 1465839830100400200\ncpu,host=a count=2i"),
+			},
+			resp: testResponse{
+				code:        http.StatusNoContent,
+				body:        "",
+				contentType: "",
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{
+					{MetricName: "cpu_count", Labels: metric.Labels{"host": "a"}, Value: metric.Gauge(2)},
+					{MetricName: "cpu_usage", Labels: metric.Labels{"host": "a"}, Value: metric.Gauge(0.5)},
+				}
+			},
+		},
+		{
+			name: "write: some lines incorrect",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/write",
+				body:   bodyStringReader("cpu usage=abc\ncpu usage=0.5"),
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        `{"error":"write rejected: 1 lines failed","lines":[{"line":1,"error":"incorrect field \"usage\" value: wrong line protocol line"}]}`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{}
+			},
+		},
+		{
+			name: "write: all lines incorrect",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/write",
+				body:   bodyStringReader("cpu"),
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        `{"error":"write rejected: 1 lines failed","lines":[{"line":1,"error":"expected measurement, fields and optional timestamp: wrong line protocol line"}]}`,
+				contentType: _http.ContentTypeApplicationJSON,
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{}
+			},
+		},
+		{
+			name: "write: db err",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/write",
+				body:   bodyStringReader("cpu usage=0.5"),
+			},
+			resp: testResponse{
+				code:        http.StatusInternalServerError,
+				body:        http.StatusText(http.StatusInternalServerError),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			dbStg: true,
+			stgMockFunc: func(ms *mocks.MockStorage) {
+				ms.EXPECT().SetMetrics(gomock.Any()).Return(errors.New("db error"))
+			},
+		},
+	}
+
+	runTests(t, tests)
+}
+
+func TestRemoteWrite(t *testing.T) {
+	body := remoteWriteBody(t, &prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{
+			{
+				Labels:  []*prompb.Label{{Name: "__name__", Value: "requests_total"}, {Name: "job", Value: "api"}},
+				Samples: []*prompb.Sample{{Value: 5, Timestamp: 1000}, {Value: 8, Timestamp: 2000}},
+			},
+			{
+				Labels:  []*prompb.Label{{Name: "__name__", Value: "temperature"}},
+				Samples: []*prompb.Sample{{Value: 21.5, Timestamp: 1000}},
+			},
+		},
+	})
+
+	tests := []testItem{
+		{
+			name: "remote write: correct request",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/api/v1/write",
+				body:        bytes.NewReader(body),
+				contentType: strPointer("application/x-protobuf"),
+			},
+			resp: testResponse{
+				code:        http.StatusNoContent,
+				body:        "",
+				contentType: "",
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{
+					{MetricName: "requests_total", Labels: metric.Labels{"job": "api"}, Value: metric.Counter(8)},
+					{MetricName: "temperature", Value: metric.Gauge(21.5)},
+				}
+			},
+		},
+		{
+			name: "remote write: incorrect body",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/api/v1/write",
+				body:   bodyStringReader("not snappy"),
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "remote write: db err",
+			req: testRequest{
+				method: http.MethodPost,
+				url:    "/api/v1/write",
+				body:   bytes.NewReader(body),
+			},
+			resp: testResponse{
+				code:        http.StatusInternalServerError,
+				body:        http.StatusText(http.StatusInternalServerError),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			dbStg: true,
+			stgMockFunc: func(ms *mocks.MockStorage) {
+				ms.EXPECT().GetCounterMetric("requests_total", metric.Labels{"job": "api"}).Return(metric.Counter(0), storage.ErrMetricNotFound)
+				ms.EXPECT().SetMetrics(gomock.Any()).Return(errors.New("db error"))
+			},
+		},
+	}
+
+	runTests(t, tests)
+}
+
+func TestWriteWithAPIKey(t *testing.T) {
+	authenticator := newTestAuthenticator(t)
+	remoteWriteSeries := func(name string) *prompb.TimeSeries {
+		return &prompb.TimeSeries{
+			Labels:  []*prompb.Label{{Name: "__name__", Value: name}},
+			Samples: []*prompb.Sample{{Value: 21.5, Timestamp: 1000}},
+		}
+	}
+	body := remoteWriteBody(t, &prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{remoteWriteSeries("team_a_temperature")},
+	})
+	outsideBody := remoteWriteBody(t, &prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{remoteWriteSeries("team_a_temperature"), remoteWriteSeries("temperature")},
+	})
+
+	otlpGauge := func(name string) *otlpb.Metric {
+		return &otlpb.Metric{Name: name, Data: &otlpb.Metric_Gauge{Gauge: &otlpb.Gauge{
+			DataPoints: []*otlpb.NumberDataPoint{{Value: &otlpb.NumberDataPoint_AsDouble{AsDouble: 21.5}}},
+		}}}
+	}
+	otlpBody := func(metrics ...*otlpb.Metric) []byte {
+		data, err := proto.Marshal(&otlpb.ExportMetricsServiceRequest{
+			ResourceMetrics: []*otlpb.ResourceMetrics{{ScopeMetrics: []*otlpb.ScopeMetrics{{Metrics: metrics}}}},
+		})
+		require.NoError(t, err)
+		return data
+	}
+
+	tests := []testItem{
+		{
+			name: "write: lines inside of API key prefix",
+			req: testRequest{
+				method:  http.MethodPost,
+				url:     "/write",
+				body:    bodyStringReader("team_a_cpu usage=0.5"),
+				headers: map[string][]string{apikey.AuthorizationHeader: {"Bearer key-a"}},
+			},
+			resp: testResponse{
+				code:        http.StatusNoContent,
+				body:        "",
+				contentType: "",
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{{MetricName: "team_a_cpu_usage", Value: metric.Gauge(0.5)}}
+			},
+			authenticator: authenticator,
+		},
+		{
+			name: "write: line outside of API key prefix",
+			req: testRequest{
+				method:  http.MethodPost,
+				url:     "/write",
+				body:    bodyStringReader("team_a_cpu usage=0.5\ncpu usage=0.5"),
+				headers: map[string][]string{apikey.AuthorizationHeader: {"Bearer key-a"}},
+			},
+			resp: testResponse{
+				code:        http.StatusForbidden,
+				body:        http.StatusText(http.StatusForbidden),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{}
+			},
+			authenticator: authenticator,
+		},
+		{
+			name: "remote write: series inside of API key prefix",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/api/v1/write",
+				body:        bytes.NewReader(body),
+				contentType: strPointer("application/x-protobuf"),
+				headers:     map[string][]string{apikey.AuthorizationHeader: {"Bearer key-a"}},
+			},
+			resp: testResponse{
+				code:        http.StatusNoContent,
+				body:        "",
+				contentType: "",
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{{MetricName: "team_a_temperature", Value: metric.Gauge(21.5)}}
+			},
+			authenticator: authenticator,
+		},
+		{
+			name: "remote write: series outside of API key prefix",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/api/v1/write",
+				body:        bytes.NewReader(outsideBody),
+				contentType: strPointer("application/x-protobuf"),
+				headers:     map[string][]string{apikey.AuthorizationHeader: {"Bearer key-a"}},
+			},
+			resp: testResponse{
+				code:        http.StatusForbidden,
+				body:        http.StatusText(http.StatusForbidden),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{}
+			},
+			authenticator: authenticator,
+		},
+		{
+			name: "otlp: metrics inside of API key prefix",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/v1/metrics",
+				body:        bytes.NewReader(otlpBody(otlpGauge("team_a_temperature"))),
+				contentType: strPointer("application/x-protobuf"),
+				headers:     map[string][]string{apikey.AuthorizationHeader: {"Bearer key-a"}},
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        "",
+				contentType: "application/x-protobuf",
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{{MetricName: "team_a_temperature", Value: metric.Gauge(21.5)}}
+			},
+			authenticator: authenticator,
+		},
+		{
+			name: "otlp: metric outside of API key prefix",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/v1/metrics",
+				body:        bytes.NewReader(otlpBody(otlpGauge("team_a_temperature"), otlpGauge("temperature"))),
+				contentType: strPointer("application/x-protobuf"),
+				headers:     map[string][]string{apikey.AuthorizationHeader: {"Bearer key-a"}},
+			},
+			resp: testResponse{
+				code:        http.StatusForbidden,
+				body:        http.StatusText(http.StatusForbidden),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{}
+			},
+			authenticator: authenticator,
+		},
+	}
+
+	runTests(t, tests)
+}
+
+func TestWriteWithCryptoKeys(t *testing.T) {
+	remoteWrite := remoteWriteBody(t, &prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{{
+			Labels:  []*prompb.Label{{Name: "__name__", Value: "temperature"}},
+			Samples: []*prompb.Sample{{Value: 21.5, Timestamp: 1000}},
+		}},
+	})
+	otlpJSON := `{"resourceMetrics":[{"scopeMetrics":[{"metrics":[` +
+		`{"name":"temperature","gauge":{"dataPoints":[{"asDouble":21.5}]}}` +
+		`]}]}]}`
+	stgCheck := func(name string) func() []storage.StorageItem {
+		return func() []storage.StorageItem {
+			return []storage.StorageItem{{MetricName: name, Value: metric.Gauge(21.5)}}
+		}
+	}
+
+	// Server with crypto keys accepts not encrypted body of ingest endpoints
+	tests := []testItem{
+		{
+			name: "write with crypto keys: line protocol",
+			req: testRequest{
+				method:     http.MethodPost,
+				url:        "/write",
+				body:       bodyStringReader("room temperature=21.5"),
+				encryption: true,
+			},
+			resp: testResponse{
+				code:        http.StatusNoContent,
+				body:        "",
+				contentType: "",
+			},
+			stgCheckFunc: stgCheck("room_temperature"),
+		},
+		{
+			name: "write with crypto keys: remote write",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/api/v1/write",
+				body:        bytes.NewReader(remoteWrite),
+				contentType: strPointer("application/x-protobuf"),
+				encryption:  true,
+			},
+			resp: testResponse{
+				code:        http.StatusNoContent,
+				body:        "",
+				contentType: "",
+			},
+			stgCheckFunc: stgCheck("temperature"),
+		},
+		{
+			name: "write with crypto keys: otlp",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/v1/metrics",
+				body:        bodyStringReader(otlpJSON),
+				contentType: strPointer("application/json"),
+				encryption:  true,
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        "{}",
+				contentType: "application/json",
+			},
+			stgCheckFunc: stgCheck("temperature"),
+		},
+	}
+
+	runTests(t, tests)
+}
+
+func remoteWriteBody(t *testing.T, req *prompb.WriteRequest) []byte {
+	data, err := proto.Marshal(req)
+	require.NoError(t, err)
+	return snappy.Encode(data)
+}
+
+func TestOTLPMetrics(t *testing.T) {
+	body, err := proto.Marshal(&otlpb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlpb.ResourceMetrics{{
+			Resource: &otlpb.Resource{Attributes: []*otlpb.KeyValue{
+				{Key: "service.name", Value: &otlpb.AnyValue{Value: &otlpb.AnyValue_StringValue{StringValue: "api"}}},
+			}},
+			ScopeMetrics: []*otlpb.ScopeMetrics{{
+				Metrics: []*otlpb.Metric{{
+					Name: "requests",
+					Data: &otlpb.Metric_Sum{Sum: &otlpb.Sum{
+						AggregationTemporality: otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+						IsMonotonic:            true,
+						DataPoints: []*otlpb.NumberDataPoint{
+							{StartTimeUnixNano: 1, Value: &otlpb.NumberDataPoint_AsInt{AsInt: 8}},
+						},
+					}},
+				}},
+			}},
+		}},
+	})
+	require.NoError(t, err)
+
+	jsonBody := `{"resourceMetrics":[{"scopeMetrics":[{"metrics":[` +
+		`{"name":"temperature","gauge":{"dataPoints":[{"asDouble":21.5,"attributes":[{"key":"room","value":{"stringValue":"hall"}}]}]}}` +
+		`]}]}]}`
+
+	tests := []testItem{
+		{
+			name: "otlp: correct protobuf request",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/v1/metrics",
+				body:        bytes.NewReader(body),
+				contentType: strPointer("application/x-protobuf"),
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        "",
+				contentType: "application/x-protobuf",
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{
+					{MetricName: "requests", Labels: metric.Labels{"service_name": "api"}, Value: metric.Counter(8)},
+				}
+			},
+		},
+		{
+			name: "otlp: correct json request",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/v1/metrics",
+				body:        bodyStringReader(jsonBody),
+				contentType: strPointer("application/json"),
+			},
+			resp: testResponse{
+				code:        http.StatusOK,
+				body:        "{}",
+				contentType: "application/json",
+			},
+			stgCheckFunc: func() []storage.StorageItem {
+				return []storage.StorageItem{
+					{MetricName: "temperature", Labels: metric.Labels{"room": "hall"}, Value: metric.Gauge(21.5)},
+				}
+			},
+		},
+		{
+			name: "otlp: unsupported content type",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/v1/metrics",
+				body:        bodyStringReader(jsonBody),
+				contentType: strPointer("text/plain"),
+			},
+			resp: testResponse{
+				code:        http.StatusUnsupportedMediaType,
+				body:        http.StatusText(http.StatusUnsupportedMediaType),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "otlp: incorrect body",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/v1/metrics",
+				body:        bodyStringReader("{"),
+				contentType: strPointer("application/json"),
+			},
+			resp: testResponse{
+				code:        http.StatusBadRequest,
+				body:        http.StatusText(http.StatusBadRequest),
+				contentType: _http.ContentTypeTextPlain,
+			},
+		},
+		{
+			name: "otlp: db err",
+			req: testRequest{
+				method:      http.MethodPost,
+				url:         "/v1/metrics",
+				body:        bytes.NewReader(body),
+				contentType: strPointer("application/x-protobuf"),
+			},
+			resp: testResponse{
+				code:        http.StatusInternalServerError,
+				body:        http.StatusText(http.StatusInternalServerError),
+				contentType: _http.ContentTypeTextPlain,
+			},
+			dbStg: true,
+			stgMockFunc: func(ms *mocks.MockStorage) {
+				ms.EXPECT().GetCounterMetric("requests", metric.Labels{"service_name": "api"}).Return(metric.Counter(0), storage.ErrMetricNotFound)
+				ms.EXPECT().SetMetrics(gomock.Any()).Return(errors.New("db error"))
+			},
+		},
+	}
+
+	runTests(t, tests)
+}
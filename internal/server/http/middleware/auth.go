@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/devldavydov/promytheus/internal/common/apikey"
+)
+
+// Auth is a middleware to authenticate API key of request and check its
+// scope. Authenticated key is stored in request context.
+type Auth struct {
+	authenticator *apikey.Authenticator
+	scope         apikey.Scope
+}
+
+func NewAuth(authenticator *apikey.Authenticator, scope apikey.Scope) *Auth {
+	return &Auth{authenticator: authenticator, scope: scope}
+}
+
+func (a *Auth) Handle(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if a.authenticator == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := a.authenticator.Authenticate(apikey.KeyFromHeaders(
+			r.Header.Get(apikey.AuthorizationHeader),
+			r.Header.Get(apikey.KeyHeader)))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if !key.HasScope(a.scope) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(apikey.NewContext(r.Context(), key)))
+	}
+	return http.HandlerFunc(fn)
+}
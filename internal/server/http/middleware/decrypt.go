@@ -3,26 +3,49 @@ package middleware
 import (
 	"crypto/rsa"
 	"net/http"
+	"strings"
 
 	"github.com/devldavydov/promytheus/internal/common/cipher"
+	_http "github.com/devldavydov/promytheus/internal/common/http"
 )
 
-// Decrypt is a RSA decryption middleware.
+// Decrypt is a RSA decryption middleware. Body with envelope Content-Encoding
+// is decrypted as RSA+AES-GCM envelope, other bodies as chunked RSA-OAEP
+// of old agents. Body is decrypted with key from key ID header or, without
+// header, with every key in turn.
 type Decrypt struct {
-	privKey *rsa.PrivateKey
+	keyRing *cipher.KeyRing
 }
 
-func NewDecrpyt(privKey *rsa.PrivateKey) *Decrypt {
-	return &Decrypt{privKey: privKey}
+func NewDecrpyt(keyRing *cipher.KeyRing) *Decrypt {
+	return &Decrypt{keyRing: keyRing}
 }
 
 func (d *Decrypt) Handle(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		if d.privKey != nil {
-			r.Body = cipher.NewDecReader(d.privKey, r.Body)
+		if d.keyRing != nil {
+			privKeys := d.keyRing.Keys()
+			if keyID := r.Header.Get(cipher.KeyIDHeader); keyID != "" {
+				privKey, ok := d.keyRing.Get(keyID)
+				if !ok {
+					_http.CreateStatusResponse(w, http.StatusBadRequest)
+					return
+				}
+				privKeys = []*rsa.PrivateKey{privKey}
+			}
+
+			if isEnvelopeEncoded(r.Header) {
+				r.Body = cipher.NewDecReaderKeys(privKeys, r.Body)
+			} else {
+				r.Body = cipher.NewLegacyDecReaderKeys(privKeys, r.Body)
+			}
 		}
 
 		next.ServeHTTP(w, r)
 	}
 	return http.HandlerFunc(fn)
 }
+
+func isEnvelopeEncoded(header http.Header) bool {
+	return strings.Contains(header.Get("Content-Encoding"), cipher.ContentEncoding)
+}
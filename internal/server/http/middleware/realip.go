@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/devldavydov/promytheus/internal/common/nettools"
+)
+
+// RealIP is a middleware to set RemoteAddr to client IP. X-Forwarded-For
+// header is honoured only for requests from trusted proxies.
+type RealIP struct {
+	trustedProxies []*net.IPNet
+}
+
+func NewRealIP(trustedProxies []*net.IPNet) *RealIP {
+	return &RealIP{trustedProxies: trustedProxies}
+}
+
+func (ri *RealIP) Handle(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ip := nettools.ClientIP(
+			r.RemoteAddr,
+			ri.trustedProxies,
+			strings.Join(r.Header.Values(nettools.ForwardedForHeader), ","))
+		if ip != nil {
+			r.RemoteAddr = ip.String()
+		}
+
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
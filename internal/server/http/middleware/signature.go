@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/devldavydov/promytheus/internal/common/hash"
+)
+
+// Signature is a middleware to check request signature over method, URI and
+// body. Body is checked after decompression and decryption.
+type Signature struct {
+	verifier *hash.SignatureVerifier
+}
+
+func NewSignature(verifier *hash.SignatureVerifier) *Signature {
+	return &Signature{verifier: verifier}
+}
+
+func (s *Signature) Handle(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if s.verifier == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.Body.Close()
+
+		if err = s.verifier.Verify(r.Header.Get(hash.SignatureHeader), hash.HTTPRequestTarget(r), body); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
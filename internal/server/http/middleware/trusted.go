@@ -3,25 +3,26 @@ package middleware
 import (
 	"net"
 	"net/http"
+
+	"github.com/devldavydov/promytheus/internal/common/acl"
 )
 
-// Trusted is a middleware to check RemoteAddr according to trusted network.
+// Trusted is a middleware to check RemoteAddr according to ACL policy of
+// route group.
 type Trusted struct {
-	trustedNetwork *net.IPNet
+	policy *acl.Policy
+	group  acl.Group
 }
 
-func NewTrusted(trustedNetwork *net.IPNet) *Trusted {
-	return &Trusted{trustedNetwork: trustedNetwork}
+func NewTrusted(policy *acl.Policy, group acl.Group) *Trusted {
+	return &Trusted{policy: policy, group: group}
 }
 
 func (t *Trusted) Handle(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		if t.trustedNetwork != nil {
-			remoteIP := net.ParseIP(r.RemoteAddr)
-			if !t.trustedNetwork.Contains(remoteIP) {
-				w.WriteHeader(http.StatusForbidden)
-				return
-			}
+		if !t.policy.Allowed(t.group, net.ParseIP(r.RemoteAddr)) {
+			w.WriteHeader(http.StatusForbidden)
+			return
 		}
 
 		next.ServeHTTP(w, r)
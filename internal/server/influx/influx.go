@@ -0,0 +1,193 @@
+// Package influx provides InfluxDB line protocol parser.
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+)
+
+// ErrWrongLine - error for incorrect line protocol line.
+var ErrWrongLine = errors.New("wrong line protocol line")
+
+// LineError - parse error of single line.
+type LineError struct {
+	Line int    `json:"line"`  // line number, starting from 1
+	Err  string `json:"error"` // error description
+}
+
+// WriteErrorDTO - response for write request with incorrect lines.
+type WriteErrorDTO struct {
+	Error string      `json:"error"` // error summary
+	Lines []LineError `json:"lines"` // incorrect lines
+}
+
+// NewWriteErrorDTO returns WriteErrorDTO for line errors.
+func NewWriteErrorDTO(errs []LineError) WriteErrorDTO {
+	return WriteErrorDTO{Error: fmt.Sprintf("write rejected: %d lines failed", len(errs)), Lines: errs}
+}
+
+// Parse converts line protocol data to storage items. Every field becomes
+// metric named measurement_field with tags as labels: numeric fields
+// (float or integer with i or u suffix) and boolean fields are gauges,
+// string fields are ignored. Integer field may be current value as well
+// as cumulative counter, so it is stored as is. Timestamp is validated
+// only, metrics are stored with receive time. Incorrect lines are skipped
+// and returned as errors.
+func Parse(data []byte) ([]storage.StorageItem, []LineError) {
+	var (
+		items []storage.StorageItem
+		errs  []LineError
+	)
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		lineItems, err := parseLine(line)
+		if err != nil {
+			errs = append(errs, LineError{Line: i + 1, Err: err.Error()})
+			continue
+		}
+		items = append(items, lineItems...)
+	}
+
+	return items, errs
+}
+
+func parseLine(line string) ([]storage.StorageItem, error) {
+	sections := splitUnescaped(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, fmt.Errorf("expected measurement, fields and optional timestamp: %w", ErrWrongLine)
+	}
+
+	if len(sections) == 3 {
+		if _, err := strconv.ParseInt(sections[2], 10, 64); err != nil {
+			return nil, fmt.Errorf("incorrect timestamp %q: %w", sections[2], ErrWrongLine)
+		}
+	}
+
+	series := splitUnescaped(sections[0], ',', false)
+	measurement := unescape(series[0])
+	if measurement == "" {
+		return nil, fmt.Errorf("empty measurement: %w", ErrWrongLine)
+	}
+
+	var labels metric.Labels
+	for _, tag := range series[1:] {
+		kv := splitUnescaped(tag, '=', false)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("incorrect tag %q: %w", tag, ErrWrongLine)
+		}
+		if labels == nil {
+			labels = make(metric.Labels)
+		}
+		labels[metric.SanitizeLabelName(unescape(kv[0]))] = unescape(kv[1])
+	}
+
+	var items []storage.StorageItem
+	for _, field := range splitUnescaped(sections[1], ',', true) {
+		key, value, ok := cutUnescaped(field, '=')
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("incorrect field %q: %w", field, ErrWrongLine)
+		}
+
+		val, err := parseFieldValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect field %q value: %w", key, err)
+		}
+		if val == nil {
+			continue
+		}
+
+		items = append(items, storage.StorageItem{
+			MetricName: metric.SanitizeMetricName(measurement + "_" + unescape(key)),
+			Labels:     labels,
+			Value:      val,
+		})
+	}
+
+	return items, nil
+}
+
+// parseFieldValue returns metric value of field or nil for string field.
+func parseFieldValue(value string) (metric.MetricValue, error) {
+	if value[0] == '"' {
+		if len(value) < 2 || value[len(value)-1] != '"' {
+			return nil, ErrWrongLine
+		}
+		return nil, nil
+	}
+
+	switch value {
+	case "t", "T", "true", "True", "TRUE":
+		return metric.Gauge(1), nil
+	case "f", "F", "false", "False", "FALSE":
+		return metric.Gauge(0), nil
+	}
+
+	switch value[len(value)-1] {
+	case 'i':
+		v, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+		if err != nil {
+			return nil, ErrWrongLine
+		}
+		return metric.Gauge(v), nil
+	case 'u':
+		v, err := strconv.ParseUint(value[:len(value)-1], 10, 64)
+		if err != nil {
+			return nil, ErrWrongLine
+		}
+		return metric.Gauge(v), nil
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, ErrWrongLine
+	}
+	return metric.Gauge(v), nil
+}
+
+// splitUnescaped splits s by sep, which is not escaped with backslash
+// and, if quoted is set, not inside double quotes.
+func splitUnescaped(s string, sep byte, quoted bool) []string {
+	var (
+		parts    []string
+		start    int
+		inQuotes bool
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '"' && quoted:
+			inQuotes = !inQuotes
+		case c == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func cutUnescaped(s string, sep byte) (before, after string, found bool) {
+	parts := splitUnescaped(s, sep, false)
+	if len(parts) < 2 {
+		return s, "", false
+	}
+	return parts[0], s[len(parts[0])+1:], true
+}
+
+var _unescaper = strings.NewReplacer(`\,`, ",", `\=`, "=", `\ `, " ", `\\`, `\`)
+
+func unescape(s string) string {
+	return _unescaper.Replace(s)
+}
@@ -0,0 +1,58 @@
+package influx
+
+import (
+	"testing"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	data := `# comment
+cpu,host=server\ 01,cpu-id=0 usage_idle=98.5,usage_user=1.5 1465839830100400200
+net,host=a bytes_recv=100i,packets=5u,up=true,msg="a, b=c d"
+
+disk free=0.5
+`
+	items, errs := Parse([]byte(data))
+	assert.Empty(t, errs)
+	assert.Equal(t, []storage.StorageItem{
+		{MetricName: "cpu_usage_idle", Labels: metric.Labels{"host": "server 01", "cpu_id": "0"}, Value: metric.Gauge(98.5)},
+		{MetricName: "cpu_usage_user", Labels: metric.Labels{"host": "server 01", "cpu_id": "0"}, Value: metric.Gauge(1.5)},
+		{MetricName: "net_bytes_recv", Labels: metric.Labels{"host": "a"}, Value: metric.Gauge(100)},
+		{MetricName: "net_packets", Labels: metric.Labels{"host": "a"}, Value: metric.Gauge(5)},
+		{MetricName: "net_up", Labels: metric.Labels{"host": "a"}, Value: metric.Gauge(1)},
+		{MetricName: "disk_free", Value: metric.Gauge(0.5)},
+	}, items)
+}
+
+func TestParseEscaped(t *testing.T) {
+	items, errs := Parse([]byte(`my\ cpu,rack\=id=a\,b load\ avg=1`))
+	assert.Empty(t, errs)
+	assert.Equal(t, []storage.StorageItem{
+		{MetricName: "my_cpu_load_avg", Labels: metric.Labels{"rack_id": "a,b"}, Value: metric.Gauge(1)},
+	}, items)
+}
+
+func TestParseLineErrors(t *testing.T) {
+	data := `cpu
+cpu usage=1 abc
+,host=a usage=1
+cpu,host usage=1
+cpu usage=
+cpu usage=abc
+cpu usage=1.5i
+cpu usage=1u,idle=NaN
+cpu usage="abc
+cpu usage=1 1 2
+mem used=-5i`
+
+	items, errs := Parse([]byte(data))
+	assert.Equal(t, []storage.StorageItem{{MetricName: "mem_used", Value: metric.Gauge(-5)}}, items)
+	assert.Len(t, errs, 10)
+	for i, e := range errs {
+		assert.Equal(t, i+1, e.Line)
+		assert.NotEmpty(t, e.Err)
+	}
+}
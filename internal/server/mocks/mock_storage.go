@@ -6,6 +6,7 @@ package mocks
 
 import (
 	reflect "reflect"
+	time "time"
 
 	metric "github.com/devldavydov/promytheus/internal/common/metric"
 	storage "github.com/devldavydov/promytheus/internal/server/storage"
@@ -63,33 +64,78 @@ func (mr *MockStorageMockRecorder) GetAllMetrics() *gomock.Call {
 }
 
 // GetCounterMetric mocks base method.
-func (m *MockStorage) GetCounterMetric(arg0 string) (metric.Counter, error) {
+func (m *MockStorage) GetCounterMetric(arg0 string, arg1 metric.Labels) (metric.Counter, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetCounterMetric", arg0)
+	ret := m.ctrl.Call(m, "GetCounterMetric", arg0, arg1)
 	ret0, _ := ret[0].(metric.Counter)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetCounterMetric indicates an expected call of GetCounterMetric.
-func (mr *MockStorageMockRecorder) GetCounterMetric(arg0 interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) GetCounterMetric(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCounterMetric", reflect.TypeOf((*MockStorage)(nil).GetCounterMetric), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCounterMetric", reflect.TypeOf((*MockStorage)(nil).GetCounterMetric), arg0, arg1)
 }
 
 // GetGaugeMetric mocks base method.
-func (m *MockStorage) GetGaugeMetric(arg0 string) (metric.Gauge, error) {
+func (m *MockStorage) GetGaugeMetric(arg0 string, arg1 metric.Labels) (metric.Gauge, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetGaugeMetric", arg0)
+	ret := m.ctrl.Call(m, "GetGaugeMetric", arg0, arg1)
 	ret0, _ := ret[0].(metric.Gauge)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetGaugeMetric indicates an expected call of GetGaugeMetric.
-func (mr *MockStorageMockRecorder) GetGaugeMetric(arg0 interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) GetGaugeMetric(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGaugeMetric", reflect.TypeOf((*MockStorage)(nil).GetGaugeMetric), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGaugeMetric", reflect.TypeOf((*MockStorage)(nil).GetGaugeMetric), arg0, arg1)
+}
+
+// GetHistogramMetric mocks base method.
+func (m *MockStorage) GetHistogramMetric(arg0 string, arg1 metric.Labels) (metric.Histogram, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistogramMetric", arg0, arg1)
+	ret0, _ := ret[0].(metric.Histogram)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistogramMetric indicates an expected call of GetHistogramMetric.
+func (mr *MockStorageMockRecorder) GetHistogramMetric(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistogramMetric", reflect.TypeOf((*MockStorage)(nil).GetHistogramMetric), arg0, arg1)
+}
+
+// GetMetricRange mocks base method.
+func (m *MockStorage) GetMetricRange(arg0, arg1 string, arg2 metric.Labels, arg3, arg4 time.Time) ([]storage.Sample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMetricRange", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].([]storage.Sample)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMetricRange indicates an expected call of GetMetricRange.
+func (mr *MockStorageMockRecorder) GetMetricRange(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetricRange", reflect.TypeOf((*MockStorage)(nil).GetMetricRange), arg0, arg1, arg2, arg3, arg4)
+}
+
+// GetSummaryMetric mocks base method.
+func (m *MockStorage) GetSummaryMetric(arg0 string, arg1 metric.Labels) (metric.Summary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSummaryMetric", arg0, arg1)
+	ret0, _ := ret[0].(metric.Summary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSummaryMetric indicates an expected call of GetSummaryMetric.
+func (mr *MockStorageMockRecorder) GetSummaryMetric(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSummaryMetric", reflect.TypeOf((*MockStorage)(nil).GetSummaryMetric), arg0, arg1)
 }
 
 // Ping mocks base method.
@@ -107,33 +153,48 @@ func (mr *MockStorageMockRecorder) Ping() *gomock.Call {
 }
 
 // SetCounterMetric mocks base method.
-func (m *MockStorage) SetCounterMetric(arg0 string, arg1 metric.Counter) (metric.Counter, error) {
+func (m *MockStorage) SetCounterMetric(arg0 string, arg1 metric.Labels, arg2 metric.Counter) (metric.Counter, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetCounterMetric", arg0, arg1)
+	ret := m.ctrl.Call(m, "SetCounterMetric", arg0, arg1, arg2)
 	ret0, _ := ret[0].(metric.Counter)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // SetCounterMetric indicates an expected call of SetCounterMetric.
-func (mr *MockStorageMockRecorder) SetCounterMetric(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) SetCounterMetric(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetCounterMetric", reflect.TypeOf((*MockStorage)(nil).SetCounterMetric), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetCounterMetric", reflect.TypeOf((*MockStorage)(nil).SetCounterMetric), arg0, arg1, arg2)
 }
 
 // SetGaugeMetric mocks base method.
-func (m *MockStorage) SetGaugeMetric(arg0 string, arg1 metric.Gauge) (metric.Gauge, error) {
+func (m *MockStorage) SetGaugeMetric(arg0 string, arg1 metric.Labels, arg2 metric.Gauge) (metric.Gauge, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetGaugeMetric", arg0, arg1)
+	ret := m.ctrl.Call(m, "SetGaugeMetric", arg0, arg1, arg2)
 	ret0, _ := ret[0].(metric.Gauge)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // SetGaugeMetric indicates an expected call of SetGaugeMetric.
-func (mr *MockStorageMockRecorder) SetGaugeMetric(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) SetGaugeMetric(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetGaugeMetric", reflect.TypeOf((*MockStorage)(nil).SetGaugeMetric), arg0, arg1, arg2)
+}
+
+// SetHistogramMetric mocks base method.
+func (m *MockStorage) SetHistogramMetric(arg0 string, arg1 metric.Labels, arg2 metric.Histogram) (metric.Histogram, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetHistogramMetric", arg0, arg1, arg2)
+	ret0, _ := ret[0].(metric.Histogram)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetHistogramMetric indicates an expected call of SetHistogramMetric.
+func (mr *MockStorageMockRecorder) SetHistogramMetric(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetGaugeMetric", reflect.TypeOf((*MockStorage)(nil).SetGaugeMetric), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetHistogramMetric", reflect.TypeOf((*MockStorage)(nil).SetHistogramMetric), arg0, arg1, arg2)
 }
 
 // SetMetrics mocks base method.
@@ -149,3 +210,18 @@ func (mr *MockStorageMockRecorder) SetMetrics(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMetrics", reflect.TypeOf((*MockStorage)(nil).SetMetrics), arg0)
 }
+
+// SetSummaryMetric mocks base method.
+func (m *MockStorage) SetSummaryMetric(arg0 string, arg1 metric.Labels, arg2 metric.Summary) (metric.Summary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetSummaryMetric", arg0, arg1, arg2)
+	ret0, _ := ret[0].(metric.Summary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetSummaryMetric indicates an expected call of SetSummaryMetric.
+func (mr *MockStorageMockRecorder) SetSummaryMetric(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSummaryMetric", reflect.TypeOf((*MockStorage)(nil).SetSummaryMetric), arg0, arg1, arg2)
+}
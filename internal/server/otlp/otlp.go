@@ -0,0 +1,363 @@
+// Package otlp provides OpenTelemetry OTLP/HTTP metrics receiver.
+package otlp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/otlpb"
+	"github.com/devldavydov/promytheus/internal/server/cumulative"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Supported request content types.
+const (
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeJSON     = "application/json"
+)
+
+var (
+	// ErrWrongRequest - error for incorrect OTLP request.
+	ErrWrongRequest = errors.New("wrong OTLP request")
+	// ErrUnsupportedContentType - error for request content type other than protobuf or JSON.
+	ErrUnsupportedContentType = errors.New("unsupported content type")
+)
+
+// Receiver converts OTLP metrics export requests to storage items.
+//
+// Labels of data point are resource attributes and data point attributes,
+// latter win on name conflict. Gauge is stored as gauge, monotonic Sum as
+// counter, non-monotonic Sum as gauge and Histogram as histogram. Storage
+// counters and histograms accumulate deltas, so delta temporality values
+// are stored as is and cumulative ones are converted with
+// cumulative.Tracker, using start time for reset detection. Delta
+// non-monotonic Sum is added to current gauge value.
+type Receiver struct {
+	tracker *cumulative.Tracker
+}
+
+// NewReceiver - constructor for Receiver.
+func NewReceiver(stg storage.Storage) *Receiver {
+	return &Receiver{tracker: cumulative.NewTracker(stg)}
+}
+
+// Decode returns export request from body in protobuf or JSON format and
+// content type for response.
+func Decode(body []byte, contentType string) (*otlpb.ExportMetricsServiceRequest, string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, "", fmt.Errorf("%q: %w", contentType, ErrUnsupportedContentType)
+	}
+
+	var req otlpb.ExportMetricsServiceRequest
+	switch mediaType {
+	case ContentTypeProtobuf:
+		err = proto.Unmarshal(body, &req)
+	case ContentTypeJSON:
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, &req)
+	default:
+		return nil, "", fmt.Errorf("%q: %w", contentType, ErrUnsupportedContentType)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%v: %w", err, ErrWrongRequest)
+	}
+
+	return &req, mediaType, nil
+}
+
+// Encode returns response in format of content type, returned by Decode.
+func Encode(resp *otlpb.ExportMetricsServiceResponse, contentType string) ([]byte, error) {
+	if contentType == ContentTypeJSON {
+		return protojson.Marshal(resp)
+	}
+	return proto.Marshal(resp)
+}
+
+// MetricNames returns names of request metrics, as they are stored.
+func MetricNames(req *otlpb.ExportMetricsServiceRequest) []string {
+	var names []string
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.Name != "" {
+					names = append(names, metric.SanitizeMetricName(m.Name))
+				}
+			}
+		}
+	}
+	return names
+}
+
+// Write saves request data points in storage. Data points, which can't be
+// stored, are skipped and reported in response partial success.
+func (r *Receiver) Write(req *otlpb.ExportMetricsServiceRequest) (*otlpb.ExportMetricsServiceResponse, error) {
+	resp := &otlpb.ExportMetricsServiceResponse{}
+
+	err := r.tracker.Write(func(b *cumulative.Batch) error {
+		var rejected []string
+
+		for _, rm := range req.ResourceMetrics {
+			resLabels := convertAttributes(nil, rm.GetResource().GetAttributes())
+
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					n, err := convertMetric(b, m, resLabels)
+					if err != nil {
+						if !errors.Is(err, ErrWrongRequest) {
+							return err
+						}
+						if resp.PartialSuccess == nil {
+							resp.PartialSuccess = &otlpb.ExportMetricsPartialSuccess{}
+						}
+						resp.PartialSuccess.RejectedDataPoints += int64(n)
+						rejected = append(rejected, err.Error())
+					}
+				}
+			}
+		}
+
+		if resp.PartialSuccess != nil {
+			resp.PartialSuccess.ErrorMessage = strings.Join(rejected, "; ")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// convertMetric adds metric data points to batch. On error number of
+// rejected data points is returned.
+func convertMetric(b *cumulative.Batch, m *otlpb.Metric, resLabels metric.Labels) (int, error) {
+	if m.Name == "" {
+		return dataPointsCount(m), fmt.Errorf("metric without name: %w", ErrWrongRequest)
+	}
+
+	name := metric.SanitizeMetricName(m.Name)
+	switch data := m.Data.(type) {
+	case *otlpb.Metric_Gauge:
+		return convertNumberPoints(data.Gauge.DataPoints, func(labels metric.Labels, value float64, _ uint64) error {
+			b.Add(storage.StorageItem{MetricName: name, Labels: labels, Value: metric.Gauge(value)})
+			return nil
+		}, name, resLabels)
+	case *otlpb.Metric_Sum:
+		add, err := sumAdder(b, name, data.Sum)
+		if err != nil {
+			return len(data.Sum.DataPoints), err
+		}
+		return convertNumberPoints(data.Sum.DataPoints, add, name, resLabels)
+	case *otlpb.Metric_Histogram:
+		return convertHistogramPoints(b, name, data.Histogram, resLabels)
+	default:
+		return 0, fmt.Errorf("metric %q: unsupported type: %w", name, ErrWrongRequest)
+	}
+}
+
+func sumAdder(b *cumulative.Batch, name string, sum *otlpb.Sum) (func(metric.Labels, float64, uint64) error, error) {
+	switch {
+	case sum.AggregationTemporality == otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE && sum.IsMonotonic:
+		return func(labels metric.Labels, value float64, startTime uint64) error {
+			if value < 0 {
+				return fmt.Errorf("metric %q: negative counter value: %w", name, ErrWrongRequest)
+			}
+			return b.AddCounter(name, labels, value, startTime)
+		}, nil
+	case sum.AggregationTemporality == otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA && sum.IsMonotonic:
+		return func(labels metric.Labels, value float64, _ uint64) error {
+			if value < 0 {
+				return fmt.Errorf("metric %q: negative counter value: %w", name, ErrWrongRequest)
+			}
+			b.Add(storage.StorageItem{MetricName: name, Labels: labels, Value: metric.Counter(math.Round(value))})
+			return nil
+		}, nil
+	case sum.AggregationTemporality == otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE:
+		return func(labels metric.Labels, value float64, _ uint64) error {
+			b.Add(storage.StorageItem{MetricName: name, Labels: labels, Value: metric.Gauge(value)})
+			return nil
+		}, nil
+	case sum.AggregationTemporality == otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA:
+		return func(labels metric.Labels, value float64, _ uint64) error {
+			return b.AddGaugeDelta(name, labels, value)
+		}, nil
+	default:
+		return nil, fmt.Errorf("metric %q: unspecified temporality: %w", name, ErrWrongRequest)
+	}
+}
+
+func convertNumberPoints(
+	points []*otlpb.NumberDataPoint,
+	add func(labels metric.Labels, value float64, startTime uint64) error,
+	name string,
+	resLabels metric.Labels,
+) (int, error) {
+	var (
+		rejected int
+		lastErr  error
+	)
+
+	for _, p := range points {
+		if p.Flags&uint32(otlpb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0 {
+			continue
+		}
+
+		var value float64
+		switch v := p.Value.(type) {
+		case *otlpb.NumberDataPoint_AsDouble:
+			value = v.AsDouble
+		case *otlpb.NumberDataPoint_AsInt:
+			value = float64(v.AsInt)
+		default:
+			rejected, lastErr = rejected+1, fmt.Errorf("metric %q: data point without value: %w", name, ErrWrongRequest)
+			continue
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			rejected, lastErr = rejected+1, fmt.Errorf("metric %q: value is not finite: %w", name, ErrWrongRequest)
+			continue
+		}
+
+		if err := add(convertAttributes(resLabels, p.Attributes), value, p.StartTimeUnixNano); err != nil {
+			if !errors.Is(err, ErrWrongRequest) {
+				return 0, err
+			}
+			rejected, lastErr = rejected+1, err
+		}
+	}
+
+	return rejected, lastErr
+}
+
+func convertHistogramPoints(b *cumulative.Batch, name string, hist *otlpb.Histogram, resLabels metric.Labels) (int, error) {
+	temporality := hist.AggregationTemporality
+	if temporality != otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE &&
+		temporality != otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA {
+		return len(hist.DataPoints), fmt.Errorf("metric %q: unspecified temporality: %w", name, ErrWrongRequest)
+	}
+
+	var (
+		rejected int
+		lastErr  error
+	)
+
+	for _, p := range hist.DataPoints {
+		if p.Flags&uint32(otlpb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0 {
+			continue
+		}
+
+		h, err := convertHistogram(p)
+		if err != nil {
+			rejected, lastErr = rejected+1, fmt.Errorf("metric %q: %v: %w", name, err, ErrWrongRequest)
+			continue
+		}
+
+		labels := convertAttributes(resLabels, p.Attributes)
+		if temporality == otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA {
+			err = b.AddHistogramDelta(name, labels, h)
+		} else {
+			err = b.AddHistogram(name, labels, h, p.StartTimeUnixNano)
+		}
+		if errors.Is(err, metric.ErrWrongMetricValue) {
+			rejected, lastErr = rejected+1, fmt.Errorf("metric %q: %v: %w", name, err, ErrWrongRequest)
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return rejected, lastErr
+}
+
+// convertHistogram converts OTLP bucket counts, one per bucket with last
+// bucket for values greater than last bound, to cumulative buckets.
+func convertHistogram(p *otlpb.HistogramDataPoint) (metric.Histogram, error) {
+	var buckets []uint64
+	switch len(p.BucketCounts) {
+	case 0:
+		if len(p.ExplicitBounds) != 0 {
+			return metric.Histogram{}, errors.New("bounds without bucket counts")
+		}
+	case len(p.ExplicitBounds) + 1:
+		buckets = make([]uint64, len(p.ExplicitBounds))
+		var total uint64
+		for i, c := range p.BucketCounts {
+			total += c
+			if i < len(buckets) {
+				buckets[i] = total
+			}
+		}
+		if total != p.Count {
+			return metric.Histogram{}, errors.New("bucket counts sum differs from count")
+		}
+	default:
+		return metric.Histogram{}, errors.New("bucket counts and bounds length mismatch")
+	}
+
+	return metric.NewHistogramFromParts(p.ExplicitBounds, buckets, &p.Sum, &p.Count)
+}
+
+// convertAttributes returns copy of base labels with attributes added.
+func convertAttributes(base metric.Labels, attrs []*otlpb.KeyValue) metric.Labels {
+	if len(base) == 0 && len(attrs) == 0 {
+		return nil
+	}
+
+	labels := make(metric.Labels, len(base)+len(attrs))
+	for k, v := range base {
+		labels[k] = v
+	}
+	for _, kv := range attrs {
+		labels[metric.SanitizeLabelName(kv.Key)] = anyValueString(kv.Value)
+	}
+	return labels
+}
+
+func anyValueString(v *otlpb.AnyValue) string {
+	switch val := v.GetValue().(type) {
+	case *otlpb.AnyValue_StringValue:
+		return val.StringValue
+	case *otlpb.AnyValue_BoolValue:
+		return strconv.FormatBool(val.BoolValue)
+	case *otlpb.AnyValue_IntValue:
+		return strconv.FormatInt(val.IntValue, 10)
+	case *otlpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(val.DoubleValue, 'g', -1, 64)
+	case *otlpb.AnyValue_BytesValue:
+		return fmt.Sprintf("%x", val.BytesValue)
+	case *otlpb.AnyValue_ArrayValue:
+		parts := make([]string, 0, len(val.ArrayValue.Values))
+		for _, item := range val.ArrayValue.Values {
+			parts = append(parts, anyValueString(item))
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	case *otlpb.AnyValue_KvlistValue:
+		parts := make([]string, 0, len(val.KvlistValue.Values))
+		for _, kv := range val.KvlistValue.Values {
+			parts = append(parts, kv.Key+"="+anyValueString(kv.Value))
+		}
+		return "{" + strings.Join(parts, ",") + "}"
+	default:
+		return ""
+	}
+}
+
+func dataPointsCount(m *otlpb.Metric) int {
+	switch data := m.Data.(type) {
+	case *otlpb.Metric_Gauge:
+		return len(data.Gauge.DataPoints)
+	case *otlpb.Metric_Sum:
+		return len(data.Sum.DataPoints)
+	case *otlpb.Metric_Histogram:
+		return len(data.Histogram.DataPoints)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,239 @@
+package otlp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/otlpb"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestWriteSum(t *testing.T) {
+	stg := createTestStorage(t)
+	r := NewReceiver(stg)
+
+	write := func(m *otlpb.Metric) {
+		resp, err := r.Write(request(m))
+		require.NoError(t, err)
+		assert.Nil(t, resp.PartialSuccess)
+	}
+
+	// Cumulative monotonic sum - counter deltas, start time change is reset
+	write(sum("requests", otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, true, intPoint(1, 10)))
+	write(sum("requests", otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, true, intPoint(1, 15)))
+	write(sum("requests", otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, true, intPoint(2, 4)))
+	assertValue(t, stg, "requests", metric.Counter(19))
+
+	// Delta monotonic sum - counter increments
+	write(sum("errors", otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, true, intPoint(1, 2), intPoint(2, 3)))
+	assertValue(t, stg, "errors", metric.Counter(5))
+
+	// Cumulative non-monotonic sum - gauge value
+	write(sum("queue", otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, false, doublePoint(7)))
+	write(sum("queue", otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, false, doublePoint(4)))
+	assertValue(t, stg, "queue", metric.Gauge(4))
+
+	// Delta non-monotonic sum - gauge change
+	write(sum("active", otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, false, doublePoint(3), doublePoint(-1)))
+	write(sum("active", otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, false, doublePoint(0.5)))
+	assertValue(t, stg, "active", metric.Gauge(2.5))
+}
+
+func TestWriteGaugeAndHistogram(t *testing.T) {
+	stg := createTestStorage(t)
+	r := NewReceiver(stg)
+
+	gauge := &otlpb.Metric{Name: "temperature", Data: &otlpb.Metric_Gauge{Gauge: &otlpb.Gauge{
+		DataPoints: []*otlpb.NumberDataPoint{doublePoint(21.5)},
+	}}}
+	histogram := func(temporality otlpb.AggregationTemporality, counts []uint64, sum float64) *otlpb.Metric {
+		var count uint64
+		for _, c := range counts {
+			count += c
+		}
+		return &otlpb.Metric{Name: "latency", Data: &otlpb.Metric_Histogram{Histogram: &otlpb.Histogram{
+			AggregationTemporality: temporality,
+			DataPoints: []*otlpb.HistogramDataPoint{{
+				StartTimeUnixNano: 1,
+				Count:             count,
+				Sum:               sum,
+				BucketCounts:      counts,
+				ExplicitBounds:    []float64{1, 5},
+				Attributes:        []*otlpb.KeyValue{stringAttr("job", "node")},
+			}},
+		}}}
+	}
+
+	for _, m := range []*otlpb.Metric{
+		gauge,
+		histogram(otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, []uint64{1, 2, 0}, 5),
+		histogram(otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, []uint64{2, 2, 1}, 12),
+		histogram(otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, []uint64{0, 1, 0}, 2),
+	} {
+		_, err := r.Write(request(m))
+		require.NoError(t, err)
+	}
+
+	assertValue(t, stg, "temperature", metric.Gauge(21.5))
+
+	h, err := stg.GetHistogramMetric("latency", metric.Labels{"service_name": "api", "job": "node"})
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{2, 5}, h.Buckets)
+	assert.Equal(t, uint64(6), h.Count)
+	assert.Equal(t, float64(14), h.Sum)
+}
+
+func TestWritePartialSuccess(t *testing.T) {
+	stg := createTestStorage(t)
+	r := NewReceiver(stg)
+
+	resp, err := r.Write(request(
+		sum("requests", otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED, true, intPoint(1, 1), intPoint(1, 2)),
+		sum("errors", otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, true, intPoint(1, -1), intPoint(1, 3)),
+		&otlpb.Metric{Name: "latency", Data: &otlpb.Metric_Histogram{Histogram: &otlpb.Histogram{
+			AggregationTemporality: otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			DataPoints:             []*otlpb.HistogramDataPoint{{Count: 1, BucketCounts: []uint64{1}, ExplicitBounds: []float64{1}}},
+		}}},
+	))
+	require.NoError(t, err)
+	require.NotNil(t, resp.PartialSuccess)
+	assert.Equal(t, int64(4), resp.PartialSuccess.RejectedDataPoints)
+	assert.Contains(t, resp.PartialSuccess.ErrorMessage, "unspecified temporality")
+
+	assertValue(t, stg, "errors", metric.Counter(3))
+	_, err = stg.GetCounterMetric("requests", metric.Labels{"service_name": "api"})
+	assert.ErrorIs(t, err, storage.ErrMetricNotFound)
+}
+
+func TestWriteHistogramBoundsChange(t *testing.T) {
+	stg := createTestStorage(t)
+	r := NewReceiver(stg)
+
+	histogram := func(temporality otlpb.AggregationTemporality, bounds ...float64) *otlpb.Metric {
+		counts := make([]uint64, len(bounds)+1)
+		counts[0] = 1
+		return &otlpb.Metric{Name: "latency", Data: &otlpb.Metric_Histogram{Histogram: &otlpb.Histogram{
+			AggregationTemporality: temporality,
+			DataPoints: []*otlpb.HistogramDataPoint{{
+				StartTimeUnixNano: 1,
+				Count:             1,
+				Sum:               0.5,
+				BucketCounts:      counts,
+				ExplicitBounds:    bounds,
+			}},
+		}}}
+	}
+
+	resp, err := r.Write(request(histogram(otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, 1, 5)))
+	require.NoError(t, err)
+	assert.Nil(t, resp.PartialSuccess)
+
+	// Histograms with other bounds are rejected, other data points are stored
+	for _, temporality := range []otlpb.AggregationTemporality{
+		otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+		otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+	} {
+		resp, err = r.Write(request(
+			histogram(temporality, 1, 10),
+			sum("requests", otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, true, intPoint(1, 1)),
+		))
+		require.NoError(t, err)
+		require.NotNil(t, resp.PartialSuccess)
+		assert.Equal(t, int64(1), resp.PartialSuccess.RejectedDataPoints)
+		assert.Contains(t, resp.PartialSuccess.ErrorMessage, "histogram bounds mismatch")
+	}
+	assertValue(t, stg, "requests", metric.Counter(2))
+
+	h, err := stg.GetHistogramMetric("latency", metric.Labels{"service_name": "api"})
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 5}, h.Bounds)
+	assert.Equal(t, uint64(1), h.Count)
+}
+
+func TestDecode(t *testing.T) {
+	data, err := proto.Marshal(request(sum("requests", otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, true, intPoint(1, 1))))
+	require.NoError(t, err)
+
+	req, contentType, err := Decode(data, "application/x-protobuf")
+	require.NoError(t, err)
+	assert.Equal(t, ContentTypeProtobuf, contentType)
+	assert.Equal(t, "requests", req.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].Name)
+
+	req, contentType, err = Decode([]byte(`{"resourceMetrics":[{"scopeMetrics":[{"metrics":[`+
+		`{"name":"requests","sum":{"aggregationTemporality":2,"isMonotonic":true,"dataPoints":[{"asInt":"5"}]}}`+
+		`]}]}],"unknownField":1}`), "application/json; charset=utf-8")
+	require.NoError(t, err)
+	assert.Equal(t, ContentTypeJSON, contentType)
+	assert.Equal(t, int64(5), req.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].GetSum().DataPoints[0].GetAsInt())
+
+	_, _, err = Decode([]byte("{"), "application/json")
+	assert.ErrorIs(t, err, ErrWrongRequest)
+	_, _, err = Decode(data, "text/plain")
+	assert.ErrorIs(t, err, ErrUnsupportedContentType)
+}
+
+func TestMetricNames(t *testing.T) {
+	req := request(
+		sum("http.requests", otlpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, true, intPoint(1, 1)),
+		&otlpb.Metric{Name: "temperature"},
+		&otlpb.Metric{})
+	assert.Equal(t, []string{"http_requests", "temperature"}, MetricNames(req))
+}
+
+func request(metrics ...*otlpb.Metric) *otlpb.ExportMetricsServiceRequest {
+	return &otlpb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlpb.ResourceMetrics{{
+			Resource:     &otlpb.Resource{Attributes: []*otlpb.KeyValue{stringAttr("service.name", "api")}},
+			ScopeMetrics: []*otlpb.ScopeMetrics{{Metrics: metrics}},
+		}},
+	}
+}
+
+func sum(name string, temporality otlpb.AggregationTemporality, monotonic bool, points ...*otlpb.NumberDataPoint) *otlpb.Metric {
+	return &otlpb.Metric{Name: name, Data: &otlpb.Metric_Sum{Sum: &otlpb.Sum{
+		DataPoints:             points,
+		AggregationTemporality: temporality,
+		IsMonotonic:            monotonic,
+	}}}
+}
+
+func intPoint(startTime uint64, value int64) *otlpb.NumberDataPoint {
+	return &otlpb.NumberDataPoint{StartTimeUnixNano: startTime, Value: &otlpb.NumberDataPoint_AsInt{AsInt: value}}
+}
+
+func doublePoint(value float64) *otlpb.NumberDataPoint {
+	return &otlpb.NumberDataPoint{StartTimeUnixNano: 1, Value: &otlpb.NumberDataPoint_AsDouble{AsDouble: value}}
+}
+
+func stringAttr(key, value string) *otlpb.KeyValue {
+	return &otlpb.KeyValue{Key: key, Value: &otlpb.AnyValue{Value: &otlpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func assertValue(t *testing.T, stg storage.Storage, name string, exp metric.MetricValue) {
+	labels := metric.Labels{"service_name": "api"}
+
+	var (
+		val metric.MetricValue
+		err error
+	)
+	switch exp.(type) {
+	case metric.Counter:
+		val, err = stg.GetCounterMetric(name, labels)
+	case metric.Gauge:
+		val, err = stg.GetGaugeMetric(name, labels)
+	}
+	require.NoError(t, err, name)
+	assert.Equal(t, exp, val, name)
+}
+
+func createTestStorage(t *testing.T) *storage.MemStorage {
+	stg, err := storage.NewMemStorage(context.TODO(), logrus.New(), storage.NewPersistSettings(0, "", false), storage.NewHistorySettings(0))
+	require.NoError(t, err)
+	t.Cleanup(stg.Close)
+	return stg
+}
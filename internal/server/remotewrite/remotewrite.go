@@ -0,0 +1,144 @@
+// Package remotewrite provides Prometheus remote_write protocol receiver.
+package remotewrite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/common/snappy"
+	"github.com/devldavydov/promytheus/internal/prompb"
+	"github.com/devldavydov/promytheus/internal/server/cumulative"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+	"google.golang.org/protobuf/proto"
+)
+
+// _nameLabel - label with metric name.
+const _nameLabel = "__name__"
+
+// ErrWrongRequest - error for incorrect remote_write request.
+var ErrWrongRequest = errors.New("wrong remote_write request")
+
+// Receiver converts remote_write requests to storage items.
+//
+// Series are stored as counters if metadata reports family as counter or,
+// without metadata, if name has _total suffix; all other series are gauges.
+// Remote_write sends cumulative counter values, while storage counters
+// accumulate deltas, so they are converted with cumulative.Tracker.
+type Receiver struct {
+	tracker *cumulative.Tracker
+
+	mu       sync.Mutex
+	families map[string]bool // metadata family name -> is counter
+}
+
+// NewReceiver - constructor for Receiver.
+func NewReceiver(stg storage.Storage) *Receiver {
+	return &Receiver{
+		tracker:  cumulative.NewTracker(stg),
+		families: make(map[string]bool),
+	}
+}
+
+// Decode returns WriteRequest from snappy compressed body.
+func Decode(body []byte) (*prompb.WriteRequest, error) {
+	data, err := snappy.Decode(body)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrWrongRequest)
+	}
+
+	var req prompb.WriteRequest
+	if err = proto.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrWrongRequest)
+	}
+
+	return &req, nil
+}
+
+// MetricNames returns names of request series, as they are stored.
+func MetricNames(req *prompb.WriteRequest) []string {
+	names := make([]string, 0, len(req.Timeseries))
+	for _, ts := range req.Timeseries {
+		if name, _ := convertLabels(ts.Labels); name != "" {
+			names = append(names, metric.SanitizeMetricName(name))
+		}
+	}
+	return names
+}
+
+// Write saves request samples in storage.
+func (r *Receiver) Write(req *prompb.WriteRequest) error {
+	r.mu.Lock()
+	for _, md := range req.Metadata {
+		r.families[md.MetricFamilyName] = md.Type == prompb.MetricMetadata_COUNTER
+	}
+	r.mu.Unlock()
+
+	return r.tracker.Write(func(b *cumulative.Batch) error {
+		return r.convert(b, req.Timeseries)
+	})
+}
+
+func (r *Receiver) convert(b *cumulative.Batch, series []*prompb.TimeSeries) error {
+	for _, ts := range series {
+		name, labels := convertLabels(ts.Labels)
+		if name == "" {
+			return fmt.Errorf("series without name: %w", ErrWrongRequest)
+		}
+		isCounter := r.isCounter(name)
+		name = metric.SanitizeMetricName(name)
+
+		for _, s := range ts.Samples {
+			// Skip stale markers
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+
+			if !isCounter {
+				b.Add(storage.StorageItem{MetricName: name, Labels: labels, Value: metric.Gauge(s.Value)})
+				continue
+			}
+
+			if s.Value < 0 {
+				continue
+			}
+
+			if err := b.AddCounter(name, labels, s.Value, 0); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *Receiver) isCounter(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if isCounter, ok := r.families[name]; ok {
+		return isCounter
+	}
+	return strings.HasSuffix(name, "_total")
+}
+func convertLabels(pbLabels []*prompb.Label) (string, metric.Labels) {
+	var (
+		name   string
+		labels metric.Labels
+	)
+
+	for _, l := range pbLabels {
+		if l.Name == _nameLabel {
+			name = l.Value
+			continue
+		}
+		if labels == nil {
+			labels = make(metric.Labels, len(pbLabels))
+		}
+		labels[metric.SanitizeLabelName(l.Name)] = l.Value
+	}
+	return name, labels
+}
@@ -0,0 +1,137 @@
+package remotewrite
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/common/snappy"
+	"github.com/devldavydov/promytheus/internal/prompb"
+	"github.com/devldavydov/promytheus/internal/server/mocks"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestWrite(t *testing.T) {
+	stg := createTestStorage(t)
+	r := NewReceiver(stg)
+
+	require.NoError(t, r.Write(&prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{
+			series("http_requests_total", 10, 15),
+			series("cpu_usage", 0.5, 0.7),
+			series("gc_cycles", 3),
+			series("stale_total", math.NaN()),
+		},
+		Metadata: []*prompb.MetricMetadata{
+			{Type: prompb.MetricMetadata_COUNTER, MetricFamilyName: "gc_cycles"},
+		},
+	}))
+
+	assertCounter(t, stg, "http_requests_total", 15)
+	assertCounter(t, stg, "gc_cycles", 3)
+	gauge, err := stg.GetGaugeMetric("cpu_usage", metric.Labels{"job": "node"})
+	require.NoError(t, err)
+	assert.Equal(t, metric.Gauge(0.7), gauge)
+	_, err = stg.GetCounterMetric("stale_total", metric.Labels{"job": "node"})
+	assert.ErrorIs(t, err, storage.ErrMetricNotFound)
+
+	// Cumulative values are converted to deltas, counter reset is stored as is
+	require.NoError(t, r.Write(&prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{
+			series("http_requests_total", 20, 2),
+			series("gc_cycles", 5),
+		},
+	}))
+
+	assertCounter(t, stg, "http_requests_total", 22)
+	assertCounter(t, stg, "gc_cycles", 5)
+}
+
+func TestWriteStoredCounterBaseline(t *testing.T) {
+	stg := createTestStorage(t)
+	_, err := stg.SetCounterMetric("http_requests_total", metric.Labels{"job": "node"}, 100)
+	require.NoError(t, err)
+
+	r := NewReceiver(stg)
+	require.NoError(t, r.Write(&prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{series("http_requests_total", 500, 510)},
+	}))
+
+	assertCounter(t, stg, "http_requests_total", 110)
+}
+
+func TestWriteRetryAfterError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	stg := mocks.NewMockStorage(ctrl)
+	gomock.InOrder(
+		stg.EXPECT().GetCounterMetric("foo_total", metric.Labels{"job": "node"}).Return(metric.Counter(0), storage.ErrMetricNotFound),
+		stg.EXPECT().SetMetrics(gomock.Any()).Return(errors.New("db error")),
+		stg.EXPECT().GetCounterMetric("foo_total", metric.Labels{"job": "node"}).Return(metric.Counter(0), storage.ErrMetricNotFound),
+		stg.EXPECT().SetMetrics([]storage.StorageItem{
+			{MetricName: "foo_total", Labels: metric.Labels{"job": "node"}, Value: metric.Counter(7)},
+		}).Return(nil),
+	)
+
+	r := NewReceiver(stg)
+	req := &prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{series("foo_total", 7)}}
+	assert.Error(t, r.Write(req))
+	assert.NoError(t, r.Write(req))
+}
+
+func TestWriteError(t *testing.T) {
+	r := NewReceiver(createTestStorage(t))
+
+	_, err := Decode([]byte("not snappy"))
+	assert.ErrorIs(t, err, ErrWrongRequest)
+	_, err = Decode(snappy.Encode([]byte{0xff, 0xff}))
+	assert.ErrorIs(t, err, ErrWrongRequest)
+	assert.ErrorIs(t, r.Write(&prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{{Samples: []*prompb.Sample{{Value: 1}}}},
+	}), ErrWrongRequest)
+}
+
+func TestDecode(t *testing.T) {
+	req, err := Decode(encodeRequest(t, &prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{series("node.load", 1), series("up", 1), {}},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"node_load", "up"}, MetricNames(req))
+}
+
+func series(name string, values ...float64) *prompb.TimeSeries {
+	ts := &prompb.TimeSeries{
+		Labels: []*prompb.Label{{Name: _nameLabel, Value: name}, {Name: "job", Value: "node"}},
+	}
+	for i, v := range values {
+		ts.Samples = append(ts.Samples, &prompb.Sample{Value: v, Timestamp: int64(i) * 1000})
+	}
+	return ts
+}
+
+func encodeRequest(t *testing.T, req *prompb.WriteRequest) []byte {
+	data, err := proto.Marshal(req)
+	require.NoError(t, err)
+	return snappy.Encode(data)
+}
+
+func assertCounter(t *testing.T, stg storage.Storage, name string, exp int64) {
+	val, err := stg.GetCounterMetric(name, metric.Labels{"job": "node"})
+	require.NoError(t, err, name)
+	assert.Equal(t, metric.Counter(exp), val, name)
+}
+
+func createTestStorage(t *testing.T) *storage.MemStorage {
+	stg, err := storage.NewMemStorage(context.TODO(), logrus.New(), storage.NewPersistSettings(0, "", false), storage.NewHistorySettings(0))
+	require.NoError(t, err)
+	t.Cleanup(stg.Close)
+	return stg
+}
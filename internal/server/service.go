@@ -2,16 +2,22 @@ package server
 
 import (
 	"context"
-	"crypto/rsa"
 	"fmt"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/devldavydov/promytheus/internal/common/apikey"
 	"github.com/devldavydov/promytheus/internal/common/cipher"
+	"github.com/devldavydov/promytheus/internal/common/hash"
+	"github.com/devldavydov/promytheus/internal/server/graphite"
 	srvgrpc "github.com/devldavydov/promytheus/internal/server/grpc"
 	"github.com/devldavydov/promytheus/internal/server/http/handler/metric"
 	_middleware "github.com/devldavydov/promytheus/internal/server/http/middleware"
+	"github.com/devldavydov/promytheus/internal/server/statsd"
 	"github.com/devldavydov/promytheus/internal/server/storage"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -43,59 +49,130 @@ func (service *Service) Start(ctx context.Context) error {
 	// Create group for servers
 	grp, grpCtx := errgroup.WithContext(ctx)
 
+	// Request signatures verifier is shared to reject replays between protocols
+	signVerifier := service.createSignatureVerifier()
+
+	// Load API keys
+	authenticator, err := service.loadAPIKeys()
+	if err != nil {
+		return fmt.Errorf("failed to load API keys: %w", err)
+	}
+
 	// Start HTTP server
-	service.startHTTPServer(stg, grp, grpCtx)
+	service.startHTTPServer(stg, authenticator, signVerifier, grp, grpCtx)
 
 	// Start GRPC server
 	if service.settings.GRPCAddress != nil {
-		service.startGRPCServer(stg, grp, grpCtx)
+		service.startGRPCServer(stg, authenticator, signVerifier, grp, grpCtx)
+	}
+
+	// Start StatsD server
+	if service.settings.StatsDAddress != nil {
+		service.startStatsDServer(stg, grp, grpCtx)
+	}
+
+	// Start Graphite server
+	if service.settings.GraphiteAddress != nil {
+		service.startGraphiteServer(stg, grp, grpCtx)
 	}
 
 	return grp.Wait()
 }
 
-func (service *Service) loadCryptoPrivKey() (*rsa.PrivateKey, error) {
+func (service *Service) createSignatureVerifier() *hash.SignatureVerifier {
+	if service.settings.HmacKeys == nil {
+		return nil
+	}
+	return hash.NewSignatureVerifier(service.settings.HmacKeys, service.settings.SignWindow, service.settings.SignRequired)
+}
+
+func (service *Service) loadAPIKeys() (*apikey.Authenticator, error) {
+	if service.settings.APIKeysPath == nil {
+		return nil, nil
+	}
+	return apikey.LoadAuthenticator(*service.settings.APIKeysPath)
+}
+
+func (service *Service) loadCryptoKeyRing() (*cipher.KeyRing, error) {
 	if service.settings.CryptoPrivKeyPath == nil {
 		return nil, nil
 	}
-	return cipher.PrivateKeyFromFile(*service.settings.CryptoPrivKeyPath)
+	return cipher.NewKeyRing(*service.settings.CryptoPrivKeyPath)
 }
 
-func (service *Service) createHTTPServer(stg storage.Storage) (*http.Server, error) {
-	// Create decryption middleware
-	cryptoPrivKey, err := service.loadCryptoPrivKey()
-	if err != nil {
-		return nil, err
+// reloadCryptoKeys reloads crypto keys on SIGHUP until context is done.
+func (service *Service) reloadCryptoKeys(ctx context.Context, keyRing *cipher.KeyRing) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+
+	for {
+		select {
+		case <-sigChan:
+			if err := keyRing.Reload(); err != nil {
+				service.logger.Errorf("Failed to reload crypto keys: %v", err)
+				continue
+			}
+			service.logger.Infof("Crypto keys reloaded: %v", keyRing.IDs())
+		case <-ctx.Done():
+			return
+		}
 	}
-	mdlwrDecr := _middleware.NewDecrpyt(cryptoPrivKey)
+}
 
+func (service *Service) createHTTPServer(
+	stg storage.Storage,
+	keyRing *cipher.KeyRing,
+	authenticator *apikey.Authenticator,
+	signVerifier *hash.SignatureVerifier,
+) *http.Server {
 	// Create router
 	router := chi.NewRouter()
-	router.Use(middleware.RealIP, middleware.Logger, middleware.Recoverer, _middleware.Gzip, mdlwrDecr.Handle)
+	router.Use(_middleware.NewRealIP(service.settings.TrustedProxies).Handle, middleware.Logger, middleware.Recoverer, _middleware.Gzip)
 
 	metric.NewHandler(
 		router,
 		stg,
-		service.settings.HmacKey,
-		service.settings.TrustedSubnet,
+		service.settings.HmacKeys,
+		keyRing,
+		service.settings.ACL,
+		authenticator,
+		signVerifier,
 		service.logger,
 	)
 
 	return &http.Server{
-			Addr:    service.settings.HTTPAddress.String(),
-			Handler: router},
-		nil
+		Addr:    service.settings.HTTPAddress.String(),
+		Handler: router}
 }
 
-func (service *Service) startHTTPServer(stg storage.Storage, grp *errgroup.Group, grpCtx context.Context) {
+func (service *Service) startHTTPServer(stg storage.Storage, authenticator *apikey.Authenticator, signVerifier *hash.SignatureVerifier, grp *errgroup.Group, grpCtx context.Context) {
 	grp.Go(func() error {
-		httpServer, err := service.createHTTPServer(stg)
+		keyRing, err := service.loadCryptoKeyRing()
 		if err != nil {
 			return err
 		}
+		if keyRing != nil {
+			service.logger.Infof("Crypto keys loaded: %v", keyRing.IDs())
+			go service.reloadCryptoKeys(grpCtx, keyRing)
+		}
+
+		httpServer := service.createHTTPServer(stg, keyRing, authenticator, signVerifier)
+		if service.settings.HTTPServerTLS != nil {
+			httpServer.TLSConfig, err = service.settings.HTTPServerTLS.Load()
+			if err != nil {
+				return err
+			}
+		}
 
 		errChan := make(chan error)
 		go func(ch chan error) {
+			if httpServer.TLSConfig != nil {
+				service.logger.Infof("HTTPS service started on [%s]", service.settings.HTTPAddress.String())
+				ch <- httpServer.ListenAndServeTLS("", "")
+				return
+			}
+
 			service.logger.Infof("HTTP service started on [%s]", service.settings.HTTPAddress.String())
 			ch <- httpServer.ListenAndServe()
 		}(errChan)
@@ -120,16 +197,18 @@ func (service *Service) startHTTPServer(stg storage.Storage, grp *errgroup.Group
 	})
 }
 
-func (service *Service) startGRPCServer(stg storage.Storage, grp *errgroup.Group, grpCtx context.Context) {
+func (service *Service) startGRPCServer(stg storage.Storage, authenticator *apikey.Authenticator, signVerifier *hash.SignatureVerifier, grp *errgroup.Group, grpCtx context.Context) {
 	grp.Go(func() error {
 		var err error
 
 		var tlsCredentials credentials.TransportCredentials
+		var allowedClients []string
 		if service.settings.GRPCServerTLS != nil {
 			tlsCredentials, err = service.settings.GRPCServerTLS.Load()
 			if err != nil {
 				return err
 			}
+			allowedClients = service.settings.GRPCServerTLS.AllowedClients
 		}
 
 		listen, err := net.Listen("tcp", service.settings.GRPCAddress.String())
@@ -138,9 +217,13 @@ func (service *Service) startGRPCServer(stg storage.Storage, grp *errgroup.Group
 		}
 		grpcSrv, _ := srvgrpc.NewServer(
 			stg,
-			service.settings.HmacKey,
-			service.settings.TrustedSubnet,
+			service.settings.HmacKeys,
+			service.settings.ACL,
+			service.settings.TrustedProxies,
+			authenticator,
+			signVerifier,
 			tlsCredentials,
+			allowedClients,
 			service.logger)
 
 		errChan := make(chan error)
@@ -163,14 +246,85 @@ func (service *Service) startGRPCServer(stg storage.Storage, grp *errgroup.Group
 	})
 }
 
+func (service *Service) startStatsDServer(stg storage.Storage, grp *errgroup.Group, grpCtx context.Context) {
+	grp.Go(func() error {
+		listener, err := statsd.NewListener(
+			service.settings.StatsDAddress.String(),
+			stg,
+			service.settings.ACL,
+			service.logger)
+		if err != nil {
+			return err
+		}
+
+		errChan := make(chan error)
+		go func(ch chan error) {
+			service.logger.Infof("StatsD service started on [%s]", service.settings.StatsDAddress.String())
+			ch <- listener.Serve()
+		}(errChan)
+
+		select {
+		case err := <-errChan:
+			return fmt.Errorf("StatsD service exited with err: %w", err)
+		case <-grpCtx.Done():
+			service.logger.Infof("StatsD service context canceled")
+
+			if err := listener.Close(); err != nil {
+				return fmt.Errorf("StatsD service shutdown err: %w", err)
+			}
+
+			service.logger.Info("StatsD service finished")
+			return nil
+		}
+	})
+}
+
+func (service *Service) startGraphiteServer(stg storage.Storage, grp *errgroup.Group, grpCtx context.Context) {
+	grp.Go(func() error {
+		listener, err := graphite.NewListener(
+			service.settings.GraphiteAddress.String(),
+			stg,
+			service.settings.GraphiteTemplates,
+			service.settings.ACL,
+			service.logger)
+		if err != nil {
+			return err
+		}
+
+		errChan := make(chan error)
+		go func(ch chan error) {
+			service.logger.Infof("Graphite service started on [%s]", service.settings.GraphiteAddress.String())
+			ch <- listener.Serve()
+		}(errChan)
+
+		select {
+		case err := <-errChan:
+			return fmt.Errorf("Graphite service exited with err: %w", err)
+		case <-grpCtx.Done():
+			service.logger.Infof("Graphite service context canceled")
+
+			ctx, cancel := context.WithTimeout(context.Background(), service.shutdownTimeout)
+			defer cancel()
+
+			err := listener.Shutdown(ctx)
+			if err != nil {
+				return fmt.Errorf("Graphite service shutdown err: %w", err)
+			}
+
+			service.logger.Info("Graphite service finished")
+			return nil
+		}
+	})
+}
+
 func (service *Service) createStorage(ctx context.Context) (storage.Storage, error) {
 	var stg storage.Storage
 	var err error
 
 	if service.settings.DatabaseDsn == "" {
-		stg, err = storage.NewMemStorage(ctx, service.logger, service.settings.PersistSettings)
+		stg, err = storage.NewMemStorage(ctx, service.logger, service.settings.PersistSettings, service.settings.HistorySettings)
 	} else {
-		stg, err = storage.NewPgStorage(service.settings.DatabaseDsn, service.logger)
+		stg, err = storage.NewPgStorage(service.settings.DatabaseDsn, service.logger, service.settings.HistorySettings)
 	}
 
 	return stg, err
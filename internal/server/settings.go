@@ -2,51 +2,94 @@ package server
 
 import (
 	"net"
+	"time"
 
+	"github.com/devldavydov/promytheus/internal/common/acl"
+	"github.com/devldavydov/promytheus/internal/common/hash"
 	"github.com/devldavydov/promytheus/internal/common/nettools"
+	"github.com/devldavydov/promytheus/internal/common/tlsconfig"
 	"github.com/devldavydov/promytheus/internal/grpc/gtls"
+	"github.com/devldavydov/promytheus/internal/server/graphite"
 	"github.com/devldavydov/promytheus/internal/server/storage"
 )
 
 type ServiceSettings struct {
 	HTTPAddress       nettools.Address
+	HTTPServerTLS     *tlsconfig.ServerSettings
 	DatabaseDsn       string
 	PersistSettings   storage.PersistSettings
-	HmacKey           *string
+	HistorySettings   storage.HistorySettings
+	HmacKeys          *hash.KeyRing
 	CryptoPrivKeyPath *string
 	TrustedSubnet     *net.IPNet
+	ACL               *acl.Policy
+	APIKeysPath       *string
+	TrustedProxies    []*net.IPNet
 	GRPCAddress       *nettools.Address
 	GRPCServerTLS     *gtls.TLSServerSettings
+	StatsDAddress     *nettools.Address
+	GraphiteAddress   *nettools.Address
+	GraphiteTemplates []graphite.Template
+	SignWindow        time.Duration
+	SignRequired      bool
 }
 
 func NewServiceSettings(
 	httpAddress nettools.Address,
-	hmacKey string,
+	httpServerTLS *tlsconfig.ServerSettings,
+	hmacKeys *hash.KeyRing,
 	databaseDsn string,
 	persistSettimgs storage.PersistSettings,
+	historySettings storage.HistorySettings,
 	cryptoPrivKeyPath string,
 	trustedSubnet *net.IPNet,
+	trustedProxies []*net.IPNet,
+	policy *acl.Policy,
+	apiKeysPath string,
 	grpcAddress *nettools.Address,
 	grpcServerTLS *gtls.TLSServerSettings,
+	statsDAddress *nettools.Address,
+	graphiteAddress *nettools.Address,
+	graphiteTemplates []graphite.Template,
+	signWindow time.Duration,
+	signRequired bool,
 ) ServiceSettings {
-	var hmac *string
-	if hmacKey != "" {
-		hmac = &hmacKey
-	}
-
 	var privKeyPath *string
 	if cryptoPrivKeyPath != "" {
 		privKeyPath = &cryptoPrivKeyPath
 	}
 
+	var keysPath *string
+	if apiKeysPath != "" {
+		keysPath = &apiKeysPath
+	}
+
+	// Trusted subnet is an allow rule of write group
+	if trustedSubnet != nil {
+		if policy == nil {
+			policy = acl.NewPolicy()
+		}
+		policy.Allow(acl.GroupWrite, trustedSubnet)
+	}
+
 	return ServiceSettings{
 		HTTPAddress:       httpAddress,
+		HTTPServerTLS:     httpServerTLS,
 		PersistSettings:   persistSettimgs,
-		HmacKey:           hmac,
+		HistorySettings:   historySettings,
+		HmacKeys:          hmacKeys,
 		DatabaseDsn:       databaseDsn,
 		CryptoPrivKeyPath: privKeyPath,
 		TrustedSubnet:     trustedSubnet,
+		TrustedProxies:    trustedProxies,
+		ACL:               policy,
+		APIKeysPath:       keysPath,
 		GRPCAddress:       grpcAddress,
 		GRPCServerTLS:     grpcServerTLS,
+		StatsDAddress:     statsDAddress,
+		GraphiteAddress:   graphiteAddress,
+		GraphiteTemplates: graphiteTemplates,
+		SignWindow:        signWindow,
+		SignRequired:      signRequired,
 	}
 }
@@ -0,0 +1,97 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+)
+
+// StatsD metric types.
+const (
+	_typeCounter   = "c"
+	_typeGauge     = "g"
+	_typeTimer     = "ms"
+	_typeHistogram = "h"
+)
+
+// _minSampleRate - lowest accepted sample rate, limits weight of one sample.
+const _minSampleRate = 1e-6
+
+// ErrWrongLine - error for incorrect StatsD line.
+var ErrWrongLine = errors.New("wrong statsd line")
+
+// sample - parsed StatsD line.
+type sample struct {
+	labels   metric.Labels
+	name     string
+	mtype    string
+	value    float64
+	rate     float64
+	relative bool // gauge value with explicit sign is delta to current value
+}
+
+// parseLine parses StatsD line in format name:value|type[|@rate][|#tag:value,...].
+// DogStatsD tags are converted to metric labels.
+func parseLine(line string) (sample, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return sample{}, fmt.Errorf("incorrect name: %w", ErrWrongLine)
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return sample{}, fmt.Errorf("incorrect format: %w", ErrWrongLine)
+	}
+
+	s := sample{name: metric.SanitizeMetricName(name), mtype: parts[1], rate: 1}
+	switch s.mtype {
+	case _typeCounter, _typeGauge, _typeTimer, _typeHistogram:
+	default:
+		return sample{}, fmt.Errorf("unknown type %q: %w", s.mtype, ErrWrongLine)
+	}
+
+	value, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return sample{}, fmt.Errorf("incorrect value %q: %w", parts[0], ErrWrongLine)
+	}
+	s.value = value
+	s.relative = s.mtype == _typeGauge && (parts[0][0] == '+' || parts[0][0] == '-')
+
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			s.rate, err = strconv.ParseFloat(part[1:], 64)
+			if err != nil || !(s.rate >= _minSampleRate && s.rate <= 1) {
+				return sample{}, fmt.Errorf("incorrect sample rate %q: %w", part, ErrWrongLine)
+			}
+		case strings.HasPrefix(part, "#"):
+			s.labels = parseTags(part[1:])
+		default:
+			return sample{}, fmt.Errorf("unknown section %q: %w", part, ErrWrongLine)
+		}
+	}
+
+	return s, nil
+}
+
+// parseTags converts DogStatsD tags to labels. Tag without value
+// becomes label with empty value, tag names are sanitized.
+func parseTags(val string) metric.Labels {
+	labels := make(metric.Labels)
+	for _, tag := range strings.Split(val, ",") {
+		if tag == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(tag, ":")
+		labels[metric.SanitizeLabelName(name)] = value
+	}
+
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
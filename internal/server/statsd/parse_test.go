@@ -0,0 +1,54 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLine(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		exp  sample
+	}{
+		{line: "foo:1|c", exp: sample{name: "foo", mtype: _typeCounter, value: 1, rate: 1}},
+		{line: "foo.bar:3.2|g", exp: sample{name: "foo_bar", mtype: _typeGauge, value: 3.2, rate: 1}},
+		{line: "foo:-3|g", exp: sample{name: "foo", mtype: _typeGauge, value: -3, rate: 1, relative: true}},
+		{line: "foo:+3|g", exp: sample{name: "foo", mtype: _typeGauge, value: 3, rate: 1, relative: true}},
+		{line: "foo:12|ms|@0.5", exp: sample{name: "foo", mtype: _typeTimer, value: 12, rate: 0.5}},
+		{
+			line: "foo:2|c|@0.1|#host:a,env.name:prod,debug",
+			exp: sample{
+				name:   "foo",
+				mtype:  _typeCounter,
+				value:  2,
+				rate:   0.1,
+				labels: metric.Labels{"host": "a", "env_name": "prod", "debug": ""},
+			},
+		},
+	} {
+		s, err := parseLine(tt.line)
+		assert.NoError(t, err, tt.line)
+		assert.Equal(t, tt.exp, s, tt.line)
+	}
+}
+
+func TestParseLineError(t *testing.T) {
+	for _, line := range []string{
+		"foo",
+		":1|c",
+		"foo:1",
+		"foo:1|x",
+		"foo:abc|c",
+		"foo:NaN|g",
+		"foo:1|c|@0",
+		"foo:1|c|@0.0000001",
+		"foo:1|c|@2",
+		"foo:1|c|@abc",
+		"foo:1|c|x",
+	} {
+		_, err := parseLine(line)
+		assert.ErrorIs(t, err, ErrWrongLine, line)
+	}
+}
@@ -0,0 +1,195 @@
+// Package statsd provides StatsD UDP ingestion listener.
+package statsd
+
+import (
+	"errors"
+	"math"
+	"net"
+	"strings"
+
+	"github.com/devldavydov/promytheus/internal/common/acl"
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// _maxPacketSize - max UDP datagram size.
+const _maxPacketSize = 65535
+
+// DefaultTimerBounds - histogram bucket bounds for timers, in milliseconds.
+var DefaultTimerBounds = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Listener - StatsD UDP listener. Every packet is written to storage as one
+// batch: counters as counters, gauges as gauges, timers as histograms.
+type Listener struct {
+	conn        net.PacketConn
+	storage     storage.Storage
+	policy      *acl.Policy
+	timerBounds []float64
+	logger      *logrus.Logger
+}
+
+// NewListener - constructor for Listener, starts listening UDP address.
+// Packets from addresses, not allowed to write by ACL policy, are dropped.
+func NewListener(address string, stg storage.Storage, policy *acl.Policy, logger *logrus.Logger) (*Listener, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Listener{
+		conn:        conn,
+		storage:     stg,
+		policy:      policy,
+		timerBounds: DefaultTimerBounds,
+		logger:      logger,
+	}, nil
+}
+
+// Addr returns listener local address.
+func (l *Listener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// Serve reads and handles packets until listener is closed.
+func (l *Listener) Serve() error {
+	buf := make([]byte, _maxPacketSize)
+	for {
+		n, addr, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		if !l.isTrusted(addr) {
+			l.logger.Warnf("StatsD packet from untrusted address [%s] dropped", addr)
+			continue
+		}
+
+		l.handlePacket(string(buf[:n]))
+	}
+}
+
+// Close stops listener.
+func (l *Listener) Close() error {
+	return l.conn.Close()
+}
+
+func (l *Listener) isTrusted(addr net.Addr) bool {
+	var ip net.IP
+	if udpAddr, ok := addr.(*net.UDPAddr); ok {
+		ip = udpAddr.IP
+	}
+	return l.policy.Allowed(acl.GroupWrite, ip)
+}
+
+func (l *Listener) handlePacket(packet string) {
+	items, err := l.parsePacket(packet)
+	if err != nil {
+		l.logger.Errorf("Failed to process StatsD packet: %v", err)
+		return
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	if err = l.storage.SetMetrics(items); err != nil {
+		l.logger.Errorf("Failed to store StatsD metrics: %v", err)
+	}
+}
+
+// parsePacket converts packet lines to storage items. Incorrect lines are
+// logged and skipped.
+func (l *Listener) parsePacket(packet string) ([]storage.StorageItem, error) {
+	var (
+		items      []storage.StorageItem
+		gauges     = make(map[string]storage.StorageItem)
+		histograms = make(map[string]storage.StorageItem)
+		gaugeIDs   []string
+		histIDs    []string
+	)
+
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		s, err := parseLine(line)
+		if err != nil {
+			l.logger.Warnf("Skipping StatsD line [%s]: %v", line, err)
+			continue
+		}
+		id := metric.SeriesID(s.name, s.labels)
+
+		switch s.mtype {
+		case _typeCounter:
+			delta := math.Round(s.value / s.rate)
+			if delta < 0 {
+				l.logger.Warnf("Skipping StatsD line [%s]: negative counter", line)
+				continue
+			}
+			if delta >= math.MaxInt64 {
+				l.logger.Warnf("Skipping StatsD line [%s]: counter out of range", line)
+				continue
+			}
+			items = append(items, storage.StorageItem{MetricName: s.name, Labels: s.labels, Value: metric.Counter(delta)})
+
+		case _typeGauge:
+			value := s.value
+			if s.relative {
+				current, err := l.currentGauge(gauges, id, s)
+				if err != nil {
+					return nil, err
+				}
+				value += current
+			}
+			if _, ok := gauges[id]; !ok {
+				gaugeIDs = append(gaugeIDs, id)
+			}
+			gauges[id] = storage.StorageItem{MetricName: s.name, Labels: s.labels, Value: metric.Gauge(value)}
+
+		case _typeTimer, _typeHistogram:
+			item, ok := histograms[id]
+			if !ok {
+				h, err := metric.NewHistogram(l.timerBounds)
+				if err != nil {
+					return nil, err
+				}
+				item = storage.StorageItem{MetricName: s.name, Labels: s.labels, Value: h}
+				histIDs = append(histIDs, id)
+			}
+			h := item.Value.(metric.Histogram)
+			h.ObserveN(s.value, uint64(math.Round(1/s.rate)))
+			item.Value = h
+			histograms[id] = item
+		}
+	}
+
+	for _, id := range gaugeIDs {
+		items = append(items, gauges[id])
+	}
+	for _, id := range histIDs {
+		items = append(items, histograms[id])
+	}
+
+	return items, nil
+}
+
+// currentGauge returns gauge value set earlier in packet or stored value, 0 for new gauge.
+func (l *Listener) currentGauge(gauges map[string]storage.StorageItem, id string, s sample) (float64, error) {
+	if item, ok := gauges[id]; ok {
+		return float64(item.Value.(metric.Gauge)), nil
+	}
+
+	value, err := l.storage.GetGaugeMetric(s.name, s.labels)
+	if err != nil {
+		if errors.Is(err, storage.ErrMetricNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return float64(value), nil
+}
@@ -0,0 +1,104 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/acl"
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/devldavydov/promytheus/internal/server/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePacket(t *testing.T) {
+	stg := createTestStorage(t)
+	_, err := stg.SetGaugeMetric("temp", nil, metric.Gauge(10))
+	require.NoError(t, err)
+
+	l := &Listener{storage: stg, timerBounds: []float64{10, 100}, logger: logrus.New()}
+	items, err := l.parsePacket("hits:1|c\nhits:1|c|@0.5\nbad line\n\ntemp:-3|g\ntemp:+1|g\nload:0.5|g\nreq:12|ms|@0.5\nreq:150|ms\nneg:-1|c")
+	require.NoError(t, err)
+
+	assert.Equal(t, []storage.StorageItem{
+		{MetricName: "hits", Value: metric.Counter(1)},
+		{MetricName: "hits", Value: metric.Counter(2)},
+		{MetricName: "temp", Value: metric.Gauge(8)},
+		{MetricName: "load", Value: metric.Gauge(0.5)},
+		{MetricName: "req", Value: metric.Histogram{Bounds: []float64{10, 100}, Buckets: []uint64{0, 2}, Sum: 174, Count: 3}},
+	}, items)
+}
+
+func TestParsePacketLimits(t *testing.T) {
+	l := &Listener{storage: createTestStorage(t), timerBounds: []float64{10, 100}, logger: logrus.New()}
+	items, err := l.parsePacket("big:1e30|c\nbig:1e18|c|@0.0001\nreq:12|ms|@0.000000001\nreq:12|ms|@0.000001\nok:5|c")
+	require.NoError(t, err)
+
+	// Counters out of int64 range and too low sample rates are skipped,
+	// timer with low sample rate is observed once with weight
+	assert.Equal(t, []storage.StorageItem{
+		{MetricName: "ok", Value: metric.Counter(5)},
+		{MetricName: "req", Value: metric.Histogram{Bounds: []float64{10, 100}, Buckets: []uint64{0, 1000000}, Sum: 12000000, Count: 1000000}},
+	}, items)
+}
+
+func TestListener(t *testing.T) {
+	stg := createTestStorage(t)
+
+	l, err := NewListener("127.0.0.1:0", stg, nil, logrus.New())
+	require.NoError(t, err)
+	go l.Serve()
+	defer l.Close()
+
+	conn, err := net.Dial("udp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("hits:3|c|#host:a\nload:0.5|g"))
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		hits, err := stg.GetCounterMetric("hits", metric.Labels{"host": "a"})
+		if err != nil || hits != metric.Counter(3) {
+			return false
+		}
+		load, err := stg.GetGaugeMetric("load", nil)
+		return err == nil && load == metric.Gauge(0.5)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestListenerUntrusted(t *testing.T) {
+	stg := createTestStorage(t)
+
+	policy, err := acl.ParsePolicy("write=10.0.0.0/8,fd00::/8,!10.1.0.0/16")
+	require.NoError(t, err)
+	l, err := NewListener("127.0.0.1:0", stg, policy, logrus.New())
+	require.NoError(t, err)
+	defer l.Close()
+
+	assert.False(t, l.isTrusted(&net.UDPAddr{IP: net.ParseIP("127.0.0.1")}))
+	assert.True(t, l.isTrusted(&net.UDPAddr{IP: net.ParseIP("10.2.3.4")}))
+	assert.True(t, l.isTrusted(&net.UDPAddr{IP: net.ParseIP("fd00::1")}))
+	assert.False(t, l.isTrusted(&net.UDPAddr{IP: net.ParseIP("10.1.2.3")}))
+}
+
+func TestListenerClose(t *testing.T) {
+	l, err := NewListener("127.0.0.1:0", createTestStorage(t), nil, logrus.New())
+	require.NoError(t, err)
+
+	errCh := make(chan error)
+	go func() { errCh <- l.Serve() }()
+
+	require.NoError(t, l.Close())
+	assert.NoError(t, <-errCh)
+}
+
+func createTestStorage(t *testing.T) *storage.MemStorage {
+	stg, err := storage.NewMemStorage(context.TODO(), logrus.New(), storage.NewPersistSettings(0, "", false), storage.NewHistorySettings(0))
+	require.NoError(t, err)
+	t.Cleanup(stg.Close)
+	return stg
+}
@@ -2,4 +2,7 @@ package storage
 
 import "errors"
 
-var ErrMetricNotFound = errors.New("metric not found")
+var (
+	ErrMetricNotFound  = errors.New("metric not found")
+	ErrHistoryDisabled = errors.New("history disabled")
+)
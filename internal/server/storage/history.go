@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+)
+
+// Sample is a timestamped metric value from history.
+type Sample struct {
+	Timestamp time.Time
+	Value     metric.MetricValue
+}
+
+// HistorySettings represents options for keeping metric samples history.
+// Size is the number of last samples kept per series. PostgreSQL storage
+// deletes older samples of series on insert.
+type HistorySettings struct {
+	Size int
+}
+
+func NewHistorySettings(size int) HistorySettings {
+	return HistorySettings{Size: size}
+}
+
+func (hs HistorySettings) Enabled() bool {
+	return hs.Size > 0
+}
+
+// historyKey identifies series history, same series ID may have different types.
+type historyKey struct {
+	metricType string
+	seriesID   string
+}
+
+// ringBuffer keeps last samples of series in time order. Buffer grows on
+// push up to capacity, so rarely updated series don't take full capacity.
+type ringBuffer struct {
+	samples  []Sample
+	start    int
+	capacity int
+}
+
+func newRingBuffer(capacity int) *ringBuffer {
+	return &ringBuffer{capacity: capacity}
+}
+
+func (r *ringBuffer) push(sample Sample) {
+	if len(r.samples) < r.capacity {
+		if len(r.samples) == cap(r.samples) {
+			newCap := 2 * cap(r.samples)
+			if newCap == 0 {
+				newCap = 1
+			}
+			if newCap > r.capacity {
+				newCap = r.capacity
+			}
+			samples := make([]Sample, len(r.samples), newCap)
+			copy(samples, r.samples)
+			r.samples = samples
+		}
+		r.samples = append(r.samples, sample)
+		return
+	}
+	r.samples[r.start] = sample
+	r.start = (r.start + 1) % r.capacity
+}
+
+func (r *ringBuffer) get(i int) Sample {
+	return r.samples[(r.start+i)%len(r.samples)]
+}
+
+// between returns samples with timestamp in [from, to].
+func (r *ringBuffer) between(from, to time.Time) []Sample {
+	lo := sort.Search(len(r.samples), func(i int) bool { return !r.get(i).Timestamp.Before(from) })
+	hi := sort.Search(len(r.samples), func(i int) bool { return r.get(i).Timestamp.After(to) })
+
+	result := make([]Sample, 0, hi-lo)
+	for i := lo; i < hi; i++ {
+		result = append(result, r.get(i))
+	}
+	return result
+}
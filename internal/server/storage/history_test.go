@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/devldavydov/promytheus/internal/common/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRingBufferBetween(t *testing.T) {
+	base := time.Unix(1000, 0)
+	buf := newRingBuffer(3)
+	assert.Empty(t, buf.between(base, base.Add(time.Hour)))
+
+	for i := 0; i < 5; i++ {
+		buf.push(Sample{Timestamp: base.Add(time.Duration(i) * time.Second), Value: metric.Gauge(i)})
+	}
+
+	assert.Equal(t, []metric.MetricValue{metric.Gauge(2), metric.Gauge(3), metric.Gauge(4)},
+		sampleValues(buf.between(base, base.Add(time.Hour))))
+	assert.Equal(t, []metric.MetricValue{metric.Gauge(3)},
+		sampleValues(buf.between(base.Add(3*time.Second), base.Add(3*time.Second))))
+	assert.Equal(t, []metric.MetricValue{metric.Gauge(2), metric.Gauge(3)},
+		sampleValues(buf.between(base, base.Add(3500*time.Millisecond))))
+	assert.Empty(t, buf.between(base.Add(5*time.Second), base.Add(time.Hour)))
+}
+
+func TestRingBufferGrow(t *testing.T) {
+	buf := newRingBuffer(5)
+	assert.Equal(t, 0, cap(buf.samples))
+
+	for i := 0; i < 7; i++ {
+		buf.push(Sample{Timestamp: time.Unix(int64(i), 0), Value: metric.Gauge(i)})
+		assert.LessOrEqual(t, cap(buf.samples), 5)
+	}
+	assert.Equal(t, 5, len(buf.samples))
+	assert.Equal(t, []metric.MetricValue{metric.Gauge(2), metric.Gauge(3), metric.Gauge(4), metric.Gauge(5), metric.Gauge(6)},
+		sampleValues(buf.between(time.Unix(0, 0), time.Unix(10, 0))))
+}
+
+func TestHistorySettingsEnabled(t *testing.T) {
+	assert.False(t, NewHistorySettings(0).Enabled())
+	assert.True(t, NewHistorySettings(1).Enabled())
+}
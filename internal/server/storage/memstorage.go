@@ -14,22 +14,31 @@ import (
 )
 
 // MemStorage represents in-memory metrics storage functionality.
+// Metrics are keyed by metric series ID (name with labels).
 type MemStorage struct {
-	gaugeStorage    map[string]metric.Gauge
-	counterStorage  map[string]metric.Counter
-	logger          *logrus.Logger
-	persistSettings PersistSettings
-	mu              sync.RWMutex
+	gaugeStorage     map[string]metric.Gauge
+	counterStorage   map[string]metric.Counter
+	histogramStorage map[string]metric.Histogram
+	summaryStorage   map[string]metric.Summary
+	history          map[historyKey]*ringBuffer
+	logger           *logrus.Logger
+	persistSettings  PersistSettings
+	historySettings  HistorySettings
+	mu               sync.RWMutex
 }
 
 var _ Storage = (*MemStorage)(nil)
 
-func NewMemStorage(ctx context.Context, logger *logrus.Logger, persistSettings PersistSettings) (*MemStorage, error) {
+func NewMemStorage(ctx context.Context, logger *logrus.Logger, persistSettings PersistSettings, historySettings HistorySettings) (*MemStorage, error) {
 	memStorage := &MemStorage{
-		persistSettings: persistSettings,
-		gaugeStorage:    make(map[string]metric.Gauge),
-		counterStorage:  make(map[string]metric.Counter),
-		logger:          logger}
+		persistSettings:  persistSettings,
+		historySettings:  historySettings,
+		gaugeStorage:     make(map[string]metric.Gauge),
+		counterStorage:   make(map[string]metric.Counter),
+		histogramStorage: make(map[string]metric.Histogram),
+		summaryStorage:   make(map[string]metric.Summary),
+		history:          make(map[historyKey]*ringBuffer),
+		logger:           logger}
 
 	if err := memStorage.init(ctx); err != nil {
 		return nil, err
@@ -37,60 +46,161 @@ func NewMemStorage(ctx context.Context, logger *logrus.Logger, persistSettings P
 	return memStorage, nil
 }
 
-func (storage *MemStorage) SetGaugeMetric(metricName string, value metric.Gauge) (metric.Gauge, error) {
+func (storage *MemStorage) SetGaugeMetric(metricName string, labels metric.Labels, value metric.Gauge) (metric.Gauge, error) {
+	if err := validateSeries(metricName, labels); err != nil {
+		return 0, err
+	}
+
 	storage.mu.Lock()
 	defer storage.mu.Unlock()
 
-	storage.gaugeStorage[metricName] = value
+	seriesID := metric.SeriesID(metricName, labels)
+	storage.gaugeStorage[seriesID] = value
+	storage.appendSample(seriesID, value, time.Now())
 	storage.trySyncPersist()
 
 	return value, nil
 }
 
-func (storage *MemStorage) GetGaugeMetric(metricName string) (metric.Gauge, error) {
+func (storage *MemStorage) GetGaugeMetric(metricName string, labels metric.Labels) (metric.Gauge, error) {
 	storage.mu.RLock()
 	defer storage.mu.RUnlock()
 
-	val, ok := storage.gaugeStorage[metricName]
+	val, ok := storage.gaugeStorage[metric.SeriesID(metricName, labels)]
 	if !ok {
 		return 0, ErrMetricNotFound
 	}
 	return val, nil
 }
 
-func (storage *MemStorage) SetCounterMetric(metricName string, value metric.Counter) (metric.Counter, error) {
+func (storage *MemStorage) SetCounterMetric(metricName string, labels metric.Labels, value metric.Counter) (metric.Counter, error) {
+	if err := validateSeries(metricName, labels); err != nil {
+		return 0, err
+	}
+
 	storage.mu.Lock()
 	defer storage.mu.Unlock()
 
-	storage.counterStorage[metricName] += value
+	seriesID := metric.SeriesID(metricName, labels)
+	storage.counterStorage[seriesID] += value
+	storage.appendSample(seriesID, storage.counterStorage[seriesID], time.Now())
 	storage.trySyncPersist()
 
-	return storage.counterStorage[metricName], nil
+	return storage.counterStorage[seriesID], nil
 }
 
-func (storage *MemStorage) GetCounterMetric(metricName string) (metric.Counter, error) {
+func (storage *MemStorage) GetCounterMetric(metricName string, labels metric.Labels) (metric.Counter, error) {
 	storage.mu.RLock()
 	defer storage.mu.RUnlock()
 
-	val, ok := storage.counterStorage[metricName]
+	val, ok := storage.counterStorage[metric.SeriesID(metricName, labels)]
 	if !ok {
 		return 0, ErrMetricNotFound
 	}
 	return val, nil
 }
 
+func (storage *MemStorage) SetHistogramMetric(metricName string, labels metric.Labels, value metric.Histogram) (metric.Histogram, error) {
+	if err := validateSeries(metricName, labels); err != nil {
+		return metric.Histogram{}, err
+	}
+
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	seriesID := metric.SeriesID(metricName, labels)
+	val, err := mergeValue(storage.histogramStorage, seriesID, value)
+	if err != nil {
+		return metric.Histogram{}, err
+	}
+	storage.histogramStorage[seriesID] = val
+	storage.appendSample(seriesID, val, time.Now())
+	storage.trySyncPersist()
+
+	return val, nil
+}
+
+func (storage *MemStorage) GetHistogramMetric(metricName string, labels metric.Labels) (metric.Histogram, error) {
+	storage.mu.RLock()
+	defer storage.mu.RUnlock()
+
+	val, ok := storage.histogramStorage[metric.SeriesID(metricName, labels)]
+	if !ok {
+		return metric.Histogram{}, ErrMetricNotFound
+	}
+	return val, nil
+}
+
+func (storage *MemStorage) SetSummaryMetric(metricName string, labels metric.Labels, value metric.Summary) (metric.Summary, error) {
+	if err := validateSeries(metricName, labels); err != nil {
+		return metric.Summary{}, err
+	}
+
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+
+	seriesID := metric.SeriesID(metricName, labels)
+	val, err := mergeValue(storage.summaryStorage, seriesID, value)
+	if err != nil {
+		return metric.Summary{}, err
+	}
+	storage.summaryStorage[seriesID] = val
+	storage.appendSample(seriesID, val, time.Now())
+	storage.trySyncPersist()
+
+	return val, nil
+}
+
+func (storage *MemStorage) GetSummaryMetric(metricName string, labels metric.Labels) (metric.Summary, error) {
+	storage.mu.RLock()
+	defer storage.mu.RUnlock()
+
+	val, ok := storage.summaryStorage[metric.SeriesID(metricName, labels)]
+	if !ok {
+		return metric.Summary{}, ErrMetricNotFound
+	}
+	return val, nil
+}
+
 func (storage *MemStorage) SetMetrics(metricList []StorageItem) error {
+	if err := validateItems(metricList); err != nil {
+		return err
+	}
+
 	storage.mu.Lock()
 	defer storage.mu.Unlock()
 
+	// Merge histograms and summaries first, so merge error leaves storage untouched
+	histograms, err := mergeItems(storage.histogramStorage, metricList, metric.HistogramTypeName)
+	if err != nil {
+		return err
+	}
+	summaries, err := mergeItems(storage.summaryStorage, metricList, metric.SummaryTypeName)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
 	for _, metricItem := range metricList {
+		seriesID := metric.SeriesID(metricItem.MetricName, metricItem.Labels)
+
 		switch metricItem.Value.TypeName() {
 		case metric.CounterTypeName:
-			storage.counterStorage[metricItem.MetricName] += metricItem.Value.(metric.Counter)
+			storage.counterStorage[seriesID] += metricItem.Value.(metric.Counter)
+			storage.appendSample(seriesID, storage.counterStorage[seriesID], now)
 		case metric.GaugeTypeName:
-			storage.gaugeStorage[metricItem.MetricName] = metricItem.Value.(metric.Gauge)
+			storage.gaugeStorage[seriesID] = metricItem.Value.(metric.Gauge)
+			storage.appendSample(seriesID, storage.gaugeStorage[seriesID], now)
 		}
 	}
+	for seriesID, val := range histograms {
+		storage.histogramStorage[seriesID] = val
+		storage.appendSample(seriesID, val, now)
+	}
+	for seriesID, val := range summaries {
+		storage.summaryStorage[seriesID] = val
+		storage.appendSample(seriesID, val, now)
+	}
 	storage.trySyncPersist()
 
 	return nil
@@ -100,12 +210,45 @@ func (storage *MemStorage) GetAllMetrics() ([]StorageItem, error) {
 	storage.mu.RLock()
 	defer storage.mu.RUnlock()
 
-	items := make([]StorageItem, 0, len(storage.counterStorage)+len(storage.gaugeStorage))
+	items := make([]StorageItem, 0,
+		len(storage.counterStorage)+len(storage.gaugeStorage)+len(storage.histogramStorage)+len(storage.summaryStorage))
 
-	counterItems := sortItems(mapToItems(storage.counterStorage))
-	gaugeItems := sortItems(mapToItems(storage.gaugeStorage))
+	counterItems, err := mapToItems(storage.counterStorage)
+	if err != nil {
+		return nil, err
+	}
+	gaugeItems, err := mapToItems(storage.gaugeStorage)
+	if err != nil {
+		return nil, err
+	}
+	histogramItems, err := mapToItems(storage.histogramStorage)
+	if err != nil {
+		return nil, err
+	}
+	summaryItems, err := mapToItems(storage.summaryStorage)
+	if err != nil {
+		return nil, err
+	}
 
-	return append(append(items, counterItems...), gaugeItems...), nil
+	items = append(items, sortItems(counterItems)...)
+	items = append(items, sortItems(gaugeItems)...)
+	items = append(items, sortItems(histogramItems)...)
+	return append(items, sortItems(summaryItems)...), nil
+}
+
+func (storage *MemStorage) GetMetricRange(metricType, metricName string, labels metric.Labels, from, to time.Time) ([]Sample, error) {
+	if !storage.historySettings.Enabled() {
+		return nil, ErrHistoryDisabled
+	}
+
+	storage.mu.RLock()
+	defer storage.mu.RUnlock()
+
+	buf, ok := storage.history[historyKey{metricType: metricType, seriesID: metric.SeriesID(metricName, labels)}]
+	if !ok {
+		return []Sample{}, nil
+	}
+	return buf.between(from, to), nil
 }
 
 func (storage *MemStorage) Ping() bool {
@@ -159,19 +302,47 @@ func (storage *MemStorage) restore() error {
 		return fmt.Errorf("failed to restore value [%s] of type [%s]: %w", v.ID, v.MType, err)
 	}
 
+	restored := make(map[string]bool, len(totalMetrics))
 	for _, v := range totalMetrics {
+		name, labels := restoreSeries(v.ID, v.Labels)
+		if err = validateSeries(name, labels); err != nil {
+			storage.logger.Warnf("Skip restore of value [%s] of type [%s]: %v", v.ID, v.MType, err)
+			continue
+		}
+		seriesID := metric.SeriesID(name, labels)
+		if seriesID != metric.SeriesID(v.ID, v.Labels) {
+			if restored[v.MType+":"+seriesID] {
+				storage.logger.Warnf("Skip restore of value [%s] of type [%s]: duplicate of [%s]", v.ID, v.MType, seriesID)
+				continue
+			}
+			storage.logger.Warnf("Value [%s] of type [%s] restored as [%s]", v.ID, v.MType, seriesID)
+		}
+		restored[v.MType+":"+seriesID] = true
+
 		if metric.CounterTypeName == v.MType {
 			val, err := metric.NewCounterFromIntP(v.Delta)
 			if err != nil {
 				return restoreErr(v, err)
 			}
-			storage.counterStorage[v.ID] = val
+			storage.counterStorage[seriesID] = val
 		} else if metric.GaugeTypeName == v.MType {
 			val, err := metric.NewGaugeFromFloatP(v.Value)
 			if err != nil {
 				return restoreErr(v, err)
 			}
-			storage.gaugeStorage[v.ID] = val
+			storage.gaugeStorage[seriesID] = val
+		} else if metric.HistogramTypeName == v.MType {
+			val, err := metric.NewHistogramFromParts(v.Bounds, v.Buckets, v.Sum, v.Count)
+			if err != nil {
+				return restoreErr(v, err)
+			}
+			storage.histogramStorage[seriesID] = val
+		} else if metric.SummaryTypeName == v.MType {
+			val, err := metric.NewSummaryFromParts(v.Sketch, v.Sum, v.Count)
+			if err != nil {
+				return restoreErr(v, err)
+			}
+			storage.summaryStorage[seriesID] = val
 		}
 	}
 	storage.logger.Infof("Storage restored from file [%s]", storage.persistSettings.StoreFile)
@@ -179,6 +350,38 @@ func (storage *MemStorage) restore() error {
 	return nil
 }
 
+// restoreSeries returns series name and labels of store file value. Names,
+// stored before validation of metric names, are sanitized.
+func restoreSeries(name string, labels metric.Labels) (string, metric.Labels) {
+	if name != "" {
+		name = metric.SanitizeMetricName(name)
+	}
+	if len(labels) == 0 {
+		return name, labels
+	}
+
+	res := make(metric.Labels, len(labels))
+	for k, v := range labels {
+		res[metric.SanitizeLabelName(k)] = v
+	}
+	return name, res
+}
+
+// appendSample adds value to series history ring buffer, if history enabled.
+func (storage *MemStorage) appendSample(seriesID string, value metric.MetricValue, ts time.Time) {
+	if !storage.historySettings.Enabled() {
+		return
+	}
+
+	key := historyKey{metricType: value.TypeName(), seriesID: seriesID}
+	buf, ok := storage.history[key]
+	if !ok {
+		buf = newRingBuffer(storage.historySettings.Size)
+		storage.history[key] = buf
+	}
+	buf.push(Sample{Timestamp: ts, Value: value})
+}
+
 func (storage *MemStorage) trySyncPersist() {
 	if storage.persistSettings.ShouldSyncPersist() {
 		storage.persist()
@@ -186,12 +389,66 @@ func (storage *MemStorage) trySyncPersist() {
 }
 
 func (storage *MemStorage) persist() {
-	totalMetrics := make([]metric.MetricsDTO, 0, len(storage.counterStorage)+len(storage.gaugeStorage))
-	for k, v := range storage.counterStorage {
-		totalMetrics = append(totalMetrics, metric.MetricsDTO{ID: k, MType: metric.CounterTypeName, Delta: v.IntP()})
+	counterItems, err := mapToItems(storage.counterStorage)
+	if err != nil {
+		storage.logger.Errorf("Failed to persist storage: %v", err)
+		return
 	}
-	for k, v := range storage.gaugeStorage {
-		totalMetrics = append(totalMetrics, metric.MetricsDTO{ID: k, MType: metric.GaugeTypeName, Value: v.FloatP()})
+	gaugeItems, err := mapToItems(storage.gaugeStorage)
+	if err != nil {
+		storage.logger.Errorf("Failed to persist storage: %v", err)
+		return
+	}
+	histogramItems, err := mapToItems(storage.histogramStorage)
+	if err != nil {
+		storage.logger.Errorf("Failed to persist storage: %v", err)
+		return
+	}
+	summaryItems, err := mapToItems(storage.summaryStorage)
+	if err != nil {
+		storage.logger.Errorf("Failed to persist storage: %v", err)
+		return
+	}
+
+	totalMetrics := make([]metric.MetricsDTO, 0, len(counterItems)+len(gaugeItems)+len(histogramItems)+len(summaryItems))
+	for _, item := range counterItems {
+		totalMetrics = append(totalMetrics, metric.MetricsDTO{
+			ID:     item.MetricName,
+			Labels: item.Labels,
+			MType:  metric.CounterTypeName,
+			Delta:  item.Value.(metric.Counter).IntP(),
+		})
+	}
+	for _, item := range gaugeItems {
+		totalMetrics = append(totalMetrics, metric.MetricsDTO{
+			ID:     item.MetricName,
+			Labels: item.Labels,
+			MType:  metric.GaugeTypeName,
+			Value:  item.Value.(metric.Gauge).FloatP(),
+		})
+	}
+	for _, item := range histogramItems {
+		val := item.Value.(metric.Histogram)
+		totalMetrics = append(totalMetrics, metric.MetricsDTO{
+			ID:      item.MetricName,
+			Labels:  item.Labels,
+			MType:   metric.HistogramTypeName,
+			Bounds:  val.Bounds,
+			Buckets: val.Buckets,
+			Sum:     val.SumP(),
+			Count:   val.CountP(),
+		})
+	}
+	for _, item := range summaryItems {
+		val := item.Value.(metric.Summary)
+		totalMetrics = append(totalMetrics, metric.MetricsDTO{
+			ID:     item.MetricName,
+			Labels: item.Labels,
+			MType:  metric.SummaryTypeName,
+			Sketch: val.SketchP(),
+			Sum:    val.SumP(),
+			Count:  val.CountP(),
+		})
 	}
 
 	file, err := os.OpenFile(storage.persistSettings.StoreFile, os.O_WRONLY|os.O_CREATE, 0644)
@@ -224,17 +481,57 @@ func (storage *MemStorage) persistIntervalThread(ctx context.Context) {
 	}
 }
 
-func mapToItems[V metric.MetricValue](m map[string]V) []StorageItem {
+func mergeValue[T mergeable[T]](m map[string]T, seriesID string, value T) (T, error) {
+	cur, ok := m[seriesID]
+	if !ok {
+		return value, nil
+	}
+	return cur.Merge(value)
+}
+
+// mergeItems merges items of given type with stored values and returns
+// merged values by series ID, without modifying stored ones.
+func mergeItems[T mergeable[T]](stored map[string]T, metricList []StorageItem, typeName string) (map[string]T, error) {
+	merged := make(map[string]T)
+	for _, metricItem := range metricList {
+		if metricItem.Value.TypeName() != typeName {
+			continue
+		}
+
+		seriesID := metric.SeriesID(metricItem.MetricName, metricItem.Labels)
+		if _, ok := merged[seriesID]; !ok {
+			if val, ok := stored[seriesID]; ok {
+				merged[seriesID] = val
+			}
+		}
+
+		val, err := mergeValue(merged, seriesID, metricItem.Value.(T))
+		if err != nil {
+			return nil, err
+		}
+		merged[seriesID] = val
+	}
+	return merged, nil
+}
+
+func mapToItems[V metric.MetricValue](m map[string]V) ([]StorageItem, error) {
 	result := make([]StorageItem, 0, len(m))
-	for name, val := range m {
-		result = append(result, StorageItem{MetricName: name, Value: val})
+	for seriesID, val := range m {
+		name, labels, err := metric.ParseSeriesID(seriesID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, StorageItem{MetricName: name, Labels: labels, Value: val})
 	}
-	return result
+	return result, nil
 }
 
 func sortItems(items []StorageItem) []StorageItem {
 	sort.Slice(items, func(i, j int) bool {
-		return items[i].MetricName < items[j].MetricName
+		if items[i].MetricName != items[j].MetricName {
+			return items[i].MetricName < items[j].MetricName
+		}
+		return items[i].Labels.String() < items[j].Labels.String()
 	})
 	return items
 }
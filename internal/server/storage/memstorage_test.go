@@ -15,9 +15,9 @@ import (
 func TestGaugeSetAndGet(t *testing.T) {
 	storage := createMemStorageWithoutPersist()
 	val := metric.Gauge(123.456)
-	storage.SetGaugeMetric("foo", val)
+	storage.SetGaugeMetric("foo", nil, val)
 
-	res, err := storage.GetGaugeMetric("foo")
+	res, err := storage.GetGaugeMetric("foo", nil)
 	assert.NoError(t, err)
 	assert.Equal(t, val, res)
 }
@@ -25,30 +25,55 @@ func TestGaugeSetAndGet(t *testing.T) {
 func TestGaugeGetUnknown(t *testing.T) {
 	storage := createMemStorageWithoutPersist()
 
-	_, err := storage.GetGaugeMetric("foo")
+	_, err := storage.GetGaugeMetric("foo", nil)
 	assert.ErrorIs(t, err, ErrMetricNotFound)
 }
 
+func TestSetWrongMetricName(t *testing.T) {
+	storage := createMemStorageWithoutPersist()
+	_, err := storage.SetGaugeMetric("foo", metric.Labels{"cpu": "1"}, 1)
+	assert.NoError(t, err)
+
+	// Name with label syntax is rejected and does not break series parsing
+	_, err = storage.SetGaugeMetric("bad{", nil, 2)
+	assert.ErrorIs(t, err, metric.ErrWrongMetricName)
+	_, err = storage.SetCounterMetric("bad}", nil, 2)
+	assert.ErrorIs(t, err, metric.ErrWrongMetricName)
+
+	// Name with labels does not collide with series of labeled metric
+	_, err = storage.SetGaugeMetric(`foo{cpu="1"}`, nil, 5)
+	assert.ErrorIs(t, err, metric.ErrWrongMetricName)
+	assert.ErrorIs(t, storage.SetMetrics([]StorageItem{
+		{MetricName: `foo{cpu="1"}`, Value: metric.Gauge(5)},
+	}), metric.ErrWrongMetricName)
+
+	items, err := storage.GetAllMetrics()
+	assert.NoError(t, err)
+	assert.Equal(t, []StorageItem{
+		{MetricName: "foo", Labels: metric.Labels{"cpu": "1"}, Value: metric.Gauge(1)},
+	}, items)
+}
+
 func TestCounterSetNewAndGet(t *testing.T) {
 	storage := createMemStorageWithoutPersist()
 	val := metric.Counter(5)
-	storage.SetCounterMetric("foo", val)
+	storage.SetCounterMetric("foo", nil, val)
 
-	res, err := storage.GetCounterMetric("foo")
+	res, err := storage.GetCounterMetric("foo", nil)
 	assert.NoError(t, err)
 	assert.Equal(t, val, res)
 }
 
 func TestCounterSetExistingAndGet(t *testing.T) {
 	storage := createMemStorageWithoutPersist()
-	storage.SetCounterMetric("foo", metric.Counter(5))
-	storage.SetCounterMetric("foo", metric.Counter(5))
+	storage.SetCounterMetric("foo", nil, metric.Counter(5))
+	storage.SetCounterMetric("foo", nil, metric.Counter(5))
 
-	res, err := storage.GetCounterMetric("foo")
+	res, err := storage.GetCounterMetric("foo", nil)
 	assert.NoError(t, err)
 	assert.Equal(t, metric.Counter(10), res)
 
-	res, err = storage.SetCounterMetric("foo", metric.Counter(5))
+	res, err = storage.SetCounterMetric("foo", nil, metric.Counter(5))
 	assert.NoError(t, err)
 	assert.Equal(t, metric.Counter(15), res)
 }
@@ -56,8 +81,104 @@ func TestCounterSetExistingAndGet(t *testing.T) {
 func TestCounterGetUnknown(t *testing.T) {
 	storage := createMemStorageWithoutPersist()
 
-	_, err := storage.GetCounterMetric("foo")
+	_, err := storage.GetCounterMetric("foo", nil)
+	assert.ErrorIs(t, err, ErrMetricNotFound)
+}
+
+func TestHistogramSetAndGet(t *testing.T) {
+	storage := createMemStorageWithoutPersist()
+	h := metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{1, 2}, Sum: 1.5, Count: 3}
+
+	res, err := storage.SetHistogramMetric("foo", nil, h)
+	assert.NoError(t, err)
+	assert.Equal(t, h, res)
+
+	res, err = storage.SetHistogramMetric("foo", nil, h)
+	assert.NoError(t, err)
+	assert.Equal(t, metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{2, 4}, Sum: 3, Count: 6}, res)
+
+	res, err = storage.GetHistogramMetric("foo", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{2, 4}, Sum: 3, Count: 6}, res)
+
+	_, err = storage.SetHistogramMetric("foo", nil, metric.Histogram{Bounds: []float64{1}, Buckets: []uint64{1}, Count: 1})
+	assert.ErrorIs(t, err, metric.ErrWrongMetricValue)
+}
+
+func TestHistogramGetUnknown(t *testing.T) {
+	storage := createMemStorageWithoutPersist()
+
+	_, err := storage.GetHistogramMetric("foo", nil)
+	assert.ErrorIs(t, err, ErrMetricNotFound)
+}
+
+func TestSetMetricsHistogram(t *testing.T) {
+	storage := createMemStorageWithoutPersist()
+	h := metric.Histogram{Bounds: []float64{1}, Buckets: []uint64{1}, Sum: 0.5, Count: 2}
+
+	err := storage.SetMetrics([]StorageItem{
+		{MetricName: "lat", Value: h},
+		{MetricName: "lat", Value: h},
+		{MetricName: "cnt", Value: metric.Counter(1)},
+	})
+	assert.NoError(t, err)
+
+	res, err := storage.GetHistogramMetric("lat", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, metric.Histogram{Bounds: []float64{1}, Buckets: []uint64{2}, Sum: 1, Count: 4}, res)
+
+	err = storage.SetMetrics([]StorageItem{
+		{MetricName: "cnt", Value: metric.Counter(1)},
+		{MetricName: "lat", Value: metric.Histogram{Bounds: []float64{2}, Buckets: []uint64{1}, Count: 1}},
+	})
+	assert.ErrorIs(t, err, metric.ErrWrongMetricValue)
+
+	cnt, err := storage.GetCounterMetric("cnt", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, metric.Counter(1), cnt)
+}
+
+func TestSummarySetAndGet(t *testing.T) {
+	storage := createMemStorageWithoutPersist()
+	s1, _ := metric.NewSummaryFromString("1")
+	s2, _ := metric.NewSummaryFromString("3")
+	exp, _ := s1.Merge(s2)
+
+	res, err := storage.SetSummaryMetric("foo", nil, s1)
+	assert.NoError(t, err)
+	assert.Equal(t, s1, res)
+
+	res, err = storage.SetSummaryMetric("foo", nil, s2)
+	assert.NoError(t, err)
+	assert.Equal(t, exp, res)
+
+	res, err = storage.GetSummaryMetric("foo", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, exp, res)
+
+	_, err = storage.GetSummaryMetric("bar", nil)
 	assert.ErrorIs(t, err, ErrMetricNotFound)
+
+	other, _ := metric.NewSummary(0.05)
+	_, err = storage.SetSummaryMetric("foo", nil, other)
+	assert.ErrorIs(t, err, metric.ErrWrongMetricValue)
+}
+
+func TestSetMetricsSummary(t *testing.T) {
+	storage := createMemStorageWithoutPersist()
+	s1, _ := metric.NewSummaryFromString("1")
+	s2, _ := metric.NewSummaryFromString("3")
+	exp, _ := s1.Merge(s2)
+
+	err := storage.SetMetrics([]StorageItem{
+		{MetricName: "lat", Value: s1},
+		{MetricName: "lat", Value: s2},
+	})
+	assert.NoError(t, err)
+
+	res, err := storage.GetSummaryMetric("lat", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, exp, res)
 }
 
 func TestSetMetrics(t *testing.T) {
@@ -84,10 +205,11 @@ func TestSetMetrics(t *testing.T) {
 
 func TestGetAllMetrics(t *testing.T) {
 	storage := createMemStorageWithoutPersist()
-	storage.SetCounterMetric("foo", metric.Counter(5))
-	storage.SetCounterMetric("bar", metric.Counter(10))
-	storage.SetGaugeMetric("fuzz", metric.Gauge(0))
-	storage.SetGaugeMetric("buzz", metric.Gauge(1.23456))
+	storage.SetCounterMetric("foo", nil, metric.Counter(5))
+	storage.SetCounterMetric("bar", nil, metric.Counter(10))
+	storage.SetGaugeMetric("fuzz", nil, metric.Gauge(0))
+	storage.SetGaugeMetric("buzz", nil, metric.Gauge(1.23456))
+	storage.SetHistogramMetric("lat", nil, metric.Histogram{Bounds: []float64{1}, Buckets: []uint64{1}, Sum: 1, Count: 1})
 
 	items, err := storage.GetAllMetrics()
 	assert.NoError(t, err)
@@ -96,9 +218,70 @@ func TestGetAllMetrics(t *testing.T) {
 		{MetricName: "foo", Value: metric.Counter(5)},
 		{MetricName: "buzz", Value: metric.Gauge(1.23456)},
 		{MetricName: "fuzz", Value: metric.Gauge(0)},
+		{MetricName: "lat", Value: metric.Histogram{Bounds: []float64{1}, Buckets: []uint64{1}, Sum: 1, Count: 1}},
+	}, items)
+}
+
+func TestMetricsWithLabels(t *testing.T) {
+	storage := createMemStorageWithoutPersist()
+	storage.SetGaugeMetric("cpu", metric.Labels{"cpu": "1"}, metric.Gauge(10))
+	storage.SetGaugeMetric("cpu", metric.Labels{"cpu": "0"}, metric.Gauge(20))
+	storage.SetGaugeMetric("cpu", nil, metric.Gauge(30))
+	storage.SetCounterMetric("req", metric.Labels{"host": "a"}, metric.Counter(1))
+
+	err := storage.SetMetrics([]StorageItem{
+		{MetricName: "req", Labels: metric.Labels{"host": "a"}, Value: metric.Counter(2)},
+		{MetricName: "req", Labels: metric.Labels{"host": "b"}, Value: metric.Counter(5)},
+	})
+	assert.NoError(t, err)
+
+	gVal, err := storage.GetGaugeMetric("cpu", metric.Labels{"cpu": "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, metric.Gauge(10), gVal)
+
+	cVal, err := storage.GetCounterMetric("req", metric.Labels{"host": "a"})
+	assert.NoError(t, err)
+	assert.Equal(t, metric.Counter(3), cVal)
+
+	_, err = storage.GetCounterMetric("req", nil)
+	assert.ErrorIs(t, err, ErrMetricNotFound)
+
+	items, err := storage.GetAllMetrics()
+	assert.NoError(t, err)
+	assert.Equal(t, []StorageItem{
+		{MetricName: "req", Labels: metric.Labels{"host": "a"}, Value: metric.Counter(3)},
+		{MetricName: "req", Labels: metric.Labels{"host": "b"}, Value: metric.Counter(5)},
+		{MetricName: "cpu", Value: metric.Gauge(30)},
+		{MetricName: "cpu", Labels: metric.Labels{"cpu": "0"}, Value: metric.Gauge(20)},
+		{MetricName: "cpu", Labels: metric.Labels{"cpu": "1"}, Value: metric.Gauge(10)},
 	}, items)
 }
 
+func TestSyncPersistAndRestoreWithLabels(t *testing.T) {
+	tmpFile, err := os.CreateTemp("/tmp", "test")
+	assert.NoError(t, err)
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	logger := logrus.New()
+	storage, err := NewMemStorage(context.TODO(), logger, NewPersistSettings(0, tmpFile.Name(), false), NewHistorySettings(0))
+	assert.NoError(t, err)
+
+	storage.SetCounterMetric("foo", metric.Labels{"host": "a"}, metric.Counter(5))
+	storage.SetGaugeMetric("bar", metric.Labels{"cpu": "3"}, metric.Gauge(4.9))
+
+	storage2, err := NewMemStorage(context.TODO(), logger, NewPersistSettings(0, tmpFile.Name(), true), NewHistorySettings(0))
+	assert.NoError(t, err)
+
+	cVal, err := storage2.GetCounterMetric("foo", metric.Labels{"host": "a"})
+	assert.NoError(t, err)
+	assert.Equal(t, metric.Counter(5), cVal)
+
+	gVal, err := storage2.GetGaugeMetric("bar", metric.Labels{"cpu": "3"})
+	assert.NoError(t, err)
+	assert.Equal(t, metric.Gauge(4.9), gVal)
+}
+
 func TestSyncPersistAndRestore(t *testing.T) {
 	tmpFile, err := os.CreateTemp("/tmp", "test")
 	assert.NoError(t, err)
@@ -106,22 +289,33 @@ func TestSyncPersistAndRestore(t *testing.T) {
 	defer os.Remove(tmpFile.Name())
 
 	logger := logrus.New()
-	storage, err := NewMemStorage(context.TODO(), logger, NewPersistSettings(0, tmpFile.Name(), false))
+	storage, err := NewMemStorage(context.TODO(), logger, NewPersistSettings(0, tmpFile.Name(), false), NewHistorySettings(0))
 	assert.NoError(t, err)
 
-	storage.SetCounterMetric("foo", metric.Counter(5))
-	storage.SetGaugeMetric("bar", metric.Gauge(4.9))
+	storage.SetCounterMetric("foo", nil, metric.Counter(5))
+	storage.SetGaugeMetric("bar", nil, metric.Gauge(4.9))
+	storage.SetHistogramMetric("lat", nil, metric.Histogram{Bounds: []float64{0.5, 1}, Buckets: []uint64{1, 2}, Sum: 1.2, Count: 2})
+	sVal, _ := metric.NewSummaryFromString("-2.5")
+	storage.SetSummaryMetric("sum", nil, sVal)
 
-	storage2, err := NewMemStorage(context.TODO(), logger, NewPersistSettings(0, tmpFile.Name(), true))
+	storage2, err := NewMemStorage(context.TODO(), logger, NewPersistSettings(0, tmpFile.Name(), true), NewHistorySettings(0))
 	assert.NoError(t, err)
 
-	cVal, err := storage2.GetCounterMetric("foo")
+	cVal, err := storage2.GetCounterMetric("foo", nil)
 	assert.NoError(t, err)
 	assert.Equal(t, metric.Counter(5), cVal)
 
-	gVal, err := storage2.GetGaugeMetric("bar")
+	gVal, err := storage2.GetGaugeMetric("bar", nil)
 	assert.NoError(t, err)
 	assert.Equal(t, metric.Gauge(4.9), gVal)
+
+	hVal, err := storage2.GetHistogramMetric("lat", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, metric.Histogram{Bounds: []float64{0.5, 1}, Buckets: []uint64{1, 2}, Sum: 1.2, Count: 2}, hVal)
+
+	sVal2, err := storage2.GetSummaryMetric("sum", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, sVal, sVal2)
 }
 
 func TestSyncIntervalPersistAndRestore(t *testing.T) {
@@ -133,23 +327,23 @@ func TestSyncIntervalPersistAndRestore(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	logger := logrus.New()
-	storage, err := NewMemStorage(ctx, logger, NewPersistSettings(2, tmpFile.Name(), false))
+	storage, err := NewMemStorage(ctx, logger, NewPersistSettings(2, tmpFile.Name(), false), NewHistorySettings(0))
 	assert.NoError(t, err)
 
-	storage.SetCounterMetric("foo", metric.Counter(5))
-	storage.SetGaugeMetric("bar", metric.Gauge(4.9))
+	storage.SetCounterMetric("foo", nil, metric.Counter(5))
+	storage.SetGaugeMetric("bar", nil, metric.Gauge(4.9))
 
 	time.Sleep(5 * time.Second)
 	cancel()
 
-	storage2, err := NewMemStorage(context.TODO(), logger, NewPersistSettings(0, tmpFile.Name(), true))
+	storage2, err := NewMemStorage(context.TODO(), logger, NewPersistSettings(0, tmpFile.Name(), true), NewHistorySettings(0))
 	assert.NoError(t, err)
 
-	cVal, err := storage2.GetCounterMetric("foo")
+	cVal, err := storage2.GetCounterMetric("foo", nil)
 	assert.NoError(t, err)
 	assert.Equal(t, metric.Counter(5), cVal)
 
-	gVal, err := storage2.GetGaugeMetric("bar")
+	gVal, err := storage2.GetGaugeMetric("bar", nil)
 	assert.NoError(t, err)
 	assert.Equal(t, metric.Gauge(4.9), gVal)
 }
@@ -157,7 +351,7 @@ func TestSyncIntervalPersistAndRestore(t *testing.T) {
 func TestRestoreFileOpenError(t *testing.T) {
 	logger := logrus.New()
 
-	_, err := NewMemStorage(context.TODO(), logger, NewPersistSettings(0, "/etc/shadow", true))
+	_, err := NewMemStorage(context.TODO(), logger, NewPersistSettings(0, "/etc/shadow", true), NewHistorySettings(0))
 	assert.Error(t, err)
 }
 
@@ -166,7 +360,7 @@ func TestRestoreFileNotExists(t *testing.T) {
 	defer cancel()
 	logger := logrus.New()
 
-	_, err := NewMemStorage(ctx, logger, NewPersistSettings(0, uuid.NewString(), true))
+	_, err := NewMemStorage(ctx, logger, NewPersistSettings(0, uuid.NewString(), true), NewHistorySettings(0))
 	assert.NoError(t, err)
 }
 
@@ -179,6 +373,8 @@ func TestRestoreFileFormatError(t *testing.T) {
 	}{
 		{name: "wrong json format", fileData: "foobar"},
 		{name: "wrong counter format", fileData: `[{"id":"foo","type":"counter","delta":-123}]`},
+		{name: "wrong histogram format", fileData: `[{"id":"foo","type":"histogram","bounds":[1],"buckets":[2],"sum":1,"count":1}]`},
+		{name: "wrong summary format", fileData: `[{"id":"foo","type":"summary","sketch":{"alpha":2},"sum":0,"count":0}]`},
 	} {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
@@ -188,13 +384,118 @@ func TestRestoreFileFormatError(t *testing.T) {
 			tmpFile.Close()
 			defer os.Remove(tmpFile.Name())
 
-			_, err = NewMemStorage(context.TODO(), logger, NewPersistSettings(0, tmpFile.Name(), true))
+			_, err = NewMemStorage(context.TODO(), logger, NewPersistSettings(0, tmpFile.Name(), true), NewHistorySettings(0))
 			assert.Error(t, err)
 		})
 	}
 
 }
 
+func TestRestoreSanitizeNames(t *testing.T) {
+	logger := logrus.New()
+
+	tmpFile, err := os.CreateTemp("/tmp", "test")
+	assert.NoError(t, err)
+	tmpFile.Write([]byte(`[` +
+		`{"id":"http.requests","type":"counter","delta":5,"labels":{"job-name":"api","1a":"b"}},` +
+		`{"id":"cpu-usage","type":"gauge","value":0.5},` +
+		`{"id":"","type":"gauge","value":1}]`))
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	stg, err := NewMemStorage(context.TODO(), logger, NewPersistSettings(0, tmpFile.Name(), true), NewHistorySettings(0))
+	assert.NoError(t, err)
+
+	cnt, err := stg.GetCounterMetric("http_requests", metric.Labels{"job_name": "api", "_1a": "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, metric.Counter(5), cnt)
+
+	gauge, err := stg.GetGaugeMetric("cpu_usage", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, metric.Gauge(0.5), gauge)
+
+	items, err := stg.GetAllMetrics()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(items))
+}
+
+func TestMetricRangeHistoryDisabled(t *testing.T) {
+	storage := createMemStorageWithoutPersist()
+	storage.SetGaugeMetric("foo", nil, metric.Gauge(1))
+
+	_, err := storage.GetMetricRange(metric.GaugeTypeName, "foo", nil, time.Time{}, time.Now())
+	assert.ErrorIs(t, err, ErrHistoryDisabled)
+}
+
+func TestMetricRange(t *testing.T) {
+	storage := createMemStorageWithHistory(3)
+	labels := metric.Labels{"host": "a"}
+
+	start := time.Now()
+	for i := 1; i <= 4; i++ {
+		storage.SetCounterMetric("foo", labels, metric.Counter(i))
+	}
+	storage.SetGaugeMetric("foo", labels, metric.Gauge(1.5))
+	storage.SetCounterMetric("foo", nil, metric.Counter(100))
+	end := time.Now()
+
+	samples, err := storage.GetMetricRange(metric.CounterTypeName, "foo", labels, start, end)
+	assert.NoError(t, err)
+	assert.Equal(t, []metric.MetricValue{metric.Counter(3), metric.Counter(6), metric.Counter(10)}, sampleValues(samples))
+	for i := 1; i < len(samples); i++ {
+		assert.False(t, samples[i].Timestamp.Before(samples[i-1].Timestamp))
+	}
+
+	samples, err = storage.GetMetricRange(metric.GaugeTypeName, "foo", labels, start, end)
+	assert.NoError(t, err)
+	assert.Equal(t, []metric.MetricValue{metric.Gauge(1.5)}, sampleValues(samples))
+
+	samples, err = storage.GetMetricRange(metric.CounterTypeName, "foo", labels, end.Add(time.Second), end.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Empty(t, samples)
+
+	samples, err = storage.GetMetricRange(metric.CounterTypeName, "bar", nil, start, end)
+	assert.NoError(t, err)
+	assert.Empty(t, samples)
+}
+
+func TestMetricRangeMergeable(t *testing.T) {
+	storage := createMemStorageWithHistory(10)
+
+	start := time.Now()
+	h := metric.Histogram{Bounds: []float64{1}, Buckets: []uint64{1}, Sum: 0.5, Count: 1}
+	storage.SetHistogramMetric("foo", nil, h)
+	storage.SetHistogramMetric("foo", nil, h)
+	end := time.Now()
+
+	samples, err := storage.GetMetricRange(metric.HistogramTypeName, "foo", nil, start, end)
+	assert.NoError(t, err)
+	assert.Equal(t, []metric.MetricValue{
+		h,
+		metric.Histogram{Bounds: []float64{1}, Buckets: []uint64{2}, Sum: 1, Count: 2},
+	}, sampleValues(samples))
+}
+
+func TestMetricRangeSetMetrics(t *testing.T) {
+	storage := createMemStorageWithHistory(10)
+
+	start := time.Now()
+	assert.NoError(t, storage.SetMetrics([]StorageItem{
+		{MetricName: "foo", Value: metric.Counter(1)},
+		{MetricName: "foo", Value: metric.Counter(2)},
+		{MetricName: "bar", Value: metric.Gauge(1)},
+	}))
+	end := time.Now()
+
+	samples, err := storage.GetMetricRange(metric.CounterTypeName, "foo", nil, start, end)
+	assert.NoError(t, err)
+	assert.Equal(t, []metric.MetricValue{metric.Counter(1), metric.Counter(3)}, sampleValues(samples))
+
+	samples, err = storage.GetMetricRange(metric.GaugeTypeName, "bar", nil, start, end)
+	assert.NoError(t, err)
+	assert.Equal(t, []metric.MetricValue{metric.Gauge(1)}, sampleValues(samples))
+}
+
 func TestPing(t *testing.T) {
 	storage := createMemStorageWithoutPersist()
 	assert.True(t, storage.Ping())
@@ -202,7 +503,21 @@ func TestPing(t *testing.T) {
 
 func createMemStorageWithoutPersist() *MemStorage {
 	logger := logrus.New()
-	storage, _ := NewMemStorage(context.TODO(), logger, NewPersistSettings(0, "", false))
+	storage, _ := NewMemStorage(context.TODO(), logger, NewPersistSettings(0, "", false), NewHistorySettings(0))
 	defer storage.Close()
 	return storage
 }
+
+func createMemStorageWithHistory(size int) *MemStorage {
+	logger := logrus.New()
+	storage, _ := NewMemStorage(context.TODO(), logger, NewPersistSettings(0, "", false), NewHistorySettings(size))
+	return storage
+}
+
+func sampleValues(samples []Sample) []metric.MetricValue {
+	values := make([]metric.MetricValue, 0, len(samples))
+	for _, s := range samples {
+		values = append(values, s.Value)
+	}
+	return values
+}
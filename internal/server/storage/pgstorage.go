@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/devldavydov/promytheus/internal/common/metric"
@@ -13,24 +14,28 @@ const _databaseRequestTimeout = 10 * time.Second
 
 // PgStorage represents PostgreSQL metrics storage functionality.
 type PgStorage struct {
-	db     *sql.DB
-	logger *logrus.Logger
+	db              *sql.DB
+	logger          *logrus.Logger
+	historySettings HistorySettings
 }
 
 type tableRow struct {
-	id    string
-	mtype string
-	delta sql.NullInt64
-	value sql.NullFloat64
+	id        string
+	mtype     string
+	labels    []byte
+	histogram []byte
+	summary   []byte
+	delta     sql.NullInt64
+	value     sql.NullFloat64
 }
 
-func NewPgStorage(pgConnString string, logger *logrus.Logger) (*PgStorage, error) {
+func NewPgStorage(pgConnString string, logger *logrus.Logger, historySettings HistorySettings) (*PgStorage, error) {
 	db, err := sql.Open("postgres", pgConnString)
 	if err != nil {
 		return nil, err
 	}
 
-	pgstorage := &PgStorage{db: db, logger: logger}
+	pgstorage := &PgStorage{db: db, logger: logger, historySettings: historySettings}
 
 	if err = pgstorage.init(); err != nil {
 		return nil, err
@@ -41,26 +46,43 @@ func NewPgStorage(pgConnString string, logger *logrus.Logger) (*PgStorage, error
 
 var _ Storage = (*PgStorage)(nil)
 
-func (pgstorage *PgStorage) SetGaugeMetric(metricName string, value metric.Gauge) (metric.Gauge, error) {
+func (pgstorage *PgStorage) SetGaugeMetric(metricName string, labels metric.Labels, value metric.Gauge) (metric.Gauge, error) {
+	if err := validateSeries(metricName, labels); err != nil {
+		return 0, err
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), _databaseRequestTimeout)
 	defer cancel()
 
-	var val metric.Gauge
-	err := pgstorage.db.QueryRowContext(ctx, _sqlUpsertGauge, metricName, metric.GaugeTypeName, value).Scan(&val)
+	tx, err := pgstorage.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
+	var val metric.Gauge
+	err = tx.QueryRowContext(ctx, _sqlUpsertGauge, metricName, metric.GaugeTypeName, labelsToJSON(labels), value).Scan(&val)
 	if err != nil {
 		return 0, err
 	}
 
+	if err = pgstorage.appendSample(ctx, tx, metricName, labels, val); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
 	return val, nil
 }
 
-func (pgstorage *PgStorage) GetGaugeMetric(metricName string) (metric.Gauge, error) {
+func (pgstorage *PgStorage) GetGaugeMetric(metricName string, labels metric.Labels) (metric.Gauge, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), _databaseRequestTimeout)
 	defer cancel()
 
 	var val metric.Gauge
-	err := pgstorage.db.QueryRowContext(ctx, _sqlSelectGauge, metricName, metric.GaugeTypeName).Scan(&val)
+	err := pgstorage.db.QueryRowContext(ctx, _sqlSelectGauge, metricName, metric.GaugeTypeName, labelsToJSON(labels)).Scan(&val)
 
 	switch {
 	case err == sql.ErrNoRows:
@@ -72,26 +94,43 @@ func (pgstorage *PgStorage) GetGaugeMetric(metricName string) (metric.Gauge, err
 	return val, nil
 }
 
-func (pgstorage *PgStorage) SetCounterMetric(metricName string, value metric.Counter) (metric.Counter, error) {
+func (pgstorage *PgStorage) SetCounterMetric(metricName string, labels metric.Labels, value metric.Counter) (metric.Counter, error) {
+	if err := validateSeries(metricName, labels); err != nil {
+		return 0, err
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), _databaseRequestTimeout)
 	defer cancel()
 
-	var val metric.Counter
-	err := pgstorage.db.QueryRowContext(ctx, _sqlUpsertCounter, metricName, metric.CounterTypeName, value).Scan(&val)
+	tx, err := pgstorage.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
+	var val metric.Counter
+	err = tx.QueryRowContext(ctx, _sqlUpsertCounter, metricName, metric.CounterTypeName, labelsToJSON(labels), value).Scan(&val)
 	if err != nil {
 		return 0, err
 	}
 
+	if err = pgstorage.appendSample(ctx, tx, metricName, labels, val); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
 	return val, nil
 }
 
-func (pgstorage *PgStorage) GetCounterMetric(metricName string) (metric.Counter, error) {
+func (pgstorage *PgStorage) GetCounterMetric(metricName string, labels metric.Labels) (metric.Counter, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), _databaseRequestTimeout)
 	defer cancel()
 
 	var val metric.Counter
-	err := pgstorage.db.QueryRowContext(ctx, _sqlSelectCounter, metricName, metric.CounterTypeName).Scan(&val)
+	err := pgstorage.db.QueryRowContext(ctx, _sqlSelectCounter, metricName, metric.CounterTypeName, labelsToJSON(labels)).Scan(&val)
 
 	switch {
 	case err == sql.ErrNoRows:
@@ -103,7 +142,27 @@ func (pgstorage *PgStorage) GetCounterMetric(metricName string) (metric.Counter,
 	return val, nil
 }
 
+func (pgstorage *PgStorage) SetHistogramMetric(metricName string, labels metric.Labels, value metric.Histogram) (metric.Histogram, error) {
+	return setJSONMetric(pgstorage, _histogramSQL, metricName, labels, value, histogramFromJSON)
+}
+
+func (pgstorage *PgStorage) GetHistogramMetric(metricName string, labels metric.Labels) (metric.Histogram, error) {
+	return getJSONMetric(pgstorage.db, _histogramSQL, metricName, labels, histogramFromJSON)
+}
+
+func (pgstorage *PgStorage) SetSummaryMetric(metricName string, labels metric.Labels, value metric.Summary) (metric.Summary, error) {
+	return setJSONMetric(pgstorage, _summarySQL, metricName, labels, value, summaryFromJSON)
+}
+
+func (pgstorage *PgStorage) GetSummaryMetric(metricName string, labels metric.Labels) (metric.Summary, error) {
+	return getJSONMetric(pgstorage.db, _summarySQL, metricName, labels, summaryFromJSON)
+}
+
 func (pgstorage *PgStorage) SetMetrics(metricList []StorageItem) error {
+	if err := validateItems(metricList); err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), _databaseRequestTimeout)
 	defer cancel()
 
@@ -128,22 +187,48 @@ func (pgstorage *PgStorage) SetMetrics(metricList []StorageItem) error {
 
 	// DB operations
 	for _, metricItem := range metricList {
+		var val metric.MetricValue
+
 		switch metricItem.Value.TypeName() {
 		case metric.CounterTypeName:
-			_, err = stmtCounter.ExecContext(ctx,
+			var counterVal metric.Counter
+			err = stmtCounter.QueryRowContext(ctx,
 				metricItem.MetricName,
 				metric.CounterTypeName,
-				metricItem.Value.(metric.Counter))
+				labelsToJSON(metricItem.Labels),
+				metricItem.Value.(metric.Counter)).Scan(&counterVal)
+			val = counterVal
 		case metric.GaugeTypeName:
-			_, err = stmtGauge.ExecContext(ctx,
+			var gaugeVal metric.Gauge
+			err = stmtGauge.QueryRowContext(ctx,
 				metricItem.MetricName,
 				metric.GaugeTypeName,
-				metricItem.Value.(metric.Gauge))
+				labelsToJSON(metricItem.Labels),
+				metricItem.Value.(metric.Gauge)).Scan(&gaugeVal)
+			val = gaugeVal
+		case metric.HistogramTypeName:
+			val, err = setJSONMetricTx(ctx, tx, _histogramSQL,
+				metricItem.MetricName,
+				metricItem.Labels,
+				metricItem.Value.(metric.Histogram),
+				histogramFromJSON)
+		case metric.SummaryTypeName:
+			val, err = setJSONMetricTx(ctx, tx, _summarySQL,
+				metricItem.MetricName,
+				metricItem.Labels,
+				metricItem.Value.(metric.Summary),
+				summaryFromJSON)
+		default:
+			continue
 		}
 
 		if err != nil {
 			return err
 		}
+
+		if err = pgstorage.appendSample(ctx, tx, metricItem.MetricName, metricItem.Labels, val); err != nil {
+			return err
+		}
 	}
 
 	return tx.Commit()
@@ -164,17 +249,28 @@ func (pgstorage *PgStorage) GetAllMetrics() ([]StorageItem, error) {
 
 	for rows.Next() {
 		var r tableRow
-		err = rows.Scan(&r.id, &r.mtype, &r.delta, &r.value)
+		err = rows.Scan(&r.id, &r.mtype, &r.labels, &r.delta, &r.value, &r.histogram, &r.summary)
 		if err != nil {
 			return nil, err
 		}
 
 		item := StorageItem{MetricName: r.id}
+		if item.Labels, err = labelsFromJSON(r.labels); err != nil {
+			return nil, err
+		}
 
 		if r.mtype == metric.CounterTypeName {
 			item.Value = metric.Counter(r.delta.Int64)
 		} else if r.mtype == metric.GaugeTypeName {
 			item.Value = metric.Gauge(r.value.Float64)
+		} else if r.mtype == metric.HistogramTypeName {
+			if item.Value, err = histogramFromJSON(r.histogram); err != nil {
+				return nil, err
+			}
+		} else if r.mtype == metric.SummaryTypeName {
+			if item.Value, err = summaryFromJSON(r.summary); err != nil {
+				return nil, err
+			}
 		}
 
 		items = append(items, item)
@@ -187,6 +283,59 @@ func (pgstorage *PgStorage) GetAllMetrics() ([]StorageItem, error) {
 	return items, nil
 }
 
+func (pgstorage *PgStorage) GetMetricRange(metricType, metricName string, labels metric.Labels, from, to time.Time) ([]Sample, error) {
+	if !pgstorage.historySettings.Enabled() {
+		return nil, ErrHistoryDisabled
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), _databaseRequestTimeout)
+	defer cancel()
+
+	rows, err := pgstorage.db.QueryContext(ctx, _sqlSelectSampleRange, metricName, metricType, labelsToJSON(labels), from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	samples := []Sample{}
+	for rows.Next() {
+		var (
+			ts    time.Time
+			delta sql.NullInt64
+			value sql.NullFloat64
+			data  []byte
+		)
+		if err = rows.Scan(&ts, &delta, &value, &data); err != nil {
+			return nil, err
+		}
+
+		sample := Sample{Timestamp: ts}
+		switch metricType {
+		case metric.CounterTypeName:
+			sample.Value = metric.Counter(delta.Int64)
+		case metric.GaugeTypeName:
+			sample.Value = metric.Gauge(value.Float64)
+		case metric.HistogramTypeName:
+			if sample.Value, err = histogramFromJSON(data); err != nil {
+				return nil, err
+			}
+		case metric.SummaryTypeName:
+			if sample.Value, err = summaryFromJSON(data); err != nil {
+				return nil, err
+			}
+		}
+
+		samples = append(samples, sample)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
 func (pgstorage *PgStorage) Ping() bool {
 	ctx, cancel := context.WithTimeout(context.Background(), _databaseRequestTimeout)
 	defer cancel()
@@ -219,5 +368,236 @@ func (pgstorage *PgStorage) init() error {
 		return err
 	}
 
+	_, err = pgstorage.db.ExecContext(ctx, _sqlMigrateLabels)
+	if err != nil {
+		return err
+	}
+
+	_, err = pgstorage.db.ExecContext(ctx, _sqlMigrateHistogram)
+	if err != nil {
+		return err
+	}
+
+	_, err = pgstorage.db.ExecContext(ctx, _sqlMigrateSummary)
+	if err != nil {
+		return err
+	}
+
+	_, err = pgstorage.db.ExecContext(ctx, _sqlCreateSampleTable)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
+
+// appendSample inserts value to samples table within transaction, if history
+// enabled. Samples of series, older than last history size ones, are deleted.
+func (pgstorage *PgStorage) appendSample(ctx context.Context, tx *sql.Tx, metricName string, labels metric.Labels, value metric.MetricValue) error {
+	if !pgstorage.historySettings.Enabled() {
+		return nil
+	}
+
+	var (
+		delta sql.NullInt64
+		val   sql.NullFloat64
+		data  sql.NullString
+	)
+	switch v := value.(type) {
+	case metric.Counter:
+		delta = sql.NullInt64{Int64: int64(v), Valid: true}
+	case metric.Gauge:
+		val = sql.NullFloat64{Float64: float64(v), Valid: true}
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		data = sql.NullString{String: string(b), Valid: true}
+	}
+
+	jsonLabels := labelsToJSON(labels)
+	_, err := tx.ExecContext(ctx, _sqlInsertSample, metricName, value.TypeName(), jsonLabels, delta, val, data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, _sqlDeleteOldSamples, metricName, value.TypeName(), jsonLabels, pgstorage.historySettings.Size)
+	return err
+}
+
+func labelsToJSON(labels metric.Labels) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+	b, _ := json.Marshal(labels)
+	return string(b)
+}
+
+func labelsFromJSON(data []byte) (metric.Labels, error) {
+	var labels metric.Labels
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return nil, err
+	}
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	return labels, nil
+}
+
+// jsonMetricSQL - queries for metric type, stored as JSON and merged on update.
+type jsonMetricSQL struct {
+	insert          string
+	selectForUpdate string
+	update          string
+	selectOne       string
+}
+
+var (
+	_histogramSQL = jsonMetricSQL{
+		insert:          _sqlInsertHistogram,
+		selectForUpdate: _sqlSelectHistogramForUpdate,
+		update:          _sqlUpdateHistogram,
+		selectOne:       _sqlSelectHistogram,
+	}
+	_summarySQL = jsonMetricSQL{
+		insert:          _sqlInsertSummary,
+		selectForUpdate: _sqlSelectSummaryForUpdate,
+		update:          _sqlUpdateSummary,
+		selectOne:       _sqlSelectSummary,
+	}
+)
+
+func setJSONMetric[T mergeable[T]](
+	pgstorage *PgStorage,
+	queries jsonMetricSQL,
+	metricName string,
+	labels metric.Labels,
+	value T,
+	fromJSON func([]byte) (T, error),
+) (T, error) {
+	var empty T
+	if err := validateSeries(metricName, labels); err != nil {
+		return empty, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), _databaseRequestTimeout)
+	defer cancel()
+
+	tx, err := pgstorage.db.BeginTx(ctx, nil)
+	if err != nil {
+		return empty, err
+	}
+	defer tx.Rollback()
+
+	val, err := setJSONMetricTx(ctx, tx, queries, metricName, labels, value, fromJSON)
+	if err != nil {
+		return empty, err
+	}
+
+	if err = pgstorage.appendSample(ctx, tx, metricName, labels, val); err != nil {
+		return empty, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return empty, err
+	}
+
+	return val, nil
+}
+
+// setJSONMetricTx merges value with stored one within transaction.
+// Row is inserted first, so concurrent writers serialize on row lock.
+func setJSONMetricTx[T mergeable[T]](
+	ctx context.Context,
+	tx *sql.Tx,
+	queries jsonMetricSQL,
+	metricName string,
+	labels metric.Labels,
+	value T,
+	fromJSON func([]byte) (T, error),
+) (T, error) {
+	var empty T
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return empty, err
+	}
+
+	mtype, labelsJSON := value.TypeName(), labelsToJSON(labels)
+
+	var stored []byte
+	err = tx.QueryRowContext(ctx, queries.insert, metricName, mtype, labelsJSON, string(data)).Scan(&stored)
+	switch {
+	case err == nil:
+		return value, nil
+	case err != sql.ErrNoRows:
+		return empty, err
+	}
+
+	err = tx.QueryRowContext(ctx, queries.selectForUpdate, metricName, mtype, labelsJSON).Scan(&stored)
+	if err != nil {
+		return empty, err
+	}
+
+	cur, err := fromJSON(stored)
+	if err != nil {
+		return empty, err
+	}
+
+	val, err := cur.Merge(value)
+	if err != nil {
+		return empty, err
+	}
+
+	if data, err = json.Marshal(val); err != nil {
+		return empty, err
+	}
+
+	if _, err = tx.ExecContext(ctx, queries.update, metricName, mtype, labelsJSON, string(data)); err != nil {
+		return empty, err
+	}
+
+	return val, nil
+}
+
+func getJSONMetric[T mergeable[T]](
+	db *sql.DB,
+	queries jsonMetricSQL,
+	metricName string,
+	labels metric.Labels,
+	fromJSON func([]byte) (T, error),
+) (T, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), _databaseRequestTimeout)
+	defer cancel()
+
+	var empty T
+
+	var data []byte
+	err := db.QueryRowContext(ctx, queries.selectOne, metricName, empty.TypeName(), labelsToJSON(labels)).Scan(&data)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return empty, ErrMetricNotFound
+	case err != nil:
+		return empty, err
+	}
+
+	return fromJSON(data)
+}
+
+func histogramFromJSON(data []byte) (metric.Histogram, error) {
+	var val metric.Histogram
+	if err := json.Unmarshal(data, &val); err != nil {
+		return metric.Histogram{}, err
+	}
+	return metric.NewHistogramFromParts(val.Bounds, val.Buckets, &val.Sum, &val.Count)
+}
+
+func summaryFromJSON(data []byte) (metric.Summary, error) {
+	var val metric.Summary
+	if err := json.Unmarshal(data, &val); err != nil {
+		return metric.Summary{}, err
+	}
+	return metric.NewSummaryFromParts(&val.Sketch, &val.Sum, &val.Count)
+}
@@ -3,41 +3,162 @@ package storage
 const (
 	_sqlCreateTable = `
 	CREATE TABLE IF NOT EXISTS metric (
-		id    text NOT NULL,
-		mtype text NOT NULL,
-		delta bigint,
-		value double precision,
+		id        text NOT NULL,
+		mtype     text NOT NULL,
+		labels    jsonb NOT NULL DEFAULT '{}',
+		delta     bigint,
+		value     double precision,
+		histogram jsonb,
+		summary   jsonb,
 		
-		PRIMARY KEY (id, mtype),
-		CHECK(mtype IN ('counter', 'gauge')),
-		CHECK(mtype = 'counter' AND delta IS NOT NULL OR mtype = 'gauge' AND value IS NOT NULL)
+		PRIMARY KEY (id, mtype, labels),
+		CHECK(mtype IN ('counter', 'gauge', 'histogram', 'summary')),
+		CHECK(mtype = 'counter' AND delta IS NOT NULL OR mtype = 'gauge' AND value IS NOT NULL OR
+			mtype = 'histogram' AND histogram IS NOT NULL OR mtype = 'summary' AND summary IS NOT NULL)
 	);
 	`
+	_sqlMigrateLabels = `
+	DO $$
+	BEGIN
+		IF NOT EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'metric' AND column_name = 'labels'
+		) THEN
+			ALTER TABLE metric ADD COLUMN labels jsonb NOT NULL DEFAULT '{}';
+			ALTER TABLE metric DROP CONSTRAINT metric_pkey;
+			ALTER TABLE metric ADD PRIMARY KEY (id, mtype, labels);
+		END IF;
+	END $$;
+	`
+	_sqlMigrateHistogram = `
+	DO $$
+	BEGIN
+		IF NOT EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'metric' AND column_name = 'histogram'
+		) THEN
+			ALTER TABLE metric ADD COLUMN histogram jsonb;
+			ALTER TABLE metric DROP CONSTRAINT IF EXISTS metric_mtype_check;
+			ALTER TABLE metric DROP CONSTRAINT IF EXISTS metric_check;
+			ALTER TABLE metric ADD CONSTRAINT metric_mtype_check
+				CHECK(mtype IN ('counter', 'gauge', 'histogram'));
+			ALTER TABLE metric ADD CONSTRAINT metric_check
+				CHECK(mtype = 'counter' AND delta IS NOT NULL OR mtype = 'gauge' AND value IS NOT NULL OR mtype = 'histogram' AND histogram IS NOT NULL);
+		END IF;
+	END $$;
+	`
+	_sqlMigrateSummary = `
+	DO $$
+	BEGIN
+		IF NOT EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'metric' AND column_name = 'summary'
+		) THEN
+			ALTER TABLE metric ADD COLUMN summary jsonb;
+			ALTER TABLE metric DROP CONSTRAINT IF EXISTS metric_mtype_check;
+			ALTER TABLE metric DROP CONSTRAINT IF EXISTS metric_check;
+			ALTER TABLE metric ADD CONSTRAINT metric_mtype_check
+				CHECK(mtype IN ('counter', 'gauge', 'histogram', 'summary'));
+			ALTER TABLE metric ADD CONSTRAINT metric_check
+				CHECK(mtype = 'counter' AND delta IS NOT NULL OR mtype = 'gauge' AND value IS NOT NULL OR
+					mtype = 'histogram' AND histogram IS NOT NULL OR mtype = 'summary' AND summary IS NOT NULL);
+		END IF;
+	END $$;
+	`
+	_sqlCreateSampleTable = `
+	CREATE TABLE IF NOT EXISTS metric_sample (
+		seq    bigserial PRIMARY KEY,
+		id     text NOT NULL,
+		mtype  text NOT NULL,
+		labels jsonb NOT NULL DEFAULT '{}',
+		ts     timestamptz NOT NULL DEFAULT now(),
+		delta  bigint,
+		value  double precision,
+		data   jsonb
+	);
+	CREATE INDEX IF NOT EXISTS metric_sample_series_idx ON metric_sample (id, mtype, labels, ts);
+	`
 	_sqlUpsertGauge = `
-	INSERT INTO metric (id, mtype, value)
-	VALUES ($1, $2, $3)
-	ON CONFLICT (id, mtype) DO UPDATE
-	SET value = $3
+	INSERT INTO metric (id, mtype, labels, value)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (id, mtype, labels) DO UPDATE
+	SET value = $4
 	RETURNING value
 	`
 	_sqlSelectGauge = `
 	SELECT value FROM metric
-	WHERE id=$1 AND mtype=$2
+	WHERE id=$1 AND mtype=$2 AND labels=$3
 	`
 	_sqlUpsertCounter = `
-	INSERT INTO metric (id, mtype, delta)
-	VALUES ($1, $2, $3)
-	ON CONFLICT (id, mtype) DO UPDATE
-	SET delta = metric.delta + $3
+	INSERT INTO metric (id, mtype, labels, delta)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (id, mtype, labels) DO UPDATE
+	SET delta = metric.delta + $4
 	RETURNING delta
 	`
 	_sqlSelectCounter = `
 	SELECT delta FROM metric
-	WHERE id=$1 AND mtype=$2
+	WHERE id=$1 AND mtype=$2 AND labels=$3
+	`
+	_sqlInsertHistogram = `
+	INSERT INTO metric (id, mtype, labels, histogram)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (id, mtype, labels) DO NOTHING
+	RETURNING histogram
+	`
+	_sqlSelectHistogramForUpdate = `
+	SELECT histogram FROM metric
+	WHERE id=$1 AND mtype=$2 AND labels=$3
+	FOR UPDATE
+	`
+	_sqlUpdateHistogram = `
+	UPDATE metric SET histogram = $4
+	WHERE id=$1 AND mtype=$2 AND labels=$3
+	`
+	_sqlSelectHistogram = `
+	SELECT histogram FROM metric
+	WHERE id=$1 AND mtype=$2 AND labels=$3
+	`
+	_sqlInsertSummary = `
+	INSERT INTO metric (id, mtype, labels, summary)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (id, mtype, labels) DO NOTHING
+	RETURNING summary
+	`
+	_sqlSelectSummaryForUpdate = `
+	SELECT summary FROM metric
+	WHERE id=$1 AND mtype=$2 AND labels=$3
+	FOR UPDATE
+	`
+	_sqlUpdateSummary = `
+	UPDATE metric SET summary = $4
+	WHERE id=$1 AND mtype=$2 AND labels=$3
+	`
+	_sqlSelectSummary = `
+	SELECT summary FROM metric
+	WHERE id=$1 AND mtype=$2 AND labels=$3
 	`
 	_sqlSelectAllMetrics = `
-	SELECT id, mtype, delta, value
+	SELECT id, mtype, labels, delta, value, histogram, summary
 	FROM metric
-	ORDER BY mtype, id
+	ORDER BY mtype, id, labels
+	`
+	_sqlInsertSample = `
+	INSERT INTO metric_sample (id, mtype, labels, delta, value, data)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_sqlDeleteOldSamples = `
+	DELETE FROM metric_sample
+	WHERE seq IN (
+		SELECT seq FROM metric_sample
+		WHERE id=$1 AND mtype=$2 AND labels=$3
+		ORDER BY ts DESC, seq DESC
+		OFFSET $4
+	)
+	`
+	_sqlSelectSampleRange = `
+	SELECT ts, delta, value, data FROM metric_sample
+	WHERE id=$1 AND mtype=$2 AND labels=$3 AND ts BETWEEN $4 AND $5
+	ORDER BY ts, seq
 	`
 )
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/devldavydov/promytheus/internal/common/metric"
 	"github.com/google/uuid"
@@ -26,7 +27,7 @@ type PgStorageSuite struct {
 
 func (pg *PgStorageSuite) SetupTest() {
 	var err error
-	pg.stg, err = NewPgStorage(os.Getenv(_envTestDatabaseDsn), logger)
+	pg.stg, err = NewPgStorage(os.Getenv(_envTestDatabaseDsn), logger, NewHistorySettings(10))
 	require.NoError(pg.T(), err)
 }
 
@@ -42,13 +43,13 @@ func (pg *PgStorageSuite) TestSetGaugeMetric() {
 	metricName := uuid.NewString()
 
 	pg.Run("set first value", func() {
-		val, err := pg.stg.SetGaugeMetric(metricName, metric.Gauge(123.123))
+		val, err := pg.stg.SetGaugeMetric(metricName, nil, metric.Gauge(123.123))
 		pg.NoError(err)
 		pg.Equal(metric.Gauge(123.123), val)
 	})
 
 	pg.Run("set second value", func() {
-		val, err := pg.stg.SetGaugeMetric(metricName, metric.Gauge(456))
+		val, err := pg.stg.SetGaugeMetric(metricName, nil, metric.Gauge(456))
 		pg.NoError(err)
 		pg.Equal(metric.Gauge(456), val)
 	})
@@ -58,15 +59,15 @@ func (pg *PgStorageSuite) TestGetGaugeMetric() {
 	metricName := uuid.NewString()
 
 	pg.Run("get metric - error not found", func() {
-		_, err := pg.stg.GetGaugeMetric(metricName)
+		_, err := pg.stg.GetGaugeMetric(metricName, nil)
 		pg.ErrorIs(err, ErrMetricNotFound)
 	})
 
 	pg.Run("set and get metric", func() {
-		_, err := pg.stg.SetGaugeMetric(metricName, metric.Gauge(123.123))
+		_, err := pg.stg.SetGaugeMetric(metricName, nil, metric.Gauge(123.123))
 		pg.NoError(err)
 
-		val, err := pg.stg.GetGaugeMetric(metricName)
+		val, err := pg.stg.GetGaugeMetric(metricName, nil)
 		pg.NoError(err)
 		pg.Equal(metric.Gauge(123.123), val)
 	})
@@ -76,13 +77,13 @@ func (pg *PgStorageSuite) TestSetCounterMetric() {
 	metricName := uuid.NewString()
 
 	pg.Run("set first value", func() {
-		val, err := pg.stg.SetCounterMetric(metricName, metric.Counter(1))
+		val, err := pg.stg.SetCounterMetric(metricName, nil, metric.Counter(1))
 		pg.NoError(err)
 		pg.Equal(metric.Counter(1), val)
 	})
 
 	pg.Run("set second value", func() {
-		val, err := pg.stg.SetCounterMetric(metricName, metric.Counter(9))
+		val, err := pg.stg.SetCounterMetric(metricName, nil, metric.Counter(9))
 		pg.NoError(err)
 		pg.Equal(metric.Counter(10), val)
 	})
@@ -92,20 +93,128 @@ func (pg *PgStorageSuite) TestGetCounterMetric() {
 	metricName := uuid.NewString()
 
 	pg.Run("get metric - error not found", func() {
-		_, err := pg.stg.GetCounterMetric(metricName)
+		_, err := pg.stg.GetCounterMetric(metricName, nil)
 		pg.ErrorIs(err, ErrMetricNotFound)
 	})
 
 	pg.Run("set and get metric", func() {
-		_, err := pg.stg.SetCounterMetric(metricName, metric.Counter(123))
+		_, err := pg.stg.SetCounterMetric(metricName, nil, metric.Counter(123))
 		pg.NoError(err)
 
-		val, err := pg.stg.GetCounterMetric(metricName)
+		val, err := pg.stg.GetCounterMetric(metricName, nil)
 		pg.NoError(err)
 		pg.Equal(metric.Counter(123), val)
 	})
 }
 
+func (pg *PgStorageSuite) TestSetAndGetHistogramMetric() {
+	metricName := uuid.NewString()
+	h := metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{1, 2}, Sum: 1.5, Count: 3}
+
+	pg.Run("get metric - error not found", func() {
+		_, err := pg.stg.GetHistogramMetric(metricName, nil)
+		pg.ErrorIs(err, ErrMetricNotFound)
+	})
+
+	pg.Run("set first value", func() {
+		val, err := pg.stg.SetHistogramMetric(metricName, nil, h)
+		pg.NoError(err)
+		pg.Equal(h, val)
+	})
+
+	pg.Run("set second value", func() {
+		val, err := pg.stg.SetHistogramMetric(metricName, nil, h)
+		pg.NoError(err)
+		pg.Equal(metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{2, 4}, Sum: 3, Count: 6}, val)
+	})
+
+	pg.Run("set metrics batch", func() {
+		err := pg.stg.SetMetrics([]StorageItem{
+			{MetricName: metricName, Value: h},
+			{MetricName: metricName, Value: h},
+		})
+		pg.NoError(err)
+
+		val, err := pg.stg.GetHistogramMetric(metricName, nil)
+		pg.NoError(err)
+		pg.Equal(metric.Histogram{Bounds: []float64{0.1, 1}, Buckets: []uint64{4, 8}, Sum: 6, Count: 12}, val)
+	})
+
+	pg.Run("set bounds mismatch", func() {
+		_, err := pg.stg.SetHistogramMetric(metricName, nil, metric.Histogram{Bounds: []float64{1}, Buckets: []uint64{1}, Count: 1})
+		pg.ErrorIs(err, metric.ErrWrongMetricValue)
+	})
+}
+
+func (pg *PgStorageSuite) TestSetAndGetSummaryMetric() {
+	metricName := uuid.NewString()
+	s1, _ := metric.NewSummaryFromString("1")
+	s2, _ := metric.NewSummaryFromString("3")
+	exp, _ := s1.Merge(s2)
+
+	pg.Run("get metric - error not found", func() {
+		_, err := pg.stg.GetSummaryMetric(metricName, nil)
+		pg.ErrorIs(err, ErrMetricNotFound)
+	})
+
+	pg.Run("set values", func() {
+		val, err := pg.stg.SetSummaryMetric(metricName, nil, s1)
+		pg.NoError(err)
+		pg.Equal(s1, val)
+
+		err = pg.stg.SetMetrics([]StorageItem{{MetricName: metricName, Value: s2}})
+		pg.NoError(err)
+
+		val, err = pg.stg.GetSummaryMetric(metricName, nil)
+		pg.NoError(err)
+		pg.Equal(exp, val)
+	})
+}
+
+func (pg *PgStorageSuite) TestMetricsWithLabels() {
+	metricName := uuid.NewString()
+
+	pg.Run("set metrics with different labels", func() {
+		_, err := pg.stg.SetCounterMetric(metricName, metric.Labels{"host": "a"}, metric.Counter(1))
+		pg.NoError(err)
+
+		err = pg.stg.SetMetrics([]StorageItem{
+			{MetricName: metricName, Labels: metric.Labels{"host": "a"}, Value: metric.Counter(2)},
+			{MetricName: metricName, Labels: metric.Labels{"host": "b"}, Value: metric.Counter(5)},
+		})
+		pg.NoError(err)
+	})
+
+	pg.Run("get metrics by labels", func() {
+		val, err := pg.stg.GetCounterMetric(metricName, metric.Labels{"host": "a"})
+		pg.NoError(err)
+		pg.Equal(metric.Counter(3), val)
+
+		val, err = pg.stg.GetCounterMetric(metricName, metric.Labels{"host": "b"})
+		pg.NoError(err)
+		pg.Equal(metric.Counter(5), val)
+
+		_, err = pg.stg.GetCounterMetric(metricName, nil)
+		pg.ErrorIs(err, ErrMetricNotFound)
+	})
+
+	pg.Run("get all with labels", func() {
+		lst, err := pg.stg.GetAllMetrics()
+		pg.NoError(err)
+
+		var found []StorageItem
+		for _, item := range lst {
+			if item.MetricName == metricName {
+				found = append(found, item)
+			}
+		}
+		pg.Equal([]StorageItem{
+			{MetricName: metricName, Labels: metric.Labels{"host": "a"}, Value: metric.Counter(3)},
+			{MetricName: metricName, Labels: metric.Labels{"host": "b"}, Value: metric.Counter(5)},
+		}, found)
+	})
+}
+
 func (pg *PgStorageSuite) TestBatchSetAndGet() {
 	gaugeMetric, counterMetric := uuid.NewString(), uuid.NewString()
 
@@ -148,6 +257,64 @@ func (pg *PgStorageSuite) TestBatchSetAndGet() {
 	})
 }
 
+func (pg *PgStorageSuite) TestGetMetricRange() {
+	metricName := uuid.NewString()
+	labels := metric.Labels{"host": "a"}
+	from, to := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	pg.Run("no samples", func() {
+		samples, err := pg.stg.GetMetricRange(metric.CounterTypeName, metricName, labels, from, to)
+		pg.NoError(err)
+		pg.Empty(samples)
+	})
+
+	pg.Run("samples of single and batch set", func() {
+		_, err := pg.stg.SetCounterMetric(metricName, labels, metric.Counter(1))
+		pg.NoError(err)
+		pg.NoError(pg.stg.SetMetrics([]StorageItem{
+			{MetricName: metricName, Labels: labels, Value: metric.Counter(2)},
+			{MetricName: metricName, Labels: labels, Value: metric.Gauge(1.5)},
+		}))
+
+		samples, err := pg.stg.GetMetricRange(metric.CounterTypeName, metricName, labels, from, to)
+		pg.NoError(err)
+		pg.Equal([]metric.MetricValue{metric.Counter(1), metric.Counter(3)}, sampleValues(samples))
+
+		samples, err = pg.stg.GetMetricRange(metric.GaugeTypeName, metricName, labels, from, to)
+		pg.NoError(err)
+		pg.Equal([]metric.MetricValue{metric.Gauge(1.5)}, sampleValues(samples))
+	})
+
+	pg.Run("histogram samples", func() {
+		h := metric.Histogram{Bounds: []float64{1}, Buckets: []uint64{1}, Sum: 0.5, Count: 1}
+		_, err := pg.stg.SetHistogramMetric(metricName, nil, h)
+		pg.NoError(err)
+
+		samples, err := pg.stg.GetMetricRange(metric.HistogramTypeName, metricName, nil, from, to)
+		pg.NoError(err)
+		pg.Equal([]metric.MetricValue{h}, sampleValues(samples))
+	})
+
+	pg.Run("samples retention", func() {
+		for i := 0; i < 12; i++ {
+			_, err := pg.stg.SetGaugeMetric(metricName, nil, metric.Gauge(i))
+			pg.NoError(err)
+		}
+
+		samples, err := pg.stg.GetMetricRange(metric.GaugeTypeName, metricName, nil, from, to)
+		pg.NoError(err)
+		pg.Len(samples, 10)
+		pg.Equal(metric.Gauge(2), samples[0].Value)
+		pg.Equal(metric.Gauge(11), samples[9].Value)
+	})
+
+	pg.Run("out of range", func() {
+		samples, err := pg.stg.GetMetricRange(metric.CounterTypeName, metricName, labels, to, to.Add(time.Hour))
+		pg.NoError(err)
+		pg.Empty(samples)
+	})
+}
+
 func TestPgStorageSuite(t *testing.T) {
 	_, ok := os.LookupEnv(_envTestDatabaseDsn)
 	if !ok {
@@ -158,6 +325,6 @@ func TestPgStorageSuite(t *testing.T) {
 }
 
 func TestPgStorageCreateError(t *testing.T) {
-	_, err := NewPgStorage("FooBar", logger)
+	_, err := NewPgStorage("FooBar", logger, NewHistorySettings(0))
 	assert.Error(t, err)
 }
@@ -2,30 +2,68 @@
 package storage
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/devldavydov/promytheus/internal/common/metric"
 )
 
 type StorageItem struct {
 	Value      metric.MetricValue
+	Labels     metric.Labels
 	MetricName string
 }
 
 // Storage is a interface for metrics store functionality.
 type Storage interface {
 	// SetGaugeMetric set gauge metric and return new value from storage or error.
-	SetGaugeMetric(metricName string, value metric.Gauge) (metric.Gauge, error)
+	SetGaugeMetric(metricName string, labels metric.Labels, value metric.Gauge) (metric.Gauge, error)
 	// GetGaugeMetric get gauge metric from storage or error.
-	GetGaugeMetric(metricName string) (metric.Gauge, error)
+	GetGaugeMetric(metricName string, labels metric.Labels) (metric.Gauge, error)
 	// SetCounterMetric set counter metric and return new value from storage or error.
-	SetCounterMetric(metricName string, value metric.Counter) (metric.Counter, error)
+	SetCounterMetric(metricName string, labels metric.Labels, value metric.Counter) (metric.Counter, error)
 	// GetCounterMetric get counter metric from storage or error.
-	GetCounterMetric(metricName string) (metric.Counter, error)
+	GetCounterMetric(metricName string, labels metric.Labels) (metric.Counter, error)
+	// SetHistogramMetric merge histogram metric and return new value from storage or error.
+	SetHistogramMetric(metricName string, labels metric.Labels, value metric.Histogram) (metric.Histogram, error)
+	// GetHistogramMetric get histogram metric from storage or error.
+	GetHistogramMetric(metricName string, labels metric.Labels) (metric.Histogram, error)
+	// SetSummaryMetric merge summary metric and return new value from storage or error.
+	SetSummaryMetric(metricName string, labels metric.Labels, value metric.Summary) (metric.Summary, error)
+	// GetSummaryMetric get summary metric from storage or error.
+	GetSummaryMetric(metricName string, labels metric.Labels) (metric.Summary, error)
 	// SetMetrics set list of metrics.
 	SetMetrics(metricList []StorageItem) error
 	// GetAllMetrics returns list of metrics from storage.
 	GetAllMetrics() ([]StorageItem, error)
+	// GetMetricRange returns metric samples with timestamp in [from, to] ordered by time or error.
+	GetMetricRange(metricType, metricName string, labels metric.Labels, from, to time.Time) ([]Sample, error)
 	// Ping tests storage availability.
 	Ping() bool
 	// Close storage connection.
 	Close()
 }
+
+// validateSeries checks metric name and labels, so that stored series can
+// not be confused with each other.
+func validateSeries(metricName string, labels metric.Labels) error {
+	if err := metric.ValidateName(metricName); err != nil {
+		return err
+	}
+	return labels.Validate()
+}
+
+func validateItems(metricList []StorageItem) error {
+	for _, metricItem := range metricList {
+		if err := validateSeries(metricItem.MetricName, metricItem.Labels); err != nil {
+			return fmt.Errorf("incorrect metric '%s': %w", metricItem.MetricName, err)
+		}
+	}
+	return nil
+}
+
+// mergeable is a metric value, which is merged with stored value on update.
+type mergeable[T any] interface {
+	metric.MetricValue
+	Merge(other T) (T, error)
+}
@@ -32,6 +32,72 @@ const docTemplate = `{
                 }
             }
         },
+        "/api/v1/write": {
+            "post": {
+                "consumes": [
+                    "application/x-protobuf"
+                ],
+                "summary": "Update metrics with Prometheus remote_write protocol",
+                "parameters": [
+                    {
+                        "description": "Snappy compressed protobuf WriteRequest",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Updated successfully"
+                    },
+                    "400": {
+                        "description": "Bad request"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "500": {
+                        "description": "Internal error"
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "produces": [
+                    "plain/text"
+                ],
+                "summary": "Check server health",
+                "responses": {
+                    "200": {
+                        "description": "Check successful"
+                    },
+                    "500": {
+                        "description": "Internal error"
+                    }
+                }
+            }
+        },
+        "/metrics": {
+            "get": {
+                "produces": [
+                    "plain/text",
+                    "application/openmetrics-text"
+                ],
+                "summary": "Get all metrics in Prometheus text or OpenMetrics format",
+                "responses": {
+                    "200": {
+                        "description": "Returns metrics, OpenMetrics if requested by Accept header"
+                    },
+                    "500": {
+                        "description": "Internal error"
+                    }
+                }
+            }
+        },
         "/ping": {
             "get": {
                 "produces": [
@@ -48,6 +114,84 @@ const docTemplate = `{
                 }
             }
         },
+        "/query_range": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Query metric history range",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Metric Name",
+                        "name": "name",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Metric Type (gauge|counter)",
+                        "name": "type",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Range start, RFC3339 or unix seconds",
+                        "name": "start",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Range end, RFC3339 or unix seconds",
+                        "name": "end",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Step, duration (15s) or seconds",
+                        "name": "step",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Step aggregation (avg|min|max|sum|last|rate), avg by default",
+                        "name": "agg",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Metric label in format name:value",
+                        "name": "label",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Returns aggregated points",
+                        "schema": {
+                            "$ref": "#/definitions/history.RangeDTO"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request"
+                    },
+                    "500": {
+                        "description": "Internal error"
+                    },
+                    "501": {
+                        "description": "Metric type not found or history disabled"
+                    }
+                }
+            }
+        },
         "/update": {
             "post": {
                 "consumes": [
@@ -114,6 +258,16 @@ const docTemplate = `{
                         "name": "metricValue",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Metric label in format name:value",
+                        "name": "label",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -177,6 +331,47 @@ const docTemplate = `{
                 }
             }
         },
+        "/v1/metrics": {
+            "post": {
+                "consumes": [
+                    "application/x-protobuf",
+                    "application/json"
+                ],
+                "produces": [
+                    "application/x-protobuf",
+                    "application/json"
+                ],
+                "summary": "Update metrics with OpenTelemetry OTLP/HTTP protocol",
+                "parameters": [
+                    {
+                        "description": "ExportMetricsServiceRequest",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "ExportMetricsServiceResponse"
+                    },
+                    "400": {
+                        "description": "Bad request"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "415": {
+                        "description": "Unsupported content type"
+                    },
+                    "500": {
+                        "description": "Internal error"
+                    }
+                }
+            }
+        },
         "/value/": {
             "post": {
                 "consumes": [
@@ -239,6 +434,22 @@ const docTemplate = `{
                         "name": "metricName",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Metric label in format name:value",
+                        "name": "label",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Quantile in [0, 1], for summary only",
+                        "name": "q",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -259,12 +470,144 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/write": {
+            "post": {
+                "consumes": [
+                    "text/plain"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Update metrics in InfluxDB line protocol",
+                "parameters": [
+                    {
+                        "description": "Metrics in line protocol, one per line",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Updated successfully"
+                    },
+                    "400": {
+                        "description": "Incorrect lines",
+                        "schema": {
+                            "$ref": "#/definitions/influx.WriteErrorDTO"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "500": {
+                        "description": "Internal error"
+                    }
+                }
+            }
         }
     },
     "definitions": {
+        "history.Point": {
+            "type": "object",
+            "properties": {
+                "ts": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "number"
+                }
+            }
+        },
+        "history.RangeDTO": {
+            "type": "object",
+            "properties": {
+                "agg": {
+                    "description": "step aggregation",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "metric name",
+                    "type": "string"
+                },
+                "labels": {
+                    "description": "metric labels",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "points": {
+                    "description": "aggregated points",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/history.Point"
+                    }
+                },
+                "step": {
+                    "description": "step duration",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "gauge|counter",
+                    "type": "string"
+                }
+            }
+        },
+        "influx.LineError": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "error description",
+                    "type": "string"
+                },
+                "line": {
+                    "description": "line number, starting from 1",
+                    "type": "integer"
+                }
+            }
+        },
+        "influx.WriteErrorDTO": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "error summary",
+                    "type": "string"
+                },
+                "lines": {
+                    "description": "incorrect lines",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/influx.LineError"
+                    }
+                }
+            }
+        },
         "metric.MetricsDTO": {
             "type": "object",
             "properties": {
+                "bounds": {
+                    "description": "bucket upper bounds if histogram",
+                    "type": "array",
+                    "items": {
+                        "type": "number"
+                    }
+                },
+                "buckets": {
+                    "description": "cumulative bucket counts if histogram",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "count": {
+                    "description": "count of observations if histogram or summary",
+                    "type": "integer"
+                },
                 "delta": {
                     "description": "metric value if counter",
                     "type": "integer"
@@ -277,8 +620,27 @@ const docTemplate = `{
                     "description": "metric name",
                     "type": "string"
                 },
+                "labels": {
+                    "description": "metric labels",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "sketch": {
+                    "description": "quantile sketch if summary",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/metric.Sketch"
+                        }
+                    ]
+                },
+                "sum": {
+                    "description": "sum of observations if histogram or summary",
+                    "type": "number"
+                },
                 "type": {
-                    "description": "metric type - gauge|counter",
+                    "description": "metric type - gauge|counter|histogram|summary",
                     "type": "string"
                 },
                 "value": {
@@ -286,6 +648,33 @@ const docTemplate = `{
                     "type": "number"
                 }
             }
+        },
+        "metric.Sketch": {
+            "type": "object",
+            "properties": {
+                "alpha": {
+                    "description": "relative accuracy",
+                    "type": "number"
+                },
+                "negative": {
+                    "description": "negative value bins",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "positive": {
+                    "description": "positive value bins",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "zero": {
+                    "description": "zero values count",
+                    "type": "integer"
+                }
+            }
         }
     }
 }`
@@ -53,3 +53,30 @@ var AllMetricsResponseWithData string = `
 		</body>
 	</html>
 	`
+
+var AllMetricsResponseWithHistogram string = `
+	<html>
+		<body>
+			<table border="1">
+				<tr>
+					<th>Metric Type</th>
+					<th>Metric Name</th>
+					<th>Metric Value</th>
+				</tr>
+				
+				<tr>
+					<td>counter</td>
+					<td>aaa</td>
+					<td>1</td>
+				</tr>
+				
+				<tr>
+					<td>histogram</td>
+					<td>latency</td>
+					<td>bounds=0.1,1;buckets=1,2;sum=1.5;count=3</td>
+				</tr>
+				
+			</table>
+		</body>
+	</html>
+	`